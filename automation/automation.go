@@ -0,0 +1,242 @@
+// Package automation evaluates users' rules against incoming readings,
+// queuing commands for their devices or webhook deliveries when rules
+// trigger.
+package automation
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"log"
+	"time"
+)
+
+// MaxReadingAge is how old readings may be when posted and still be
+// evaluated, so backfilling history doesn't run pumps.
+const MaxReadingAge = time.Hour
+
+// WebhookPayload is the data of the alert delivered to a rule's webhook
+// when it triggers.
+type WebhookPayload struct {
+	RuleID    int64          `json:"rule_id"`
+	Rule      string         `json:"rule"`
+	Reading   models.Reading `json:"reading"`
+	Triggered time.Time      `json:"triggered"`
+}
+
+// Deliverer queues signed, retried deliveries of events to URLs, such as a
+// webhooks.Publisher, returning the ID of the delivery queued.
+type Deliverer interface {
+	Deliver(userEmail, url, event, core string, data interface{}, now time.Time) (int64, error)
+}
+
+// Engine evaluates rules against readings and carries out the actions of
+// those that trigger.
+type Engine struct {
+	rules        models.RuleStore
+	commands     models.CommandStore
+	events       models.EventStore
+	plants       models.PlantStore
+	calibrations models.CalibrationStore
+	webhooks     Deliverer
+}
+
+// NewEngine returns a new *Engine queuing webhook deliveries with the given
+// Deliverer.
+func NewEngine(rs models.RuleStore, cs models.CommandStore, es models.EventStore, ps models.PlantStore,
+	c models.CalibrationStore, webhooks Deliverer) *Engine {
+	return &Engine{rules: rs, commands: cs, events: es, plants: ps, calibrations: c, webhooks: webhooks}
+}
+
+// Evaluate checks the user's enabled rules for the reading's core against
+// the calibrated reading, carrying out the action of each rule that
+// triggers, or only recording what it would do for dry run rules.  Each
+// rule's firing is claimed first, so concurrent readings fire it once
+// within its cooldown; failed executions release the claim.  The
+// executions recorded are returned.
+func (e *Engine) Evaluate(reading models.Reading, now time.Time) ([]models.Execution, error) {
+	rules, err := e.rules.GetCoreRules(reading.UserEmail, reading.CoreID)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	calibrations, err := e.calibrations.GetCalibrations(reading.UserEmail)
+	if err != nil {
+		return nil, err
+	}
+	calibrated := calibrations.Apply(reading)
+
+	var executions []models.Execution
+	for _, rule := range rules {
+		if !rule.Matches(calibrated) || !rule.ScheduledAt(now) || rule.CoolingDownAt(now) {
+			continue
+		}
+
+		quiet, err := e.quiet(rule, now)
+		if err != nil {
+			return executions, err
+		}
+
+		if quiet {
+			continue
+		}
+
+		claimed, err := e.rules.ClaimFiring(rule.UserEmail, rule.ID, now)
+		if err != nil {
+			return executions, err
+		}
+
+		if !claimed {
+			continue
+		}
+
+		execution := e.execute(rule, calibrated, now)
+		if err := e.rules.StoreExecution(execution); err != nil {
+			return executions, err
+		}
+
+		executions = append(executions, execution)
+	}
+
+	return executions, nil
+}
+
+// quiet returns true if an event in one of the rule's quiet periods was
+// logged for its core, directly or through the plant it monitors.
+func (e *Engine) quiet(rule models.Rule, now time.Time) (bool, error) {
+	var longest time.Duration
+	for _, q := range rule.Quiet {
+		if q.Period > longest {
+			longest = q.Period
+		}
+	}
+
+	if longest == 0 {
+		return false, nil
+	}
+
+	events, err := e.events.GetEvents(rule.UserEmail, now.Add(-longest), now)
+	if err != nil {
+		return false, err
+	}
+
+	plantAssignments := make(map[int64][]models.Assignment)
+	for _, event := range events {
+		if _, ok := plantAssignments[event.PlantID]; !ok && event.CoreID == "" {
+			if plantAssignments[event.PlantID], err = e.plants.GetAssignments(rule.UserEmail, event.PlantID); err != nil {
+				return false, err
+			}
+		}
+
+		concerned := false
+		for _, core := range event.Cores(plantAssignments[event.PlantID]) {
+			concerned = concerned || core == rule.CoreID
+		}
+
+		if !concerned {
+			continue
+		}
+
+		for _, q := range rule.Quiet {
+			if event.Kind == q.Kind && now.Sub(event.Posted) <= q.Period {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// execute carries out the rule's action, describing the outcome as an
+// execution.  Webhooks are queued for delivery rather than posted, so
+// failed posts are retried and logged with the user's other deliveries.
+func (e *Engine) execute(rule models.Rule, reading models.Reading, now time.Time) models.Execution {
+	execution := models.Execution{
+		RuleID:    rule.ID,
+		UserEmail: rule.UserEmail,
+		CoreID:    rule.CoreID,
+		Triggered: now,
+		Reading:   reading.Posted,
+		Result:    models.ExecutionFired,
+	}
+
+	action := rule.Action
+	if rule.DryRun {
+		execution.Result = models.ExecutionDryRun
+		switch action.Kind {
+		case models.ActionCommand:
+			execution.Detail = fmt.Sprintf("would send %s %s", action.Command, action.Argument)
+		case models.ActionWebhook:
+			execution.Detail = "would post to " + action.URL
+		}
+		return execution
+	}
+
+	fail := func(err error) models.Execution {
+		execution.Result, execution.Detail = models.ExecutionFailed, err.Error()
+		return execution
+	}
+
+	switch action.Kind {
+	case models.ActionCommand:
+		command := models.NewCommand(rule.UserEmail, rule.CoreID, action.Command, action.Argument, action.TTL, now)
+		id, err := e.commands.StoreCommand(command)
+		if err != nil {
+			return fail(err)
+		}
+		execution.CommandID = id
+
+		if action.LogEvent != "" {
+			_, err := e.events.StoreEvent(models.Event{
+				UserEmail: rule.UserEmail,
+				Kind:      action.LogEvent,
+				Source:    models.EventAutomated,
+				CoreID:    rule.CoreID,
+				Posted:    now,
+				Notes:     "rule " + rule.Name,
+			})
+			if err != nil {
+				log.Printf("Error logging %s event for rule %d: %s", action.LogEvent, rule.ID, err)
+			}
+		}
+	case models.ActionWebhook:
+		payload := WebhookPayload{RuleID: rule.ID, Rule: rule.Name, Reading: reading, Triggered: now}
+		id, err := e.webhooks.Deliver(rule.UserEmail, action.URL, models.WebhookAlert, rule.CoreID, payload, now)
+		if err != nil {
+			return fail(err)
+		}
+		execution.Detail = fmt.Sprintf("queued delivery %d", id)
+	}
+
+	return execution
+}
+
+// ReadingStore wraps a models.ReadingStore, evaluating rules against each
+// reading stored that was posted recently.
+type ReadingStore struct {
+	models.ReadingStore
+	engine *Engine
+}
+
+// NewReadingStore returns a new *ReadingStore
+func NewReadingStore(rs models.ReadingStore, engine *Engine) *ReadingStore {
+	return &ReadingStore{ReadingStore: rs, engine: engine}
+}
+
+// StoreReading stores the reading then evaluates rules against it.  Failing
+// to evaluate rules is logged rather than failing to store the reading.
+func (s *ReadingStore) StoreReading(reading models.Reading) error {
+	if err := s.ReadingStore.StoreReading(reading); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.Sub(reading.Posted) > MaxReadingAge {
+		return nil
+	}
+
+	if _, err := s.engine.Evaluate(reading, now); err != nil {
+		log.Printf("Error evaluating rules for core %s: %s", reading.CoreID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package automation
+
+import (
+	"errors"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+const userEmail = "johndoe@stupidname.com"
+
+// deliverer records the webhook payloads delivered, failing once full.
+type deliverer struct {
+	urls     []string
+	payloads []WebhookPayload
+	limit    int
+}
+
+func (d *deliverer) Deliver(userEmail, url, event, core string, data interface{}, now time.Time) (int64, error) {
+	if len(d.payloads) >= d.limit {
+		return 0, errors.New("deliveries full")
+	}
+
+	d.urls = append(d.urls, url)
+	d.payloads = append(d.payloads, data.(WebhookPayload))
+	return int64(len(d.payloads)), nil
+}
+
+func waterRule() models.Rule {
+	return models.Rule{
+		UserEmail:  userEmail,
+		Name:       "water when dry",
+		CoreID:     "core",
+		Conditions: []models.Condition{{Metric: "moisture", Compare: models.Below, Value: 30}},
+		Quiet:      []models.QuietPeriod{{Kind: models.EventWatering, Period: time.Hour * 6}},
+		Action:     models.RuleAction{Kind: models.ActionCommand, Command: "water", Argument: "20s", LogEvent: models.EventWatering},
+		Cooldown:   time.Minute * 30,
+		Enabled:    true,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rs := &fake.RuleStore{}
+	cs := &fake.CommandStore{}
+	es := &fake.EventStore{}
+
+	ruleID, err := rs.StoreRule(waterRule())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(rs, cs, es, &fake.PlantStore{}, &fake.CalibrationStore{}, &deliverer{})
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	dry := models.Reading{UserEmail: userEmail, CoreID: "core", Posted: now, Moisture: 25}
+
+	executions, err := engine.Evaluate(models.Reading{UserEmail: userEmail, CoreID: "core", Posted: now, Moisture: 45}, now)
+	if err != nil || len(executions) != 0 {
+		t.Fatalf("Expected no executions for moist soil, got %v (%v)", executions, err)
+	}
+
+	executions, err = engine.Evaluate(dry, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executions) != 1 || executions[0].Result != models.ExecutionFired || executions[0].CommandID == 0 {
+		t.Fatalf("Expected rule to fire, got %v", executions)
+	}
+
+	commands, _ := cs.GetCommands(userEmail, "core")
+	if len(commands) != 1 || commands[0].Name != "water" || commands[0].Argument != "20s" {
+		t.Fatalf("Expected water command queued, got %v", commands)
+	}
+
+	events, _ := es.GetEvents(userEmail, now, now)
+	if len(events) != 1 || events[0].Kind != models.EventWatering || events[0].Source != models.EventAutomated {
+		t.Fatalf("Expected automated watering logged, got %v", events)
+	}
+
+	// still dry after the cooldown, but watered within the quiet period
+	for _, at := range []time.Time{now.Add(time.Minute * 10), now.Add(time.Hour)} {
+		if executions, err := engine.Evaluate(dry, at); err != nil || len(executions) != 0 {
+			t.Fatalf("Expected no executions at %s, got %v (%v)", at, executions, err)
+		}
+	}
+
+	if executions, _ := engine.Evaluate(dry, now.Add(time.Hour*7)); len(executions) != 1 {
+		t.Fatalf("Expected rule to fire after the quiet period, got %v", executions)
+	}
+
+	history, err := rs.GetExecutions(userEmail, ruleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || !history[0].Triggered.Equal(now.Add(time.Hour*7)) {
+		t.Fatalf("Expected 2 executions, most recent first, got %v", history)
+	}
+}
+
+func TestEvaluatePlantQuiet(t *testing.T) {
+	rs := &fake.RuleStore{}
+	es := &fake.EventStore{}
+	ps := &fake.PlantStore{}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	plant, err := ps.StorePlant(models.Plant{UserEmail: userEmail, Name: "basil"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ps.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: plant, CoreID: "core", Start: now.AddDate(0, 0, -1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// watered by hand, logged against the plant
+	if _, err := es.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventWatering, Source: models.EventManual, PlantID: plant, Posted: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rs.StoreRule(waterRule()); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(rs, &fake.CommandStore{}, es, ps, &fake.CalibrationStore{}, &deliverer{})
+
+	executions, err := engine.Evaluate(models.Reading{UserEmail: userEmail, CoreID: "core", Posted: now, Moisture: 25}, now)
+	if err != nil || len(executions) != 0 {
+		t.Fatalf("Expected plant watering to quiet rule, got %v (%v)", executions, err)
+	}
+}
+
+func TestEvaluateDryRunAndWebhooks(t *testing.T) {
+	rs := &fake.RuleStore{}
+	cs := &fake.CommandStore{}
+
+	dryRun := waterRule()
+	dryRun.DryRun = true
+	if _, err := rs.StoreRule(dryRun); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := waterRule()
+	hook.Action = models.RuleAction{Kind: models.ActionWebhook, URL: "https://example.com/hook"}
+	if _, err := rs.StoreRule(hook); err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks := &deliverer{limit: 1}
+	engine := NewEngine(rs, cs, &fake.EventStore{}, &fake.PlantStore{}, &fake.CalibrationStore{}, webhooks)
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	dry := models.Reading{UserEmail: userEmail, CoreID: "core", Posted: now, Moisture: 25}
+
+	executions, err := engine.Evaluate(dry, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executions) != 2 || executions[0].Result != models.ExecutionDryRun || executions[1].Result != models.ExecutionFired {
+		t.Fatalf("Expected dry run and fired executions, got %v", executions)
+	}
+
+	if commands, _ := cs.GetCommands(userEmail, "core"); len(commands) != 0 {
+		t.Fatalf("Expected dry run not to queue commands, got %v", commands)
+	}
+
+	if len(webhooks.payloads) != 1 || webhooks.urls[0] != hook.Action.URL || webhooks.payloads[0].Rule != hook.Name ||
+		webhooks.payloads[0].Reading.Moisture != 25 || executions[1].Detail != "queued delivery 1" {
+		t.Fatalf("Expected webhook delivery queued, got %v (%v)", webhooks.payloads, executions)
+	}
+
+	// failing to queue the delivery is recorded as a failed execution
+	executions, _ = engine.Evaluate(dry, now.Add(time.Hour))
+	if len(executions) != 2 || executions[1].Result != models.ExecutionFailed || executions[1].Detail != "deliveries full" {
+		t.Fatalf("Expected failed webhook execution, got %v", executions)
+	}
+
+	// failed executions release their claim, so don't start a cooldown
+	rules, _ := rs.GetCoreRules(userEmail, "core")
+	if len(rules) != 2 || !rules[0].LastFired.Equal(now.Add(time.Hour)) || !rules[1].LastFired.Equal(now) {
+		t.Fatalf("Expected only the dry run to cool down again, got %v", rules)
+	}
+}
+
+func TestEvaluateClaimsFiring(t *testing.T) {
+	rs := &fake.RuleStore{}
+	cs := &fake.CommandStore{}
+
+	if _, err := rs.StoreRule(waterRule()); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(rs, cs, &fake.EventStore{}, &fake.PlantStore{}, &fake.CalibrationStore{}, &deliverer{})
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	dry := models.Reading{UserEmail: userEmail, CoreID: "core", Posted: now, Moisture: 25}
+
+	// readings evaluated concurrently fire the rule once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := engine.Evaluate(dry, now); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if commands, _ := cs.GetCommands(userEmail, "core"); len(commands) != 1 {
+		t.Fatalf("Expected one command queued, got %v", commands)
+	}
+}
+
+func TestStoreReadingEvaluatesRecentReadings(t *testing.T) {
+	rs := &fake.RuleStore{}
+	cs := &fake.CommandStore{}
+
+	if _, err := rs.StoreRule(waterRule()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewReadingStore(&fake.ReadingStore{}, NewEngine(rs, cs, &fake.EventStore{}, &fake.PlantStore{}, &fake.CalibrationStore{}, &deliverer{}))
+
+	// backfilled readings don't trigger rules
+	old := models.Reading{UserEmail: userEmail, CoreID: "core", Posted: time.Now().Add(-MaxReadingAge * 2), Moisture: 25}
+	if err := s.StoreReading(old); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands, _ := cs.GetCommands(userEmail, "core"); len(commands) != 0 {
+		t.Fatalf("Expected no commands for an old reading, got %v", commands)
+	}
+
+	recent := models.Reading{UserEmail: userEmail, CoreID: "core", Posted: time.Now().Add(-time.Minute), Moisture: 25}
+	if err := s.StoreReading(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands, _ := cs.GetCommands(userEmail, "core"); len(commands) != 1 {
+		t.Fatalf("Expected a command for a recent reading, got %v", commands)
+	}
+}
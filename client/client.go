@@ -17,6 +17,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -84,12 +85,13 @@ type DeviceSignator struct {
 	Token     string
 }
 
-// Sign (incomplete) signs a request by applying the headers indicating which
-// device signed the request for which user and providing a token signed with
-// that user's secret.
+// Sign signs a request by applying the headers indicating which device
+// signed the request for which user and providing a token signed with that
+// user's secret.  The request's form must also give the device's coreid.
 func (s *DeviceSignator) Sign(r *http.Request) {
 	r.Header.Add(middleware.AuthTypeHeader, middleware.DeviceAuthTypeValue)
 	r.Header.Add(middleware.AuthUserHeader, s.UserEmail)
+	r.Header.Add(middleware.TokenHeader, s.Token)
 }
 
 func responseError(resp *http.Response) error {
@@ -125,46 +127,183 @@ func GetLatest(s Signator, domain string) ([]models.Reading, error) {
 	return readings, nil
 }
 
-// GetReadings gets all the readings stored in a specified time frame for a user.
+// GetReadings gets all the readings stored in a specified time frame for a
+// user, walking each page of them.
 func GetReadings(s Signator, domain, coreid string, start, end time.Time) ([]models.Reading, error) {
 	var readings []models.Reading
 
+	it := IterateReadings(s, domain, coreid, start, end, 0)
+	for it.Next() {
+		readings = append(readings, it.Reading())
+	}
+
+	return readings, it.Err()
+}
+
+// ReadingIterator walks the readings stored in a time frame for a core, in
+// the order they were posted, requesting a page of them at a time.
+type ReadingIterator struct {
+	s      Signator
+	domain string
+	query  url.Values
+	page   []models.Reading
+	i      int
+	cursor string
+	done   bool
+	err    error
+}
+
+// IterateReadings returns a ReadingIterator over the readings stored in a
+// specified time frame for a core, requesting limit readings at a time; a
+// zero limit lets the server decide.
+func IterateReadings(s Signator, domain, coreid string, start, end time.Time, limit int) *ReadingIterator {
 	query := url.Values{}
 	query.Add("start", start.Format(time.RFC3339))
 	query.Add("end", end.Format(time.RFC3339))
 	query.Add("core", coreid)
-	reqURL := domain + "/api/readings?" + query.Encode()
+	if limit > 0 {
+		query.Add("limit", strconv.Itoa(limit))
+	}
 
-	req, err := http.NewRequest("GET", reqURL, nil)
+	return &ReadingIterator{s: s, domain: domain, query: query}
+}
+
+// Next advances to the next reading, requesting the next page if needed.
+// It returns false when there are no more readings or a request failed.
+func (it *ReadingIterator) Next() bool {
+	for it.i >= len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+
+		it.page, it.i = nil, 0
+		it.err = it.fetch()
+	}
+
+	it.i++
+	return true
+}
+
+// Reading returns the reading Next advanced to.
+func (it *ReadingIterator) Reading() models.Reading {
+	return it.page[it.i-1]
+}
+
+// Err returns the error, if any, that stopped the iteration.
+func (it *ReadingIterator) Err() error {
+	return it.err
+}
+
+// fetch requests the page of readings following the cursor.
+func (it *ReadingIterator) fetch() error {
+	if it.cursor != "" {
+		it.query.Set("cursor", it.cursor)
+	}
+
+	req, err := http.NewRequest("GET", it.domain+"/api/readings?"+it.query.Encode(), nil)
 	if err != nil {
-		return readings, err
+		return err
 	}
 
-	s.Sign(req)
+	it.s.Sign(req)
 	resp, err := client.Do(req)
 	if err != nil {
-		return readings, err
+		return err
 	}
 	defer resp.Body.Close()
 
+	// not found is returned when there are no readings
+	if resp.StatusCode == http.StatusNotFound {
+		it.done = true
+		return nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return readings, responseError(resp)
+		return responseError(resp)
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&readings)
+	if err := json.NewDecoder(resp.Body).Decode(&it.page); err != nil {
+		return err
+	}
+
+	it.cursor = resp.Header.Get(models.NextCursorHeader)
+	it.done = it.cursor == ""
+	return nil
+}
+
+// GetReport gets a report of gaps and anomalies in a core's readings within
+// a specified time frame.  A zero cadence lets the server determine how
+// often readings are expected.
+func GetReport(s Signator, domain, coreid string, start, end time.Time, cadence time.Duration) (models.Report, error) {
+	var report models.Report
+
+	query := url.Values{}
+	query.Add("start", start.Format(time.RFC3339))
+	query.Add("end", end.Format(time.RFC3339))
+	query.Add("core", coreid)
+	if cadence > 0 {
+		query.Add("cadence", cadence.String())
+	}
+	reqURL := domain + "/api/report?" + query.Encode()
+
+	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
-		return readings, err
+		return report, err
 	}
 
-	return readings, nil
+	s.Sign(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return report, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return report, responseError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// Deletion is a deletion of readings, along with when its readings are
+// purged and can no longer be restored.
+type Deletion struct {
+	models.ReadingDeletion
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+// deletionCount is the count of readings a dry run would delete, or an undo
+// restored.
+type deletionCount struct {
+	Count int `json:"count"`
+}
+
+// DeleteReadings deletes all readings within a specified time frame,
+// returning the deletion, which UndoDeleteReadings reverses until its
+// readings are purged.
+func DeleteReadings(s Signator, domain, coreid string, start, end time.Time) (Deletion, error) {
+	var deletion Deletion
+	err := deleteReadings(s, domain, coreid, start, end, false, &deletion)
+	return deletion, err
 }
 
-// DeleteReadings deletes all readings within a specified time frame.
-func DeleteReadings(s Signator, domain, coreid string, start, end time.Time) error {
+// DeleteReadingsDryRun returns the number of readings DeleteReadings would
+// delete, without deleting them.
+func DeleteReadingsDryRun(s Signator, domain, coreid string, start, end time.Time) (int, error) {
+	var count deletionCount
+	err := deleteReadings(s, domain, coreid, start, end, true, &count)
+	return count.Count, err
+}
+
+func deleteReadings(s Signator, domain, coreid string, start, end time.Time, dryRun bool, response interface{}) error {
 	query := url.Values{}
 	query.Add("start", start.Format(time.RFC3339))
 	query.Add("end", end.Format(time.RFC3339))
 	query.Add("core", coreid)
+	if dryRun {
+		query.Add("dry_run", "true")
+	}
 	reqURL := domain + "/api/delete_readings?" + query.Encode()
 
 	req, err := http.NewRequest("DELETE", reqURL, nil)
@@ -179,11 +318,32 @@ func DeleteReadings(s Signator, domain, coreid string, start, end time.Time) err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
+	if resp.StatusCode != http.StatusOK {
 		return responseError(resp)
 	}
 
-	return nil
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// UndoDeleteReadings restores the readings of the deletion with the given
+// ID, returning the number restored.
+func UndoDeleteReadings(s Signator, domain string, id int64) (int, error) {
+	form := url.Values{}
+	form.Set("id", strconv.FormatInt(id, 10))
+
+	resp, err := postForm(s, domain+"/api/undo_delete_readings", form)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp)
+	}
+
+	var restored deletionCount
+	err = json.NewDecoder(resp.Body).Decode(&restored)
+	return restored.Count, err
 }
 
 // PostReading posts a new reading
@@ -211,15 +371,139 @@ func PostReading(s Signator, domain string, reading models.Reading) error {
 	}
 	defer resp.Body.Close()
 
+	// 200 is returned when an identical reading was already stored
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// SendCommand queues a command for a core, such as "water" with the
+// argument "30s".  A zero ttl lets the server decide how long the command
+// waits to be delivered and acked.
+func SendCommand(s Signator, domain, coreid, name, argument string, ttl time.Duration) (models.Command, error) {
+	var command models.Command
+
+	query := url.Values{}
+	query.Add("name", name)
+	query.Add("argument", argument)
+	if ttl > 0 {
+		query.Add("ttl", ttl.String())
+	}
+	reqURL := domain + "/api/devices/" + url.QueryEscape(coreid) + "/commands?" + query.Encode()
+
+	req, err := http.NewRequest("POST", reqURL, nil)
+	if err != nil {
+		return command, err
+	}
+
+	s.Sign(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return command, err
+	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusCreated {
+		return command, responseError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&command)
+	return command, err
+}
+
+// GetCommands gets the commands queued for a core and their states.
+func GetCommands(s Signator, domain, coreid string) ([]models.Command, error) {
+	var commands []models.Command
+
+	req, err := http.NewRequest("GET", domain+"/api/devices/"+url.QueryEscape(coreid)+"/commands", nil)
+	if err != nil {
+		return commands, err
+	}
+
+	s.Sign(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return commands, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return commands, responseError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&commands)
+	return commands, err
+}
+
+// PollCommands gets the commands pending for a core, as the core would;
+// commands are only returned by one poll.
+func PollCommands(s Signator, domain, coreid string) ([]models.Command, error) {
+	var commands []models.Command
+
+	form := url.Values{}
+	form.Set("coreid", coreid)
+
+	resp, err := postForm(s, domain+"/api/commands", form)
+	if err != nil {
+		return commands, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return commands, responseError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&commands)
+	return commands, err
+}
+
+// AckCommand acknowledges, as the core would, that a delivered command was
+// carried out with the given result.
+func AckCommand(s Signator, domain, coreid string, id int64, result string) error {
+	form := url.Values{}
+	form.Set("coreid", coreid)
+	form.Set("id", strconv.FormatInt(id, 10))
+	form.Set("result", result)
+
+	resp, err := postForm(s, domain+"/api/commands/ack", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
 		return responseError(resp)
 	}
 
 	return nil
 }
 
+// postForm signs and posts a form, as devices do.
+func postForm(s Signator, reqURL string, form url.Values) (*http.Response, error) {
+	formStr := form.Encode()
+	req, err := http.NewRequest("POST", reqURL, strings.NewReader(formStr))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ContentLength = int64(len(formStr))
+	s.Sign(req)
+
+	return client.Do(req)
+}
+
 // PostReadings posts a list of readings
 func PostReadings(s Signator, domain string, readings []models.Reading) (string, error) {
+	return PostReadingsIdempotent(s, domain, "", readings)
+}
+
+// PostReadingsIdempotent posts a list of readings with the given idempotency
+// key; retrying with the same key returns the ID of the originally queued job
+// rather than queuing the readings again.
+func PostReadingsIdempotent(s Signator, domain, key string, readings []models.Reading) (string, error) {
 	reqBody := new(bytes.Buffer)
 	err := json.NewEncoder(reqBody).Encode(&readings)
 	if err != nil {
@@ -232,6 +516,9 @@ func PostReadings(s Signator, domain string, readings []models.Reading) (string,
 	}
 
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if key != "" {
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+	}
 	s.Sign(req)
 
 	resp, err := client.Do(req)
@@ -310,7 +597,112 @@ func RotateSecret(s Signator, domain string) (models.Secret, error) {
 	return models.Secret(dest.Bytes()), nil
 }
 
-func GetJobStatus(s Signator, domain, jobID string) (*bifrost.JobStatus, error) {
+// ExportAccount queues a job exporting all of the user's data, with their
+// readings in the given format, csv or json, returning the job's ID.
+func ExportAccount(s Signator, domain, format string) (string, error) {
+	form := url.Values{}
+	form.Set("format", format)
+
+	resp, err := postForm(s, domain+"/api/account/export", form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return "", responseError(resp)
+	}
+
+	jobIDBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(jobIDBytes), nil
+}
+
+// DownloadExport writes the zip archive of a completed export job to w,
+// returning models.ErrorExportNotReady if the job hasn't completed.
+func DownloadExport(s Signator, domain, jobID string, w io.Writer) error {
+	req, err := http.NewRequest("GET", domain+"/api/account/export?jobID="+url.QueryEscape(jobID), nil)
+	if err != nil {
+		return err
+	}
+
+	s.Sign(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		return models.ErrorExportNotReady
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DeleteAccount deletes the user's account and all their data, first
+// requesting the token confirming the deletion.
+func DeleteAccount(s Signator, domain string) error {
+	resp, err := deleteAccount(s, domain, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+
+	confirmation, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp, err = deleteAccount(s, domain, string(confirmation))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+func deleteAccount(s Signator, domain, confirm string) (*http.Response, error) {
+	query := url.Values{}
+	if confirm != "" {
+		query.Add("confirm", confirm)
+	}
+
+	req, err := http.NewRequest("DELETE", domain+"/api/account?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Sign(req)
+	return client.Do(req)
+}
+
+// JobStatus is the status of a job queued on the server, along with the
+// result it reported if complete.
+type JobStatus struct {
+	bifrost.JobStatus
+	Result json.RawMessage
+}
+
+// GetJobStatus gets the status of a job queued on the server.
+func GetJobStatus(s Signator, domain, jobID string) (*JobStatus, error) {
 	req, err := http.NewRequest("GET", domain+"/api/job?jobID="+jobID, nil)
 	if err != nil {
 		return nil, err
@@ -327,7 +719,7 @@ func GetJobStatus(s Signator, domain, jobID string) (*bifrost.JobStatus, error)
 		return nil, responseError(resp)
 	}
 
-	jobStatus := new(bifrost.JobStatus)
+	jobStatus := new(JobStatus)
 	err = json.NewDecoder(resp.Body).Decode(jobStatus)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/routes"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type nopSignator struct{}
+
+func (nopSignator) Sign(r *http.Request) {}
+
+func readingsServer(userEmail string, s *fake.ReadingStore) *httptest.Server {
+	withEmail := apollo.Constructor(func(next apollo.Handler) apollo.Handler {
+		return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(context.WithValue(ctx, "email", userEmail), w, r)
+		})
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/readings", apollo.New(withEmail).Then(
+		routes.GetReadings(s, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{})))
+
+	return httptest.NewServer(mux)
+}
+
+func TestIterateReadings(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	s := &fake.ReadingStore{}
+	for i := 0; i < 23; i++ {
+		if err := s.StoreReading(fake.RandReading(userEmail, coreid, start.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := readingsServer(userEmail, s)
+	defer server.Close()
+
+	it := IterateReadings(nopSignator{}, server.URL, coreid, start, start.Add(time.Hour), 5)
+
+	var count int
+	for it.Next() {
+		if expected := start.Add(time.Duration(count) * time.Minute); !it.Reading().Posted.Equal(expected) {
+			t.Fatalf("Reading %d out of order; posted %s expected %s", count, it.Reading().Posted, expected)
+		}
+		count++
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 23 {
+		t.Fatalf("Expected 23 readings, got %d", count)
+	}
+
+	readings, err := GetReadings(nopSignator{}, server.URL, coreid, start.Add(time.Hour), start.Add(time.Hour*2))
+	if err != nil {
+		t.Fatalf("Error getting readings of span without any: %s", err)
+	}
+
+	if len(readings) != 0 {
+		t.Fatalf("Expected no readings, got %v", readings)
+	}
+
+	if _, err := GetReadings(nopSignator{}, server.URL, "othercore", start, start.Add(time.Hour)); err == nil {
+		t.Fatal("Expected error getting readings of core not the user's")
+	}
+}
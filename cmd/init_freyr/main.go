@@ -16,6 +16,7 @@ var (
 	oauthID     = flag.String("oauthId", "", "Google Oauth Id")
 	oauthSecret = flag.String("oauthSecret", "", "Google Oauth Secret")
 	demoUser    = flag.String("demouser", "noone@nothing.com", "Demo user account email")
+	admins      = flag.String("admins", "noone@nothing.com", "Comma separated admin account emails")
 	dbUser      = flag.String("dbuser", "fakeuser", "Postgres database username")
 	dbPass      = flag.String("dbpass", "changeme", "Postgres database password")
 	force       = flag.Bool("force", false, "Overrite settings files if they exist")
@@ -28,6 +29,7 @@ type templateConfig struct {
 	OauthID     string
 	OauthSecret string
 	DemoUser    string
+	Admins      string
 	DbUser      string
 	DbPass      string
 	Secret      string
@@ -52,6 +54,7 @@ func main() {
 		OauthID:     *oauthID,
 		OauthSecret: *oauthSecret,
 		DemoUser:    *demoUser,
+		Admins:      *admins,
 		DbUser:      *dbUser,
 		DbPass:      *dbPass,
 		Secret:      secret.Encode(),
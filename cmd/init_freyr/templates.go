@@ -6,6 +6,7 @@ SURTR_USER={{.DemoUser}}
  `
 
 var freyrEnv = `FREYR_DEMOUSER={{.DemoUser}}
+FREYR_ADMINS={{.Admins}}
 FREYR_DBHOST=postgres
 FREYR_DBPASSW={{.DbPass}}
 FREYR_DBUSER={{.DbUser}}
@@ -45,12 +45,12 @@ func TestAcceptance(t *testing.T) {
 	// First test, test secret generation facilities
 	// generate a web token with the system secret just
 	// to get a secret for the user.
-	token, err := token.GenerateWebToken(token.JWTTokenGen(c.SecretKey), time.Now().Add(time.Hour), c.TestUser)
+	webToken, err := token.GenerateWebToken(token.JWTTokenGen(c.SecretKey), time.Now().Add(time.Hour), c.TestUser)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	webSignator := client.WebSignator{Token: token}
+	webSignator := client.WebSignator{Token: webToken}
 
 	userSecret, err := client.GetSecret(webSignator, c.Domain)
 	if err != nil {
@@ -171,7 +171,34 @@ func TestAcceptance(t *testing.T) {
 		}
 	}
 
-	err = client.DeleteReadings(apiSignator, c.Domain, coreId, startTime, postTime)
+	count, err := client.DeleteReadingsDryRun(apiSignator, c.Domain, coreId, startTime, postTime)
+	if err != nil {
+		t.Fatalf("Error counting readings to delete: %s", err.Error())
+	}
+
+	if count != len(sentReadings) {
+		t.Fatalf("Dry run would delete %d readings; expected %d", count, len(sentReadings))
+	}
+
+	deletion, err := client.DeleteReadings(apiSignator, c.Domain, coreId, startTime, postTime)
+	if err != nil {
+		t.Fatalf("Error deleting readings: %s", err.Error())
+	}
+
+	if deletion.Count != count {
+		t.Fatalf("Deleted %d readings; expected %d", deletion.Count, count)
+	}
+
+	restored, err := client.UndoDeleteReadings(apiSignator, c.Domain, deletion.ID)
+	if err != nil {
+		t.Fatalf("Error undoing deletion: %s", err.Error())
+	}
+
+	if restored != count {
+		t.Fatalf("Restored %d readings; expected %d", restored, count)
+	}
+
+	_, err = client.DeleteReadings(apiSignator, c.Domain, coreId, startTime, postTime)
 	if err != nil {
 		t.Fatalf("Error deleting readings: %s", err.Error())
 	}
@@ -202,4 +229,41 @@ func TestAcceptance(t *testing.T) {
 			t.Fatal("Reading was not added in post multiple call: %v", reading)
 		}
 	}
+
+	// Test Four: queue a command for a core, then poll for and ack it as the
+	// core would.
+	command, err := client.SendCommand(apiSignator, c.Domain, coreId, "water", "30s", time.Minute)
+	if err != nil {
+		t.Fatalf("Error queuing command: %s", err.Error())
+	}
+
+	deviceToken, err := token.GenerateDeviceToken(token.JWTTokenGen(newUserSecret), time.Now().Add(time.Hour), coreId, c.TestUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deviceSignator := &client.DeviceSignator{UserEmail: c.TestUser, Token: deviceToken}
+
+	delivered, err := client.PollCommands(deviceSignator, c.Domain, coreId)
+	if err != nil {
+		t.Fatalf("Error polling commands: %s", err.Error())
+	}
+
+	if len(delivered) != 1 || delivered[0].ID != command.ID {
+		t.Fatalf("Expected queued command delivered, got %v", delivered)
+	}
+
+	err = client.AckCommand(deviceSignator, c.Domain, coreId, command.ID, "watered")
+	if err != nil {
+		t.Fatalf("Error acking command: %s", err.Error())
+	}
+
+	commands, err := client.GetCommands(apiSignator, c.Domain, coreId)
+	if err != nil {
+		t.Fatalf("Error getting commands: %s", err.Error())
+	}
+
+	if len(commands) == 0 || commands[len(commands)-1].State != models.CommandAcked {
+		t.Fatalf("Expected command acked, got %v", commands)
+	}
 }
@@ -6,9 +6,11 @@ import (
 	"github.com/jwaldrip/odin/cli"
 	"github.com/serdmanczyk/freyr/client"
 	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/middleware"
 	"github.com/serdmanczyk/freyr/models"
 	"github.com/serdmanczyk/freyr/token"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -33,12 +35,46 @@ func main() {
 	})
 
 	delete := surtr.DefineSubCommand("delete", "deletecommands", func(c cli.Command) {
-		c.ErrPrintln("Define what you want to delete [readings]")
+		c.ErrPrintln("Define what you want to delete [readings, undo]")
 	})
 
+	report := surtr.DefineSubCommand("report", "report gaps and anomalies in a core's readings", getReport, "domain", "secret", "email", "coreid", "start", "end")
+	report.DefineStringFlag("cadence", "", "How often readings are expected, e.g. 15m; determined by the server if empty")
+	report.DefineBoolFlag("json", false, "Print the report as JSON")
+
+	command := surtr.DefineSubCommand("command", "queue and receive commands for cores", func(c cli.Command) {
+		c.ErrPrintln("Define what you want to do [send, list, poll, ack]")
+	})
+
+	send := command.DefineSubCommand("send", "queue a command for a core", sendCommand, "domain", "secret", "email", "coreid", "name")
+	send.DefineStringFlag("argument", "", "Argument to the command, e.g. 30s")
+	send.DefineStringFlag("ttl", "", "How long the command waits to be delivered and acked, e.g. 5m; determined by the server if empty")
+	send.AliasFlag('a', "argument")
+
+	command.DefineSubCommand("list", "list commands queued for a core", listCommands, "domain", "secret", "email", "coreid")
+	command.DefineSubCommand("poll", "receive pending commands as the core", pollCommands, "domain", "secret", "email", "coreid")
+
+	ack := command.DefineSubCommand("ack", "acknowledge a delivered command as the core", ackCommand, "domain", "secret", "email", "coreid", "id")
+	ack.DefineStringFlag("result", "", "Outcome of carrying out the command")
+
+	account := surtr.DefineSubCommand("account", "export or delete your account", func(c cli.Command) {
+		c.ErrPrintln("Define what you want to do [export, delete]")
+	})
+
+	export := account.DefineSubCommand("export", "export all your data to a zip archive", exportAccount, "domain", "secret", "email", "filepath")
+	export.DefineStringFlag("format", "csv", "Format of exported readings, csv or json")
+	export.DefineStringFlag("timeout", time.Minute.String(), "Time to wait for the export to complete")
+
+	da := account.DefineSubCommand("delete", "delete your account and all your data", deleteAccount, "domain", "secret", "email")
+	da.DefineStringFlag("confirm", "", "Your email, confirming the account is to be deleted")
+
 	surtr.DefineSubCommand("rotatesecret", "rotate user secret", rotateSecret, "domain", "secret", "email")
+	surtr.DefineSubCommand("apikey", "print the API key for basic auth, e.g. by Prometheus", printAPIKey, "secret")
+
+	dr := delete.DefineSubCommand("readings", "delete readings", deleteBetween, "domain", "secret", "email", "coreid", "start", "end")
+	dr.DefineBoolFlag("dry-run", false, "Print the number of readings that would be deleted without deleting them")
 
-	delete.DefineSubCommand("readings", "delete readings", deleteBetween, "domain", "secret", "email", "coreid", "start", "end")
+	delete.DefineSubCommand("undo", "restore the readings of a deletion before they're purged", undoDelete, "domain", "secret", "email", "id")
 
 	webToken := token.DefineSubCommand("web", "generate web token", genWebToken, "email", "secret")
 	webToken.DefineStringFlag("exp", defaultExp, "expiration date of token")
@@ -69,6 +105,7 @@ func main() {
 
 	prs := post.DefineSubCommand("readings", "post a reading", postReadings, "domain", "secret", "email", "filepath")
 	prs.DefineStringFlag("timeout", time.Minute.String(), "Time to wait for job to complete")
+	prs.DefineStringFlag("key", "", "Idempotency key, retries with the same key won't store readings twice")
 
 	surtr.Start()
 }
@@ -156,6 +193,65 @@ func getBetween(c cli.Command) {
 	}
 }
 
+func getReport(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	coreid := c.Param("coreid").String()
+	start := c.Param("start").String()
+	end := c.Param("end").String()
+	cadenceStr := c.Flag("cadence").String()
+	asJSON := c.Flag("json").Get().(bool)
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		panic(err)
+	}
+
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		panic(err)
+	}
+
+	var cadence time.Duration
+	if cadenceStr != "" {
+		cadence, err = time.ParseDuration(cadenceStr)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	report, err := client.GetReport(signator, domain, coreid, startTime, endTime, cadence)
+	if err != nil {
+		panic(err)
+	}
+
+	if asJSON {
+		err = json.NewEncoder(os.Stdout).Encode(report)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	c.Printf("%s: %d readings, expected every %s, %d findings\n", report.CoreID, report.Readings, report.Cadence, len(report.Findings))
+	for _, f := range report.Findings {
+		switch f.Kind {
+		case models.FindingGap:
+			c.Printf("%s\t%s\t%s to %s, %d readings missing\n", f.Kind, "-", f.Start.Format(time.RFC3339), f.End.Format(time.RFC3339), f.Missing)
+		case models.FindingSpike:
+			c.Printf("%s\t%s\t%s, %.2f (score %.1f)\n", f.Kind, f.Metric, f.Start.Format(time.RFC3339), f.Value, f.Score)
+		default:
+			c.Printf("%s\t%s\t%s to %s at %.2f\n", f.Kind, f.Metric, f.Start.Format(time.RFC3339), f.End.Format(time.RFC3339), f.Value)
+		}
+	}
+}
+
 func deleteBetween(c cli.Command) {
 	domain := c.Param("domain").String()
 	secret := c.Param("secret").String()
@@ -179,10 +275,107 @@ func deleteBetween(c cli.Command) {
 		panic(err)
 	}
 
-	err = client.DeleteReadings(signator, domain, coreid, startTime, endTime)
+	if c.Flag("dry-run").Get().(bool) {
+		count, err := client.DeleteReadingsDryRun(signator, domain, coreid, startTime, endTime)
+		if err != nil {
+			panic(err)
+		}
+
+		c.Printf("%d readings would be deleted\n", count)
+		return
+	}
+
+	deletion, err := client.DeleteReadings(signator, domain, coreid, startTime, endTime)
+	if err != nil {
+		panic(err)
+	}
+
+	c.Printf("Deleted %d readings; undo with deletion %d before %s\n",
+		deletion.Count, deletion.ID, deletion.PurgeAfter.Format(time.RFC3339))
+}
+
+func undoDelete(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+
+	id, err := strconv.ParseInt(c.Param("id").String(), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	restored, err := client.UndoDeleteReadings(signator, domain, id)
 	if err != nil {
 		panic(err)
 	}
+
+	c.Printf("Restored %d readings\n", restored)
+}
+
+func exportAccount(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	filepath := c.Param("filepath").String()
+
+	timeout, err := time.ParseDuration(c.Flag("timeout").String())
+	if err != nil {
+		panic(err)
+	}
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	jobID, err := client.ExportAccount(signator, domain, c.Flag("format").String())
+	if err != nil {
+		panic(err)
+	}
+
+	err = client.WaitForJob(signator, domain, jobID, timeout)
+	if err != nil {
+		panic(err)
+	}
+
+	archive, err := os.Create(filepath)
+	if err != nil {
+		panic(err)
+	}
+	defer archive.Close()
+
+	err = client.DownloadExport(signator, domain, jobID, archive)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func deleteAccount(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	if c.Flag("confirm").String() != email {
+		c.ErrPrintln("--confirm must be your email to delete your account")
+		return
+	}
+
+	err = client.DeleteAccount(signator, domain)
+	if err != nil {
+		panic(err)
+	}
+
+	c.Printf("Deleted account %s\n", email)
 }
 
 func getLatest(c cli.Command) {
@@ -280,12 +473,22 @@ func rotateSecret(c cli.Command) {
 	c.Println(newsecret.Encode())
 }
 
+func printAPIKey(c cli.Command) {
+	secret, err := models.SecretFromBase64(c.Param("secret").String())
+	if err != nil {
+		panic(err)
+	}
+
+	c.Println(middleware.APIKey(secret))
+}
+
 func postReadings(c cli.Command) {
 	domain := c.Param("domain").String()
 	email := c.Param("email").String()
 	secret := c.Param("secret").String()
 	filepath := c.Param("filepath").String()
 	timeoutStr := c.Flag("timeout").String()
+	key := c.Flag("key").String()
 
 	timeout, err := time.ParseDuration(timeoutStr)
 	if err != nil {
@@ -307,7 +510,7 @@ func postReadings(c cli.Command) {
 	if err != nil {
 		panic(err)
 	}
-	jobID, err := client.PostReadings(signator, domain, readings)
+	jobID, err := client.PostReadingsIdempotent(signator, domain, key, readings)
 	if err != nil {
 		panic(err)
 	}
@@ -316,4 +519,117 @@ func postReadings(c cli.Command) {
 	if err != nil {
 		panic(err)
 	}
+
+	status, err := client.GetJobStatus(signator, domain, jobID)
+	if err != nil {
+		panic(err)
+	}
+
+	c.Println(string(status.Result))
+}
+
+func sendCommand(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	coreid := c.Param("coreid").String()
+	name := c.Param("name").String()
+	argument := c.Flag("argument").String()
+	ttlStr := c.Flag("ttl").String()
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	var ttl time.Duration
+	if ttlStr != "" {
+		ttl, err = time.ParseDuration(ttlStr)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	command, err := client.SendCommand(signator, domain, coreid, name, argument, ttl)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(command)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func listCommands(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	coreid := c.Param("coreid").String()
+
+	signator, err := client.NewAPISignator(email, secret)
+	if err != nil {
+		panic(err)
+	}
+
+	commands, err := client.GetCommands(signator, domain, coreid)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(commands)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// deviceSignator signs requests as the core would, with a device token
+// generated from the user's secret.
+func deviceSignator(email, base64secret, coreid string) *client.DeviceSignator {
+	parsedSecret, err := models.SecretFromBase64(base64secret)
+	if err != nil {
+		panic(err)
+	}
+
+	deviceToken, err := token.GenerateDeviceToken(token.JWTTokenGen(parsedSecret), time.Now().Add(time.Hour), coreid, email)
+	if err != nil {
+		panic(err)
+	}
+
+	return &client.DeviceSignator{UserEmail: email, Token: deviceToken}
+}
+
+func pollCommands(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	coreid := c.Param("coreid").String()
+
+	commands, err := client.PollCommands(deviceSignator(email, secret, coreid), domain, coreid)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(commands)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ackCommand(c cli.Command) {
+	domain := c.Param("domain").String()
+	secret := c.Param("secret").String()
+	email := c.Param("email").String()
+	coreid := c.Param("coreid").String()
+	result := c.Flag("result").String()
+
+	id, err := strconv.ParseInt(c.Param("id").String(), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+
+	err = client.AckCommand(deviceSignator(email, secret, coreid), domain, coreid, id, result)
+	if err != nil {
+		panic(err)
+	}
 }
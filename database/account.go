@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/serdmanczyk/freyr/models"
+)
+
+// DeleteAccount deletes the user's data from every table holding it, then
+// the user along with their secret, in one transaction.
+func (db DB) DeleteAccount(userEmail string) error {
+	t, err := db.begin()
+	if err != nil {
+		return err
+	}
+
+	var email string
+	err = t.queryRow("select email from users where email = $1", userEmail).Scan(&email)
+	if err == sql.ErrNoRows {
+		t.Rollback()
+		return models.ErrorUserDoesntExist
+	}
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	for _, table := range db.dialect.userTables {
+		if _, err := t.exec("delete from "+table+" where useremail = $1", userEmail); err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	if _, err := t.exec("delete from users where email = $1", userEmail); err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return t.Commit()
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/models"
+)
+
+// calibrationParams are the kind specific parameters of a calibration, stored
+// as JSON in a single column.
+type calibrationParams struct {
+	Offset       float64                   `json:"offset,omitempty"`
+	Scale        float64                   `json:"scale,omitempty"`
+	Coefficients []float64                 `json:"coefficients,omitempty"`
+	Points       []models.CalibrationPoint `json:"points,omitempty"`
+}
+
+// GetCalibrations retrieves all calibrations for a user's cores.
+func (db DB) GetCalibrations(userEmail string) (models.Calibrations, error) {
+	var calibrations models.Calibrations
+
+	rows, err := db.Query(`select id, useremail, coreid, metric, kind, params, effective_from
+		from calibrations where useremail = $1 order by coreid, metric, effective_from`, userEmail)
+	if err != nil {
+		return calibrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Calibration
+		var paramsJSON string
+
+		err := rows.Scan(&c.ID, &c.UserEmail, &c.CoreID, &c.Metric, &c.Kind, &paramsJSON, &c.EffectiveFrom)
+		if err != nil {
+			return calibrations, err
+		}
+
+		var params calibrationParams
+		if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+			return calibrations, err
+		}
+
+		c.Offset, c.Scale, c.Coefficients, c.Points = params.Offset, params.Scale, params.Coefficients, params.Points
+		calibrations = append(calibrations, c)
+	}
+
+	return calibrations, rows.Err()
+}
+
+// StoreCalibration inserts a new calibration, returning its ID.
+func (db DB) StoreCalibration(c models.Calibration) (int64, error) {
+	paramsJSON, err := json.Marshal(calibrationParams{
+		Offset:       c.Offset,
+		Scale:        c.Scale,
+		Coefficients: c.Coefficients,
+		Points:       c.Points,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = db.QueryRow(`insert into calibrations
+		(useremail, coreid, metric, kind, params, effective_from)
+		values ($1, $2, $3, $4, $5, $6) returning id;`,
+		c.UserEmail, c.CoreID, c.Metric, c.Kind, string(paramsJSON), c.EffectiveFrom).Scan(&id)
+
+	return id, err
+}
+
+// DeleteCalibration deletes one of a user's calibrations.
+func (db DB) DeleteCalibration(userEmail string, id int64) error {
+	result, err := db.Exec("delete from calibrations where useremail = $1 and id = $2", userEmail, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return models.ErrorCalibrationDoesntExist
+	}
+
+	return nil
+}
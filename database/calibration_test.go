@@ -0,0 +1,69 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestCalibrations(t *testing.T) {
+	userEmail := "bragi@asgard.unv"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	table := models.Calibration{UserEmail: userEmail, CoreID: "garden", Metric: "moisture", Kind: models.CalibrationTable,
+		Points: []models.CalibrationPoint{{Raw: 1000, Value: 0}, {Raw: 3000, Value: 100}}, EffectiveFrom: start.Add(time.Hour)}
+	linear := models.Calibration{UserEmail: userEmail, CoreID: "garden", Metric: "moisture", Kind: models.CalibrationLinear,
+		Offset: 1, Scale: 0.01, EffectiveFrom: start}
+
+	tableID, err := db.StoreCalibration(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linearID, err := db.StoreCalibration(linear)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calibrations, err := db.GetCalibrations(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calibrations) != 2 || calibrations[0].ID != linearID || calibrations[1].ID != tableID {
+		t.Fatalf("Expected calibrations ordered by effective time, got %v", calibrations)
+	}
+
+	if c := calibrations[0]; c.Kind != models.CalibrationLinear || c.Offset != 1 || c.Scale != 0.01 || !c.EffectiveFrom.Equal(start) {
+		t.Fatalf("Unexpected linear calibration %v", c)
+	}
+
+	if c := calibrations[1]; c.Kind != models.CalibrationTable || len(c.Points) != 2 || c.Points[1].Value != 100 {
+		t.Fatalf("Unexpected table calibration %v", c)
+	}
+
+	if err := db.DeleteCalibration("loki@asgard.unv", linearID); err != models.ErrorCalibrationDoesntExist {
+		t.Fatalf("Deleting another user's calibration; expected ErrorCalibrationDoesntExist, got %v", err)
+	}
+
+	if err := db.DeleteCalibration(userEmail, linearID); err != nil {
+		t.Fatal(err)
+	}
+
+	calibrations, err = db.GetCalibrations(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calibrations) != 1 || calibrations[0].ID != tableID {
+		t.Fatalf("Expected only the table calibration left, got %v", calibrations)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"github.com/lib/pq"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+const commandColumns = "id, useremail, coreid, name, argument, state, created, expires, delivered, acked, result"
+
+// GetCommands retrieves the commands queued for the user's core, in the
+// order they were queued.
+func (db DB) GetCommands(userEmail, core string) ([]models.Command, error) {
+	return db.queryCommands("select "+commandColumns+" from commands where useremail = $1 and coreid = $2 order by id",
+		userEmail, core)
+}
+
+// StoreCommand queues a new command, returning its ID.
+func (db DB) StoreCommand(c models.Command) (int64, error) {
+	var id int64
+	err := db.QueryRow(`insert into commands (useremail, coreid, name, argument, state, created, expires)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id;`,
+		c.UserEmail, c.CoreID, c.Name, c.Argument, c.State, c.Created, c.Expires).Scan(&id)
+
+	return id, err
+}
+
+// DeliverCommands marks the core's unexpired pending commands delivered and
+// returns them, in the order they were queued.  Each command is delivered
+// at most once, even to concurrent polls.
+func (db DB) DeliverCommands(userEmail, core string, now time.Time) ([]models.Command, error) {
+	commands, err := db.queryCommands(`update commands set state = $3, delivered = $5
+		where useremail = $1 and coreid = $2 and state = $4 and expires > $5
+		returning `+commandColumns, userEmail, core, models.CommandDelivered, models.CommandPending, now)
+	if err != nil {
+		return commands, err
+	}
+
+	models.SortCommands(commands)
+	return commands, nil
+}
+
+// AckCommand marks the core's delivered, unexpired command acked with the
+// result the device reported.
+func (db DB) AckCommand(userEmail, core string, id int64, result string, now time.Time) error {
+	res, err := db.Exec(`update commands set state = $4, acked = $6, result = $7
+		where useremail = $1 and coreid = $2 and id = $3 and state = $5 and expires > $6`,
+		userEmail, core, id, models.CommandAcked, models.CommandDelivered, now, result)
+	err = expectRow(res, err, models.ErrorCommandNotDelivered)
+	if err != models.ErrorCommandNotDelivered {
+		return err
+	}
+
+	var exists bool
+	err = db.QueryRow("select exists (select 1 from commands where useremail = $1 and coreid = $2 and id = $3)",
+		userEmail, core, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return models.ErrorCommandDoesntExist
+	}
+
+	return models.ErrorCommandNotDelivered
+}
+
+// ExpireCommands marks pending and delivered commands past their expiry as
+// expired, returning how many were.
+func (db DB) ExpireCommands(now time.Time) (int64, error) {
+	result, err := db.Exec("update commands set state = $1 where state in ($2, $3) and expires <= $4",
+		models.CommandExpired, models.CommandPending, models.CommandDelivered, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (db DB) queryCommands(query string, args ...interface{}) ([]models.Command, error) {
+	var commands []models.Command
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return commands, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Command
+		var delivered, acked pq.NullTime
+
+		err := rows.Scan(&c.ID, &c.UserEmail, &c.CoreID, &c.Name, &c.Argument, &c.State,
+			&c.Created, &c.Expires, &delivered, &acked, &c.Result)
+		if err != nil {
+			return commands, err
+		}
+
+		if delivered.Valid {
+			c.Delivered = &delivered.Time
+		}
+		if acked.Valid {
+			c.Acked = &acked.Time
+		}
+
+		commands = append(commands, c)
+	}
+
+	return commands, rows.Err()
+}
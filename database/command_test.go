@@ -0,0 +1,89 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestCommands(t *testing.T) {
+	userEmail := "thor@asgard.unv"
+	core := "mjolnir"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	water, err := db.StoreCommand(models.NewCommand(userEmail, core, "water", "30s", 0, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.StoreCommand(models.NewCommand(userEmail, core, "fan", "on", time.Minute, now)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AckCommand(userEmail, core, water, "", now); err != models.ErrorCommandNotDelivered {
+		t.Fatalf("Expected ErrorCommandNotDelivered, got %v", err)
+	}
+
+	// the fan command has expired by the time the core polls
+	delivered, err := db.DeliverCommands(userEmail, core, now.Add(time.Minute*2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 1 || delivered[0].ID != water || delivered[0].State != models.CommandDelivered || delivered[0].Delivered == nil {
+		t.Fatalf("Expected water command delivered, got %v", delivered)
+	}
+
+	if delivered, err = db.DeliverCommands(userEmail, core, now.Add(time.Minute*3)); err != nil || len(delivered) != 0 {
+		t.Fatalf("Expected nothing delivered twice, got %v (%v)", delivered, err)
+	}
+
+	if err := db.AckCommand(userEmail, core, water, "watered", now.Add(time.Minute*3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AckCommand(userEmail, core, water+100, "", now); err != models.ErrorCommandDoesntExist {
+		t.Fatalf("Expected ErrorCommandDoesntExist, got %v", err)
+	}
+
+	// the light command is delivered, but expires before the core acks it
+	light, err := db.StoreCommand(models.NewCommand(userEmail, core, "light", "off", time.Minute, now.Add(time.Minute*3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered, err = db.DeliverCommands(userEmail, core, now.Add(time.Minute*3)); err != nil || len(delivered) != 1 || delivered[0].ID != light {
+		t.Fatalf("Expected light command delivered, got %v (%v)", delivered, err)
+	}
+
+	if err := db.AckCommand(userEmail, core, light, "", now.Add(time.Minute*5)); err != models.ErrorCommandNotDelivered {
+		t.Fatalf("Expected ErrorCommandNotDelivered acking expired command, got %v", err)
+	}
+
+	expired, err := db.ExpireCommands(now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expired != 2 {
+		t.Fatalf("Expected 2 commands expired, got %d", expired)
+	}
+
+	commands, err := db.GetCommands(userEmail, core)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commands) != 3 || commands[0].State != models.CommandAcked || commands[0].Result != "watered" ||
+		commands[0].Acked == nil || commands[1].State != models.CommandExpired || commands[2].State != models.CommandExpired {
+		t.Fatalf("Unexpected commands %v", commands)
+	}
+}
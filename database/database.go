@@ -1,5 +1,6 @@
 // Package database defines method for interacting with PostgreSQL for
-// persistent data.
+// persistent data.  Readings, users and secrets may instead be stored in
+// SQLite, for installs without a Postgres server.
 package database
 
 import (
@@ -8,9 +9,10 @@ import (
 )
 
 // DB is a type used by external packages to implement database operations.
-// DB should be initialized via DBConn function.
+// DB should be initialized via DBConn or SQLiteConn functions.
 type DB struct {
 	*sql.DB
+	dialect dialect
 }
 
 // DBConn returns a new DB, initialized to connect to the database
@@ -19,8 +21,14 @@ func DBConn(dbType, host, user, password string) (DB, error) {
 
 	db, err := sql.Open(dbType, connstr)
 	if err != nil {
-		return DB{nil}, err
+		return DB{nil, postgres}, err
 	}
 
-	return DB{db}, nil
+	return DB{db, postgres}, nil
+}
+
+// Dialect returns the dialect of SQL database the DB connects to: Postgres
+// or SQLite.
+func (db DB) Dialect() string {
+	return db.dialect.name
 }
@@ -16,7 +16,7 @@ func TestMain(m *testing.M) {
 	}
 
 	db = ldb
-	_, err = db.Exec("TRUNCATE users, readings")
+	_, err = db.Exec("TRUNCATE users, readings, reading_deletions, deleted_readings, quarantine, validation_limits, calibrations, preferences, retention_policies, readings_hourly, readings_daily, scheduled_tasks, devices, zones, plants, plant_assignments, events, commands, rules, rule_executions, webhook_subscriptions, webhook_deliveries")
 	if err != nil {
 		panic("Coudn't connect to table! " + err.Error())
 	}
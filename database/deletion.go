@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+const readingColumns = "useremail, posted, coreid, temperature, humidity, moisture, light, battery"
+
+// DeleteReadings moves the user's readings within a specified time span to
+// deleted_readings, where they're kept until the deletion is undone or
+// purged.
+func (db DB) DeleteReadings(userEmail, core string, start, end time.Time) (models.ReadingDeletion, error) {
+	d := models.ReadingDeletion{
+		UserEmail: userEmail,
+		CoreID:    core,
+		Start:     start,
+		End:       end,
+		Deleted:   time.Now(),
+	}
+
+	t, err := db.begin()
+	if err != nil {
+		return d, err
+	}
+
+	err = t.queryRow(`insert into reading_deletions (useremail, coreid, start_time, end_time, count, deleted)
+		values ($1, $2, $3, $4, 0, $5) returning id`,
+		userEmail, core, start, end, d.Deleted).Scan(&d.ID)
+	if err != nil {
+		t.Rollback()
+		return d, err
+	}
+
+	result, err := t.exec(`insert into deleted_readings (deletion_id, `+readingColumns+`)
+		select cast($1 as integer), `+readingColumns+` from readings
+		where useremail = $2 and coreid = $3 and posted between $4 and $5`,
+		d.ID, userEmail, core, start, end)
+	if err != nil {
+		t.Rollback()
+		return d, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		t.Rollback()
+		return d, err
+	}
+	d.Count = int(count)
+
+	_, err = t.exec("delete from readings where useremail = $1 and coreid = $2 and posted between $3 and $4",
+		userEmail, core, start, end)
+	if err != nil {
+		t.Rollback()
+		return d, err
+	}
+
+	_, err = t.exec("update reading_deletions set count = $1 where id = $2", d.Count, d.ID)
+	if err != nil {
+		t.Rollback()
+		return d, err
+	}
+
+	return d, t.Commit()
+}
+
+// UndoDeletion restores the readings of the user's deletion, if made within
+// the grace period, that haven't been stored again since, and forgets the
+// deletion.
+func (db DB) UndoDeletion(userEmail string, id int64) (int, error) {
+	t, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+
+	err = t.queryRow("select id from reading_deletions where id = $1 and useremail = $2 and deleted >= $3",
+		id, userEmail, time.Now().Add(-models.DeletionGracePeriod)).Scan(&id)
+	if err == sql.ErrNoRows {
+		t.Rollback()
+		return 0, models.ErrorDeletionDoesntExist
+	}
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	result, err := t.exec(`insert into readings (`+readingColumns+`)
+		select `+readingColumns+` from deleted_readings where deletion_id = $1
+		on conflict do nothing`, id)
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	restored, err := result.RowsAffected()
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	// deleted readings cascade
+	if _, err := t.exec("delete from reading_deletions where id = $1", id); err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	return int(restored), t.Commit()
+}
+
+// PurgeDeletions deletes the deletions made before the given time along with
+// the readings they deleted.
+func (db DB) PurgeDeletions(before time.Time) (int, error) {
+	// deleted readings cascade
+	result, err := db.exec("delete from reading_deletions where deleted < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+const deviceColumns = "useremail, coreid, last_seen, reporting_interval, status, status_changed"
+
+// SeeDevice records the user's core was seen at the given time, adding it
+// as an online device if it hasn't been seen before.
+func (db DB) SeeDevice(userEmail, core string, seen time.Time) error {
+	_, err := db.Exec(`insert into devices (useremail, coreid, last_seen, status, status_changed)
+		values ($1, $2, $3, $4, $3)
+		on conflict (useremail, coreid) do update set last_seen = greatest(devices.last_seen, excluded.last_seen);`,
+		userEmail, core, seen, models.DeviceOnline)
+
+	return err
+}
+
+// GetDevices retrieves the user's devices.
+func (db DB) GetDevices(userEmail string) ([]models.Device, error) {
+	return db.queryDevices("select "+deviceColumns+" from devices where useremail = $1 order by coreid", userEmail)
+}
+
+// GetAllDevices retrieves every user's devices.
+func (db DB) GetAllDevices() ([]models.Device, error) {
+	return db.queryDevices("select " + deviceColumns + " from devices order by useremail, coreid")
+}
+
+// SetReportingInterval updates how often the user's core is expected to
+// post readings.
+func (db DB) SetReportingInterval(userEmail, core string, interval time.Duration) error {
+	result, err := db.Exec("update devices set reporting_interval = $3 where useremail = $1 and coreid = $2",
+		userEmail, core, int64(interval/time.Second))
+	return expectRow(result, err, models.ErrorDeviceDoesntExist)
+}
+
+// SetDeviceStatus records the status determined for the user's core.
+func (db DB) SetDeviceStatus(userEmail, core, status string, changed time.Time) error {
+	result, err := db.Exec("update devices set status = $3, status_changed = $4 where useremail = $1 and coreid = $2",
+		userEmail, core, status, changed)
+	return expectRow(result, err, models.ErrorDeviceDoesntExist)
+}
+
+func (db DB) queryDevices(query string, args ...interface{}) ([]models.Device, error) {
+	var devices []models.Device
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return devices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device models.Device
+		var intervalSeconds int64
+
+		err := rows.Scan(&device.UserEmail, &device.CoreID, &device.LastSeen, &intervalSeconds, &device.Status, &device.StatusChanged)
+		if err != nil {
+			return devices, err
+		}
+
+		device.ReportingInterval = time.Duration(intervalSeconds) * time.Second
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
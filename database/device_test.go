@@ -0,0 +1,54 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestDevices(t *testing.T) {
+	userEmail := "heimdall@asgard.unv"
+	coreid := "53ff6f0650723"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetReportingInterval(userEmail, coreid, time.Hour); err != models.ErrorDeviceDoesntExist {
+		t.Fatalf("Expected ErrorDeviceDoesntExist, got %v", err)
+	}
+
+	seen := time.Date(2016, 5, 10, 12, 0, 0, 0, time.UTC)
+	for _, s := range []time.Time{seen, seen.Add(-time.Hour)} {
+		if err := db.SeeDevice(userEmail, coreid, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.SetReportingInterval(userEmail, coreid, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := seen.Add(time.Hour * 3)
+	if err := db.SetDeviceStatus(userEmail, coreid, models.DeviceStale, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := db.GetAllDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got %d", len(devices))
+	}
+
+	device := devices[0]
+	if !device.LastSeen.Equal(seen) || device.ReportingInterval != time.Hour ||
+		device.Status != models.DeviceStale || !device.StatusChanged.Equal(changed) {
+		t.Fatalf("Unexpected device %v", device)
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	pq "github.com/lib/pq"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Dialects of SQL databases a DB may connect to.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// dialect holds what differs between the SQL of the databases readings,
+// users and secrets may be stored in.  Other stores use Postgres' SQL.
+type dialect struct {
+	name string
+	// rebind rewrites a query's $n placeholders as the dialect's.
+	rebind func(query string) string
+	// uniqueViolation returns true if err reports a unique constraint
+	// violated.
+	uniqueViolation func(err error) bool
+	// timeArg converts a time to the form the dialect stores and
+	// compares times in.
+	timeArg func(t time.Time) interface{}
+	// userTables are the tables holding users' data, by a useremail
+	// column, in an order they may be deleted from.
+	userTables []string
+}
+
+var postgres = dialect{
+	name:   Postgres,
+	rebind: func(query string) string { return query },
+	uniqueViolation: func(err error) bool {
+		pqErr, ok := err.(*pq.Error)
+		return ok && pqErr.Code == "23505" // unique_violation
+	},
+	timeArg: func(t time.Time) interface{} { return t },
+	userTables: []string{
+		"rule_executions", "rules", "commands", "webhook_deliveries", "webhook_subscriptions",
+		"events", "plant_assignments", "plants", "zones", "devices", "quarantine",
+		"validation_limits", "calibrations", "preferences", "retention_policies",
+		"readings_hourly", "readings_daily", "deleted_readings", "reading_deletions", "readings",
+	},
+}
+
+// sqliteTimeFormat is how times are stored in SQLite: in UTC, and of fixed
+// width so they compare in time order as text.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+var placeholder = regexp.MustCompile(`\$([0-9]+)`)
+
+var sqlite = dialect{
+	name: SQLite,
+	rebind: func(query string) string {
+		return placeholder.ReplaceAllString(query, "?$1")
+	},
+	uniqueViolation: func(err error) bool {
+		return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+	},
+	timeArg:    func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeFormat) },
+	userTables: []string{"deleted_readings", "reading_deletions", "readings"},
+}
+
+// exec executes a query written for Postgres in the DB's dialect.
+func (db DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.Exec(db.dialect.rebind(query), db.args(args)...)
+}
+
+// query runs a query written for Postgres in the DB's dialect.
+func (db DB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Query(db.dialect.rebind(query), db.args(args)...)
+}
+
+// queryRow runs a query written for Postgres, expected to return at most
+// one row, in the DB's dialect.
+func (db DB) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRow(db.dialect.rebind(query), db.args(args)...)
+}
+
+// tx is a transaction running queries written for Postgres in its DB's
+// dialect.
+type tx struct {
+	*sql.Tx
+	db DB
+}
+
+// begin starts a transaction in the DB's dialect.
+func (db DB) begin() (tx, error) {
+	t, err := db.Begin()
+	return tx{t, db}, err
+}
+
+func (t tx) exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Exec(t.db.dialect.rebind(query), t.db.args(args)...)
+}
+
+func (t tx) queryRow(query string, args ...interface{}) *sql.Row {
+	return t.QueryRow(t.db.dialect.rebind(query), t.db.args(args)...)
+}
+
+func (db DB) args(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = db.dialect.timeArg(t)
+		}
+		converted[i] = arg
+	}
+
+	return converted
+}
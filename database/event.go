@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// GetEvents retrieves a user's care events posted within the specified time
+// span, ordered by time posted.
+func (db DB) GetEvents(userEmail string, start, end time.Time) ([]models.Event, error) {
+	var events []models.Event
+
+	rows, err := db.Query(`select id, useremail, kind, source, coalesce(plant_id, 0), coreid, posted, amount, notes
+		from events where useremail = $1 and posted between $2 and $3 order by posted`, userEmail, start, end)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.Event
+		err := rows.Scan(&e.ID, &e.UserEmail, &e.Kind, &e.Source, &e.PlantID, &e.CoreID, &e.Posted, &e.Amount, &e.Notes)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// StoreEvent inserts a new care event, returning its ID.  The event's plant,
+// if any, must be one of the user's.
+func (db DB) StoreEvent(e models.Event) (int64, error) {
+	if e.PlantID != 0 {
+		var exists bool
+		err := db.QueryRow("select exists (select 1 from plants where useremail = $1 and id = $2)", e.UserEmail, e.PlantID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			return 0, models.ErrorPlantDoesntExist
+		}
+	}
+
+	var id int64
+	err := db.QueryRow(`insert into events (useremail, kind, source, plant_id, coreid, posted, amount, notes)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id;`,
+		e.UserEmail, e.Kind, e.Source, sql.NullInt64{Int64: e.PlantID, Valid: e.PlantID != 0},
+		e.CoreID, e.Posted, e.Amount, e.Notes).Scan(&id)
+
+	return id, err
+}
+
+// DeleteEvent deletes one of a user's care events.
+func (db DB) DeleteEvent(userEmail string, id int64) error {
+	result, err := db.Exec("delete from events where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorEventDoesntExist)
+}
@@ -0,0 +1,57 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	userEmail := "idunn@asgard.unv"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basil, err := db.StorePlant(models.Plant{UserEmail: userEmail, Name: "basil"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	_, err = db.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventWatering, Source: models.EventManual, PlantID: basil + 1, Posted: start})
+	if err != models.ErrorPlantDoesntExist {
+		t.Fatalf("Expected ErrorPlantDoesntExist, got %v", err)
+	}
+
+	fertilized, err := db.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventFertilizing, Source: models.EventManual, CoreID: "core", Posted: start.Add(time.Hour * 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventWatering, Source: models.EventAutomated, PlantID: basil, Posted: start.Add(time.Hour), Amount: 250, Notes: "drip line"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := db.GetEvents(userEmail, start, start.Add(time.Hour*2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[0].PlantID != basil || events[0].Amount != 250 || events[1].CoreID != "core" || events[1].PlantID != 0 {
+		t.Fatalf("Unexpected events %v", events)
+	}
+
+	if err := db.DeleteEvent(userEmail, fertilized); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteEvent(userEmail, fertilized); err != models.ErrorEventDoesntExist {
+		t.Fatalf("Expected ErrorEventDoesntExist, got %v", err)
+	}
+}
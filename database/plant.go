@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/serdmanczyk/freyr/models"
+)
+
+// GetZones retrieves a user's zones.
+func (db DB) GetZones(userEmail string) ([]models.Zone, error) {
+	var zones []models.Zone
+
+	rows, err := db.Query("select id, useremail, name, description from zones where useremail = $1 order by name", userEmail)
+	if err != nil {
+		return zones, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var z models.Zone
+		if err := rows.Scan(&z.ID, &z.UserEmail, &z.Name, &z.Description); err != nil {
+			return zones, err
+		}
+		zones = append(zones, z)
+	}
+
+	return zones, rows.Err()
+}
+
+// StoreZone inserts a new zone, or updates the zone if it has an ID,
+// returning its ID.
+func (db DB) StoreZone(z models.Zone) (int64, error) {
+	if z.ID == 0 {
+		var id int64
+		err := db.QueryRow("insert into zones (useremail, name, description) values ($1, $2, $3) returning id;",
+			z.UserEmail, z.Name, z.Description).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec("update zones set name = $3, description = $4 where useremail = $1 and id = $2",
+		z.UserEmail, z.ID, z.Name, z.Description)
+	return z.ID, expectRow(result, err, models.ErrorZoneDoesntExist)
+}
+
+// DeleteZone deletes one of a user's zones; its plants are left without a
+// zone.
+func (db DB) DeleteZone(userEmail string, id int64) error {
+	result, err := db.Exec("delete from zones where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorZoneDoesntExist)
+}
+
+// GetPlants retrieves a user's plants.
+func (db DB) GetPlants(userEmail string) ([]models.Plant, error) {
+	var plants []models.Plant
+
+	rows, err := db.Query(`select id, useremail, coalesce(zone_id, 0), name, species, notes
+		from plants where useremail = $1 order by name`, userEmail)
+	if err != nil {
+		return plants, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Plant
+		if err := rows.Scan(&p.ID, &p.UserEmail, &p.ZoneID, &p.Name, &p.Species, &p.Notes); err != nil {
+			return plants, err
+		}
+		plants = append(plants, p)
+	}
+
+	return plants, rows.Err()
+}
+
+// StorePlant inserts a new plant, or updates the plant if it has an ID,
+// returning its ID.
+func (db DB) StorePlant(p models.Plant) (int64, error) {
+	if p.ZoneID != 0 {
+		var exists bool
+		err := db.QueryRow("select exists (select 1 from zones where useremail = $1 and id = $2)", p.UserEmail, p.ZoneID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			return 0, models.ErrorZoneDoesntExist
+		}
+	}
+
+	zoneID := sql.NullInt64{Int64: p.ZoneID, Valid: p.ZoneID != 0}
+
+	if p.ID == 0 {
+		var id int64
+		err := db.QueryRow(`insert into plants (useremail, zone_id, name, species, notes)
+			values ($1, $2, $3, $4, $5) returning id;`,
+			p.UserEmail, zoneID, p.Name, p.Species, p.Notes).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec(`update plants set zone_id = $3, name = $4, species = $5, notes = $6
+		where useremail = $1 and id = $2`, p.UserEmail, p.ID, zoneID, p.Name, p.Species, p.Notes)
+	return p.ID, expectRow(result, err, models.ErrorPlantDoesntExist)
+}
+
+// DeletePlant deletes one of a user's plants along with its assignments.
+func (db DB) DeletePlant(userEmail string, id int64) error {
+	result, err := db.Exec("delete from plants where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorPlantDoesntExist)
+}
+
+// GetAssignments retrieves the assignments of cores to one of a user's
+// plants, ordered by start.
+func (db DB) GetAssignments(userEmail string, plantID int64) ([]models.Assignment, error) {
+	var assignments []models.Assignment
+
+	rows, err := db.Query(`select id, useremail, plant_id, coreid, start_time, end_time
+		from plant_assignments where useremail = $1 and plant_id = $2 order by start_time`, userEmail, plantID)
+	if err != nil {
+		return assignments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Assignment
+		var end pq.NullTime
+
+		if err := rows.Scan(&a.ID, &a.UserEmail, &a.PlantID, &a.CoreID, &a.Start, &end); err != nil {
+			return assignments, err
+		}
+
+		if end.Valid {
+			a.End = &end.Time
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, rows.Err()
+}
+
+// StoreAssignment inserts a new assignment of a core to one of the user's
+// plants, returning its ID.  If the new assignment is open-ended, an open
+// assignment of the same core that started earlier is ended when the new
+// assignment starts.
+func (db DB) StoreAssignment(a models.Assignment) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := storeAssignment(tx, a)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func storeAssignment(tx *sql.Tx, a models.Assignment) (int64, error) {
+	var exists bool
+	err := tx.QueryRow("select exists (select 1 from plants where useremail = $1 and id = $2)", a.UserEmail, a.PlantID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, models.ErrorPlantDoesntExist
+	}
+
+	// serialize assignments of the user's cores by locking the user's row,
+	// which exists before a core's first assignment, and the core's
+	// assignments, leaving other users' assignments unblocked
+	if _, err := tx.Exec("select 1 from users where email = $1 for update", a.UserEmail); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("select 1 from plant_assignments where useremail = $1 and coreid = $2 for update", a.UserEmail, a.CoreID)
+	if err != nil {
+		return 0, err
+	}
+
+	if a.End == nil {
+		_, err = tx.Exec(`update plant_assignments set end_time = $3
+			where useremail = $1 and coreid = $2 and end_time is null and start_time < $3`, a.UserEmail, a.CoreID, a.Start)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	end := pq.NullTime{Valid: a.End != nil}
+	if a.End != nil {
+		end.Time = *a.End
+	}
+
+	var overlaps bool
+	err = tx.QueryRow(`select exists (select 1 from plant_assignments
+		where useremail = $1 and coreid = $2
+		and (end_time is null or end_time > $3) and ($4::timestamptz is null or start_time < $4))`,
+		a.UserEmail, a.CoreID, a.Start, end).Scan(&overlaps)
+	if err != nil {
+		return 0, err
+	}
+
+	if overlaps {
+		return 0, models.ErrorAssignmentOverlaps
+	}
+
+	var id int64
+	err = tx.QueryRow(`insert into plant_assignments (useremail, plant_id, coreid, start_time, end_time)
+		values ($1, $2, $3, $4, $5) returning id;`, a.UserEmail, a.PlantID, a.CoreID, a.Start, end).Scan(&id)
+	return id, err
+}
+
+// DeleteAssignment deletes one of a user's assignments.
+func (db DB) DeleteAssignment(userEmail string, id int64) error {
+	result, err := db.Exec("delete from plant_assignments where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorAssignmentDoesntExist)
+}
+
+// expectRow returns notFound if the statement's result affected no rows.
+func expectRow(result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return notFound
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestPlants(t *testing.T) {
+	userEmail := "frigg@asgard.unv"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zoneID, err := db.StoreZone(models.Zone{UserEmail: userEmail, Name: "greenhouse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.StorePlant(models.Plant{UserEmail: userEmail, ZoneID: zoneID + 1, Name: "basil"}); err != models.ErrorZoneDoesntExist {
+		t.Fatalf("Expected ErrorZoneDoesntExist, got %v", err)
+	}
+
+	basil, err := db.StorePlant(models.Plant{UserEmail: userEmail, ZoneID: zoneID, Name: "basil"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tomato, err := db.StorePlant(models.Plant{UserEmail: userEmail, Name: "tomato"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	moved := start.AddDate(0, 0, 3)
+
+	if _, err := db.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: basil, CoreID: "core", Start: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: tomato, CoreID: "core", Start: moved}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: tomato, CoreID: "core", Start: start.AddDate(0, 0, 1)})
+	if err != models.ErrorAssignmentOverlaps {
+		t.Fatalf("Expected ErrorAssignmentOverlaps, got %v", err)
+	}
+
+	// an assignment with an end doesn't end the open one it overlaps
+	later, laterEnd := moved.AddDate(0, 0, 1), moved.AddDate(0, 0, 2)
+	_, err = db.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: basil, CoreID: "core", Start: later, End: &laterEnd})
+	if err != models.ErrorAssignmentOverlaps {
+		t.Fatalf("Expected ErrorAssignmentOverlaps for bounded assignment, got %v", err)
+	}
+
+	assignments, err := db.GetAssignments(userEmail, basil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(assignments) != 1 || assignments[0].End == nil || !assignments[0].End.Equal(moved) {
+		t.Fatalf("Expected basil assignment ended at %s, got %v", moved, assignments)
+	}
+
+	if err := db.DeleteZone(userEmail, zoneID); err != nil {
+		t.Fatal(err)
+	}
+
+	plants, err := db.GetPlants(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plants) != 2 || plants[0].ZoneID != 0 {
+		t.Fatalf("Expected plants left without a zone, got %v", plants)
+	}
+
+	if err := db.DeletePlant(userEmail, tomato); err != nil {
+		t.Fatal(err)
+	}
+
+	assignments, err = db.GetAssignments(userEmail, tomato)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(assignments) != 0 {
+		t.Fatalf("Expected deleted plant's assignments deleted, got %v", assignments)
+	}
+}
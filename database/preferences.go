@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/models"
+)
+
+// GetPreferences retrieves the user's preferences, along with their locale,
+// from the database.  Preferences the user hasn't set are left empty.
+func (db DB) GetPreferences(userEmail string) (models.Preferences, error) {
+	var preferences models.Preferences
+	var locale, units, timeZone, coreTimeZones sql.NullString
+
+	err := db.QueryRow(`select users.locale, preferences.units, preferences.time_zone, preferences.core_time_zones
+		from users left join preferences on preferences.useremail = users.email
+		where users.email = $1;`, userEmail).Scan(&locale, &units, &timeZone, &coreTimeZones)
+	if err == sql.ErrNoRows {
+		return preferences, nil
+	}
+
+	if err != nil {
+		return preferences, err
+	}
+
+	preferences.Locale = locale.String
+	preferences.TimeZone = timeZone.String
+	if coreTimeZones.String != "" {
+		if err := json.Unmarshal([]byte(coreTimeZones.String), &preferences.CoreTimeZones); err != nil {
+			return preferences, err
+		}
+	}
+
+	preferences.Units, err = models.ParseUnits(units.String)
+	return preferences, err
+}
+
+// StorePreferences inserts or updates the user's preferences in the database.
+func (db DB) StorePreferences(userEmail string, preferences models.Preferences) error {
+	coreTimeZones, err := json.Marshal(preferences.CoreTimeZones)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`insert into preferences (useremail, units, time_zone, core_time_zones)
+		values ($1, $2, $3, $4)
+		on conflict (useremail) do update set units = excluded.units,
+			time_zone = excluded.time_zone, core_time_zones = excluded.core_time_zones;`,
+		userEmail, preferences.Units.String(), preferences.TimeZone, string(coreTimeZones))
+
+	return err
+}
@@ -0,0 +1,46 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+)
+
+func TestPreferences(t *testing.T) {
+	testUser := models.User{
+		Email:  "sif@asgard.unv",
+		Locale: "en-US",
+	}
+
+	err := db.StoreUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preferences, err := db.GetPreferences(testUser.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preferences.Locale != testUser.Locale || len(preferences.Units) != 0 {
+		t.Fatalf("Unexpected preferences for new user: %v", preferences)
+	}
+
+	units := models.Units{"temperature": models.Celsius, "light": models.Percent}
+	for i := 0; i < 2; i++ {
+		err = db.StorePreferences(testUser.Email, models.Preferences{Units: units})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	preferences, err = db.GetPreferences(testUser.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preferences.Units.String() != units.String() {
+		t.Fatalf("Incorrect units returned; expected %s, got %s", units, preferences.Units)
+	}
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/serdmanczyk/freyr/models"
+	"strings"
+	"time"
+)
+
+// reasonSeparator joins a quarantined reading's reasons into a single column.
+const reasonSeparator = "\n"
+
+// QuarantineReading stores a reading that failed validation, along with the
+// reasons why, in the quarantine table.  Quarantining the same reading twice
+// has no effect.
+func (db DB) QuarantineReading(reading models.Reading, reasons []string) error {
+	_, err := db.Exec(`insert into quarantine
+		(useremail, posted, coreid, temperature, humidity, moisture, light, battery, reasons, quarantined)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		on conflict (useremail, coreid, posted) do nothing;`,
+		reading.UserEmail, reading.Posted, reading.CoreID,
+		reading.Temperature, reading.Humidity, reading.Moisture, reading.Light, reading.Battery,
+		strings.Join(reasons, reasonSeparator), time.Now())
+
+	return err
+}
+
+// GetQuarantined retrieves all quarantined readings for a user.
+func (db DB) GetQuarantined(userEmail string) ([]models.QuarantinedReading, error) {
+	var quarantined []models.QuarantinedReading
+
+	rows, err := db.Query(`select
+		id, useremail, posted, coreid, temperature, humidity, moisture, light, battery, reasons, quarantined
+		from quarantine where useremail = $1 order by quarantined`, userEmail)
+	if err != nil {
+		return quarantined, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q models.QuarantinedReading
+		var reasons string
+
+		err := rows.Scan(&q.ID, &q.Reading.UserEmail, &q.Reading.Posted, &q.Reading.CoreID,
+			&q.Reading.Temperature, &q.Reading.Humidity, &q.Reading.Moisture, &q.Reading.Light,
+			&q.Reading.Battery, &reasons, &q.Quarantined)
+		if err != nil {
+			return quarantined, err
+		}
+
+		q.Reasons = strings.Split(reasons, reasonSeparator)
+		quarantined = append(quarantined, q)
+	}
+
+	return quarantined, rows.Err()
+}
+
+// ReleaseQuarantined removes a reading from quarantine and returns it so it
+// can be stored.
+func (db DB) ReleaseQuarantined(userEmail string, id int64) (models.Reading, error) {
+	var reading models.Reading
+
+	err := db.QueryRow(`delete from quarantine where useremail = $1 and id = $2
+		returning useremail, posted, coreid, temperature, humidity, moisture, light, battery`,
+		userEmail, id).Scan(&reading.UserEmail, &reading.Posted, &reading.CoreID,
+		&reading.Temperature, &reading.Humidity, &reading.Moisture, &reading.Light, &reading.Battery)
+	if err == sql.ErrNoRows {
+		return reading, models.ErrorQuarantinedDoesntExist
+	}
+
+	return reading, err
+}
+
+// DeleteQuarantined discards a quarantined reading.
+func (db DB) DeleteQuarantined(userEmail string, id int64) error {
+	result, err := db.Exec("delete from quarantine where useremail = $1 and id = $2", userEmail, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return models.ErrorQuarantinedDoesntExist
+	}
+
+	return nil
+}
+
+// GetValidationLimits retrieves the validation limits a user has configured
+// for a core.  Metrics without configured limits are absent.
+func (db DB) GetValidationLimits(userEmail, core string) (models.ValidationLimits, error) {
+	limits := make(models.ValidationLimits)
+
+	rows, err := db.Query(`select metric, min, max, max_rate
+		from validation_limits where useremail = $1 and coreid = $2`, userEmail, core)
+	if err != nil {
+		return limits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var metric string
+		var limit models.MetricLimit
+
+		if err := rows.Scan(&metric, &limit.Min, &limit.Max, &limit.MaxRate); err != nil {
+			return limits, err
+		}
+
+		limits[metric] = limit
+	}
+
+	return limits, rows.Err()
+}
+
+// StoreValidationLimits inserts or updates the validation limits for the
+// metrics given for a user's core.
+func (db DB) StoreValidationLimits(userEmail, core string, limits models.ValidationLimits) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for metric, limit := range limits {
+		_, err := tx.Exec(`insert into validation_limits
+			(useremail, coreid, metric, min, max, max_rate) values ($1, $2, $3, $4, $5, $6)
+			on conflict (useremail, coreid, metric)
+			do update set min = excluded.min, max = excluded.max, max_rate = excluded.max_rate;`,
+			userEmail, core, metric, limit.Min, limit.Max, limit.MaxRate)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	userEmail := "baldr@asgard.unv"
+	coreID := "777777777777"
+
+	err := db.StoreUser(models.User{
+		Email: userEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reading := fake.RandReading(userEmail, coreID, time.Unix(1461500000, 0))
+	reasons := []string{"temperature too hot", "humidity too wet"}
+
+	for i := 0; i < 2; i++ {
+		err = db.QuarantineReading(reading, reasons)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quarantined, err := db.GetQuarantined(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quarantined) != 1 {
+		t.Fatalf("Expected one quarantined reading, got %d", len(quarantined))
+	}
+
+	if len(quarantined[0].Reasons) != len(reasons) {
+		t.Fatalf("Incorrect reasons returned; expected %v, got %v", reasons, quarantined[0].Reasons)
+	}
+
+	_, err = db.ReleaseQuarantined("someoneelse@asgard.unv", quarantined[0].ID)
+	if err != models.ErrorQuarantinedDoesntExist {
+		t.Fatalf("Expected %s releasing another user's reading, got %v", models.ErrorQuarantinedDoesntExist, err)
+	}
+
+	released, err := db.ReleaseQuarantined(userEmail, quarantined[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !released.Compare(reading) {
+		t.Fatalf("Incorrect reading released; expected %v, got %v", reading, released)
+	}
+
+	err = db.DeleteQuarantined(userEmail, quarantined[0].ID)
+	if err != models.ErrorQuarantinedDoesntExist {
+		t.Fatalf("Expected %s deleting released reading, got %v", models.ErrorQuarantinedDoesntExist, err)
+	}
+}
+
+func TestValidationLimits(t *testing.T) {
+	userEmail := "bragi@asgard.unv"
+	coreID := "888888888888"
+
+	err := db.StoreUser(models.User{
+		Email: userEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := models.ValidationLimits{
+		"moisture": {Min: 0, Max: 4096, MaxRate: 100},
+	}
+
+	for i := 0; i < 2; i++ {
+		err = db.StoreValidationLimits(userEmail, coreID, limits)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := db.GetValidationLimits(userEmail, coreID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 1 || stored["moisture"] != limits["moisture"] {
+		t.Fatalf("Incorrect limits returned; expected %v, got %v", limits, stored)
+	}
+}
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"database/sql"
+	"fmt"
 	"github.com/serdmanczyk/freyr/models"
+	"strings"
 	"time"
 )
 
@@ -9,14 +12,15 @@ import (
 func (db DB) GetLatestReadings(userEmail string) ([]models.Reading, error) {
 	var readings []models.Reading
 
-	rows, err := db.Query(`
+	rows, err := db.query(`
 	select readings.useremail, readings.posted, readings.coreid, readings.posted, readings.temperature,
 		readings.humidity, readings.moisture, readings.light, readings.battery
 	from readings inner join 
-	    (select coreid, max(posted) from
+	    (select coreid, max(posted) as max from
 	        (select * from readings where useremail = $1) as userreadings
 	    group by coreid) as maxposted
-	    on readings.coreid = maxposted.coreid and readings.posted = maxposted.max`, userEmail)
+	    on readings.coreid = maxposted.coreid and readings.posted = maxposted.max
+	where readings.useremail = $1`, userEmail)
 	if err != nil {
 		return readings, err
 	}
@@ -41,43 +45,107 @@ func (db DB) GetLatestReadings(userEmail string) ([]models.Reading, error) {
 	return readings, err
 }
 
-// StoreReading stores a new reading in the database
+// StoreReading stores a new reading in the database.  If a reading already
+// exists for the same user, core and time models.ErrorReadingExists is
+// returned when it is identical, otherwise a models.ReadingConflictError.
 func (db DB) StoreReading(reading models.Reading) error {
-	_, err := db.Exec(`insert into readings
+	_, err := db.exec(`insert into readings
 		(useremail, posted, coreid, temperature, humidity, moisture, light, battery)
 		values ($1, $2, $3, $4, $5, $6, $7, $8);`,
 		reading.UserEmail, reading.Posted, reading.CoreID,
 		reading.Temperature, reading.Humidity, reading.Moisture, reading.Light, reading.Battery)
+	if db.dialect.uniqueViolation(err) {
+		return db.duplicateReadingError(reading)
+	}
+
+	return err
+}
+
+// duplicateReadingError compares a reading that violated the readings primary
+// key with the reading already stored and returns the matching error.
+func (db DB) duplicateReadingError(reading models.Reading) error {
+	var stored models.Reading
+
+	err := db.queryRow(`select
+		useremail, posted, coreid, temperature, humidity, moisture, light, battery
+		from readings where useremail = $1 and coreid = $2 and posted = $3`,
+		reading.UserEmail, reading.CoreID, reading.Posted).Scan(&stored.UserEmail, &stored.Posted,
+		&stored.CoreID, &stored.Temperature, &stored.Humidity, &stored.Moisture, &stored.Light, &stored.Battery)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if !reading.Compare(stored) {
+		return models.ReadingConflictError{Stored: stored}
+	}
+
+	return models.ErrorReadingExists
+}
+
+// HasReadings returns true if the user has any readings of the core in the
+// database.
+func (db DB) HasReadings(userEmail, core string) (bool, error) {
+	var exists bool
+	err := db.queryRow("select exists (select 1 from readings where useremail = $1 and coreid = $2)",
+		userEmail, core).Scan(&exists)
+	return exists, err
 }
 
-// DeleteReadings deletes readings within a specified time span from the database
-func (db DB) DeleteReadings(core string, start, end time.Time) error {
-	_, err := db.Exec("delete from readings where coreid = $1 and posted between $2 and $3",
-		core, start, end)
+// CountReadings counts the user's readings within a specified time span in
+// the database.
+func (db DB) CountReadings(userEmail, core string, start, end time.Time) (int, error) {
+	var count int
+	err := db.queryRow("select count(*) from readings where useremail = $1 and coreid = $2 and posted between $3 and $4",
+		userEmail, core, start, end).Scan(&count)
+	return count, err
+}
+
+// GetReadings gets the user's readings within a specified time span from the
+// database, in time order.
+func (db DB) GetReadings(userEmail, core string, start, end time.Time) ([]models.Reading, error) {
+	rows, err := db.query(`select
+		useremail, posted, coreid, temperature, humidity, moisture, light, battery
+		from readings where useremail = $1 and coreid = $2 and posted between $3 and $4
+		order by posted`, userEmail, core, start, end)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return scanReadings(rows)
 }
 
-// GetReadings gets readings within a specified time span from the database
-func (db DB) GetReadings(core string, start, end time.Time) ([]models.Reading, error) {
-	var readings []models.Reading
+// GetReadingsPage gets at most limit of the user's readings of any of the
+// cores within a specified time span from the database that follow the
+// cursor, in cursor order.
+func (db DB) GetReadingsPage(userEmail string, cores []string, start, end time.Time, after models.Cursor, limit int) ([]models.Reading, error) {
+	if len(cores) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userEmail, start, end, after.Posted, after.CoreID, limit}
+	placeholders := make([]string, len(cores))
+	for i, core := range cores {
+		args = append(args, core)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
 
-	rows, err := db.Query(`select
+	rows, err := db.query(`select
 		useremail, posted, coreid, temperature, humidity, moisture, light, battery
-		from readings where coreid = $1 and posted between $2 and $3`, core, start, end)
+		from readings where useremail = $1 and coreid in (`+strings.Join(placeholders, ", ")+`)
+			and posted between $2 and $3 and (posted, coreid) > ($4, $5)
+		order by posted, coreid
+		limit $6`, args...)
 	if err != nil {
-		return readings, err
+		return nil, err
 	}
+
+	return scanReadings(rows)
+}
+
+func scanReadings(rows *sql.Rows) ([]models.Reading, error) {
 	defer rows.Close()
 
+	var readings []models.Reading
 	for rows.Next() {
 		reading := models.Reading{}
 
@@ -90,9 +158,5 @@ func (db DB) GetReadings(core string, start, end time.Time) ([]models.Reading, e
 		readings = append(readings, reading)
 	}
 
-	if err := rows.Err(); err != nil {
-		return readings, err
-	}
-
-	return readings, err
+	return readings, rows.Err()
 }
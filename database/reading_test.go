@@ -30,7 +30,7 @@ func TestReadings(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	readings, err := db.GetReadings(coreID, start.Add(time.Second*-1), start.Add(time.Second))
+	readings, err := db.GetReadings(userEmail, coreID, start.Add(time.Second*-1), start.Add(time.Second))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -162,7 +162,7 @@ func TestDeleteReadings(t *testing.T) {
 		}
 	}
 
-	readings, err := db.GetReadings(core, start, end)
+	readings, err := db.GetReadings(userEmail, core, start, end)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -171,12 +171,12 @@ func TestDeleteReadings(t *testing.T) {
 		t.Fatal("No readings inserted into database")
 	}
 
-	err = db.DeleteReadings(core, start, end)
+	_, err = db.DeleteReadings(userEmail, core, start, end)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	readings, err = db.GetReadings(core, start, end)
+	readings, err = db.GetReadings(userEmail, core, start, end)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -185,3 +185,40 @@ func TestDeleteReadings(t *testing.T) {
 		t.Fatalf("Readings still remain after delete: %d, %v", len(readings), readings)
 	}
 }
+
+func TestStoreReadingDuplicate(t *testing.T) {
+	userEmail := "heimdall@bifrost.unv"
+	coreID := "321321321321"
+
+	err := db.StoreUser(models.User{
+		Email: userEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reading := fake.RandReading(userEmail, coreID, time.Unix(1461400000, 0))
+
+	err = db.StoreReading(reading)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.StoreReading(reading)
+	if err != models.ErrorReadingExists {
+		t.Fatalf("Incorrect error storing identical reading; expected %s, got %v", models.ErrorReadingExists, err)
+	}
+
+	conflicting := reading
+	conflicting.Moisture += 10
+
+	err = db.StoreReading(conflicting)
+	conflict, ok := err.(models.ReadingConflictError)
+	if !ok {
+		t.Fatalf("Incorrect error storing conflicting reading; got %v", err)
+	}
+
+	if !reading.Compare(conflict.Stored) {
+		t.Fatalf("Conflict error should hold stored reading; expected %v, got %v", reading, conflict.Stored)
+	}
+}
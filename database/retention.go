@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"strings"
+	"time"
+)
+
+// rollupTables maps rollup intervals to the table holding them.
+var rollupTables = map[string]string{
+	models.IntervalHour: "readings_hourly",
+	models.IntervalDay:  "readings_daily",
+}
+
+// rollupDeleteBatch is how many of a core's rolled up readings are deleted
+// by each statement.
+const rollupDeleteBatch = 500
+
+// GetRetentionPolicy retrieves the user's retention policy, the zero policy
+// (keep everything) if they haven't set one.
+func (db DB) GetRetentionPolicy(userEmail string) (models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+
+	err := db.QueryRow(`select raw_days, hourly_days, daily_days
+		from retention_policies where useremail = $1`, userEmail).Scan(&policy.RawDays, &policy.HourlyDays, &policy.DailyDays)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	}
+
+	return policy, err
+}
+
+// StoreRetentionPolicy inserts or updates the user's retention policy.
+func (db DB) StoreRetentionPolicy(userEmail string, policy models.RetentionPolicy) error {
+	_, err := db.Exec(`insert into retention_policies (useremail, raw_days, hourly_days, daily_days)
+		values ($1, $2, $3, $4)
+		on conflict (useremail) do update set raw_days = excluded.raw_days,
+			hourly_days = excluded.hourly_days, daily_days = excluded.daily_days;`,
+		userEmail, policy.RawDays, policy.HourlyDays, policy.DailyDays)
+
+	return err
+}
+
+// GetRetentionPolicies retrieves the retention policies of all users that
+// have set one.
+func (db DB) GetRetentionPolicies() (map[string]models.RetentionPolicy, error) {
+	policies := make(map[string]models.RetentionPolicy)
+
+	rows, err := db.Query("select useremail, raw_days, hourly_days, daily_days from retention_policies")
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userEmail string
+		var policy models.RetentionPolicy
+
+		if err := rows.Scan(&userEmail, &policy.RawDays, &policy.HourlyDays, &policy.DailyDays); err != nil {
+			return policies, err
+		}
+
+		policies[userEmail] = policy
+	}
+
+	return policies, rows.Err()
+}
+
+// RollupReadings stores the rollups, combining them with those already
+// stored for the same buckets, then deletes the user's readings rolled up,
+// in batches of each core's posted times.
+func (db DB) RollupReadings(userEmail string, rolledUp map[string][]time.Time, hourly, daily []models.Aggregate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for interval, rollups := range map[string][]models.Aggregate{
+		models.IntervalHour: hourly,
+		models.IntervalDay:  daily,
+	} {
+		query := rollupSQL(rollupTables[interval])
+		for _, rollup := range rollups {
+			args := []interface{}{userEmail, rollup.CoreID, rollup.Start, rollup.Metrics[models.Metrics[0]].Count}
+			for _, metric := range models.Metrics {
+				summary := rollup.Metrics[metric]
+				args = append(args, summary.Min, summary.Max, summary.Mean)
+			}
+
+			if _, err := tx.Exec(query, args...); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	for core, posted := range rolledUp {
+		for len(posted) > 0 {
+			batch := posted
+			if len(batch) > rollupDeleteBatch {
+				batch = batch[:rollupDeleteBatch]
+			}
+			posted = posted[len(batch):]
+
+			args := []interface{}{userEmail, core}
+			placeholders := make([]string, len(batch))
+			for i, t := range batch {
+				args = append(args, t)
+				placeholders[i] = fmt.Sprintf("$%d", i+3)
+			}
+
+			_, err := tx.Exec("delete from readings where useremail = $1 and coreid = $2 and posted in ("+strings.Join(placeholders, ", ")+")", args...)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// rollupSQL builds the statement storing a rollup in the given table,
+// combining it with any already stored for its bucket.
+func rollupSQL(table string) string {
+	columns := []string{"useremail", "coreid", "bucket", "count"}
+	updates := []string{fmt.Sprintf("count = %s.count + excluded.count", table)}
+
+	for _, metric := range models.Metrics {
+		columns = append(columns, metric+"_min", metric+"_max", metric+"_mean")
+		updates = append(updates,
+			fmt.Sprintf("%[1]s_min = least(%[2]s.%[1]s_min, excluded.%[1]s_min)", metric, table),
+			fmt.Sprintf("%[1]s_max = greatest(%[2]s.%[1]s_max, excluded.%[1]s_max)", metric, table),
+			fmt.Sprintf("%[1]s_mean = (%[2]s.%[1]s_mean * %[2]s.count + excluded.%[1]s_mean * excluded.count) / (%[2]s.count + excluded.count)", metric, table))
+	}
+
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return fmt.Sprintf(`insert into %s (%s) values (%s)
+		on conflict (useremail, coreid, bucket) do update set %s;`,
+		table, strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+}
+
+// DeleteRollups deletes the user's rollups of the given interval ("hour" or
+// "day") with buckets starting before the given time.
+func (db DB) DeleteRollups(userEmail, interval string, before time.Time) error {
+	table, ok := rollupTables[interval]
+	if !ok {
+		return models.ErrorInvalidInterval
+	}
+
+	_, err := db.Exec("delete from "+table+" where useremail = $1 and bucket < $2", userEmail, before)
+	return err
+}
+
+// GetRollups retrieves a core's rollups with buckets starting within the
+// specified time span.  Hourly rollups are returned where they exist, daily
+// rollups only for days without hourly rollups.
+func (db DB) GetRollups(userEmail, core string, start, end time.Time) ([]models.Aggregate, error) {
+	var aggregates []models.Aggregate
+
+	columns := []string{"coreid", "bucket", "count"}
+	for _, metric := range models.Metrics {
+		columns = append(columns, metric+"_min", metric+"_max", metric+"_mean")
+	}
+	selects := strings.Join(columns, ", ")
+
+	rows, err := db.Query(`select `+selects+` from readings_hourly
+		where useremail = $1 and coreid = $2 and bucket between $3 and $4
+		union all
+		select `+selects+` from readings_daily
+		where useremail = $1 and coreid = $2 and bucket between $3 and $4
+		and not exists (select 1 from readings_hourly
+			where readings_hourly.useremail = readings_daily.useremail
+			and readings_hourly.coreid = readings_daily.coreid
+			and readings_hourly.bucket >= readings_daily.bucket
+			and readings_hourly.bucket < readings_daily.bucket + interval '1 day')
+		order by bucket`, userEmail, core, start, end)
+	if err != nil {
+		return aggregates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var agg models.Aggregate
+		var count int
+		values := make([]float64, len(models.Metrics)*3)
+
+		dest := []interface{}{&agg.CoreID, &agg.Start, &count}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return aggregates, err
+		}
+
+		agg.Metrics = make(map[string]models.MetricSummary, len(models.Metrics))
+		for i, metric := range models.Metrics {
+			agg.Metrics[metric] = models.MetricSummary{
+				Min:   values[i*3],
+				Max:   values[i*3+1],
+				Mean:  values[i*3+2],
+				Count: count,
+			}
+		}
+
+		aggregates = append(aggregates, agg)
+	}
+
+	return aggregates, rows.Err()
+}
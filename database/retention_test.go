@@ -0,0 +1,80 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/retention"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	userEmail := "thor@asgard.unv"
+	coreid := "3452352525"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := models.RetentionPolicy{RawDays: 1, HourlyDays: 7}
+	if err := db.StoreRetentionPolicy(userEmail, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := db.GetRetentionPolicy(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored != policy {
+		t.Fatalf("Stored policy %v doesn't match %v", stored, policy)
+	}
+
+	// readings every 30 minutes for two UTC days
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Minute*30)
+	for i := 0; i < 96; i++ {
+		if err := db.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cutoff := start.AddDate(0, 0, 1)
+	if err := retention.Rollup(db, db, db, db, userEmail, cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	readings, err := db.GetReadings(userEmail, coreid, start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 48 {
+		t.Fatalf("Expected 48 raw readings kept, got %d", len(readings))
+	}
+
+	rollups, err := db.GetRollups(userEmail, coreid, start, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rollups) != 24 {
+		t.Fatalf("Expected 24 hourly rollups, got %d", len(rollups))
+	}
+
+	if err := db.DeleteRollups(userEmail, models.IntervalHour, cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	rollups, err = db.GetRollups(userEmail, coreid, start, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rollups) != 1 || rollups[0].Metrics["temperature"].Count != 48 {
+		t.Fatalf("Expected one daily rollup of 48 readings, got %v", rollups)
+	}
+}
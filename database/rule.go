@@ -0,0 +1,204 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+const ruleColumns = "id, useremail, name, coreid, conditions, quiet, schedule, action, cooldown, enabled, dry_run, last_fired"
+
+// GetRules retrieves the user's rules.
+func (db DB) GetRules(userEmail string) ([]models.Rule, error) {
+	return db.queryRules("select "+ruleColumns+" from rules where useremail = $1 order by id", userEmail)
+}
+
+// GetCoreRules retrieves the user's enabled rules for the core.
+func (db DB) GetCoreRules(userEmail, core string) ([]models.Rule, error) {
+	return db.queryRules("select "+ruleColumns+" from rules where useremail = $1 and coreid = $2 and enabled order by id",
+		userEmail, core)
+}
+
+// StoreRule inserts a new rule, returning its ID, or updates the user's rule
+// with the rule's ID.  Updating a rule keeps its last firing.
+func (db DB) StoreRule(r models.Rule) (int64, error) {
+	conditions, err := json.Marshal(r.Conditions)
+	if err != nil {
+		return 0, err
+	}
+
+	quiet, err := json.Marshal(r.Quiet)
+	if err != nil {
+		return 0, err
+	}
+
+	var schedule sql.NullString
+	if r.Schedule != nil {
+		encoded, err := json.Marshal(r.Schedule)
+		if err != nil {
+			return 0, err
+		}
+		schedule = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	action, err := json.Marshal(r.Action)
+	if err != nil {
+		return 0, err
+	}
+
+	cooldown := int64(r.Cooldown / time.Second)
+
+	if r.ID == 0 {
+		var id int64
+		err := db.QueryRow(`insert into rules (useremail, name, coreid, conditions, quiet, schedule, action, cooldown, enabled, dry_run)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id;`,
+			r.UserEmail, r.Name, r.CoreID, string(conditions), string(quiet), schedule, string(action),
+			cooldown, r.Enabled, r.DryRun).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec(`update rules set name = $3, coreid = $4, conditions = $5, quiet = $6, schedule = $7,
+		action = $8, cooldown = $9, enabled = $10, dry_run = $11
+		where useremail = $1 and id = $2`,
+		r.UserEmail, r.ID, r.Name, r.CoreID, string(conditions), string(quiet), schedule, string(action),
+		cooldown, r.Enabled, r.DryRun)
+
+	return r.ID, expectRow(result, err, models.ErrorRuleDoesntExist)
+}
+
+// DeleteRule deletes one of the user's rules along with its executions.
+func (db DB) DeleteRule(userEmail string, id int64) error {
+	result, err := db.Exec("delete from rules where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorRuleDoesntExist)
+}
+
+// GetExecutions retrieves the executions of the user's rule, most recent
+// first.
+func (db DB) GetExecutions(userEmail string, ruleID int64) ([]models.Execution, error) {
+	var executions []models.Execution
+
+	rows, err := db.Query(`select id, rule_id, useremail, coreid, triggered, reading, result, detail, coalesce(command_id, 0)
+		from rule_executions where useremail = $1 and rule_id = $2 order by triggered desc, id desc`, userEmail, ruleID)
+	if err != nil {
+		return executions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.Execution
+		err := rows.Scan(&e.ID, &e.RuleID, &e.UserEmail, &e.CoreID, &e.Triggered, &e.Reading, &e.Result, &e.Detail, &e.CommandID)
+		if err != nil {
+			return executions, err
+		}
+		executions = append(executions, e)
+	}
+
+	return executions, rows.Err()
+}
+
+// ClaimFiring records now as the rule's last firing unless it last fired
+// within its cooldown, in a single update so only one claim succeeds.
+func (db DB) ClaimFiring(userEmail string, id int64, now time.Time) (bool, error) {
+	result, err := db.Exec(`update rules set last_fired = $3 where useremail = $1 and id = $2
+		and (last_fired is null or last_fired <= $3 - cooldown * interval '1 second')`, userEmail, id, now)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// StoreExecution inserts the execution.  A failed execution releases its
+// claim on the rule, restoring its last firing to its latest execution that
+// didn't fail.
+func (db DB) StoreExecution(e models.Execution) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	err = tx.QueryRow("select 1 from rules where useremail = $1 and id = $2", e.UserEmail, e.RuleID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		err = models.ErrorRuleDoesntExist
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`insert into rule_executions (rule_id, useremail, coreid, triggered, reading, result, detail, command_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		e.RuleID, e.UserEmail, e.CoreID, e.Triggered, e.Reading, e.Result, e.Detail,
+		sql.NullInt64{Int64: e.CommandID, Valid: e.CommandID != 0})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if e.Result == models.ExecutionFailed {
+		_, err = tx.Exec(`update rules set last_fired = (select max(triggered) from rule_executions
+			where rule_id = $1 and result <> $3) where id = $1 and last_fired = $2`, e.RuleID, e.Triggered, models.ExecutionFailed)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db DB) queryRules(query string, args ...interface{}) ([]models.Rule, error) {
+	var rules []models.Rule
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.Rule
+		var conditions, quiet, action string
+		var schedule sql.NullString
+		var cooldown int64
+		var lastFired pq.NullTime
+
+		err := rows.Scan(&r.ID, &r.UserEmail, &r.Name, &r.CoreID, &conditions, &quiet, &schedule, &action,
+			&cooldown, &r.Enabled, &r.DryRun, &lastFired)
+		if err != nil {
+			return rules, err
+		}
+
+		if err := json.Unmarshal([]byte(conditions), &r.Conditions); err != nil {
+			return rules, err
+		}
+
+		if err := json.Unmarshal([]byte(quiet), &r.Quiet); err != nil {
+			return rules, err
+		}
+
+		if schedule.Valid {
+			r.Schedule = new(models.RuleSchedule)
+			if err := json.Unmarshal([]byte(schedule.String), r.Schedule); err != nil {
+				return rules, err
+			}
+		}
+
+		if err := json.Unmarshal([]byte(action), &r.Action); err != nil {
+			return rules, err
+		}
+
+		r.Cooldown = time.Duration(cooldown) * time.Second
+		if lastFired.Valid {
+			r.LastFired = &lastFired.Time
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
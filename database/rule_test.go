@@ -0,0 +1,128 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRules(t *testing.T) {
+	userEmail := "freyr@vanaheim.unv"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := models.Rule{
+		UserEmail:  userEmail,
+		Name:       "water when dry",
+		CoreID:     "core",
+		Conditions: []models.Condition{{Metric: "moisture", Compare: models.Below, Value: 30}},
+		Quiet:      []models.QuietPeriod{{Kind: models.EventWatering, Period: time.Hour * 6}},
+		Schedule:   &models.RuleSchedule{From: "06:00", Until: "20:00", TimeZone: "America/Chicago"},
+		Action:     models.RuleAction{Kind: models.ActionCommand, Command: "water", Argument: "20s", TTL: time.Minute},
+		Cooldown:   time.Minute * 30,
+		Enabled:    true,
+	}
+
+	rule.ID, err = db.StoreRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := rule
+	disabled.ID, disabled.Enabled, disabled.Schedule = 0, false, nil
+	if disabled.ID, err = db.StoreRule(disabled); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := db.GetRules(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 2 || !reflect.DeepEqual(rules[0], rule) || rules[1].Schedule != nil {
+		t.Fatalf("Expected %v stored, got %v", rule, rules)
+	}
+
+	rules, err = db.GetCoreRules(userEmail, "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 1 || rules[0].ID != rule.ID {
+		t.Fatalf("Expected only the enabled rule for the core, got %v", rules)
+	}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	command, err := db.StoreCommand(models.NewCommand(userEmail, "core", "water", "20s", 0, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []bool{true, false} {
+		if claimed, err := db.ClaimFiring(userEmail, rule.ID, now); err != nil || claimed != expected {
+			t.Fatalf("Claim %d: expected %t, got %t (%v)", i, expected, claimed, err)
+		}
+	}
+
+	err = db.StoreExecution(models.Execution{RuleID: rule.ID, UserEmail: userEmail, CoreID: "core",
+		Triggered: now, Reading: now, Result: models.ExecutionFired, CommandID: command})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed execution releases its claim after the cooldown
+	later := now.Add(rule.Cooldown)
+	if claimed, err := db.ClaimFiring(userEmail, rule.ID, later); err != nil || !claimed {
+		t.Fatalf("Expected claim after the cooldown, got %t (%v)", claimed, err)
+	}
+
+	err = db.StoreExecution(models.Execution{RuleID: rule.ID, UserEmail: userEmail, CoreID: "core",
+		Triggered: later, Reading: later, Result: models.ExecutionFailed, Detail: "offline"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.StoreExecution(models.Execution{RuleID: rule.ID + 100, UserEmail: userEmail, CoreID: "core",
+		Triggered: now, Reading: now, Result: models.ExecutionFired})
+	if err != models.ErrorRuleDoesntExist {
+		t.Fatalf("Expected ErrorRuleDoesntExist, got %v", err)
+	}
+
+	executions, err := db.GetExecutions(userEmail, rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executions) != 2 || executions[1].CommandID != command || !executions[1].Triggered.Equal(now) {
+		t.Fatalf("Unexpected executions %v", executions)
+	}
+
+	// updating keeps the last firing
+	rule.Name = "water when very dry"
+	if _, err := db.StoreRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err = db.GetCoreRules(userEmail, "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 1 || rules[0].Name != rule.Name || rules[0].LastFired == nil || !rules[0].LastFired.Equal(now) {
+		t.Fatalf("Expected updated rule last fired at %s, got %v", now, rules)
+	}
+
+	if err := db.DeleteRule(userEmail, rule.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteRule(userEmail, rule.ID); err != models.ErrorRuleDoesntExist {
+		t.Fatalf("Expected ErrorRuleDoesntExist, got %v", err)
+	}
+}
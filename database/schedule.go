@@ -0,0 +1,78 @@
+package database
+
+import (
+	"github.com/lib/pq"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// GetTaskStates retrieves the state of every scheduled task that has been
+// scheduled.
+func (db DB) GetTaskStates() ([]models.TaskState, error) {
+	var states []models.TaskState
+
+	rows, err := db.Query(`select name, last_run, last_error, next_run, locked_by, locked_until
+		from scheduled_tasks order by name`)
+	if err != nil {
+		return states, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state models.TaskState
+		var lastRun, lockedUntil pq.NullTime
+
+		err := rows.Scan(&state.Name, &lastRun, &state.LastError, &state.NextRun, &state.LockedBy, &lockedUntil)
+		if err != nil {
+			return states, err
+		}
+
+		state.LastRun = lastRun.Time
+		state.LockedUntil = lockedUntil.Time
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// ScheduleTask records the task's first run, if it hasn't been scheduled
+// already.
+func (db DB) ScheduleTask(name string, next time.Time) error {
+	_, err := db.Exec(`insert into scheduled_tasks (name, next_run) values ($1, $2)
+		on conflict (name) do nothing;`, name, next)
+
+	return err
+}
+
+// ClaimTask locks the task for owner for the lease if it is due to run as
+// of now, or regardless of when it is due if force is true.  It returns
+// false if the task isn't due or is locked by another run.  Leases are
+// taken and compared by the database's clock, so instances' clocks needn't
+// agree, and the update is atomic so only one of any concurrent claims
+// succeeds.
+func (db DB) ClaimTask(name, owner string, now time.Time, lease time.Duration, force bool) (bool, error) {
+	result, err := db.Exec(`update scheduled_tasks set locked_by = $2, locked_until = now() + $4 * interval '1 second'
+		where name = $1 and ($5 or next_run <= $3)
+		and (locked_until is null or locked_until <= now());`, name, owner, now, lease.Seconds(), force)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// CompleteTask records the outcome of the owner's run of the task and
+// releases its lock.
+func (db DB) CompleteTask(name, owner string, ran time.Time, runErr error, next time.Time) error {
+	var lastError string
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+
+	_, err := db.Exec(`update scheduled_tasks set last_run = $3, last_error = $4, next_run = $5,
+		locked_by = '', locked_until = null
+		where name = $1 and locked_by = $2;`, name, owner, ran, lastError, next)
+
+	return err
+}
@@ -0,0 +1,66 @@
+// +build integration
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduledTasks(t *testing.T) {
+	now := time.Date(2016, 5, 10, 0, 30, 0, 0, time.UTC)
+	next := now.Add(time.Minute * 30)
+
+	for i := 0; i < 2; i++ {
+		if err := db.ScheduleTask("retention", next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claimed, err := db.ClaimTask("retention", "one", now, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed {
+		t.Fatal("Task claimed before it was due")
+	}
+
+	claimed, err = db.ClaimTask("retention", "one", next, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !claimed {
+		t.Fatal("Due task not claimed")
+	}
+
+	claimed, err = db.ClaimTask("retention", "two", next, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed {
+		t.Fatal("Locked task claimed by another owner")
+	}
+
+	err = db.CompleteTask("retention", "one", next, errors.New("Oops"), next.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := db.GetTaskStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 {
+		t.Fatalf("Expected 1 task state, got %d", len(states))
+	}
+
+	state := states[0]
+	if !state.LastRun.Equal(next) || state.LastError != "Oops" || !state.NextRun.Equal(next.Add(time.Hour)) || state.Locked(next) {
+		t.Fatalf("Unexpected task state %v", state)
+	}
+}
@@ -11,7 +11,7 @@ func (db DB) GetSecret(userEmail string) (secret models.Secret, err error) {
 
 	secret = models.Secret([]byte{})
 
-	err = db.QueryRow("select secret from users where email = $1;", userEmail).Scan(&secretString)
+	err = db.queryRow("select secret from users where email = $1;", userEmail).Scan(&secretString)
 	if err == sql.ErrNoRows || secretString == "" {
 		err = models.ErrorSecretDoesntExist
 		return
@@ -23,7 +23,7 @@ func (db DB) GetSecret(userEmail string) (secret models.Secret, err error) {
 
 // StoreSecret updates the specified user's secret in the database
 func (db DB) StoreSecret(userEmail string, secret models.Secret) error {
-	_, err := db.Exec("update users set secret = $1 where email = $2;", secret.Encode(), userEmail)
+	_, err := db.exec("update users set secret = $1 where email = $2;", secret.Encode(), userEmail)
 
 	return err
 }
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrorNoSQLiteDriver is returned by SQLiteConn when Freyr was built without
+// the SQLite driver, which requires cgo and the sqlite build tag.
+var ErrorNoSQLiteDriver = errors.New("SQLite driver not built in; build with -tags sqlite")
+
+// sqliteSchema creates the tables of the stores SQLite backs, mirroring their
+// Postgres definitions in postgres/create_tables.sql.
+const sqliteSchema = `
+create table if not exists users (
+	email text primary key,
+	full_name text,
+	family_name text,
+	given_name text,
+	gender text,
+	locale text,
+	secret text
+);
+
+create table if not exists readings (
+	useremail text references users(email),
+	posted timestamp,
+	coreid text,
+	temperature real,
+	humidity real,
+	moisture real,
+	light real,
+	battery real,
+	primary key (useremail, coreid, posted)
+);
+
+-- autoincrement so undone deletions' ids aren't reused
+create table if not exists reading_deletions (
+	id integer primary key autoincrement,
+	useremail text references users(email),
+	coreid text not null,
+	start_time timestamp not null,
+	end_time timestamp not null,
+	count integer not null,
+	deleted timestamp not null
+);
+
+create table if not exists deleted_readings (
+	deletion_id integer references reading_deletions(id) on delete cascade,
+	useremail text,
+	posted timestamp,
+	coreid text,
+	temperature real,
+	humidity real,
+	moisture real,
+	light real,
+	battery real
+);
+
+create index if not exists deleted_readings_deletion on deleted_readings (deletion_id);
+
+insert or ignore into users (email, full_name, family_name, given_name, gender, locale, secret) values
+('noone@nothing.com', 'demo user', 'user', 'demo', 'androgenous', 'en', '');`
+
+// SQLiteConn returns a new DB storing readings, users and secrets in the
+// SQLite database at path, which is created if it doesn't exist.  Other
+// stores require Postgres.
+func SQLiteConn(path string) (DB, error) {
+	if !sqliteRegistered() {
+		return DB{nil, sqlite}, ErrorNoSQLiteDriver
+	}
+
+	db, err := sql.Open(SQLite, path+"?_foreign_keys=1")
+	if err != nil {
+		return DB{nil, sqlite}, err
+	}
+
+	// SQLite allows one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return DB{nil, sqlite}, err
+	}
+
+	return DB{db, sqlite}, nil
+}
+
+func sqliteRegistered() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == SQLite {
+			return true
+		}
+	}
+
+	return false
+}
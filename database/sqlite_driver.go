@@ -0,0 +1,6 @@
+// +build sqlite
+
+package database
+
+// The SQLite driver requires cgo, so is only built in when asked for.
+import _ "github.com/mattn/go-sqlite3"
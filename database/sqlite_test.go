@@ -0,0 +1,91 @@
+// +build sqlite
+
+package database
+
+import (
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/routes"
+	"github.com/serdmanczyk/freyr/storetest"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openSQLite opens a new SQLite database, returning it and a function
+// closing and removing it.
+func openSQLite(t *testing.T) (DB, func()) {
+	dir, err := ioutil.TempDir("", "freyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := SQLiteConn(filepath.Join(dir, "freyr.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Error opening SQLite database: %s", err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSQLiteStores(t *testing.T) {
+	db, cleanup := openSQLite(t)
+	defer cleanup()
+
+	storetest.Test(t, func() storetest.Stores {
+		return storetest.Stores{Readings: db, Users: db, Secrets: db, Accounts: db}
+	})
+}
+
+func TestSQLiteRoutes(t *testing.T) {
+	db, cleanup := openSQLite(t)
+	defer cleanup()
+
+	userEmail := "thor@asgard.unv"
+	core := "mjolnir"
+	posted := time.Date(2016, time.May, 10, 8, 0, 0, 0, time.UTC)
+
+	if err := db.StoreUser(models.User{Email: userEmail}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.StoreReading(fake.RandReading(userEmail, core, posted)); err != nil {
+		t.Fatal(err)
+	}
+
+	unsupported := Unsupported{}
+	ctx := context.WithValue(context.Background(), "email", userEmail)
+	for path, handler := range map[string]apollo.Handler{
+		"/latest": routes.GetLatestReadings(db, unsupported, unsupported, unsupported),
+		"/readings?core=" + core + "&start=2016-05-10T00:00:00Z&end=2016-05-11T00:00:00Z": routes.GetReadings(db, unsupported, unsupported, unsupported, unsupported),
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(ctx, resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected %d, got %d: %s", path, http.StatusOK, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestSQLiteRebind(t *testing.T) {
+	query := sqlite.rebind("select * from readings where coreid = $1 and posted between $2 and $10")
+	expected := "select * from readings where coreid = ?1 and posted between ?2 and ?10"
+	if query != expected {
+		t.Fatalf("Query not rebound; got %s expected %s", query, expected)
+	}
+}
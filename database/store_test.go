@@ -0,0 +1,14 @@
+// +build integration
+
+package database
+
+import (
+	"github.com/serdmanczyk/freyr/storetest"
+	"testing"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Test(t, func() storetest.Stores {
+		return storetest.Stores{Readings: db, Users: db, Secrets: db, Accounts: db}
+	})
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"errors"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// ErrorUnsupported is returned by Unsupported when data is stored that
+// requires Postgres.
+var ErrorUnsupported = errors.New("Not supported when storing readings in SQLite; requires Postgres")
+
+// Unsupported stands in for the calibration, preference, device, event,
+// plant and retention stores when readings are stored in SQLite, so routes
+// reading readings work without them.  It holds no calibrations, devices,
+// events, plants or rollups, gives every user the default preferences and
+// retention policy, and refuses to store anything.
+type Unsupported struct{}
+
+// GetCalibrations returns no calibrations.
+func (Unsupported) GetCalibrations(userEmail string) (models.Calibrations, error) {
+	return nil, nil
+}
+
+// StoreCalibration returns ErrorUnsupported.
+func (Unsupported) StoreCalibration(calibration models.Calibration) (int64, error) {
+	return 0, ErrorUnsupported
+}
+
+// DeleteCalibration returns ErrorUnsupported.
+func (Unsupported) DeleteCalibration(userEmail string, id int64) error {
+	return ErrorUnsupported
+}
+
+// GetPreferences returns the default preferences.
+func (Unsupported) GetPreferences(userEmail string) (models.Preferences, error) {
+	return models.Preferences{}, nil
+}
+
+// StorePreferences returns ErrorUnsupported.
+func (Unsupported) StorePreferences(userEmail string, preferences models.Preferences) error {
+	return ErrorUnsupported
+}
+
+// SeeDevice records nothing.
+func (Unsupported) SeeDevice(userEmail, core string, seen time.Time) error {
+	return nil
+}
+
+// GetDevices returns no devices.
+func (Unsupported) GetDevices(userEmail string) ([]models.Device, error) {
+	return nil, nil
+}
+
+// GetAllDevices returns no devices.
+func (Unsupported) GetAllDevices() ([]models.Device, error) {
+	return nil, nil
+}
+
+// SetReportingInterval returns ErrorUnsupported.
+func (Unsupported) SetReportingInterval(userEmail, core string, interval time.Duration) error {
+	return ErrorUnsupported
+}
+
+// SetDeviceStatus returns ErrorUnsupported.
+func (Unsupported) SetDeviceStatus(userEmail, core, status string, changed time.Time) error {
+	return ErrorUnsupported
+}
+
+// GetEvents returns no events.
+func (Unsupported) GetEvents(userEmail string, start, end time.Time) ([]models.Event, error) {
+	return nil, nil
+}
+
+// StoreEvent returns ErrorUnsupported.
+func (Unsupported) StoreEvent(event models.Event) (int64, error) {
+	return 0, ErrorUnsupported
+}
+
+// DeleteEvent returns ErrorUnsupported.
+func (Unsupported) DeleteEvent(userEmail string, id int64) error {
+	return ErrorUnsupported
+}
+
+// GetZones returns no zones.
+func (Unsupported) GetZones(userEmail string) ([]models.Zone, error) {
+	return nil, nil
+}
+
+// StoreZone returns ErrorUnsupported.
+func (Unsupported) StoreZone(zone models.Zone) (int64, error) {
+	return 0, ErrorUnsupported
+}
+
+// DeleteZone returns ErrorUnsupported.
+func (Unsupported) DeleteZone(userEmail string, id int64) error {
+	return ErrorUnsupported
+}
+
+// GetPlants returns no plants.
+func (Unsupported) GetPlants(userEmail string) ([]models.Plant, error) {
+	return nil, nil
+}
+
+// StorePlant returns ErrorUnsupported.
+func (Unsupported) StorePlant(plant models.Plant) (int64, error) {
+	return 0, ErrorUnsupported
+}
+
+// DeletePlant returns ErrorUnsupported.
+func (Unsupported) DeletePlant(userEmail string, id int64) error {
+	return ErrorUnsupported
+}
+
+// GetAssignments returns no assignments.
+func (Unsupported) GetAssignments(userEmail string, plantID int64) ([]models.Assignment, error) {
+	return nil, nil
+}
+
+// StoreAssignment returns ErrorUnsupported.
+func (Unsupported) StoreAssignment(assignment models.Assignment) (int64, error) {
+	return 0, ErrorUnsupported
+}
+
+// DeleteAssignment returns ErrorUnsupported.
+func (Unsupported) DeleteAssignment(userEmail string, id int64) error {
+	return ErrorUnsupported
+}
+
+// GetRetentionPolicy returns the default policy, keeping everything.
+func (Unsupported) GetRetentionPolicy(userEmail string) (models.RetentionPolicy, error) {
+	return models.RetentionPolicy{}, nil
+}
+
+// StoreRetentionPolicy returns ErrorUnsupported.
+func (Unsupported) StoreRetentionPolicy(userEmail string, policy models.RetentionPolicy) error {
+	return ErrorUnsupported
+}
+
+// GetRetentionPolicies returns no policies.
+func (Unsupported) GetRetentionPolicies() (map[string]models.RetentionPolicy, error) {
+	return nil, nil
+}
+
+// RollupReadings returns ErrorUnsupported.
+func (Unsupported) RollupReadings(userEmail string, rolledUp map[string][]time.Time, hourly, daily []models.Aggregate) error {
+	return ErrorUnsupported
+}
+
+// DeleteRollups returns ErrorUnsupported.
+func (Unsupported) DeleteRollups(userEmail, interval string, before time.Time) error {
+	return ErrorUnsupported
+}
+
+// GetRollups returns no rollups.
+func (Unsupported) GetRollups(userEmail, core string, start, end time.Time) ([]models.Aggregate, error) {
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+const subscriptionQuery = `select s.id, s.useremail, s.url, s.events, s.coreid, s.created, d.last_attempt, coalesce(d.status_code, 0)
+	from webhook_subscriptions s left join lateral (
+		select last_attempt, status_code from webhook_deliveries
+		where subscription_id = s.id and last_attempt is not null
+		order by last_attempt desc limit 1) d on true`
+
+const deliveryColumns = "id, subscription_id, url, useremail, event, payload, state, attempts, status_code, error, created, last_attempt, next_attempt"
+
+// GetSubscriptions retrieves the user's webhook subscriptions with their
+// most recent delivery attempt.
+func (db DB) GetSubscriptions(userEmail string) ([]models.Subscription, error) {
+	return db.querySubscriptions(subscriptionQuery+" where s.useremail = $1 order by s.id", userEmail)
+}
+
+// GetEventSubscriptions retrieves the user's webhook subscriptions to the
+// event.
+func (db DB) GetEventSubscriptions(userEmail, event string) ([]models.Subscription, error) {
+	return db.querySubscriptions(subscriptionQuery+" where s.useremail = $1 and s.events ? $2 order by s.id", userEmail, event)
+}
+
+// StoreSubscription inserts a new webhook subscription, returning its ID,
+// or updates the user's subscription with the subscription's ID.
+func (db DB) StoreSubscription(s models.Subscription) (int64, error) {
+	events, err := json.Marshal(s.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.ID == 0 {
+		var id int64
+		err := db.QueryRow(`insert into webhook_subscriptions (useremail, url, events, coreid, created)
+			values ($1, $2, $3, $4, $5) returning id;`,
+			s.UserEmail, s.URL, string(events), s.CoreID, s.Created).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec("update webhook_subscriptions set url = $3, events = $4, coreid = $5 where useremail = $1 and id = $2",
+		s.UserEmail, s.ID, s.URL, string(events), s.CoreID)
+	return s.ID, expectRow(result, err, models.ErrorSubscriptionDoesntExist)
+}
+
+// DeleteSubscription deletes one of the user's webhook subscriptions along
+// with its deliveries.
+func (db DB) DeleteSubscription(userEmail string, id int64) error {
+	result, err := db.Exec("delete from webhook_subscriptions where useremail = $1 and id = $2", userEmail, id)
+	return expectRow(result, err, models.ErrorSubscriptionDoesntExist)
+}
+
+// GetDeliveries retrieves the deliveries to the user's subscription, most
+// recent first.
+func (db DB) GetDeliveries(userEmail string, subscriptionID int64) ([]models.Delivery, error) {
+	return db.queryDeliveries("select "+deliveryColumns+` from webhook_deliveries
+		where useremail = $1 and subscription_id = $2 order by created desc, id desc`, userEmail, subscriptionID)
+}
+
+// GetDelivery retrieves the delivery with the given ID.
+func (db DB) GetDelivery(id int64) (models.Delivery, error) {
+	deliveries, err := db.queryDeliveries("select "+deliveryColumns+" from webhook_deliveries where id = $1", id)
+	if err != nil {
+		return models.Delivery{}, err
+	}
+
+	if len(deliveries) == 0 {
+		return models.Delivery{}, models.ErrorDeliveryDoesntExist
+	}
+
+	return deliveries[0], nil
+}
+
+// GetDueDeliveries retrieves pending deliveries whose next attempt is due.
+func (db DB) GetDueDeliveries(now time.Time) ([]models.Delivery, error) {
+	return db.queryDeliveries("select "+deliveryColumns+` from webhook_deliveries
+		where state = $1 and next_attempt <= $2 order by next_attempt`, models.DeliveryPending, now)
+}
+
+// StoreDelivery inserts a new delivery, returning its ID.  Deliveries
+// without a subscription store a null subscription_id.
+func (db DB) StoreDelivery(d models.Delivery) (int64, error) {
+	var id int64
+	err := db.QueryRow(`insert into webhook_deliveries (subscription_id, url, useremail, event, payload, state, created, next_attempt)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id;`,
+		sql.NullInt64{Int64: d.SubscriptionID, Valid: d.SubscriptionID != 0}, d.URL, d.UserEmail, d.Event,
+		string(d.Payload), d.State, d.Created, d.NextAttempt).Scan(&id)
+
+	return id, err
+}
+
+// ClaimDelivery pushes the pending delivery's next attempt back to until if
+// it is due, returning whether it was.
+func (db DB) ClaimDelivery(id int64, now, until time.Time) (bool, error) {
+	result, err := db.Exec(`update webhook_deliveries set next_attempt = $4
+		where id = $1 and state = $2 and next_attempt <= $3`, id, models.DeliveryPending, now, until)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// UpdateDelivery records the outcome of a delivery attempt.
+func (db DB) UpdateDelivery(d models.Delivery) error {
+	var lastAttempt pq.NullTime
+	if d.LastAttempt != nil {
+		lastAttempt = pq.NullTime{Time: *d.LastAttempt, Valid: true}
+	}
+
+	result, err := db.Exec(`update webhook_deliveries set state = $2, attempts = $3, status_code = $4, error = $5,
+		last_attempt = $6, next_attempt = $7 where id = $1`,
+		d.ID, d.State, d.Attempts, d.StatusCode, d.Error, lastAttempt, d.NextAttempt)
+	return expectRow(result, err, models.ErrorDeliveryDoesntExist)
+}
+
+func (db DB) querySubscriptions(query string, args ...interface{}) ([]models.Subscription, error) {
+	var subscriptions []models.Subscription
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return subscriptions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Subscription
+		var events string
+		var lastAttempt pq.NullTime
+
+		err := rows.Scan(&s.ID, &s.UserEmail, &s.URL, &events, &s.CoreID, &s.Created, &lastAttempt, &s.LastStatusCode)
+		if err != nil {
+			return subscriptions, err
+		}
+
+		if err := json.Unmarshal([]byte(events), &s.Events); err != nil {
+			return subscriptions, err
+		}
+
+		if lastAttempt.Valid {
+			s.LastAttempt = &lastAttempt.Time
+		}
+
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (db DB) queryDeliveries(query string, args ...interface{}) ([]models.Delivery, error) {
+	var deliveries []models.Delivery
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.Delivery
+		var subscriptionID sql.NullInt64
+		var payload string
+		var lastAttempt pq.NullTime
+
+		err := rows.Scan(&d.ID, &subscriptionID, &d.URL, &d.UserEmail, &d.Event, &payload, &d.State, &d.Attempts,
+			&d.StatusCode, &d.Error, &d.Created, &lastAttempt, &d.NextAttempt)
+		if err != nil {
+			return deliveries, err
+		}
+
+		d.SubscriptionID = subscriptionID.Int64
+		d.Payload = []byte(payload)
+		if lastAttempt.Valid {
+			d.LastAttempt = &lastAttempt.Time
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
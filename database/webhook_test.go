@@ -0,0 +1,118 @@
+// +build integration
+
+package database
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	userEmail := "freyr@vanaheim.unv"
+
+	err := db.StoreUser(models.User{Email: userEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	subscription := models.Subscription{UserEmail: userEmail, URL: "https://example.com/hook",
+		Events: []string{models.WebhookReading, models.WebhookAlert}, CoreID: "core", Created: now}
+
+	subscription.ID, err = db.StoreSubscription(subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriptions, err := db.GetEventSubscriptions(userEmail, models.WebhookAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subscriptions) != 1 || subscriptions[0].URL != subscription.URL || subscriptions[0].CoreID != "core" {
+		t.Fatalf("Expected %v stored, got %v", subscription, subscriptions)
+	}
+
+	subscriptions, err = db.GetEventSubscriptions(userEmail, models.WebhookDeviceOffline)
+	if err != nil || len(subscriptions) != 0 {
+		t.Fatalf("Expected no offline subscriptions, got %v (%v)", subscriptions, err)
+	}
+
+	payload := json.RawMessage(`{"event": "alert",  "data": {}}`)
+	d := models.Delivery{SubscriptionID: subscription.ID, UserEmail: userEmail, Event: models.WebhookAlert,
+		Payload: payload, State: models.DeliveryPending, Created: now, NextAttempt: now}
+
+	d.ID, err = db.StoreDelivery(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := db.GetDueDeliveries(now)
+	if err != nil || len(due) != 1 || due[0].ID != d.ID {
+		t.Fatalf("Expected delivery due, got %v (%v)", due, err)
+	}
+
+	claimed, err := db.ClaimDelivery(d.ID, now, now.Add(time.Minute))
+	if err != nil || !claimed {
+		t.Fatalf("Expected delivery claimed, got %t (%v)", claimed, err)
+	}
+
+	claimed, err = db.ClaimDelivery(d.ID, now, now.Add(time.Minute))
+	if err != nil || claimed {
+		t.Fatalf("Expected claimed delivery not claimed twice, got %t (%v)", claimed, err)
+	}
+
+	d, err = db.GetDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(d.Payload) != string(payload) {
+		t.Fatalf("Expected payload %s kept exactly, got %s", payload, d.Payload)
+	}
+
+	d.Attempted(now, 502, nil)
+	if err := db.UpdateDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := db.GetDeliveries(userEmail, subscription.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].StatusCode != 502 || !deliveries[0].NextAttempt.Equal(d.NextAttempt) {
+		t.Fatalf("Expected attempt recorded, got %v", deliveries)
+	}
+
+	subscriptions, err = db.GetSubscriptions(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subscriptions) != 1 || subscriptions[0].LastStatusCode != 502 || !subscriptions[0].LastAttempt.Equal(now) {
+		t.Fatalf("Expected last attempt on subscription, got %v", subscriptions)
+	}
+
+	if err := db.DeleteSubscription(userEmail, subscription.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteSubscription(userEmail, subscription.ID); err != models.ErrorSubscriptionDoesntExist {
+		t.Fatalf("Expected ErrorSubscriptionDoesntExist, got %v", err)
+	}
+
+	// rules' webhook actions are delivered without a subscription
+	id, err := db.StoreDelivery(models.Delivery{URL: "https://example.com/rule", UserEmail: userEmail, Event: models.WebhookAlert,
+		Payload: payload, State: models.DeliveryPending, Created: now, NextAttempt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = db.GetDelivery(id)
+	if err != nil || d.SubscriptionID != 0 || d.URL != "https://example.com/rule" {
+		t.Fatalf("Expected delivery to the rule's URL, got %v (%v)", d, err)
+	}
+}
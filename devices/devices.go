@@ -0,0 +1,115 @@
+// Package devices tracks when users' devices last posted readings and
+// detects devices that have stopped reporting.
+package devices
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"log"
+	"time"
+)
+
+// ReadingStore wraps a models.ReadingStore, recording the reading's core as
+// seen whenever the device posts a reading, including duplicate, conflicting
+// or quarantined readings.
+type ReadingStore struct {
+	models.ReadingStore
+	devices models.DeviceStore
+	now     func() time.Time
+}
+
+// NewReadingStore returns a new *ReadingStore
+func NewReadingStore(rs models.ReadingStore, ds models.DeviceStore) *ReadingStore {
+	return &ReadingStore{ReadingStore: rs, devices: ds, now: time.Now}
+}
+
+// StoreReading stores the reading then records its core as seen when the
+// reading was received, rather than at the time the device posted it, so
+// devices with fast clocks or backfilling old readings are seen as they
+// report.
+func (s *ReadingStore) StoreReading(reading models.Reading) error {
+	err := s.ReadingStore.StoreReading(reading)
+	if _, conflict := err.(models.ReadingConflictError); err != nil && !conflict &&
+		err != models.ErrorReadingExists && err != models.ErrorReadingQuarantined {
+		return err
+	}
+
+	if seenErr := s.devices.SeeDevice(reading.UserEmail, reading.CoreID, s.now()); seenErr != nil {
+		log.Printf("Error recording core %s as seen: %s", reading.CoreID, seenErr)
+	}
+
+	return err
+}
+
+// Notifier is an interface for types that raise notifications when a
+// device's status changes.
+type Notifier interface {
+	DeviceStatusChanged(device models.Device, previous string) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(device models.Device, previous string) error
+
+// DeviceStatusChanged calls f.
+func (f NotifierFunc) DeviceStatusChanged(device models.Device, previous string) error {
+	return f(device, previous)
+}
+
+// Notifiers is a Notifier notifying each of its Notifiers in turn.
+type Notifiers []Notifier
+
+// DeviceStatusChanged notifies every Notifier, returning the last error.
+func (n Notifiers) DeviceStatusChanged(device models.Device, previous string) (err error) {
+	for _, notifier := range n {
+		if notifyErr := notifier.DeviceStatusChanged(device, previous); notifyErr != nil {
+			err = notifyErr
+		}
+	}
+
+	return
+}
+
+// LogNotifier is a Notifier that logs status changes.
+var LogNotifier = NotifierFunc(func(device models.Device, previous string) error {
+	log.Printf("Core %s of %s is %s (was %s), last seen %s", device.CoreID, device.UserEmail,
+		device.Status, previous, device.LastSeen.Format(time.RFC3339))
+	return nil
+})
+
+// Check determines the status of every device as of now, recording and
+// notifying n of any that changed.  Failures for one device don't prevent
+// checking the others.
+func Check(s models.DeviceStore, n Notifier, now time.Time) error {
+	devices, err := s.GetAllDevices()
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, device := range devices {
+		status := device.StatusAt(now)
+		if status == device.Status {
+			continue
+		}
+
+		previous := device.Status
+		device.Status, device.StatusChanged = status, now
+
+		if err := s.SetDeviceStatus(device.UserEmail, device.CoreID, status, now); err != nil {
+			log.Printf("Error updating status of core %s: %s", device.CoreID, err)
+			failed++
+			continue
+		}
+
+		if err := n.DeviceStatusChanged(device, previous); err != nil {
+			log.Printf("Error notifying status of core %s: %s", device.CoreID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed checking %d of %d devices", failed, len(devices))
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package devices
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestStoreReadingSeesDevice(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fD := &fake.DeviceStore{}
+	s := NewReadingStore(&fake.ReadingStore{}, fD)
+
+	// readings posted by a device whose clock runs a day fast
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	received := start.AddDate(0, 0, -1)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Minute*10)
+	first, second := readingGen(), readingGen()
+
+	for _, r := range []models.Reading{second, first, second} {
+		received = received.Add(time.Minute)
+		s.now = func() time.Time { return received }
+
+		err := s.StoreReading(r)
+		if err != nil && err != models.ErrorReadingExists {
+			t.Fatal(err)
+		}
+	}
+
+	devices, err := fD.GetDevices(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 1 || !devices[0].LastSeen.Equal(received) {
+		t.Fatalf("Expected core last seen when last received at %s, got %v", received, devices)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	seen := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	fD := &fake.DeviceStore{}
+	for _, core := range []string{"one", "two"} {
+		if err := fD.SeeDevice(userEmail, core, seen); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fD.SetReportingInterval(userEmail, "two", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var notified []models.Device
+	notifier := NotifierFunc(func(device models.Device, previous string) error {
+		if previous != models.DeviceOnline {
+			t.Errorf("Expected core %s to have been online, was %s", device.CoreID, previous)
+		}
+		notified = append(notified, device)
+		return nil
+	})
+
+	now := seen.Add(time.Hour * 2)
+	for i := 0; i < 2; i++ {
+		if err := Check(fD, notifier, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(notified) != 1 || notified[0].CoreID != "one" || notified[0].Status != models.DeviceOffline {
+		t.Fatalf("Expected a single notification of core one offline, got %v", notified)
+	}
+
+	devices, err := fD.GetDevices(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, device := range devices {
+		if device.Status != device.StatusAt(now) {
+			t.Errorf("Core %s status %s not updated to %s", device.CoreID, device.Status, device.StatusAt(now))
+		}
+	}
+}
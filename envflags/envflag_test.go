@@ -34,5 +34,21 @@ func TestFlags(t *testing.T) {
 	}
 }
 
+func TestOptionalConfig(t *testing.T) {
+	c := struct {
+		Required string `flag:"required" env:"TEST_REQUIRED"`
+		Optional string `flag:"optional" env:"TEST_OPTIONAL" optional:"true"`
+	}{Required: "required"}
+
+	if ConfigEmpty(&c) {
+		t.Errorf("Config shouldn't be empty, only an optional flag is not set")
+	}
+
+	c.Required = ""
+	if !ConfigEmpty(&c) {
+		t.Errorf("Config should be empty, required flag is not set")
+	}
+}
+
 // Could run more tests but need to figure out how to reset 'flag' package.
 // Not currently a priority.
@@ -3,11 +3,12 @@
 // on the struct fields, both the cli flag option name and environment
 // variable name can be specified it can be specified.  Environment
 // variable values will be defaults, with cli options taking preference
-// if specified.
+// if specified.  Fields tagged optional aren't required to be set.
 //
 // example struct:
 //    type config struct {
 //        StructField string `flag:"struct_field" env:"APP_STRUCTFIELD"`
+//        OptionalField string `flag:"optional_field" env:"APP_OPTIONALFIELD" optional:"true"`
 //    }
 //
 package envflags
@@ -37,12 +38,16 @@ func SetFlags(s interface{}) bool {
 }
 
 // ConfigEmpty takes a config struct and determines if any of its field's
-// values are their zero value, meaning that their associated config flag
-// and environment variable were not specified.
+// values, other than optional fields, are their zero value, meaning that
+// their associated config flag and environment variable were not specified.
 func ConfigEmpty(s interface{}) bool {
 	val := reflect.ValueOf(s).Elem()
 
 	for i := 0; i < val.NumField(); i++ {
+		if val.Type().Field(i).Tag.Get("optional") == "true" {
+			continue
+		}
+
 		field := val.Field(i)
 		zero := reflect.Zero(field.Type())
 		if zero.String() == field.String() {
@@ -0,0 +1,32 @@
+package fake
+
+import "github.com/serdmanczyk/freyr/models"
+
+// AccountStore implements the models.AccountStore interface for use in unit
+// tests of libraries that accept a models.AccountStore.  Accounts are
+// deleted from Users, Secrets and, if not nil, Readings and Devices.
+type AccountStore struct {
+	Users    UserStore
+	Secrets  SecretStore
+	Readings *ReadingStore
+	Devices  *DeviceStore
+}
+
+// DeleteAccount removes the user and everything stored for them.
+func (f AccountStore) DeleteAccount(userEmail string) error {
+	if _, ok := f.Users[userEmail]; !ok {
+		return models.ErrorUserDoesntExist
+	}
+
+	if f.Readings != nil {
+		f.Readings.deleteUser(userEmail)
+	}
+
+	if f.Devices != nil {
+		f.Devices.deleteUser(userEmail)
+	}
+
+	delete(f.Secrets, userEmail)
+	delete(f.Users, userEmail)
+	return nil
+}
@@ -0,0 +1,43 @@
+package fake
+
+import "github.com/serdmanczyk/freyr/models"
+
+// CalibrationStore implements the models.CalibrationStore interface via an in
+// memory slice for use in unit tests of libraries that accept a
+// models.CalibrationStore.
+type CalibrationStore struct {
+	calibrations models.Calibrations
+	nextID       int64
+}
+
+// GetCalibrations returns the calibrations stored for the user.
+func (f *CalibrationStore) GetCalibrations(userEmail string) (models.Calibrations, error) {
+	var calibrations models.Calibrations
+	for _, c := range f.calibrations {
+		if c.UserEmail == userEmail {
+			calibrations = append(calibrations, c)
+		}
+	}
+
+	return calibrations, nil
+}
+
+// StoreCalibration appends the calibration to its slice of calibrations.
+func (f *CalibrationStore) StoreCalibration(c models.Calibration) (int64, error) {
+	f.nextID++
+	c.ID = f.nextID
+	f.calibrations = append(f.calibrations, c)
+	return c.ID, nil
+}
+
+// DeleteCalibration removes the user's calibration.
+func (f *CalibrationStore) DeleteCalibration(userEmail string, id int64) error {
+	for i, c := range f.calibrations {
+		if c.ID == id && c.UserEmail == userEmail {
+			f.calibrations = append(f.calibrations[:i], f.calibrations[i+1:]...)
+			return nil
+		}
+	}
+
+	return models.ErrorCalibrationDoesntExist
+}
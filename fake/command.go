@@ -0,0 +1,100 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"sync"
+	"time"
+)
+
+// CommandStore implements the models.CommandStore interface via an in
+// memory slice for use in unit tests of libraries that accept a
+// models.CommandStore.
+type CommandStore struct {
+	mu       sync.Mutex
+	commands []models.Command
+	nextID   int64
+}
+
+// GetCommands returns the commands queued for the user's core.
+func (f *CommandStore) GetCommands(userEmail, core string) ([]models.Command, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var commands []models.Command
+	for _, c := range f.commands {
+		if c.UserEmail == userEmail && c.CoreID == core {
+			commands = append(commands, c)
+		}
+	}
+
+	return commands, nil
+}
+
+// StoreCommand appends the command to its slice of commands.
+func (f *CommandStore) StoreCommand(c models.Command) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	c.ID = f.nextID
+	f.commands = append(f.commands, c)
+	return c.ID, nil
+}
+
+// DeliverCommands marks the core's unexpired pending commands delivered and
+// returns them.
+func (f *CommandStore) DeliverCommands(userEmail, core string, now time.Time) ([]models.Command, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var delivered []models.Command
+	for i, c := range f.commands {
+		if c.UserEmail == userEmail && c.CoreID == core && c.StateAt(now) == models.CommandPending {
+			f.commands[i].State = models.CommandDelivered
+			f.commands[i].Delivered = &now
+			delivered = append(delivered, f.commands[i])
+		}
+	}
+
+	return delivered, nil
+}
+
+// AckCommand marks the core's delivered, unexpired command acked.
+func (f *CommandStore) AckCommand(userEmail, core string, id int64, result string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, c := range f.commands {
+		if c.ID != id || c.UserEmail != userEmail || c.CoreID != core {
+			continue
+		}
+
+		if c.State != models.CommandDelivered || !c.Expires.After(now) {
+			return models.ErrorCommandNotDelivered
+		}
+
+		f.commands[i].State = models.CommandAcked
+		f.commands[i].Acked = &now
+		f.commands[i].Result = result
+		return nil
+	}
+
+	return models.ErrorCommandDoesntExist
+}
+
+// ExpireCommands marks pending and delivered commands past their expiry as
+// expired.
+func (f *CommandStore) ExpireCommands(now time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var expired int64
+	for i, c := range f.commands {
+		if c.State != models.CommandExpired && c.StateAt(now) == models.CommandExpired {
+			f.commands[i].State = models.CommandExpired
+			expired++
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,92 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// DeviceStore implements the models.DeviceStore interface via an in memory
+// slice for use in unit tests of libraries that accept a models.DeviceStore.
+type DeviceStore struct {
+	devices []models.Device
+}
+
+// SeeDevice updates the device's last seen time, adding it if not present.
+func (f *DeviceStore) SeeDevice(userEmail, core string, seen time.Time) error {
+	if i := f.find(userEmail, core); i >= 0 {
+		if seen.After(f.devices[i].LastSeen) {
+			f.devices[i].LastSeen = seen
+		}
+		return nil
+	}
+
+	f.devices = append(f.devices, models.Device{
+		UserEmail:     userEmail,
+		CoreID:        core,
+		LastSeen:      seen,
+		Status:        models.DeviceOnline,
+		StatusChanged: seen,
+	})
+	return nil
+}
+
+// GetDevices returns the user's devices.
+func (f *DeviceStore) GetDevices(userEmail string) ([]models.Device, error) {
+	var devices []models.Device
+	for _, d := range f.devices {
+		if d.UserEmail == userEmail {
+			devices = append(devices, d)
+		}
+	}
+
+	return devices, nil
+}
+
+// GetAllDevices returns every device.
+func (f *DeviceStore) GetAllDevices() ([]models.Device, error) {
+	return append([]models.Device(nil), f.devices...), nil
+}
+
+// SetReportingInterval updates the device's reporting interval.
+func (f *DeviceStore) SetReportingInterval(userEmail, core string, interval time.Duration) error {
+	i := f.find(userEmail, core)
+	if i < 0 {
+		return models.ErrorDeviceDoesntExist
+	}
+
+	f.devices[i].ReportingInterval = interval
+	return nil
+}
+
+// SetDeviceStatus updates the device's status.
+func (f *DeviceStore) SetDeviceStatus(userEmail, core, status string, changed time.Time) error {
+	i := f.find(userEmail, core)
+	if i < 0 {
+		return models.ErrorDeviceDoesntExist
+	}
+
+	f.devices[i].Status = status
+	f.devices[i].StatusChanged = changed
+	return nil
+}
+
+func (f *DeviceStore) find(userEmail, core string) int {
+	for i, d := range f.devices {
+		if d.UserEmail == userEmail && d.CoreID == core {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// deleteUser removes the user's devices.
+func (f *DeviceStore) deleteUser(userEmail string) {
+	kept := f.devices[:0]
+	for _, d := range f.devices {
+		if d.UserEmail != userEmail {
+			kept = append(kept, d)
+		}
+	}
+	f.devices = kept
+}
@@ -0,0 +1,47 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// EventStore implements the models.EventStore interface via an in memory
+// slice for use in unit tests of libraries that accept a models.EventStore.
+type EventStore struct {
+	events []models.Event
+	nextID int64
+}
+
+// GetEvents returns the user's events posted within the time span, ordered
+// by time posted.
+func (f *EventStore) GetEvents(userEmail string, start, end time.Time) ([]models.Event, error) {
+	var events []models.Event
+	for _, e := range f.events {
+		if e.UserEmail == userEmail && !e.Posted.Before(start) && !e.Posted.After(end) {
+			events = append(events, e)
+		}
+	}
+
+	models.SortEvents(events)
+	return events, nil
+}
+
+// StoreEvent appends the event to its slice of events.
+func (f *EventStore) StoreEvent(e models.Event) (int64, error) {
+	f.nextID++
+	e.ID = f.nextID
+	f.events = append(f.events, e)
+	return e.ID, nil
+}
+
+// DeleteEvent removes the user's event.
+func (f *EventStore) DeleteEvent(userEmail string, id int64) error {
+	for i, e := range f.events {
+		if e.ID == id && e.UserEmail == userEmail {
+			f.events = append(f.events[:i], f.events[i+1:]...)
+			return nil
+		}
+	}
+
+	return models.ErrorEventDoesntExist
+}
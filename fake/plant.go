@@ -0,0 +1,196 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+)
+
+// PlantStore implements the models.PlantStore interface via in memory slices
+// for use in unit tests of libraries that accept a models.PlantStore.
+type PlantStore struct {
+	zones       []models.Zone
+	plants      []models.Plant
+	assignments []models.Assignment
+	nextID      int64
+}
+
+// GetZones returns the user's zones.
+func (f *PlantStore) GetZones(userEmail string) ([]models.Zone, error) {
+	var zones []models.Zone
+	for _, z := range f.zones {
+		if z.UserEmail == userEmail {
+			zones = append(zones, z)
+		}
+	}
+
+	return zones, nil
+}
+
+// StoreZone appends or replaces the zone.
+func (f *PlantStore) StoreZone(z models.Zone) (int64, error) {
+	if z.ID == 0 {
+		f.nextID++
+		z.ID = f.nextID
+		f.zones = append(f.zones, z)
+		return z.ID, nil
+	}
+
+	for i, existing := range f.zones {
+		if existing.ID == z.ID && existing.UserEmail == z.UserEmail {
+			f.zones[i] = z
+			return z.ID, nil
+		}
+	}
+
+	return 0, models.ErrorZoneDoesntExist
+}
+
+// DeleteZone removes the zone, leaving its plants without a zone.
+func (f *PlantStore) DeleteZone(userEmail string, id int64) error {
+	for i, z := range f.zones {
+		if z.ID == id && z.UserEmail == userEmail {
+			f.zones = append(f.zones[:i], f.zones[i+1:]...)
+			for j := range f.plants {
+				if f.plants[j].ZoneID == id {
+					f.plants[j].ZoneID = 0
+				}
+			}
+			return nil
+		}
+	}
+
+	return models.ErrorZoneDoesntExist
+}
+
+// GetPlants returns the user's plants.
+func (f *PlantStore) GetPlants(userEmail string) ([]models.Plant, error) {
+	var plants []models.Plant
+	for _, p := range f.plants {
+		if p.UserEmail == userEmail {
+			plants = append(plants, p)
+		}
+	}
+
+	return plants, nil
+}
+
+// StorePlant appends or replaces the plant.
+func (f *PlantStore) StorePlant(p models.Plant) (int64, error) {
+	if p.ZoneID != 0 && !f.hasZone(p.UserEmail, p.ZoneID) {
+		return 0, models.ErrorZoneDoesntExist
+	}
+
+	if p.ID == 0 {
+		f.nextID++
+		p.ID = f.nextID
+		f.plants = append(f.plants, p)
+		return p.ID, nil
+	}
+
+	for i, existing := range f.plants {
+		if existing.ID == p.ID && existing.UserEmail == p.UserEmail {
+			f.plants[i] = p
+			return p.ID, nil
+		}
+	}
+
+	return 0, models.ErrorPlantDoesntExist
+}
+
+// DeletePlant removes the plant and its assignments.
+func (f *PlantStore) DeletePlant(userEmail string, id int64) error {
+	for i, p := range f.plants {
+		if p.ID == id && p.UserEmail == userEmail {
+			f.plants = append(f.plants[:i], f.plants[i+1:]...)
+
+			var kept []models.Assignment
+			for _, a := range f.assignments {
+				if a.PlantID != id {
+					kept = append(kept, a)
+				}
+			}
+			f.assignments = kept
+			return nil
+		}
+	}
+
+	return models.ErrorPlantDoesntExist
+}
+
+// GetAssignments returns the plant's assignments in the order stored.
+func (f *PlantStore) GetAssignments(userEmail string, plantID int64) ([]models.Assignment, error) {
+	var assignments []models.Assignment
+	for _, a := range f.assignments {
+		if a.UserEmail == userEmail && a.PlantID == plantID {
+			assignments = append(assignments, a)
+		}
+	}
+
+	return assignments, nil
+}
+
+// StoreAssignment ends any earlier open assignment of the core, if the
+// assignment is open-ended, then appends the assignment if it doesn't
+// overlap another.
+func (f *PlantStore) StoreAssignment(a models.Assignment) (int64, error) {
+	if !f.hasPlant(a.UserEmail, a.PlantID) {
+		return 0, models.ErrorPlantDoesntExist
+	}
+
+	ends := func(existing models.Assignment) bool {
+		return a.End == nil && existing.CoreID == a.CoreID && existing.End == nil && existing.Start.Before(a.Start)
+	}
+
+	for _, existing := range f.assignments {
+		if existing.UserEmail != a.UserEmail || ends(existing) {
+			continue
+		}
+
+		if existing.Overlaps(a) {
+			return 0, models.ErrorAssignmentOverlaps
+		}
+	}
+
+	for i, existing := range f.assignments {
+		if existing.UserEmail == a.UserEmail && ends(existing) {
+			end := a.Start
+			f.assignments[i].End = &end
+		}
+	}
+
+	f.nextID++
+	a.ID = f.nextID
+	f.assignments = append(f.assignments, a)
+	return a.ID, nil
+}
+
+// DeleteAssignment removes the assignment.
+func (f *PlantStore) DeleteAssignment(userEmail string, id int64) error {
+	for i, a := range f.assignments {
+		if a.ID == id && a.UserEmail == userEmail {
+			f.assignments = append(f.assignments[:i], f.assignments[i+1:]...)
+			return nil
+		}
+	}
+
+	return models.ErrorAssignmentDoesntExist
+}
+
+func (f *PlantStore) hasZone(userEmail string, id int64) bool {
+	for _, z := range f.zones {
+		if z.ID == id && z.UserEmail == userEmail {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *PlantStore) hasPlant(userEmail string, id int64) bool {
+	for _, p := range f.plants {
+		if p.ID == id && p.UserEmail == userEmail {
+			return true
+		}
+	}
+
+	return false
+}
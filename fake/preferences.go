@@ -0,0 +1,21 @@
+package fake
+
+import "github.com/serdmanczyk/freyr/models"
+
+// PreferenceStore implements the models.PreferenceStore interface for use in
+// unit tests of libraries that accept a models.PreferenceStore.  Implemented
+// via an in memory map.
+type PreferenceStore map[string]models.Preferences
+
+// GetPreferences returns the preferences for the given userEmail.
+func (p PreferenceStore) GetPreferences(userEmail string) (models.Preferences, error) {
+	return p[userEmail], nil
+}
+
+// StorePreferences updates/inserts preferences for the given userEmail,
+// keeping the stored locale.
+func (p PreferenceStore) StorePreferences(userEmail string, preferences models.Preferences) error {
+	preferences.Locale = p[userEmail].Locale
+	p[userEmail] = preferences
+	return nil
+}
@@ -0,0 +1,83 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// QuarantineStore implements the models.QuarantineStore interface via in
+// memory slices and maps for use in unit tests of libraries that accept a
+// models.QuarantineStore.
+type QuarantineStore struct {
+	quarantined []models.QuarantinedReading
+	limits      map[string]models.ValidationLimits
+	nextID      int64
+}
+
+// QuarantineReading appends the reading to its slice of quarantined readings.
+func (f *QuarantineStore) QuarantineReading(reading models.Reading, reasons []string) error {
+	for _, q := range f.quarantined {
+		if q.Reading.UserEmail == reading.UserEmail && q.Reading.CoreID == reading.CoreID && q.Reading.Posted.Equal(reading.Posted) {
+			return nil
+		}
+	}
+
+	f.nextID++
+	f.quarantined = append(f.quarantined, models.QuarantinedReading{
+		ID:          f.nextID,
+		Reading:     reading,
+		Reasons:     reasons,
+		Quarantined: time.Now(),
+	})
+	return nil
+}
+
+// GetQuarantined returns the user's quarantined readings.
+func (f *QuarantineStore) GetQuarantined(userEmail string) ([]models.QuarantinedReading, error) {
+	var quarantined []models.QuarantinedReading
+	for _, q := range f.quarantined {
+		if q.Reading.UserEmail == userEmail {
+			quarantined = append(quarantined, q)
+		}
+	}
+
+	return quarantined, nil
+}
+
+// ReleaseQuarantined removes the quarantined reading and returns it.
+func (f *QuarantineStore) ReleaseQuarantined(userEmail string, id int64) (models.Reading, error) {
+	for i, q := range f.quarantined {
+		if q.ID == id && q.Reading.UserEmail == userEmail {
+			f.quarantined = append(f.quarantined[:i], f.quarantined[i+1:]...)
+			return q.Reading, nil
+		}
+	}
+
+	return models.Reading{}, models.ErrorQuarantinedDoesntExist
+}
+
+// DeleteQuarantined discards the quarantined reading.
+func (f *QuarantineStore) DeleteQuarantined(userEmail string, id int64) error {
+	_, err := f.ReleaseQuarantined(userEmail, id)
+	return err
+}
+
+// GetValidationLimits returns the limits stored for the user's core.
+func (f *QuarantineStore) GetValidationLimits(userEmail, core string) (models.ValidationLimits, error) {
+	limits := make(models.ValidationLimits)
+	for metric, limit := range f.limits[userEmail+core] {
+		limits[metric] = limit
+	}
+
+	return limits, nil
+}
+
+// StoreValidationLimits updates/inserts limits for the user's core.
+func (f *QuarantineStore) StoreValidationLimits(userEmail, core string, limits models.ValidationLimits) error {
+	if f.limits == nil {
+		f.limits = make(map[string]models.ValidationLimits)
+	}
+
+	f.limits[userEmail+core] = f.limits[userEmail+core].Merge(limits)
+	return nil
+}
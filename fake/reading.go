@@ -1,7 +1,6 @@
 package fake
 
 import (
-	"errors"
 	"github.com/serdmanczyk/freyr/models"
 	"math"
 	"math/rand"
@@ -41,40 +40,194 @@ func RandReading(userEmail, core string, posted time.Time) models.Reading {
 // via an in memory slice.  It is used for unit tests of libraries that accept
 // a models.ReadingStore interface.
 type ReadingStore struct {
+	readings  []models.Reading
+	deletions []deletion
+	lastID    int64
+}
+
+// deletion is a deletion along with the readings it deleted.
+type deletion struct {
+	models.ReadingDeletion
 	readings []models.Reading
 }
 
-// StoreReading appends the reading to its slice of readings
+// StoreReading appends the reading to its slice of readings, returning
+// models.ErrorReadingExists or a models.ReadingConflictError if a reading is
+// already stored for the same user, core and time.
 func (f *ReadingStore) StoreReading(reading models.Reading) error {
+	for _, stored := range f.readings {
+		if stored.UserEmail != reading.UserEmail || stored.CoreID != reading.CoreID || !stored.Posted.Equal(reading.Posted) {
+			continue
+		}
+
+		if !stored.Compare(reading) {
+			return models.ReadingConflictError{Stored: stored}
+		}
+
+		return models.ErrorReadingExists
+	}
+
 	f.readings = append(f.readings, reading)
 	return nil
 }
 
-// GetLatestReadings is a placeholder to fulfill the models.ReadingStore interface
+// GetLatestReadings returns the most recent reading of each of the user's
+// cores.
 func (f *ReadingStore) GetLatestReadings(userEmail string) (readings []models.Reading, err error) {
-	err = errors.New("don't need this yet")
+	latest := make(map[string]int)
+	for _, r := range f.readings {
+		if r.UserEmail != userEmail {
+			continue
+		}
+
+		i, ok := latest[r.CoreID]
+		if !ok {
+			latest[r.CoreID] = len(readings)
+			readings = append(readings, r)
+			continue
+		}
+
+		if r.Posted.After(readings[i].Posted) {
+			readings[i] = r
+		}
+	}
+
 	return
 }
 
-// DeleteReadings is a placeholder to fulfill the models.ReadingStore interface
-func (f *ReadingStore) DeleteReadings(core string, start, end time.Time) error {
-	return errors.New("don't need this yet")
+// HasReadings returns true if the user has any readings of the core.
+func (f *ReadingStore) HasReadings(userEmail, core string) (bool, error) {
+	for _, r := range f.readings {
+		if r.UserEmail == userEmail && r.CoreID == core {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CountReadings returns the number of the user's readings of the core that
+// lie between the specified start and end time, inclusive.
+func (f *ReadingStore) CountReadings(userEmail, core string, start, end time.Time) (int, error) {
+	readings, _ := f.GetReadings(userEmail, core, start, end)
+	return len(readings), nil
+}
+
+// DeleteReadings removes the user's readings of the core that lie between
+// the specified start and end time, inclusive, keeping them with the
+// deletion until it's undone or purged.
+func (f *ReadingStore) DeleteReadings(userEmail, core string, start, end time.Time) (models.ReadingDeletion, error) {
+	deleted, _ := f.GetReadings(userEmail, core, start, end)
+	f.readings = models.FilterReadings(f.readings, func(r models.Reading) bool {
+		return !spans(r, userEmail, core, start, end)
+	})
+
+	f.lastID++
+	d := models.ReadingDeletion{
+		ID:        f.lastID,
+		UserEmail: userEmail,
+		CoreID:    core,
+		Start:     start,
+		End:       end,
+		Count:     len(deleted),
+		Deleted:   time.Now(),
+	}
+	f.deletions = append(f.deletions, deletion{d, deleted})
+
+	return d, nil
 }
 
-// GetReadings returns readings in its slice of readings that lie between
-// the specified start and end time.
-func (f *ReadingStore) GetReadings(core string, start, end time.Time) ([]models.Reading, error) {
+// UndoDeletion restores the readings of the user's deletion, if made within
+// the grace period, that haven't been stored again since.
+func (f *ReadingStore) UndoDeletion(userEmail string, id int64) (int, error) {
+	graceStart := time.Now().Add(-models.DeletionGracePeriod)
+	for i, d := range f.deletions {
+		if d.ID != id || d.UserEmail != userEmail || d.Deleted.Before(graceStart) {
+			continue
+		}
+
+		var restored int
+		for _, r := range d.readings {
+			if f.StoreReading(r) == nil {
+				restored++
+			}
+		}
+
+		f.deletions = append(f.deletions[:i], f.deletions[i+1:]...)
+		return restored, nil
+	}
+
+	return 0, models.ErrorDeletionDoesntExist
+}
+
+// PurgeDeletions discards deletions made before the given time and the
+// readings they deleted.
+func (f *ReadingStore) PurgeDeletions(before time.Time) (int, error) {
+	kept := f.deletions[:0]
+	for _, d := range f.deletions {
+		if !d.Deleted.Before(before) {
+			kept = append(kept, d)
+		}
+	}
+
+	purged := len(f.deletions) - len(kept)
+	f.deletions = kept
+	return purged, nil
+}
+
+// deleteUser removes the user's readings and deletions.
+func (f *ReadingStore) deleteUser(userEmail string) {
+	f.readings = models.FilterReadings(f.readings, func(r models.Reading) bool {
+		return r.UserEmail != userEmail
+	})
+
+	kept := f.deletions[:0]
+	for _, d := range f.deletions {
+		if d.UserEmail != userEmail {
+			kept = append(kept, d)
+		}
+	}
+	f.deletions = kept
+}
+
+// GetReadings returns the user's readings of the core in its slice of
+// readings that lie between the specified start and end time, in time order.
+func (f *ReadingStore) GetReadings(userEmail, core string, start, end time.Time) ([]models.Reading, error) {
 	filtered := models.FilterReadings(f.readings, func(r models.Reading) bool {
-		if r.CoreID == core && r.Posted.After(start) && r.Posted.Before(end) {
-			return true
+		return spans(r, userEmail, core, start, end)
+	})
+	models.SortReadings(filtered)
+
+	return filtered, nil
+}
+
+// GetReadingsPage returns at most limit of the user's readings of any of the
+// cores GetReadings would that follow the cursor, in cursor order.
+func (f *ReadingStore) GetReadingsPage(userEmail string, cores []string, start, end time.Time, after models.Cursor, limit int) ([]models.Reading, error) {
+	filtered := models.FilterReadings(f.readings, func(r models.Reading) bool {
+		for _, core := range cores {
+			if spans(r, userEmail, core, start, end) {
+				return after.Precedes(r)
+			}
 		}
 
 		return false
 	})
+	models.SortReadingsByCursor(filtered)
+
+	if len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
 
 	return filtered, nil
 }
 
+// spans returns true if the reading is the user's of the core and lies
+// between start and end, inclusive, like the database's between.
+func spans(r models.Reading, userEmail, core string, start, end time.Time) bool {
+	return r.UserEmail == userEmail && r.CoreID == core && !r.Posted.Before(start) && !r.Posted.After(end)
+}
+
 // Translator returns a function that translates input floats
 // from linear domain a-b to domain c-d.
 func Translator(a, b, c, d float64) func(float64) float64 {
@@ -0,0 +1,129 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// RetentionStore implements the models.RetentionStore interface for use in
+// unit tests of libraries that accept a models.RetentionStore.  Raw readings
+// rolled up are deleted from Readings.
+type RetentionStore struct {
+	Readings *ReadingStore
+	policies map[string]models.RetentionPolicy
+	rollups  map[string][]models.Aggregate
+}
+
+// GetRetentionPolicy returns the user's policy.
+func (f *RetentionStore) GetRetentionPolicy(userEmail string) (models.RetentionPolicy, error) {
+	return f.policies[userEmail], nil
+}
+
+// StoreRetentionPolicy updates/inserts the user's policy.
+func (f *RetentionStore) StoreRetentionPolicy(userEmail string, policy models.RetentionPolicy) error {
+	if f.policies == nil {
+		f.policies = make(map[string]models.RetentionPolicy)
+	}
+
+	f.policies[userEmail] = policy
+	return nil
+}
+
+// GetRetentionPolicies returns all stored policies.
+func (f *RetentionStore) GetRetentionPolicies() (map[string]models.RetentionPolicy, error) {
+	policies := make(map[string]models.RetentionPolicy, len(f.policies))
+	for userEmail, policy := range f.policies {
+		policies[userEmail] = policy
+	}
+
+	return policies, nil
+}
+
+// RollupReadings combines the rollups with those stored for the same
+// buckets, then removes the user's readings rolled up from Readings.
+func (f *RetentionStore) RollupReadings(userEmail string, rolledUp map[string][]time.Time, hourly, daily []models.Aggregate) error {
+	if f.rollups == nil {
+		f.rollups = make(map[string][]models.Aggregate)
+	}
+
+	same := func(t time.Time) time.Time { return t }
+	for interval, rollups := range map[string][]models.Aggregate{
+		models.IntervalHour: hourly,
+		models.IntervalDay:  daily,
+	} {
+		key := userEmail + interval
+		f.rollups[key] = models.MergeAggregates(append(f.rollups[key], rollups...), same)
+	}
+
+	var kept []models.Reading
+	for _, r := range f.Readings.readings {
+		if r.UserEmail != userEmail || !rolledUpAt(rolledUp[r.CoreID], r.Posted) {
+			kept = append(kept, r)
+		}
+	}
+
+	f.Readings.readings = kept
+	return nil
+}
+
+// DeleteRollups removes the user's rollups of the interval starting before
+// the given time.
+func (f *RetentionStore) DeleteRollups(userEmail, interval string, before time.Time) error {
+	key := userEmail + interval
+
+	var kept []models.Aggregate
+	for _, a := range f.rollups[key] {
+		if !a.Start.Before(before) {
+			kept = append(kept, a)
+		}
+	}
+
+	f.rollups[key] = kept
+	return nil
+}
+
+// GetRollups returns the core's hourly rollups within the time span, and
+// daily rollups for days without hourly rollups.
+func (f *RetentionStore) GetRollups(userEmail, core string, start, end time.Time) ([]models.Aggregate, error) {
+	var aggregates []models.Aggregate
+
+	var hours []time.Time
+	for _, a := range f.rollups[userEmail+models.IntervalHour] {
+		if a.CoreID != core {
+			continue
+		}
+
+		hours = append(hours, a.Start)
+		if !a.Start.Before(start) && !a.Start.After(end) {
+			aggregates = append(aggregates, a)
+		}
+	}
+
+	for _, a := range f.rollups[userEmail+models.IntervalDay] {
+		if a.CoreID != core || a.Start.Before(start) || a.Start.After(end) {
+			continue
+		}
+
+		covered := false
+		for _, hour := range hours {
+			covered = covered || (!hour.Before(a.Start) && hour.Before(a.Start.AddDate(0, 0, 1)))
+		}
+
+		if !covered {
+			aggregates = append(aggregates, a)
+		}
+	}
+
+	return aggregates, nil
+}
+
+// rolledUpAt returns whether the time is one of those rolled up.
+func rolledUpAt(rolledUp []time.Time, posted time.Time) bool {
+	for _, t := range rolledUp {
+		if t.Equal(posted) {
+			return true
+		}
+	}
+
+	return false
+}
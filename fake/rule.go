@@ -0,0 +1,159 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"sync"
+	"time"
+)
+
+// RuleStore implements the models.RuleStore interface via in memory slices
+// for use in unit tests of libraries that accept a models.RuleStore.
+type RuleStore struct {
+	mu         sync.Mutex
+	rules      []models.Rule
+	executions []models.Execution
+	nextID     int64
+}
+
+// GetRules returns the user's rules.
+func (f *RuleStore) GetRules(userEmail string) ([]models.Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rules []models.Rule
+	for _, r := range f.rules {
+		if r.UserEmail == userEmail {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, nil
+}
+
+// GetCoreRules returns the user's enabled rules for the core.
+func (f *RuleStore) GetCoreRules(userEmail, core string) ([]models.Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rules []models.Rule
+	for _, r := range f.rules {
+		if r.UserEmail == userEmail && r.CoreID == core && r.Enabled {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, nil
+}
+
+// StoreRule appends the rule to its slice of rules, or replaces the rule
+// with the same ID.
+func (f *RuleStore) StoreRule(rule models.Rule) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if rule.ID == 0 {
+		f.nextID++
+		rule.ID = f.nextID
+		f.rules = append(f.rules, rule)
+		return rule.ID, nil
+	}
+
+	for i, r := range f.rules {
+		if r.ID == rule.ID && r.UserEmail == rule.UserEmail {
+			rule.LastFired = r.LastFired
+			f.rules[i] = rule
+			return rule.ID, nil
+		}
+	}
+
+	return 0, models.ErrorRuleDoesntExist
+}
+
+// DeleteRule removes the user's rule and its executions.
+func (f *RuleStore) DeleteRule(userEmail string, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, r := range f.rules {
+		if r.ID == id && r.UserEmail == userEmail {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+
+			executions := f.executions[:0]
+			for _, e := range f.executions {
+				if e.RuleID != id {
+					executions = append(executions, e)
+				}
+			}
+			f.executions = executions
+			return nil
+		}
+	}
+
+	return models.ErrorRuleDoesntExist
+}
+
+// GetExecutions returns the executions of the user's rule, most recent
+// first.
+func (f *RuleStore) GetExecutions(userEmail string, ruleID int64) ([]models.Execution, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var executions []models.Execution
+	for i := len(f.executions) - 1; i >= 0; i-- {
+		if e := f.executions[i]; e.RuleID == ruleID && e.UserEmail == userEmail {
+			executions = append(executions, e)
+		}
+	}
+
+	return executions, nil
+}
+
+// ClaimFiring records now as the rule's last firing unless it is cooling
+// down.
+func (f *RuleStore) ClaimFiring(userEmail string, id int64, now time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, r := range f.rules {
+		if r.ID == id && r.UserEmail == userEmail {
+			if r.CoolingDownAt(now) {
+				return false, nil
+			}
+
+			f.rules[i].LastFired = &now
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// StoreExecution appends the execution to its slice of executions.  Failed
+// executions restore the rule's last firing to its latest execution that
+// didn't fail.
+func (f *RuleStore) StoreExecution(e models.Execution) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, r := range f.rules {
+		if r.ID == e.RuleID && r.UserEmail == e.UserEmail {
+			f.nextID++
+			e.ID = f.nextID
+			f.executions = append(f.executions, e)
+
+			if e.Result == models.ExecutionFailed && r.LastFired != nil && r.LastFired.Equal(e.Triggered) {
+				f.rules[i].LastFired = nil
+				for _, previous := range f.executions {
+					if previous.RuleID == e.RuleID && previous.Result != models.ExecutionFailed &&
+						(f.rules[i].LastFired == nil || previous.Triggered.After(*f.rules[i].LastFired)) {
+						triggered := previous.Triggered
+						f.rules[i].LastFired = &triggered
+					}
+				}
+			}
+			return nil
+		}
+	}
+
+	return models.ErrorRuleDoesntExist
+}
@@ -0,0 +1,90 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskStore implements the models.TaskStore interface via an in memory map
+// for use in unit tests of libraries that accept a models.TaskStore.  It is
+// safe for concurrent use, as schedulers run tasks concurrently.
+type TaskStore struct {
+	lock   sync.Mutex
+	states map[string]models.TaskState
+}
+
+// GetTaskStates returns the state of every scheduled task ordered by name.
+func (f *TaskStore) GetTaskStates() ([]models.TaskState, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var names []string
+	for name := range f.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var states []models.TaskState
+	for _, name := range names {
+		states = append(states, f.states[name])
+	}
+
+	return states, nil
+}
+
+// ScheduleTask adds the task's state if not already present.
+func (f *TaskStore) ScheduleTask(name string, next time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.states == nil {
+		f.states = make(map[string]models.TaskState)
+	}
+
+	if _, ok := f.states[name]; !ok {
+		f.states[name] = models.TaskState{Name: name, NextRun: next}
+	}
+
+	return nil
+}
+
+// ClaimTask locks the task for owner for the lease if it is due, or force
+// is true, and isn't locked.
+func (f *TaskStore) ClaimTask(name, owner string, now time.Time, lease time.Duration, force bool) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	state, ok := f.states[name]
+	if !ok || state.Locked(now) || (!force && state.NextRun.After(now)) {
+		return false, nil
+	}
+
+	state.LockedBy = owner
+	state.LockedUntil = now.Add(lease)
+	f.states[name] = state
+	return true, nil
+}
+
+// CompleteTask records the run and unlocks the task if owner holds its lock.
+func (f *TaskStore) CompleteTask(name, owner string, ran time.Time, runErr error, next time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	state, ok := f.states[name]
+	if !ok || state.LockedBy != owner {
+		return nil
+	}
+
+	state.LastRun = ran
+	state.LastError = ""
+	if runErr != nil {
+		state.LastError = runErr.Error()
+	}
+	state.NextRun = next
+	state.LockedBy = ""
+	state.LockedUntil = time.Time{}
+	f.states[name] = state
+	return nil
+}
@@ -10,14 +10,19 @@ type UserStore map[string]models.User
 func (u UserStore) GetUser(email string) (models.User, error) {
 	user, ok := u[email]
 	if !ok {
-		return models.User{}, nil
+		return models.User{}, models.ErrorUserDoesntExist
 	}
 
 	return user, nil
 }
 
-// StoreUser inserts/updates data for the given user.
+// StoreUser inserts data for the given user, returning
+// models.ErrorUserAlreadyExists if they're already stored.
 func (u UserStore) StoreUser(user models.User) error {
+	if _, ok := u[user.Email]; ok {
+		return models.ErrorUserAlreadyExists
+	}
+
 	u[user.Email] = user
 	return nil
 }
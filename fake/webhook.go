@@ -0,0 +1,196 @@
+package fake
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"sync"
+	"time"
+)
+
+// WebhookStore implements the models.WebhookStore interface via in memory
+// slices for use in unit tests of libraries that accept a
+// models.WebhookStore.
+type WebhookStore struct {
+	mu            sync.Mutex
+	subscriptions []models.Subscription
+	deliveries    []models.Delivery
+	nextID        int64
+}
+
+// GetSubscriptions returns the user's subscriptions with their most recent
+// delivery attempt.
+func (f *WebhookStore) GetSubscriptions(userEmail string) ([]models.Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var subscriptions []models.Subscription
+	for _, s := range f.subscriptions {
+		if s.UserEmail != userEmail {
+			continue
+		}
+
+		for _, d := range f.deliveries {
+			if d.SubscriptionID == s.ID && d.LastAttempt != nil && (s.LastAttempt == nil || !d.LastAttempt.Before(*s.LastAttempt)) {
+				s.LastAttempt, s.LastStatusCode = d.LastAttempt, d.StatusCode
+			}
+		}
+
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
+
+// GetEventSubscriptions returns the user's subscriptions to the event.
+func (f *WebhookStore) GetEventSubscriptions(userEmail, event string) ([]models.Subscription, error) {
+	subscriptions, _ := f.GetSubscriptions(userEmail)
+
+	var wanted []models.Subscription
+	for _, s := range subscriptions {
+		for _, e := range s.Events {
+			if e == event {
+				wanted = append(wanted, s)
+				break
+			}
+		}
+	}
+
+	return wanted, nil
+}
+
+// StoreSubscription appends the subscription to its slice of
+// subscriptions, or replaces the subscription with the same ID.
+func (f *WebhookStore) StoreSubscription(s models.Subscription) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s.ID == 0 {
+		f.nextID++
+		s.ID = f.nextID
+		f.subscriptions = append(f.subscriptions, s)
+		return s.ID, nil
+	}
+
+	for i, stored := range f.subscriptions {
+		if stored.ID == s.ID && stored.UserEmail == s.UserEmail {
+			s.Created = stored.Created
+			f.subscriptions[i] = s
+			return s.ID, nil
+		}
+	}
+
+	return 0, models.ErrorSubscriptionDoesntExist
+}
+
+// DeleteSubscription removes the user's subscription and its deliveries.
+func (f *WebhookStore) DeleteSubscription(userEmail string, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, s := range f.subscriptions {
+		if s.ID == id && s.UserEmail == userEmail {
+			f.subscriptions = append(f.subscriptions[:i], f.subscriptions[i+1:]...)
+
+			deliveries := f.deliveries[:0]
+			for _, d := range f.deliveries {
+				if d.SubscriptionID != id {
+					deliveries = append(deliveries, d)
+				}
+			}
+			f.deliveries = deliveries
+			return nil
+		}
+	}
+
+	return models.ErrorSubscriptionDoesntExist
+}
+
+// GetDeliveries returns the deliveries to the user's subscription, most
+// recent first.
+func (f *WebhookStore) GetDeliveries(userEmail string, subscriptionID int64) ([]models.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var deliveries []models.Delivery
+	for i := len(f.deliveries) - 1; i >= 0; i-- {
+		if d := f.deliveries[i]; d.SubscriptionID == subscriptionID && d.UserEmail == userEmail {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// GetDelivery returns the delivery with the given ID.
+func (f *WebhookStore) GetDelivery(id int64) (models.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, d := range f.deliveries {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+
+	return models.Delivery{}, models.ErrorDeliveryDoesntExist
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due.
+func (f *WebhookStore) GetDueDeliveries(now time.Time) ([]models.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var due []models.Delivery
+	for _, d := range f.deliveries {
+		if d.State == models.DeliveryPending && !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	return due, nil
+}
+
+// StoreDelivery appends the delivery to its slice of deliveries.
+func (f *WebhookStore) StoreDelivery(d models.Delivery) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	d.ID = f.nextID
+	f.deliveries = append(f.deliveries, d)
+	return d.ID, nil
+}
+
+// ClaimDelivery pushes the pending delivery's next attempt back to until if
+// it is due.
+func (f *WebhookStore) ClaimDelivery(id int64, now, until time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, d := range f.deliveries {
+		if d.ID == id {
+			if d.State != models.DeliveryPending || d.NextAttempt.After(now) {
+				return false, nil
+			}
+
+			f.deliveries[i].NextAttempt = until
+			return true, nil
+		}
+	}
+
+	return false, models.ErrorDeliveryDoesntExist
+}
+
+// UpdateDelivery replaces the delivery with the same ID.
+func (f *WebhookStore) UpdateDelivery(d models.Delivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, stored := range f.deliveries {
+		if stored.ID == d.ID {
+			f.deliveries[i] = d
+			return nil
+		}
+	}
+
+	return models.ErrorDeliveryDoesntExist
+}
@@ -0,0 +1,231 @@
+// Package lineprotocol parses InfluxDB line protocol, as emitted by sensor
+// firmwares such as Tasmota and ESPHome and by Telegraf, and maps the points
+// parsed onto readings.
+package lineprotocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a measurement, its tags and numeric fields, at a time.  String
+// fields are parsed but dropped, as readings are numeric; booleans are 1 or
+// 0.  Line is the line of the batch the point was parsed from.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Time        time.Time
+	Line        int
+}
+
+// ParseError describes why a line of a batch couldn't be parsed.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("unable to parse line %d: %s", e.Line, e.Err)
+}
+
+var (
+	// ErrorUnknownPrecision is returned when parsing timestamps of a
+	// precision other than n, u, ms, s, m or h.
+	ErrorUnknownPrecision = errors.New("Unknown timestamp precision")
+	errMissingFields      = errors.New("missing fields")
+	errMissingMeasurement = errors.New("missing measurement")
+	errBadTag             = errors.New("tag missing value")
+	errBadField           = errors.New("field missing value")
+	errUnquoted           = errors.New("unterminated string")
+)
+
+// precisions maps the precisions timestamps may be given in, as InfluxDB's
+// precision query option, to their units.
+var precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// Parse parses a batch of points whose timestamps are in the given
+// precision.  Points without a timestamp are given now.  Blank lines and
+// comments are skipped.
+func Parse(batch []byte, precision string, now time.Time) ([]Point, error) {
+	unit, ok := precisions[precision]
+	if !ok {
+		return nil, ErrorUnknownPrecision
+	}
+
+	var points []Point
+	for i, line := range bytes.Split(batch, []byte("\n")) {
+		text := strings.TrimSpace(string(line))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		point, err := parseLine(text, unit, now)
+		if err != nil {
+			return nil, ParseError{Line: i + 1, Err: err}
+		}
+
+		point.Line = i + 1
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+func parseLine(line string, unit time.Duration, now time.Time) (Point, error) {
+	sections, err := split(line, ' ')
+	if err != nil {
+		return Point{}, err
+	}
+
+	if len(sections) < 2 || len(sections) > 3 {
+		return Point{}, errMissingFields
+	}
+
+	key, err := split(sections[0], ',')
+	if err != nil {
+		return Point{}, err
+	}
+
+	point := Point{
+		Measurement: unescape(key[0]),
+		Tags:        make(map[string]string),
+		Fields:      make(map[string]float64),
+		Time:        now,
+	}
+
+	if point.Measurement == "" {
+		return Point{}, errMissingMeasurement
+	}
+
+	for _, tag := range key[1:] {
+		k, v, ok := pair(tag)
+		if !ok || v == "" {
+			return Point{}, errBadTag
+		}
+
+		point.Tags[unescape(k)] = unescape(v)
+	}
+
+	fields, err := split(sections[1], ',')
+	if err != nil {
+		return Point{}, err
+	}
+
+	for _, field := range fields {
+		k, v, ok := pair(field)
+		if !ok || v == "" {
+			return Point{}, errBadField
+		}
+
+		value, numeric, err := fieldValue(v)
+		if err != nil {
+			return Point{}, err
+		}
+
+		if numeric {
+			point.Fields[unescape(k)] = value
+		}
+	}
+
+	if len(sections) == 3 {
+		timestamp, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return Point{}, err
+		}
+
+		point.Time = time.Unix(0, timestamp*int64(unit)).UTC()
+	}
+
+	return point, nil
+}
+
+// fieldValue parses a field's value, returning false for strings.
+func fieldValue(v string) (float64, bool, error) {
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	switch v[len(v)-1] {
+	case '"':
+		if len(v) < 2 || v[0] != '"' {
+			return 0, false, errUnquoted
+		}
+		return 0, false, nil
+	case 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(i), true, err
+	case 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(u), true, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return f, true, err
+}
+
+// split splits s at each occurrence of sep that isn't escaped by a
+// backslash or within a double quoted field value.  Runs of spaces separate
+// sections once.
+func split(s string, sep byte) ([]string, error) {
+	var parts []string
+	start, quoted := 0, false
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && (quoted || i > 0 && s[i-1] == '='):
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			for sep == ' ' && i+1 < len(s) && s[i+1] == ' ' {
+				i++
+			}
+			start = i + 1
+		}
+	}
+
+	if quoted {
+		return nil, errUnquoted
+	}
+
+	return append(parts, s[start:]), nil
+}
+
+// pair splits a key=value pair at its first unescaped equals sign.
+func pair(s string) (key, value string, ok bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			return s[:i], s[i+1:], i > 0
+		}
+	}
+
+	return "", "", false
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`, `\\`, `\`)
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,189 @@
+package lineprotocol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	batch := `# Telegraf
+sensors,host=garden temperature=21.5,humidity=60i,moisture=41u 1462867200000000000
+
+weather\ station,device=green\,house,room=a\ b\=c status="ok, fine",light=1200,wet=true
+temperature,device=porch value=-3.25e1 1462867260`
+
+	points, err := Parse([]byte(batch), "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Point{
+		{Measurement: "sensors", Tags: map[string]string{"host": "garden"},
+			Fields: map[string]float64{"temperature": 21.5, "humidity": 60, "moisture": 41}, Time: now, Line: 2},
+		{Measurement: "weather station", Tags: map[string]string{"device": "green,house", "room": "a b=c"},
+			Fields: map[string]float64{"light": 1200, "wet": 1}, Time: now, Line: 4},
+		{Measurement: "temperature", Tags: map[string]string{"device": "porch"},
+			Fields: map[string]float64{"value": -32.5}, Time: time.Unix(0, 1462867260).UTC(), Line: 5},
+	}
+
+	if !reflect.DeepEqual(points, expected) {
+		t.Fatalf("Expected %v, got %v", expected, points)
+	}
+
+	for _, tc := range []struct {
+		precision string
+		timestamp string
+		expected  time.Time
+	}{
+		{"s", "1462867200", now},
+		{"ms", "1462867200000", now},
+		{"u", "1462867200000000", now},
+		{"h", "406352", now},
+	} {
+		points, err := Parse([]byte("m f=1 "+tc.timestamp), tc.precision, time.Time{})
+		if err != nil || !points[0].Time.Equal(tc.expected) {
+			t.Errorf("Parsing %s in %s: expected %s, got %v (%v)", tc.timestamp, tc.precision, tc.expected, points, err)
+		}
+	}
+
+	if _, err := Parse([]byte("m f=1"), "d", now); err != ErrorUnknownPrecision {
+		t.Fatalf("Expected ErrorUnknownPrecision, got %v", err)
+	}
+
+	for _, line := range []string{
+		"measurement",
+		",tag=a f=1",
+		"m,tag f=1",
+		"m f",
+		"m f=",
+		"m f=abc",
+		"m f=12x",
+		`m f="unterminated`,
+		"m f=1 yesterday",
+		"m f=1 1 2",
+	} {
+		_, err := Parse([]byte("m f=1\n"+line), "", now)
+		if perr, ok := err.(ParseError); !ok || perr.Line != 2 {
+			t.Errorf("Parsing %q: expected error on line 2, got %v", line, err)
+		}
+	}
+}
+
+func TestMappingReadings(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Measurement: "sensors", Tags: map[string]string{"host": "server", "device": "garden"},
+			Fields: map[string]float64{"Temp": 21.5, "uptime": 3600, "light": 300, "battery": 90}, Time: now, Line: 1},
+		{Measurement: "humidity", Tags: map[string]string{"device": "garden"},
+			Fields: map[string]float64{"value": 60}, Time: now, Line: 2},
+		{Measurement: "sensors", Tags: map[string]string{"host": "server", "device": "garden"},
+			Fields: map[string]float64{"soil_moisture": 40, "hum": 55, "temperature": 22, "lux": 310, "battery_level": 89},
+			Time: now.Add(time.Minute), Line: 3},
+		{Measurement: "system", Tags: map[string]string{"device": "garden"},
+			Fields: map[string]float64{"load": 1}, Time: now, Line: 4},
+		{Measurement: "moisture", Tags: map[string]string{"device": "garden"},
+			Fields: map[string]float64{"value": 41}, Time: now, Line: 5},
+	}
+
+	readings, err := Mapping{}.Readings("user", points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 2 {
+		t.Fatalf("Expected points merged into two readings, got %v", readings)
+	}
+
+	if r := readings[0]; r.CoreID != "garden" || r.UserEmail != "user" || r.Temperature != 21.5 || r.Humidity != 60 ||
+		r.Moisture != 41 || !r.Posted.Equal(now) {
+		t.Fatalf("Unexpected first reading %v", r)
+	}
+
+	if r := readings[1]; r.Moisture != 40 || r.Battery != 89 || r.Temperature != 22 {
+		t.Fatalf("Unexpected second reading %v", r)
+	}
+
+	readings, err = Mapping{CoreTags: []string{"host"}}.Readings("user", points[2:3])
+	if err != nil || len(readings) != 1 || readings[0].CoreID != "server" {
+		t.Fatalf("Expected core from host tag, got %v (%v)", readings, err)
+	}
+
+	readings, err = Mapping{CoreID: "core"}.Readings("user", points)
+	if err != nil || len(readings) != 2 || readings[0].CoreID != "core" {
+		t.Fatalf("Expected core given for batch, got %v (%v)", readings, err)
+	}
+
+	_, err = Mapping{CoreTags: []string{"room"}}.Readings("user", points)
+	if perr, ok := err.(ParseError); !ok || perr.Line != 1 {
+		t.Fatalf("Expected error for point without core, got %v", err)
+	}
+
+	// points not giving every metric between them aren't zero filled
+	_, err = Mapping{}.Readings("user", points[:4])
+	if perr, ok := err.(ParseError); !ok || perr.Line != 1 || !strings.HasSuffix(perr.Err.Error(), "missing moisture") {
+		t.Fatalf("Expected error for reading missing moisture, got %v", err)
+	}
+}
+
+func TestMappingWindowFill(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Measurement: "humidity", Tags: map[string]string{"device": "porch"},
+			Fields: map[string]float64{"value": 60}, Time: now.Add(time.Second * 2), Line: 1},
+		{Measurement: "temperature", Tags: map[string]string{"device": "porch"},
+			Fields: map[string]float64{"value": 21}, Time: now, Line: 2},
+		{Measurement: "temperature", Tags: map[string]string{"device": "porch"},
+			Fields: map[string]float64{"value": 22}, Time: now.Add(time.Second * 5), Line: 3},
+		{Measurement: "humidity", Tags: map[string]string{"device": "porch"},
+			Fields: map[string]float64{"value": 61}, Time: now.Add(time.Second * 30), Line: 4},
+	}
+
+	fill, err := ParseFill("moisture:0,light:0,battery:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Mapping{Fill: fill}.Readings("user", points)
+	if perr, ok := err.(ParseError); !ok || perr.Line != 2 || !strings.HasSuffix(perr.Err.Error(), "missing humidity") {
+		t.Fatalf("Expected points at different times not merged, got %v", err)
+	}
+
+	_, err = Mapping{Window: time.Second * 10}.Readings("user", points)
+	if perr, ok := err.(ParseError); !ok || perr.Line != 2 || !strings.HasSuffix(perr.Err.Error(), "missing moisture, light, battery") {
+		t.Fatalf("Expected error for reading missing unfilled metrics, got %v", err)
+	}
+
+	// the second temperature starts a reading, which the last humidity is
+	// too late to be merged into
+	readings, err := Mapping{Window: time.Second * 10, Fill: fill}.Readings("user", points[:3])
+	if err == nil {
+		t.Fatalf("Expected second temperature's reading missing humidity, got %v", readings)
+	}
+
+	readings, err = Mapping{Window: time.Minute, Fill: fill}.Readings("user", points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 2 {
+		t.Fatalf("Expected points merged into two readings, got %v", readings)
+	}
+
+	if r := readings[0]; !r.Posted.Equal(now) || r.Temperature != 21 || r.Humidity != 60 || r.Battery != 100 {
+		t.Fatalf("Unexpected first reading %v", r)
+	}
+
+	if r := readings[1]; !r.Posted.Equal(now.Add(time.Second*5)) || r.Temperature != 22 || r.Humidity != 61 {
+		t.Fatalf("Unexpected second reading %v", r)
+	}
+
+	for _, s := range []string{"moisture", "moisture:", "soil:0", "moisture:wet"} {
+		if _, err := ParseFill(s); err == nil {
+			t.Errorf("Expected error parsing fill %q", s)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package lineprotocol
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueField is the field name firmwares such as Tasmota and Home Assistant
+// use for the single value of a measurement named after its metric, e.g.
+// "temperature,device=porch value=21.5".
+const ValueField = "value"
+
+// DefaultCoreTags are the tags, in order of preference, a point's core is
+// taken from when no core is given for the batch.
+var DefaultCoreTags = []string{"coreid", "device", "host"}
+
+// FieldMetrics maps field, or measurement, names firmwares commonly use to
+// the metrics of readings.  Names are matched case insensitively.
+var FieldMetrics = map[string]string{
+	"temperature":   "temperature",
+	"temp":          "temperature",
+	"humidity":      "humidity",
+	"hum":           "humidity",
+	"moisture":      "moisture",
+	"soil_moisture": "moisture",
+	"light":         "light",
+	"illuminance":   "light",
+	"lux":           "light",
+	"battery":       "battery",
+	"battery_level": "battery",
+}
+
+// Mapping describes how points are mapped onto readings.  Points are
+// attributed to CoreID, if given, or else to the value of the first of
+// CoreTags they have.  Points of a core within Window of a reading's first
+// point, and giving metrics it doesn't have yet, are merged into it; firmwares
+// such as Tasmota and ESPHome send each metric as its own point, often at
+// slightly different times.  Fill gives the values of metrics a core's
+// points don't, e.g. those it has no sensor for.
+type Mapping struct {
+	CoreID   string
+	CoreTags []string
+	Window   time.Duration
+	Fill     map[string]float64
+}
+
+// ParseFill parses a comma separated list of metric:value pairs, such as
+// "moisture:0,battery:100", giving the values of metrics points don't.
+func ParseFill(s string) (map[string]float64, error) {
+	fill := make(map[string]float64)
+	if s == "" {
+		return fill, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid fill %q, expected metric:value", pair)
+		}
+
+		if _, ok := (models.Reading{}).Value(parts[0]); !ok {
+			return nil, fmt.Errorf("invalid fill %q, unknown metric %s", pair, parts[0])
+		}
+
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fill %q, %s is not a number", pair, parts[1])
+		}
+		fill[parts[0]] = value
+	}
+
+	return fill, nil
+}
+
+// Readings maps the points onto the user's readings, merging points of the
+// same core and time, or within the mapping's Window, into one reading
+// posted at the time of its first point.  Fields not naming a metric are
+// ignored; a field named ValueField names the metric by its measurement.
+// An error is returned if a point's core can't be determined, or if the
+// points of a reading don't give all of models.Metrics between them and the
+// mapping's Fill, rather than storing zero for those missing.
+func (m Mapping) Readings(userEmail string, points []Point) ([]models.Reading, error) {
+	tags := m.CoreTags
+	if len(tags) == 0 {
+		tags = DefaultCoreTags
+	}
+
+	// merged in time order, so each core's latest reading is the one points
+	// are merged into
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	var readings []models.Reading
+	var lines []int
+	var given []map[string]bool
+	latest := make(map[string]int)
+
+	for _, p := range sorted {
+		core := m.CoreID
+		for _, tag := range tags {
+			if core == "" {
+				core = p.Tags[tag]
+			}
+		}
+
+		if core == "" {
+			return nil, ParseError{Line: p.Line, Err: fmt.Errorf("no core given by tags %s", strings.Join(tags, ", "))}
+		}
+
+		var metrics []string
+		var values []float64
+		for field, value := range p.Fields {
+			name := field
+			if field == ValueField {
+				name = p.Measurement
+			}
+
+			if metric, ok := FieldMetrics[strings.ToLower(name)]; ok {
+				metrics, values = append(metrics, metric), append(values, value)
+			}
+		}
+
+		if len(metrics) == 0 {
+			continue
+		}
+
+		i, ok := latest[core]
+		if !ok || !m.merges(readings[i], given[i], p.Time, metrics) {
+			i = len(readings)
+			latest[core] = i
+			readings = append(readings, models.Reading{UserEmail: userEmail, CoreID: core, Posted: p.Time})
+			lines = append(lines, p.Line)
+			given = append(given, make(map[string]bool))
+		}
+
+		for j, metric := range metrics {
+			readings[i].SetValue(metric, values[j])
+			given[i][metric] = true
+		}
+	}
+
+	for i, reading := range readings {
+		var missing []string
+		for _, metric := range models.Metrics {
+			if given[i][metric] {
+				continue
+			}
+
+			if value, ok := m.Fill[metric]; ok {
+				readings[i].SetValue(metric, value)
+				continue
+			}
+
+			missing = append(missing, metric)
+		}
+
+		if len(missing) > 0 {
+			return nil, ParseError{Line: lines[i], Err: fmt.Errorf("reading of core %s at %s missing %s",
+				reading.CoreID, reading.Posted.Format(time.RFC3339Nano), strings.Join(missing, ", "))}
+		}
+	}
+
+	return readings, nil
+}
+
+// merges returns whether a point at the time, giving the metrics, is merged
+// into the reading: if at the reading's time or, when merging within a
+// window, within it and not giving a metric the reading already has.
+func (m Mapping) merges(reading models.Reading, given map[string]bool, posted time.Time, metrics []string) bool {
+	if posted.Equal(reading.Posted) {
+		return true
+	}
+
+	if posted.Sub(reading.Posted) > m.Window {
+		return false
+	}
+
+	for _, metric := range metrics {
+		if given[metric] {
+			return false
+		}
+	}
+
+	return true
+}
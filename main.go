@@ -8,21 +8,32 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/codegangsta/negroni"
 	"github.com/cyclopsci/apollo"
 	_ "github.com/lib/pq"
 	"github.com/serdmanczyk/bifrost"
+	"github.com/serdmanczyk/freyr/automation"
 	"github.com/serdmanczyk/freyr/database"
+	"github.com/serdmanczyk/freyr/devices"
 	"github.com/serdmanczyk/freyr/envflags"
 	"github.com/serdmanczyk/freyr/middleware"
+	"github.com/serdmanczyk/freyr/models"
 	"github.com/serdmanczyk/freyr/oauth"
+	"github.com/serdmanczyk/freyr/retention"
 	"github.com/serdmanczyk/freyr/routes"
+	"github.com/serdmanczyk/freyr/scheduler"
 	"github.com/serdmanczyk/freyr/token"
+	"github.com/serdmanczyk/freyr/validation"
+	"github.com/serdmanczyk/freyr/webhooks"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	// time zones for preferences, embedded as the image has no zoneinfo
+	_ "time/tzdata"
 )
 
 // Config represent the basic configuration needed by Freyr to operate.
@@ -31,10 +42,13 @@ type Config struct {
 	OauthClientSecret string `flag:"oauthClientSecret" env:"FREYR_OAUTHSECRET"`
 	Domain            string `flag:"domain" env:"FREYR_DOMAIN"`
 	SecretKey         string `flag:"secretkey" env:"FREYR_SECRET"`
-	DBHost            string `flag:"dbhost" env:"FREYR_DBHOST"`
-	DBUser            string `flag:"dbuser" env:"FREYR_DBUSER"`
-	DBPassword        string `flag:"dbpassw" env:"FREYR_DBPASSW"`
+	DBType            string `flag:"dbtype" env:"FREYR_DBTYPE" optional:"true"`
+	DBHost            string `flag:"dbhost" env:"FREYR_DBHOST" optional:"true"`
+	DBUser            string `flag:"dbuser" env:"FREYR_DBUSER" optional:"true"`
+	DBPassword        string `flag:"dbpassw" env:"FREYR_DBPASSW" optional:"true"`
+	DBPath            string `flag:"dbpath" env:"FREYR_DBPATH" optional:"true"`
 	DemoUser          string `flag:"demouser" env:"FREYR_DEMOUSER"`
+	Admins            string `flag:"admins" env:"FREYR_ADMINS" optional:"true"`
 }
 
 func main() {
@@ -50,7 +64,7 @@ func main() {
 
 	googleOauth := oauth.NewGoogleOauth(c.OauthClientID, c.OauthClientSecret, c.Domain)
 	tokenSource := token.JWTTokenGen(c.SecretKey)
-	dbConn, err := database.DBConn("postgres", c.DBHost, c.DBUser, c.DBPassword)
+	dbConn, err := openDB(c)
 	if err != nil {
 		log.Fatalf("Error initializing database conn: %s", err)
 	}
@@ -60,14 +74,89 @@ func main() {
 		bifrost.JobExpiry(time.Minute*60),
 	)
 
+	jobLedger := routes.NewJobLedger(workerDispatcher)
+	go func() {
+		for range time.Tick(time.Minute * 5) {
+			jobLedger.Prune()
+		}
+	}()
+	taskScheduler := scheduler.New(dbConn)
+	var readingStore models.ReadingStore = dbConn
+	var calibrationStore models.CalibrationStore = dbConn
+	var preferenceStore models.PreferenceStore = dbConn
+	var deviceStore models.DeviceStore = dbConn
+	var eventStore models.EventStore = dbConn
+	var plantStore models.PlantStore = dbConn
+	var retentionStore models.RetentionStore = dbConn
+
+	if dbConn.Dialect() == database.SQLite {
+		log.Print("SQLite stores only readings, users and secrets; readings are stored without validation or quarantine, " +
+			"and calibrations, preferences, devices, plants, commands, rules, webhooks, validation limits, retention and scheduled tasks require Postgres")
+
+		// readings are read without calibrations, preferences, devices,
+		// events, plants or rollups
+		unsupported := database.Unsupported{}
+		calibrationStore, preferenceStore, deviceStore = unsupported, unsupported, unsupported
+		eventStore, plantStore, retentionStore = unsupported, unsupported, unsupported
+
+		// without the scheduler's store, purge deleted readings here
+		go func() {
+			for now := range time.Tick(time.Hour) {
+				if _, err := dbConn.PurgeDeletions(now.Add(-models.DeletionGracePeriod)); err != nil {
+					log.Printf("Error purging deleted readings: %s", err)
+				}
+			}
+		}()
+	} else {
+		webhookPublisher := webhooks.NewPublisher(dbConn, dbConn, workerDispatcher)
+
+		taskScheduler.Register("retention", scheduler.Every(time.Hour), func(now time.Time) error {
+			return retention.Enforce(dbConn, dbConn, dbConn, dbConn, now)
+		})
+		taskScheduler.Register("device_status", scheduler.Every(time.Minute*5), func(now time.Time) error {
+			return devices.Check(dbConn, devices.Notifiers{devices.LogNotifier, webhookPublisher}, now)
+		})
+		taskScheduler.Register("command_expiry", scheduler.Every(time.Minute), func(now time.Time) error {
+			_, err := dbConn.ExpireCommands(now)
+			return err
+		})
+		taskScheduler.Register("webhook_retry", scheduler.Every(time.Minute), webhookPublisher.RetryDue)
+		taskScheduler.Register("deletion_purge", scheduler.Every(time.Hour), func(now time.Time) error {
+			_, err := dbConn.PurgeDeletions(now.Add(-models.DeletionGracePeriod))
+			return err
+		})
+		go taskScheduler.Start(time.Minute, nil)
+
+		ruleStore := webhooks.NewRuleStore(dbConn, webhookPublisher)
+		ruleEngine := automation.NewEngine(ruleStore, dbConn, dbConn, dbConn, dbConn, webhookPublisher)
+		readingStore = webhooks.NewReadingStore(automation.NewReadingStore(
+			devices.NewReadingStore(validation.NewReadingStore(dbConn, dbConn), dbConn), ruleEngine), webhookPublisher)
+	}
+
+	// routes of stores SQLite doesn't have answer 501 in SQLite mode
+	postgresOnly := func(h http.Handler) http.Handler {
+		if dbConn.Dialect() != database.SQLite {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, database.ErrorUnsupported.Error(), http.StatusNotImplemented)
+		})
+	}
+
 	webAuth := middleware.NewWebAuthorizer(tokenSource)
 	apiAuth := middleware.NewAPIAuthorizer(dbConn)
 	deviceAuth := middleware.NewDeviceAuthorizer(dbConn)
+	keyAuth := middleware.NewKeyAuthorizer(dbConn)
+	influxAuth := middleware.NewInfluxAuthorizer(dbConn)
 
 	apiAuthed := apollo.New(middleware.Authorize(apiAuth))
 	webAuthed := apollo.New(middleware.Authorize(webAuth))
 	webAPIAuthed := apollo.New(middleware.Authorize(webAuth, apiAuth))
 	apiDeviceAuthed := apollo.New(middleware.Authorize(apiAuth, deviceAuth))
+	apiKeyAuthed := apollo.New(middleware.Authorize(apiAuth, keyAuth))
+	writeAuthed := apollo.New(middleware.Authorize(apiAuth, deviceAuth, influxAuth))
+	adminAuthed := apollo.New(middleware.Authorize(webAuth, apiAuth), middleware.RequireAdmin(c.Admins))
 
 	rootMux := http.NewServeMux()
 	rootMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -80,16 +169,61 @@ func main() {
 	rootMux.Handle("/api/", http.StripPrefix("/api", apiMux))
 
 	apiMux.Handle("/user", webAPIAuthed.Then(routes.User(dbConn)))
+	apiMux.Handle("/account", webAPIAuthed.Then(routes.Account(dbConn, tokenSource, c.DemoUser)))
+	apiMux.Handle("/account/export", webAPIAuthed.Then(routes.ExportAccount(jobLedger, dbConn, calibrationStore, preferenceStore, retentionStore, dbConn, dbConn, deviceStore)))
+	apiMux.Handle("/preferences", webAPIAuthed.Then(routes.Preferences(preferenceStore)))
+	apiMux.Handle("/retention", webAPIAuthed.Then(routes.Retention(retentionStore)))
 	apiMux.Handle("/secret", webAuthed.Then(routes.GenerateSecret(dbConn)))
-	apiMux.Handle("/latest", webAPIAuthed.Then(routes.GetLatestReadings(dbConn)))
-	apiMux.Handle("/readings", webAPIAuthed.Then(routes.Readings(workerDispatcher, dbConn)))
+	apiMux.Handle("/latest", webAPIAuthed.Then(routes.GetLatestReadings(dbConn, calibrationStore, preferenceStore, deviceStore)))
+	apiMux.Handle("/aggregate", webAPIAuthed.Then(routes.Aggregate(dbConn, calibrationStore, preferenceStore, retentionStore)))
+	apiMux.Handle("/report", webAPIAuthed.Then(routes.Report(dbConn, calibrationStore, preferenceStore, deviceStore)))
+	apiMux.Handle("/today", webAPIAuthed.Then(routes.Today(dbConn, calibrationStore, preferenceStore)))
+	apiMux.Handle("/readings", webAPIAuthed.Then(routes.Readings(jobLedger, readingStore, calibrationStore, preferenceStore, eventStore, plantStore)))
 
-	apiMux.Handle("/reading", apiDeviceAuthed.Then(routes.PostReading(dbConn)))
+	apiMux.Handle("/devices", webAPIAuthed.Then(routes.Devices(deviceStore)))
+	apiMux.Handle("/devices/", routes.Subresources("devices", map[string]http.Handler{
+		"battery":  webAPIAuthed.Then(routes.Battery(dbConn, calibrationStore)),
+		"commands": postgresOnly(webAPIAuthed.Then(routes.Commands(dbConn))),
+	}))
+	apiMux.Handle("/zones", webAPIAuthed.Then(routes.Zones(plantStore)))
+	apiMux.Handle("/plants", webAPIAuthed.Then(routes.Plants(plantStore)))
+	apiMux.Handle("/plants/", routes.Subresources("plants", map[string]http.Handler{
+		"assignments": webAPIAuthed.Then(routes.PlantAssignments(plantStore)),
+		"readings":    webAPIAuthed.Then(routes.PlantReadings(plantStore, dbConn, calibrationStore, preferenceStore, eventStore)),
+	}))
+	apiMux.Handle("/rules", postgresOnly(webAPIAuthed.Then(routes.Rules(dbConn))))
+	apiMux.Handle("/rules/", routes.Subresources("rules", map[string]http.Handler{
+		"executions": postgresOnly(webAPIAuthed.Then(routes.RuleExecutions(dbConn))),
+	}))
+	apiMux.Handle("/webhooks", postgresOnly(webAPIAuthed.Then(routes.Webhooks(dbConn))))
+	apiMux.Handle("/webhooks/", routes.Subresources("webhooks", map[string]http.Handler{
+		"deliveries": postgresOnly(webAPIAuthed.Then(routes.WebhookDeliveries(dbConn))),
+	}))
+	apiMux.Handle("/events", webAPIAuthed.Then(routes.Events(eventStore, plantStore)))
+	apiMux.Handle("/events/response", webAPIAuthed.Then(routes.WateringResponses(eventStore, plantStore, dbConn, calibrationStore)))
+	apiMux.Handle("/quarantine", postgresOnly(webAPIAuthed.Then(routes.Quarantine(dbConn, dbConn))))
+	apiMux.Handle("/validation", postgresOnly(webAPIAuthed.Then(routes.ValidationLimits(dbConn))))
+	apiMux.Handle("/calibrations", webAPIAuthed.Then(routes.Calibrations(calibrationStore)))
 
-	apiMux.Handle("/job", apiAuthed.Then(routes.Jobs(workerDispatcher)))
+	apiMux.Handle("/reading", apiDeviceAuthed.Then(routes.PostReading(readingStore)))
+	apiMux.Handle("/write", writeAuthed.Then(routes.Write(readingStore)))
+	apiMux.Handle("/commands", postgresOnly(apiDeviceAuthed.Then(routes.PollCommands(dbConn, deviceStore))))
+	apiMux.Handle("/commands/ack", postgresOnly(apiDeviceAuthed.Then(routes.AckCommand(dbConn))))
+
+	apiMux.Handle("/job", apiAuthed.Then(routes.Jobs(jobLedger)))
 	apiMux.Handle("/delete_readings", apiAuthed.Then(routes.DeleteReadings(dbConn)))
+	apiMux.Handle("/undo_delete_readings", apiAuthed.Then(routes.UndoDeleteReadings(dbConn)))
 	apiMux.Handle("/rotate_secret", apiAuthed.Then(routes.RotateSecret(dbConn)))
 
+	apiMux.Handle("/metrics", apiKeyAuthed.Then(routes.Metrics(dbConn, calibrationStore)))
+	apiMux.Handle("/read", apiKeyAuthed.Then(routes.RemoteRead(dbConn, calibrationStore)))
+	apiMux.Handle("/grafana/", apiKeyAuthed.Then(routes.GrafanaTest()))
+	apiMux.Handle("/grafana/search", apiKeyAuthed.Then(routes.GrafanaSearch(dbConn)))
+	apiMux.Handle("/grafana/query", apiKeyAuthed.Then(routes.GrafanaQuery(dbConn, calibrationStore, preferenceStore, retentionStore)))
+	apiMux.Handle("/grafana/annotations", apiKeyAuthed.Then(routes.GrafanaAnnotations(eventStore, plantStore)))
+
+	apiMux.Handle("/tasks", postgresOnly(adminAuthed.Then(routes.Tasks(taskScheduler, jobLedger))))
+
 	apiMux.Handle("/authorize", oauth.HandleAuthorize(googleOauth, tokenSource))
 	apiMux.Handle("/oauth2callback", oauth.HandleOAuth2Callback(googleOauth, tokenSource, dbConn))
 	apiMux.Handle("/logout", oauth.LogOut())
@@ -101,3 +235,24 @@ func main() {
 	n.UseHandler(rootMux)
 	n.Run(":80")
 }
+
+// openDB connects to the database configured by dbtype: Postgres, by
+// default, at dbhost, or SQLite, in the file at dbpath.
+func openDB(c Config) (database.DB, error) {
+	switch c.DBType {
+	case "", database.Postgres:
+		if c.DBHost == "" || c.DBUser == "" || c.DBPassword == "" {
+			return database.DB{}, errors.New("dbhost, dbuser and dbpassw are required for postgres")
+		}
+
+		return database.DBConn(database.Postgres, c.DBHost, c.DBUser, c.DBPassword)
+	case "sqlite", database.SQLite:
+		if c.DBPath == "" {
+			return database.DB{}, errors.New("dbpath is required for sqlite")
+		}
+
+		return database.SQLiteConn(c.DBPath)
+	}
+
+	return database.DB{}, fmt.Errorf("unknown dbtype %s; expected postgres or sqlite", c.DBType)
+}
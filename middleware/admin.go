@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/cyclopsci/apollo"
+	"golang.org/x/net/context"
+	"net/http"
+	"strings"
+)
+
+// RequireAdmin returns a piece of middleware that only calls subsequent
+// handlers if the authorized user is one of the given comma separated admin
+// emails; with none, every request is forbidden.  It must follow Authorize.
+func RequireAdmin(admins string) apollo.Constructor {
+	adminSet := make(map[string]bool)
+	for _, admin := range strings.Split(admins, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			adminSet[admin] = true
+		}
+	}
+
+	return apollo.Constructor(func(next apollo.Handler) apollo.Handler {
+		return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			email, _ := ctx.Value("email").(string)
+			if !adminSet[email] {
+				http.Error(w, "Request forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(ctx, w, r)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/cyclopsci/apollo"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	for _, tc := range []struct {
+		email string
+		code  int
+	}{
+		{email: testEmail, code: http.StatusOK},
+		{email: "loki@asgard.unv", code: http.StatusForbidden},
+		{email: "", code: http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("GET", "/whatever", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := apollo.New(withEmail(tc.email), RequireAdmin("odin@asgard.unv, "+testEmail)).ThenFunc(happyHandler)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.code {
+			t.Errorf("%q: expected %d, got %d", tc.email, tc.code, resp.Code)
+		}
+	}
+}
+
+// withEmail returns middleware authorizing requests as the given user, if
+// not empty.
+func withEmail(email string) apollo.Constructor {
+	return apollo.Constructor(func(next apollo.Handler) apollo.Handler {
+		return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if email != "" {
+				ctx = context.WithValue(ctx, "email", email)
+			}
+			next.ServeHTTP(ctx, w, r)
+		})
+	})
+}
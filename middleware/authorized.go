@@ -10,6 +10,7 @@ import (
 	"golang.org/x/net/context"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -179,7 +180,8 @@ func NewDeviceAuthorizer(ss models.SecretStore) *DeviceAuthorizer {
 
 // Authorize validates a a valid JWT signature header is present signed by
 // the user's secret and that the content in the signature matches the headers
-// describing the user and core on who's behalf the request was made.
+// describing the user and core on who's behalf the request was made.  The
+// core is given by the "coreid" form value, in the body or query string.
 func (d *DeviceAuthorizer) Authorize(ctx context.Context, r *http.Request) context.Context {
 	authType := r.Header.Get(AuthTypeHeader)
 	if authType != DeviceAuthTypeValue {
@@ -196,7 +198,7 @@ func (d *DeviceAuthorizer) Authorize(ctx context.Context, r *http.Request) conte
 		return nil
 	}
 
-	requestCoreID := r.PostFormValue("coreid")
+	requestCoreID := r.FormValue("coreid")
 	if requestCoreID == "" {
 		return nil
 	}
@@ -222,3 +224,93 @@ func (d *DeviceAuthorizer) Authorize(ctx context.Context, r *http.Request) conte
 
 	return context.WithValue(ctx, "email", requestUserEmail)
 }
+
+// apiKeyScope is the string signed by a user's secret to derive their API
+// key.
+const apiKeyScope = "freyr-api-key"
+
+// APIKey returns the API key derived from a user's secret, for clients such
+// as Prometheus that can't sign each request but can send static
+// credentials.  Rotating the secret revokes the key.
+func APIKey(s models.Secret) string {
+	return s.Sign(apiKeyScope)
+}
+
+// KeyAuthorizer is a type used to verify requests carry a user's API key,
+// as the password of HTTP basic authentication with the user's email as
+// the username.
+type KeyAuthorizer struct {
+	secretStore models.SecretStore
+}
+
+// NewKeyAuthorizer returns a new *KeyAuthorizer
+func NewKeyAuthorizer(ss models.SecretStore) *KeyAuthorizer {
+	return &KeyAuthorizer{secretStore: ss}
+}
+
+// Authorize validates the request's basic authentication password is the
+// API key derived from the user's secret.
+func (k *KeyAuthorizer) Authorize(ctx context.Context, r *http.Request) context.Context {
+	userEmail, key, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	return authorizeKey(ctx, k.secretStore, userEmail, key)
+}
+
+// authorizeKey returns a context indicating the user if the key is the API
+// key derived from their secret, or else nil.
+func authorizeKey(ctx context.Context, ss models.SecretStore, userEmail, key string) context.Context {
+	if userEmail == "" {
+		return nil
+	}
+
+	userSecret, err := ss.GetSecret(userEmail)
+	if err != nil {
+		return nil
+	}
+
+	if !userSecret.Verify(apiKeyScope, key) {
+		return nil
+	}
+
+	return context.WithValue(ctx, "email", userEmail)
+}
+
+// influxTokenPrefix precedes the "username:password" credentials of an
+// Authorization header sent by InfluxDB clients.
+const influxTokenPrefix = "Token "
+
+// InfluxAuthorizer is a type used to verify requests carry a user's API key
+// in any of the ways InfluxDB clients send credentials, with the user's
+// email as the username: HTTP basic authentication, the "u" and "p" query
+// options, or an "Authorization: Token email:key" header.
+type InfluxAuthorizer struct {
+	secretStore models.SecretStore
+}
+
+// NewInfluxAuthorizer returns a new *InfluxAuthorizer
+func NewInfluxAuthorizer(ss models.SecretStore) *InfluxAuthorizer {
+	return &InfluxAuthorizer{secretStore: ss}
+}
+
+// Authorize validates the request's credentials give the API key derived
+// from the user's secret.
+func (i *InfluxAuthorizer) Authorize(ctx context.Context, r *http.Request) context.Context {
+	userEmail, key, ok := r.BasicAuth()
+	if !ok {
+		query := r.URL.Query()
+		userEmail, key = query.Get("u"), query.Get("p")
+	}
+
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, influxTokenPrefix) {
+		credentials := strings.SplitN(strings.TrimPrefix(authorization, influxTokenPrefix), ":", 2)
+		if len(credentials) != 2 {
+			return nil
+		}
+		userEmail, key = credentials[0], credentials[1]
+	}
+
+	return authorizeKey(ctx, i.secretStore, userEmail, key)
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -104,7 +105,7 @@ func TestApiAuthorizer(t *testing.T) {
 
 	authorizeRequest, err := http.NewRequest("GET", "/authorize", nil)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Error(err)
 	}
 
 	SignRequest(secret, userEmail, authorizeRequest)
@@ -144,7 +145,7 @@ func TestDeviceAuthorizer(t *testing.T) {
 	body := strings.NewReader("event=post_reading&data=%7B%20%22temperature%22%3A%2019.800%2C%20%22humidity%22%3A%2057.300%2C%20%22moisture%22%3A%200000%2C%20%22light%22%3A%201.000%20%7D&published_at=2016-04-20T04%3A32%3A52.962Z&coreid=" + coreID)
 	authorizeRequest, err := http.NewRequest("POST", "/authorize", body)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Error(err)
 	}
 
 	authorizeRequest.Header.Add(AuthTypeHeader, DeviceAuthTypeValue)
@@ -176,3 +177,135 @@ func TestDeviceAuthorizer(t *testing.T) {
 		t.Errorf("Email in signed token not made available to context, got %s expected %s", email, testEmail)
 	}
 }
+
+func TestKeyAuthorizer(t *testing.T) {
+	secret, err := models.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userEmail := "badwolf@galifrey.unv"
+
+	ss := fake.SecretStore{userEmail: secret}
+	handler := apollo.New(Authorize(NewKeyAuthorizer(ss))).ThenFunc(happyHandler)
+
+	for _, tc := range []struct {
+		user, key string
+		code      int
+	}{
+		{userEmail, APIKey(secret), http.StatusOK},
+		{userEmail, secret.Encode(), http.StatusUnauthorized},
+		{"unknown@galifrey.unv", APIKey(secret), http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		authorizeRequest, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.user != "" {
+			authorizeRequest.SetBasicAuth(tc.user, tc.key)
+		}
+
+		authorizeResponse := httptest.NewRecorder()
+		handler.ServeHTTP(authorizeResponse, authorizeRequest)
+
+		if authorizeResponse.Code != tc.code {
+			t.Errorf("Response code incorrect for %s.  Expected %d, got %d", tc.user, tc.code, authorizeResponse.Code)
+		}
+
+		if tc.code == http.StatusOK && authorizeResponse.Header().Get("Email") != userEmail {
+			t.Errorf("Email not made available to context, got %s expected %s", authorizeResponse.Header().Get("Email"), userEmail)
+		}
+	}
+}
+
+func TestInfluxAuthorizer(t *testing.T) {
+	secret, err := models.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userEmail := "badwolf@galifrey.unv"
+
+	ss := fake.SecretStore{userEmail: secret}
+	handler := apollo.New(Authorize(NewInfluxAuthorizer(ss))).ThenFunc(happyHandler)
+
+	for _, tc := range []struct {
+		name  string
+		setup func(r *http.Request)
+		code  int
+	}{
+		{"basic", func(r *http.Request) { r.SetBasicAuth(userEmail, APIKey(secret)) }, http.StatusOK},
+		{"query", func(r *http.Request) {
+			r.URL.RawQuery = url.Values{"u": {userEmail}, "p": {APIKey(secret)}}.Encode()
+		}, http.StatusOK},
+		{"token", func(r *http.Request) { r.Header.Set("Authorization", "Token "+userEmail+":"+APIKey(secret)) }, http.StatusOK},
+		{"token secret", func(r *http.Request) { r.Header.Set("Authorization", "Token "+userEmail+":"+secret.Encode()) }, http.StatusUnauthorized},
+		{"token without user", func(r *http.Request) { r.Header.Set("Authorization", "Token "+APIKey(secret)) }, http.StatusUnauthorized},
+		{"query unknown user", func(r *http.Request) {
+			r.URL.RawQuery = url.Values{"u": {"unknown@galifrey.unv"}, "p": {APIKey(secret)}}.Encode()
+		}, http.StatusUnauthorized},
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+	} {
+		authorizeRequest, err := http.NewRequest("POST", "/write", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.setup(authorizeRequest)
+
+		authorizeResponse := httptest.NewRecorder()
+		handler.ServeHTTP(authorizeResponse, authorizeRequest)
+
+		if authorizeResponse.Code != tc.code {
+			t.Errorf("Response code incorrect for %s.  Expected %d, got %d", tc.name, tc.code, authorizeResponse.Code)
+		}
+
+		if tc.code == http.StatusOK && authorizeResponse.Header().Get("Email") != userEmail {
+			t.Errorf("Email not made available to context for %s, got %s", tc.name, authorizeResponse.Header().Get("Email"))
+		}
+	}
+}
+
+func TestDeviceAuthorizerQueryCore(t *testing.T) {
+	secret, err := models.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userEmail := "badwolf@galifrey.unv"
+	coreID := "53ff76065075535110341387"
+
+	ss := fake.SecretStore{userEmail: secret}
+	handler := apollo.New(Authorize(NewDeviceAuthorizer(ss))).ThenFunc(happyHandler)
+
+	token, err := token.GenerateDeviceToken(token.JWTTokenGen(secret), time.Now().Add(time.Second), coreID, userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		core string
+		code int
+	}{
+		{coreID, http.StatusOK},
+		{"someothercore", http.StatusUnauthorized},
+	} {
+		body := strings.NewReader("sensors temperature=19.8")
+		authorizeRequest, err := http.NewRequest("POST", "/write?coreid="+tc.core, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authorizeRequest.Header.Add(AuthTypeHeader, DeviceAuthTypeValue)
+		authorizeRequest.Header.Add(AuthUserHeader, userEmail)
+		authorizeRequest.Header.Add(TokenHeader, token)
+
+		authorizeResponse := httptest.NewRecorder()
+		handler.ServeHTTP(authorizeResponse, authorizeRequest)
+
+		if authorizeResponse.Code != tc.code {
+			t.Errorf("Response code incorrect for core %s.  Expected %d, got %d", tc.core, tc.code, authorizeResponse.Code)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "errors"
+
+// ErrorExportNotReady is returned when an account export is downloaded
+// before its job completes.
+var ErrorExportNotReady = errors.New("export not ready")
+
+// AccountStore is an interface for any type that can delete a user's
+// account.  DeleteAccount removes everything stored for the user, including
+// their readings, those deleted but not yet purged, and their secret, and
+// then the user, returning ErrorUserDoesntExist if the user isn't stored.
+type AccountStore interface {
+	DeleteAccount(userEmail string) error
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Aggregation intervals with special meaning; any other interval is parsed
+// as a time.Duration.
+const (
+	// IntervalDay buckets readings by calendar day in the aggregation's time
+	// zone, so buckets span 23 or 25 hours across daylight saving changes.
+	IntervalDay = "day"
+	// IntervalHour buckets readings by the hour in the aggregation's time
+	// zone.
+	IntervalHour = "hour"
+)
+
+// ErrorInvalidInterval is returned when an aggregation interval is neither a
+// named interval nor a positive duration.
+var ErrorInvalidInterval = errors.New("Invalid aggregation interval")
+
+// MetricSummary summarizes the values of one metric within an aggregation
+// bucket.
+type MetricSummary struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	Count int     `json:"count"`
+}
+
+// Aggregate summarizes a core's readings within a bucket of time starting at
+// Start.
+type Aggregate struct {
+	CoreID  string                   `json:"coreid"`
+	Start   time.Time                `json:"start"`
+	Metrics map[string]MetricSummary `json:"metrics"`
+}
+
+// Bucketer maps times to the start of the aggregation bucket they fall in.
+type Bucketer func(time.Time) time.Time
+
+// NewBucketer returns a Bucketer for the given interval with buckets aligned
+// to the local time of loc.
+func NewBucketer(interval string, loc *time.Location) (Bucketer, error) {
+	switch interval {
+	case IntervalDay:
+		return func(t time.Time) time.Time {
+			y, m, d := t.In(loc).Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, loc)
+		}, nil
+	case IntervalHour:
+		interval = time.Hour.String()
+	}
+
+	step, err := time.ParseDuration(interval)
+	if err != nil || step <= 0 {
+		return nil, ErrorInvalidInterval
+	}
+
+	return func(t time.Time) time.Time {
+		// align to local time so e.g. hours in half-hour offset zones
+		// start on the local hour
+		_, offset := t.In(loc).Zone()
+		shift := time.Duration(offset) * time.Second
+		return t.Add(shift).Truncate(step).Add(-shift).In(loc)
+	}, nil
+}
+
+// Merge combines the summary with another summary of the same metric.
+func (m MetricSummary) Merge(other MetricSummary) MetricSummary {
+	if m.Count == 0 {
+		return other
+	}
+
+	if other.Count == 0 {
+		return m
+	}
+
+	count := m.Count + other.Count
+	return MetricSummary{
+		Min:   math.Min(m.Min, other.Min),
+		Max:   math.Max(m.Max, other.Max),
+		Mean:  (m.Mean*float64(m.Count) + other.Mean*float64(other.Count)) / float64(count),
+		Count: count,
+	}
+}
+
+// Map returns the aggregate with f applied to readings built from the
+// minimum, maximum and mean of each metric, posted at the aggregate's start.
+// It is used to calibrate or convert aggregates as if they were readings;
+// minimums and maximums are swapped if f is decreasing.
+func (a Aggregate) Map(f func(Reading) Reading) Aggregate {
+	min := Reading{CoreID: a.CoreID, Posted: a.Start}
+	max, mean := min, min
+	for metric, summary := range a.Metrics {
+		min.SetValue(metric, summary.Min)
+		max.SetValue(metric, summary.Max)
+		mean.SetValue(metric, summary.Mean)
+	}
+
+	min, max, mean = f(min), f(max), f(mean)
+
+	mapped := Aggregate{CoreID: a.CoreID, Start: a.Start, Metrics: make(map[string]MetricSummary, len(a.Metrics))}
+	for metric, summary := range a.Metrics {
+		minValue, _ := min.Value(metric)
+		maxValue, _ := max.Value(metric)
+		meanValue, _ := mean.Value(metric)
+		mapped.Metrics[metric] = MetricSummary{
+			Min:   math.Min(minValue, maxValue),
+			Max:   math.Max(minValue, maxValue),
+			Mean:  meanValue,
+			Count: summary.Count,
+		}
+	}
+
+	return mapped
+}
+
+// AggregateReadings groups readings by core and bucket and summarizes each
+// metric.  Aggregates are ordered by core then start.
+func AggregateReadings(readings []Reading, bucket Bucketer) []Aggregate {
+	aggregates := make([]Aggregate, 0, len(readings))
+	for _, r := range readings {
+		agg := Aggregate{CoreID: r.CoreID, Start: r.Posted, Metrics: make(map[string]MetricSummary, len(Metrics))}
+		for _, metric := range Metrics {
+			value, _ := r.Value(metric)
+			agg.Metrics[metric] = MetricSummary{Min: value, Max: value, Mean: value, Count: 1}
+		}
+		aggregates = append(aggregates, agg)
+	}
+
+	return MergeAggregates(aggregates, bucket)
+}
+
+// MergeAggregates regroups aggregates, such as rollups of a finer interval,
+// into the bucket their start falls in, combining summaries of aggregates
+// for the same core and bucket.  Aggregates are ordered by core then start.
+func MergeAggregates(aggregates []Aggregate, bucket Bucketer) []Aggregate {
+	type key struct {
+		core  string
+		start int64
+	}
+
+	merged := make(map[key]*Aggregate)
+	for _, a := range aggregates {
+		start := bucket(a.Start)
+		k := key{core: a.CoreID, start: start.UnixNano()}
+
+		agg, ok := merged[k]
+		if !ok {
+			agg = &Aggregate{CoreID: a.CoreID, Start: start, Metrics: make(map[string]MetricSummary)}
+			merged[k] = agg
+		}
+
+		for metric, summary := range a.Metrics {
+			agg.Metrics[metric] = agg.Metrics[metric].Merge(summary)
+		}
+	}
+
+	result := make([]Aggregate, 0, len(merged))
+	for _, agg := range merged {
+		result = append(result, *agg)
+	}
+
+	sort.Sort(byCoreStart(result))
+	return result
+}
+
+type byCoreStart []Aggregate
+
+func (a byCoreStart) Len() int      { return len(a) }
+func (a byCoreStart) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byCoreStart) Less(i, j int) bool {
+	if a[i].CoreID != a[j].CoreID {
+		return a[i].CoreID < a[j].CoreID
+	}
+	return a[i].Start.Before(a[j].Start)
+}
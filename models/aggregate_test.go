@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketerDay(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := NewBucketer(IntervalDay, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 02:00 UTC is still the previous day in New York
+	start := bucket(time.Date(2016, 5, 10, 2, 0, 0, 0, time.UTC))
+	expected := time.Date(2016, 5, 9, 0, 0, 0, 0, newYork)
+	if !start.Equal(expected) {
+		t.Fatalf("Incorrect bucket; expected %s, got %s", expected, start)
+	}
+
+	// daylight saving starts 2016-03-13, that day is 23 hours long
+	dstStart := bucket(time.Date(2016, 3, 13, 12, 0, 0, 0, newYork))
+	nextDay := bucket(time.Date(2016, 3, 14, 12, 0, 0, 0, newYork))
+	if nextDay.Sub(dstStart) != time.Hour*23 {
+		t.Fatalf("Daylight saving day should be 23 hours, got %s", nextDay.Sub(dstStart))
+	}
+}
+
+func TestBucketerDuration(t *testing.T) {
+	kolkata := time.FixedZone("IST", int(time.Hour*5+time.Minute*30)/int(time.Second))
+
+	bucket, err := NewBucketer(IntervalHour, kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := bucket(time.Date(2016, 5, 10, 12, 45, 0, 0, kolkata))
+	expected := time.Date(2016, 5, 10, 12, 0, 0, 0, kolkata)
+	if !start.Equal(expected) {
+		t.Fatalf("Hours should align to local time; expected %s, got %s", expected, start)
+	}
+
+	for _, invalid := range []string{"week", "-5m", "0s"} {
+		if _, err := NewBucketer(invalid, time.UTC); err != ErrorInvalidInterval {
+			t.Errorf("Interval %q should be invalid, got %v", invalid, err)
+		}
+	}
+}
+
+func TestAggregateReadings(t *testing.T) {
+	bucket, err := NewBucketer(IntervalDay, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readings := []Reading{
+		{CoreID: "b", Posted: day.Add(time.Hour), Temperature: 10},
+		{CoreID: "a", Posted: day.Add(time.Hour * 26), Temperature: 30},
+		{CoreID: "a", Posted: day.Add(time.Hour), Temperature: 10},
+		{CoreID: "a", Posted: day.Add(time.Hour * 2), Temperature: 20},
+	}
+
+	aggregates := AggregateReadings(readings, bucket)
+	if len(aggregates) != 3 {
+		t.Fatalf("Expected 3 aggregates, got %d", len(aggregates))
+	}
+
+	first := aggregates[0]
+	if first.CoreID != "a" || !first.Start.Equal(day) {
+		t.Fatalf("Aggregates not ordered by core and start: %v", aggregates)
+	}
+
+	temperature := first.Metrics["temperature"]
+	if temperature.Min != 10 || temperature.Max != 20 || temperature.Mean != 15 || temperature.Count != 2 {
+		t.Fatalf("Incorrect temperature summary: %v", temperature)
+	}
+}
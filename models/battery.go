@@ -0,0 +1,133 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Discharge rate trends, comparing the rate over the later half of the
+// current discharge to the earlier half.
+const (
+	BatteryTrendAccelerating = "accelerating"
+	BatteryTrendSteady       = "steady"
+	BatteryTrendSlowing      = "slowing"
+)
+
+const (
+	// ChargeThreshold is the rise in battery percentage between consecutive
+	// readings taken to mean the battery was charged or replaced.
+	ChargeThreshold = 10.0
+	// steadyTrend is the relative change in discharge rate within which the
+	// rate is considered steady.
+	steadyTrend = 0.1
+	day         = float64(time.Hour * 24)
+)
+
+// ChargeEvent is a rise in a core's battery level between two readings.
+type ChargeEvent struct {
+	Posted time.Time `json:"posted"`
+	From   float64   `json:"from"`
+	To     float64   `json:"to"`
+}
+
+// BatteryForecast estimates when a core's battery will be empty from the
+// readings since it was last charged.  DischargeRate is in percent per day;
+// DaysUntilEmpty and EmptyAt are nil unless the battery is discharging.
+type BatteryForecast struct {
+	CoreID         string       `json:"coreid"`
+	Level          float64      `json:"level"`
+	Posted         time.Time    `json:"posted"`
+	DischargeRate  float64      `json:"discharge_rate"`
+	Trend          string       `json:"trend,omitempty"`
+	DaysUntilEmpty *float64     `json:"days_until_empty"`
+	EmptyAt        *time.Time   `json:"empty_at"`
+	LastCharge     *ChargeEvent `json:"last_charge"`
+	Readings       int          `json:"readings"`
+}
+
+// ForecastBattery fits a line to the battery levels of the core's readings
+// since the last charge event and extrapolates it to zero.  Readings may be
+// in any order.
+func ForecastBattery(core string, readings []Reading) BatteryForecast {
+	forecast := BatteryForecast{CoreID: core}
+	if len(readings) == 0 {
+		return forecast
+	}
+
+	sorted := append([]Reading(nil), readings...)
+	SortReadings(sorted)
+
+	discharge := sorted
+	for i := 1; i < len(sorted); i++ {
+		if rise := sorted[i].Battery - sorted[i-1].Battery; rise >= ChargeThreshold {
+			forecast.LastCharge = &ChargeEvent{Posted: sorted[i].Posted, From: sorted[i-1].Battery, To: sorted[i].Battery}
+			discharge = sorted[i:]
+		}
+	}
+
+	latest := discharge[len(discharge)-1]
+	forecast.Level, forecast.Posted, forecast.Readings = latest.Battery, latest.Posted, len(discharge)
+
+	rate, ok := dischargeRate(discharge)
+	if !ok {
+		return forecast
+	}
+	forecast.DischargeRate = rate
+
+	half := len(discharge) / 2
+	early, earlyOK := dischargeRate(discharge[:half])
+	late, lateOK := dischargeRate(discharge[half:])
+	if earlyOK && lateOK {
+		switch change := late - early; {
+		case math.Abs(change) <= math.Abs(rate)*steadyTrend:
+			forecast.Trend = BatteryTrendSteady
+		case change > 0:
+			forecast.Trend = BatteryTrendAccelerating
+		default:
+			forecast.Trend = BatteryTrendSlowing
+		}
+	}
+
+	if rate > 0 {
+		days := math.Max(latest.Battery, 0) / rate
+		emptyAt := latest.Posted.Add(time.Duration(days * day))
+		forecast.DaysUntilEmpty, forecast.EmptyAt = &days, &emptyAt
+	}
+
+	return forecast
+}
+
+// dischargeRate returns the negated slope of battery level over time in
+// percent per day.
+func dischargeRate(readings []Reading) (rate float64, ok bool) {
+	slope, ok := slopePerDay(readings, "battery")
+	return -slope, ok
+}
+
+// slopePerDay returns the least squares slope of the metric over time in
+// units per day.  It isn't ok for fewer than two readings or readings all
+// posted at the same time.
+func slopePerDay(readings []Reading, metric string) (slope float64, ok bool) {
+	if len(readings) < 2 {
+		return 0, false
+	}
+
+	origin := readings[0].Posted
+	var sumX, sumY, sumXY, sumXX float64
+	for _, r := range readings {
+		x := float64(r.Posted.Sub(origin)) / day
+		y, _ := r.Value(metric)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(readings))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestForecastBattery(t *testing.T) {
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var readings []Reading
+	level := 40.0
+	for hour := 0; hour < 24*10; hour++ {
+		posted := start.Add(time.Hour * time.Duration(hour))
+		if hour == 24*4 {
+			// swapped for a fresh battery on day 4
+			level = 95
+		}
+
+		readings = append(readings, Reading{CoreID: "core", Posted: posted, Battery: level})
+		level -= 5.0 / 24
+	}
+
+	// out of order readings are sorted
+	readings[0], readings[len(readings)-1] = readings[len(readings)-1], readings[0]
+
+	forecast := ForecastBattery("core", readings)
+
+	if forecast.LastCharge == nil || !forecast.LastCharge.Posted.Equal(start.AddDate(0, 0, 4)) || forecast.LastCharge.To != 95 {
+		t.Fatalf("Unexpected last charge %v", forecast.LastCharge)
+	}
+
+	if forecast.Readings != 24*6 {
+		t.Errorf("Expected forecast from %d readings, got %d", 24*6, forecast.Readings)
+	}
+
+	if math.Abs(forecast.DischargeRate-5) > epsilon {
+		t.Errorf("Expected discharge rate of 5%%/day, got %f", forecast.DischargeRate)
+	}
+
+	if forecast.Trend != BatteryTrendSteady {
+		t.Errorf("Expected steady trend, got %q", forecast.Trend)
+	}
+
+	expectedDays := forecast.Level / 5
+	if forecast.DaysUntilEmpty == nil || math.Abs(*forecast.DaysUntilEmpty-expectedDays) > epsilon {
+		t.Errorf("Expected %f days until empty, got %v", expectedDays, forecast.DaysUntilEmpty)
+	}
+}
+
+func TestForecastBatteryTrend(t *testing.T) {
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var readings []Reading
+	level := 100.0
+	for hour := 0; hour < 24*6; hour++ {
+		readings = append(readings, Reading{Posted: start.Add(time.Hour * time.Duration(hour)), Battery: level})
+		if hour < 24*3 {
+			level -= 2.0 / 24
+		} else {
+			level -= 8.0 / 24
+		}
+	}
+
+	if forecast := ForecastBattery("core", readings); forecast.Trend != BatteryTrendAccelerating {
+		t.Errorf("Expected accelerating trend, got %q", forecast.Trend)
+	}
+
+	for i := range readings {
+		readings[i].Battery = 80
+	}
+
+	forecast := ForecastBattery("core", readings)
+	if forecast.DischargeRate != 0 || forecast.DaysUntilEmpty != nil || forecast.EmptyAt != nil {
+		t.Errorf("Expected no discharge for a constant level, got %v", forecast)
+	}
+}
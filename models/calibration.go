@@ -0,0 +1,173 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Calibration kinds describe how a Calibration maps raw values.
+const (
+	// CalibrationLinear maps raw values as raw*Scale + Offset.
+	CalibrationLinear = "linear"
+	// CalibrationPolynomial maps raw values as the sum of
+	// Coefficients[i]*raw^i.
+	CalibrationPolynomial = "polynomial"
+	// CalibrationTable maps raw values by linear interpolation between the
+	// nearest Points, clamping to the first and last point's values.
+	CalibrationTable = "table"
+)
+
+var (
+	// ErrorCalibrationDoesntExist is returned from a CalibrationStore when a
+	// requested calibration doesn't exist.
+	ErrorCalibrationDoesntExist = errors.New("No calibration exists for given criterion")
+	// ErrorInvalidCalibration is returned when a calibration's parameters
+	// don't match its kind or metric.
+	ErrorInvalidCalibration = errors.New("Calibration parameters are invalid")
+)
+
+// CalibrationStore is an interface for any type that can store and retrieve
+// the calibrations of a user's cores.
+type CalibrationStore interface {
+	GetCalibrations(userEmail string) (Calibrations, error)
+	StoreCalibration(calibration Calibration) (int64, error)
+	DeleteCalibration(userEmail string, id int64) error
+}
+
+// CalibrationPoint is a single entry of a table calibration mapping a raw
+// value to its calibrated value.
+type CalibrationPoint struct {
+	Raw   float64 `json:"raw"`
+	Value float64 `json:"value"`
+}
+
+// Calibration describes how raw values of one metric from a core are mapped
+// to meaningful values, starting at EffectiveFrom and lasting until a later
+// calibration for the same core and metric takes effect.
+type Calibration struct {
+	ID            int64              `json:"id"`
+	UserEmail     string             `json:"user"`
+	CoreID        string             `json:"coreid"`
+	Metric        string             `json:"metric"`
+	Kind          string             `json:"kind"`
+	Offset        float64            `json:"offset,omitempty"`
+	Scale         float64            `json:"scale,omitempty"`
+	Coefficients  []float64          `json:"coefficients,omitempty"`
+	Points        []CalibrationPoint `json:"points,omitempty"`
+	EffectiveFrom time.Time          `json:"effective_from"`
+}
+
+// Validate checks the calibration's parameters are usable for its kind.
+// Table points are sorted by raw value.
+func (c *Calibration) Validate() error {
+	if _, ok := (Reading{}).Value(c.Metric); !ok || c.CoreID == "" {
+		return ErrorInvalidCalibration
+	}
+
+	switch c.Kind {
+	case CalibrationLinear:
+		if c.Scale == 0 {
+			return ErrorInvalidCalibration
+		}
+	case CalibrationPolynomial:
+		if len(c.Coefficients) == 0 {
+			return ErrorInvalidCalibration
+		}
+	case CalibrationTable:
+		if len(c.Points) < 2 {
+			return ErrorInvalidCalibration
+		}
+
+		sort.Sort(byRaw(c.Points))
+		for i := 1; i < len(c.Points); i++ {
+			if c.Points[i].Raw == c.Points[i-1].Raw {
+				return ErrorInvalidCalibration
+			}
+		}
+	default:
+		return ErrorInvalidCalibration
+	}
+
+	return nil
+}
+
+// Calibrate maps a raw value to its calibrated value.
+func (c Calibration) Calibrate(raw float64) float64 {
+	switch c.Kind {
+	case CalibrationLinear:
+		return raw*c.Scale + c.Offset
+	case CalibrationPolynomial:
+		var value float64
+		for i := len(c.Coefficients) - 1; i >= 0; i-- {
+			value = value*raw + c.Coefficients[i]
+		}
+		return value
+	case CalibrationTable:
+		if len(c.Points) == 0 {
+			return raw
+		}
+
+		i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Raw >= raw })
+		if i == 0 {
+			return c.Points[0].Value
+		}
+
+		if i == len(c.Points) {
+			return c.Points[len(c.Points)-1].Value
+		}
+
+		lo, hi := c.Points[i-1], c.Points[i]
+		return lo.Value + (raw-lo.Raw)*(hi.Value-lo.Value)/(hi.Raw-lo.Raw)
+	}
+
+	return raw
+}
+
+// Calibrations is a list of calibrations for any number of cores and
+// metrics.
+type Calibrations []Calibration
+
+// Apply returns the reading with each metric mapped by the calibration in
+// effect for its core and metric at the time it was posted.  Metrics without
+// a calibration in effect are left raw.
+func (cs Calibrations) Apply(reading Reading) Reading {
+	for _, metric := range Metrics {
+		var effective *Calibration
+		for i, c := range cs {
+			if c.CoreID != reading.CoreID || c.Metric != metric || c.EffectiveFrom.After(reading.Posted) {
+				continue
+			}
+
+			if effective == nil || c.EffectiveFrom.After(effective.EffectiveFrom) {
+				effective = &cs[i]
+			}
+		}
+
+		if effective == nil {
+			continue
+		}
+
+		raw, _ := reading.Value(metric)
+		reading.SetValue(metric, effective.Calibrate(raw))
+	}
+
+	return reading
+}
+
+// ApplyAll applies calibrations to each of the readings in place.
+func (cs Calibrations) ApplyAll(readings []Reading) {
+	if len(cs) == 0 {
+		return
+	}
+
+	for i, reading := range readings {
+		readings[i] = cs.Apply(reading)
+	}
+}
+
+type byRaw []CalibrationPoint
+
+func (p byRaw) Len() int           { return len(p) }
+func (p byRaw) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byRaw) Less(i, j int) bool { return p[i].Raw < p[j].Raw }
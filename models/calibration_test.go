@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		calibration Calibration
+		raw, value  float64
+	}{
+		{name: "linear", calibration: Calibration{Kind: CalibrationLinear, Offset: -10, Scale: 0.5}, raw: 100, value: 40},
+		{name: "polynomial", calibration: Calibration{Kind: CalibrationPolynomial, Coefficients: []float64{1, 2, 3}}, raw: 2, value: 17},
+		{name: "table between", calibration: Calibration{Kind: CalibrationTable, Points: []CalibrationPoint{{Raw: 1000, Value: 100}, {Raw: 3000, Value: 0}}}, raw: 2500, value: 25},
+		{name: "table below", calibration: Calibration{Kind: CalibrationTable, Points: []CalibrationPoint{{Raw: 1000, Value: 100}, {Raw: 3000, Value: 0}}}, raw: 10, value: 100},
+		{name: "table above", calibration: Calibration{Kind: CalibrationTable, Points: []CalibrationPoint{{Raw: 1000, Value: 100}, {Raw: 3000, Value: 0}}}, raw: 4000, value: 0},
+	} {
+		if got := tc.calibration.Calibrate(tc.raw); !floatCompare(got, tc.value) {
+			t.Errorf("%s: expected %g, got %g", tc.name, tc.value, got)
+		}
+	}
+}
+
+func TestCalibrationValidate(t *testing.T) {
+	table := Calibration{
+		CoreID: "1234",
+		Metric: "moisture",
+		Kind:   CalibrationTable,
+		Points: []CalibrationPoint{{Raw: 3000, Value: 0}, {Raw: 1000, Value: 100}},
+	}
+
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Points[0].Raw != 1000 {
+		t.Fatalf("Table points should be sorted by raw value, got %v", table.Points)
+	}
+
+	for _, invalid := range []Calibration{
+		{CoreID: "1234", Metric: "moisture", Kind: CalibrationLinear},
+		{CoreID: "1234", Metric: "moisture", Kind: "spline", Scale: 1},
+		{CoreID: "1234", Metric: "wind", Kind: CalibrationLinear, Scale: 1},
+		{CoreID: "1234", Metric: "moisture", Kind: CalibrationTable, Points: []CalibrationPoint{{Raw: 1, Value: 1}, {Raw: 1, Value: 2}}},
+	} {
+		if invalid.Validate() == nil {
+			t.Errorf("Calibration should be invalid: %v", invalid)
+		}
+	}
+}
+
+func TestCalibrationsApply(t *testing.T) {
+	swapped := time.Unix(1461300000, 0)
+	calibrations := Calibrations{
+		{CoreID: "1234", Metric: "moisture", Kind: CalibrationLinear, Scale: 1, Offset: 10, EffectiveFrom: swapped.Add(-time.Hour * 24)},
+		{CoreID: "1234", Metric: "moisture", Kind: CalibrationLinear, Scale: 1, Offset: 20, EffectiveFrom: swapped},
+		{CoreID: "5678", Metric: "moisture", Kind: CalibrationLinear, Scale: 1, Offset: 30},
+	}
+
+	for _, tc := range []struct {
+		posted   time.Time
+		moisture float64
+	}{
+		{posted: swapped.Add(-time.Hour * 48), moisture: 50},
+		{posted: swapped.Add(-time.Hour), moisture: 60},
+		{posted: swapped, moisture: 70},
+	} {
+		reading := calibrations.Apply(Reading{CoreID: "1234", Posted: tc.posted, Moisture: 50, Temperature: 15})
+		if !floatCompare(reading.Moisture, tc.moisture) {
+			t.Errorf("Reading at %s: expected moisture %g, got %g", tc.posted, tc.moisture, reading.Moisture)
+		}
+
+		if !floatCompare(reading.Temperature, 15) {
+			t.Errorf("Uncalibrated metric changed: got %g", reading.Temperature)
+		}
+	}
+}
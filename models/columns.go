@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrorUnknownMetric is returned when a metric named isn't one of Metrics.
+var ErrorUnknownMetric = errors.New("Unknown metric; expected temperature, humidity, moisture, light or battery")
+
+// ParseMetrics parses a comma separated list of metrics, returning all of
+// Metrics if the list is empty.
+func ParseMetrics(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return Metrics, nil
+	}
+
+	var metrics []string
+	seen := make(map[string]bool)
+	for _, metric := range strings.Split(list, ",") {
+		metric = strings.TrimSpace(metric)
+		if _, ok := (Reading{}).Value(metric); !ok {
+			return nil, ErrorUnknownMetric
+		}
+
+		if !seen[metric] {
+			seen[metric] = true
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+// ReadingColumns holds the readings of a core as columns, more compactly
+// than an array of readings: the times they were posted, in milliseconds
+// since the epoch, and the values of each metric at those times.
+type ReadingColumns struct {
+	CoreID     string               `json:"coreid"`
+	Timestamps []int64              `json:"timestamps"`
+	Values     map[string][]float64 `json:"values"`
+}
+
+// Columns returns the columns of the metrics of each core's readings, in
+// order of the cores' first readings.  Readings keep their order within
+// their core's columns.
+func Columns(readings []Reading, metrics []string) []ReadingColumns {
+	var columns []ReadingColumns
+	index := make(map[string]int)
+
+	for _, r := range readings {
+		i, ok := index[r.CoreID]
+		if !ok {
+			i = len(columns)
+			index[r.CoreID] = i
+			columns = append(columns, ReadingColumns{CoreID: r.CoreID, Values: make(map[string][]float64)})
+		}
+
+		c := &columns[i]
+		c.Timestamps = append(c.Timestamps, r.Posted.UnixNano()/int64(time.Millisecond))
+		for _, metric := range metrics {
+			value, _ := r.Value(metric)
+			c.Values[metric] = append(c.Values[metric], value)
+		}
+	}
+
+	return columns
+}
+
+// Project returns the reading as a JSON object of only the given metrics,
+// along with its user, core and time.
+func (r Reading) Project(metrics []string) map[string]interface{} {
+	projected := map[string]interface{}{
+		"user":   r.UserEmail,
+		"coreid": r.CoreID,
+		"posted": r.Posted,
+	}
+
+	for _, metric := range metrics {
+		projected[metric], _ = r.Value(metric)
+	}
+
+	return projected
+}
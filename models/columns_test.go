@@ -0,0 +1,58 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := ParseMetrics("light, temperature,light")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(metrics, []string{"light", "temperature"}) {
+		t.Fatalf("Incorrect metrics parsed: %v", metrics)
+	}
+
+	if metrics, err := ParseMetrics(""); err != nil || !reflect.DeepEqual(metrics, Metrics) {
+		t.Fatalf("Expected all metrics when none given, got %v %v", metrics, err)
+	}
+
+	if _, err := ParseMetrics("temperature,wind"); err != ErrorUnknownMetric {
+		t.Fatalf("Expected %v, got %v", ErrorUnknownMetric, err)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	epoch := time.Unix(1463011200, 0)
+	readings := []Reading{
+		{CoreID: "b", Posted: epoch, Temperature: 20, Light: 100},
+		{CoreID: "a", Posted: epoch, Temperature: 18, Light: 90},
+		{CoreID: "b", Posted: epoch.Add(time.Second), Temperature: 21, Light: 110},
+	}
+
+	columns := Columns(readings, []string{"temperature"})
+	expected := []ReadingColumns{
+		{CoreID: "b", Timestamps: []int64{1463011200000, 1463011201000}, Values: map[string][]float64{"temperature": {20, 21}}},
+		{CoreID: "a", Timestamps: []int64{1463011200000}, Values: map[string][]float64{"temperature": {18}}},
+	}
+
+	if !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("Incorrect columns; got %v expected %v", columns, expected)
+	}
+}
+
+func TestProject(t *testing.T) {
+	reading := Reading{UserEmail: "a@b.c", CoreID: "a", Posted: time.Unix(1463011200, 0), Temperature: 20, Light: 100}
+
+	projected := reading.Project([]string{"light"})
+	if len(projected) != 4 || projected["light"] != 100.0 || projected["coreid"] != "a" {
+		t.Fatalf("Incorrect projection: %v", projected)
+	}
+
+	if _, ok := projected["temperature"]; ok {
+		t.Fatalf("Projection included metric not asked for: %v", projected)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// States of commands queued for devices.  Pending commands are waiting for
+// the device to poll; delivered commands have been handed to the device and
+// are waiting for it to acknowledge carrying them out.  Commands not acked
+// before they expire are never delivered, or considered failed if they were.
+const (
+	CommandPending   = "pending"
+	CommandDelivered = "delivered"
+	CommandAcked     = "acked"
+	CommandExpired   = "expired"
+)
+
+const (
+	// DefaultCommandTTL is how long commands wait to be delivered and acked
+	// unless a TTL is given when queuing them.
+	DefaultCommandTTL = time.Minute * 10
+	// MaxCommandTTL is the longest commands may wait; a stale command to
+	// run a pump is worse than none.
+	MaxCommandTTL = time.Hour * 24
+)
+
+var (
+	// ErrorCommandDoesntExist is returned when a command is requested that
+	// doesn't exist for the user's core.
+	ErrorCommandDoesntExist = errors.New("Command does not exist")
+	// ErrorInvalidCommand is returned when a command has no name, a name
+	// containing whitespace, or expires before it is created or after the
+	// maximum TTL.
+	ErrorInvalidCommand = errors.New("Command must have a name without whitespace and a TTL of at most 24h")
+	// ErrorCommandNotDelivered is returned when a command that wasn't
+	// delivered, or was already acked or expired, is acked.
+	ErrorCommandNotDelivered = errors.New("Command is not awaiting acknowledgement")
+)
+
+// CommandStore is an interface for any type that can queue commands for
+// users' devices and track their delivery.
+type CommandStore interface {
+	GetCommands(userEmail, core string) ([]Command, error)
+	StoreCommand(command Command) (int64, error)
+	DeliverCommands(userEmail, core string, now time.Time) ([]Command, error)
+	AckCommand(userEmail, core string, id int64, result string, now time.Time) error
+	ExpireCommands(now time.Time) (int64, error)
+}
+
+// Command is an instruction queued for a core, such as "water" with the
+// argument "30s".  Cores receive commands by polling, so a command may not
+// be carried out until some time after it was created, if at all.  Result
+// is whatever the device reported when acking the command.
+type Command struct {
+	ID        int64      `json:"id"`
+	UserEmail string     `json:"user"`
+	CoreID    string     `json:"coreid"`
+	Name      string     `json:"name"`
+	Argument  string     `json:"argument,omitempty"`
+	State     string     `json:"state"`
+	Created   time.Time  `json:"created"`
+	Expires   time.Time  `json:"expires"`
+	Delivered *time.Time `json:"delivered,omitempty"`
+	Acked     *time.Time `json:"acked,omitempty"`
+	Result    string     `json:"result,omitempty"`
+}
+
+// NewCommand returns a pending command for the core, created now and
+// expiring after the TTL, or DefaultCommandTTL if it is zero.
+func NewCommand(userEmail, core, name, argument string, ttl time.Duration, now time.Time) Command {
+	if ttl == 0 {
+		ttl = DefaultCommandTTL
+	}
+
+	return Command{
+		UserEmail: userEmail,
+		CoreID:    core,
+		Name:      name,
+		Argument:  argument,
+		State:     CommandPending,
+		Created:   now,
+		Expires:   now.Add(ttl),
+	}
+}
+
+// Validate checks the command has a name and a permitted TTL.
+func (c Command) Validate() error {
+	if c.Name == "" || strings.IndexFunc(c.Name, isSpace) >= 0 || c.CoreID == "" {
+		return ErrorInvalidCommand
+	}
+
+	if ttl := c.Expires.Sub(c.Created); ttl <= 0 || ttl > MaxCommandTTL {
+		return ErrorInvalidCommand
+	}
+
+	return nil
+}
+
+// StateAt returns the command's state at the given time, which is expired
+// for pending or delivered commands past their expiry even if they haven't
+// yet been marked as such.
+func (c Command) StateAt(now time.Time) string {
+	if (c.State == CommandPending || c.State == CommandDelivered) && !now.Before(c.Expires) {
+		return CommandExpired
+	}
+
+	return c.State
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// SortCommands sorts commands by ID, the order they were queued in.
+func SortCommands(commands []Command) {
+	sort.Sort(byCommandID(commands))
+}
+
+type byCommandID []Command
+
+func (a byCommandID) Len() int           { return len(a) }
+func (a byCommandID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCommandID) Less(i, j int) bool { return a[i].ID < a[j].ID }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandValidate(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		command Command
+		err     error
+	}{
+		{NewCommand("user", "core", "water", "30s", 0, now), nil},
+		{NewCommand("user", "core", "fan", "", MaxCommandTTL, now), nil},
+		{NewCommand("user", "core", "", "30s", 0, now), ErrorInvalidCommand},
+		{NewCommand("user", "core", "water 30s", "", 0, now), ErrorInvalidCommand},
+		{NewCommand("user", "", "water", "30s", 0, now), ErrorInvalidCommand},
+		{NewCommand("user", "core", "water", "30s", -time.Minute, now), ErrorInvalidCommand},
+		{NewCommand("user", "core", "water", "30s", MaxCommandTTL+time.Second, now), ErrorInvalidCommand},
+	} {
+		if err := tc.command.Validate(); err != tc.err {
+			t.Errorf("Validating %v: expected %v, got %v", tc.command, tc.err, err)
+		}
+	}
+}
+
+func TestCommandStateAt(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	command := NewCommand("user", "core", "water", "30s", 0, now)
+
+	if !command.Expires.Equal(now.Add(DefaultCommandTTL)) {
+		t.Fatalf("Expected command to expire after %s, got %s", DefaultCommandTTL, command.Expires)
+	}
+
+	for _, tc := range []struct {
+		state    string
+		at       time.Time
+		expected string
+	}{
+		{CommandPending, now, CommandPending},
+		{CommandPending, command.Expires, CommandExpired},
+		{CommandDelivered, now.Add(time.Minute), CommandDelivered},
+		{CommandDelivered, command.Expires.Add(time.Minute), CommandExpired},
+		{CommandAcked, command.Expires.Add(time.Minute), CommandAcked},
+	} {
+		command.State = tc.state
+		if state := command.StateAt(tc.at); state != tc.expected {
+			t.Errorf("Expected %s command to be %s at %s, got %s", tc.state, tc.expected, tc.at, state)
+		}
+	}
+}
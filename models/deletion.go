@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// DeletionGracePeriod is how long deleted readings may be restored before
+// they're purged.
+const DeletionGracePeriod = time.Hour * 24 * 7
+
+// ErrorDeletionDoesntExist is returned from a ReadingStore when a deletion
+// to undo isn't the user's, is past its grace period, or was already undone
+// or purged.
+var ErrorDeletionDoesntExist = errors.New("No deletion exists to undo")
+
+// ReadingDeletion is an operation deleting a user's readings of a core
+// between a start and end time.  Its readings may be restored until it's
+// purged, DeletionGracePeriod after it was made.
+type ReadingDeletion struct {
+	ID        int64     `json:"id"`
+	UserEmail string    `json:"user"`
+	CoreID    string    `json:"coreid"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Count     int       `json:"count"`
+	Deleted   time.Time `json:"deleted"`
+}
+
+// PurgeAfter returns when the deletion's readings are purged.
+func (d ReadingDeletion) PurgeAfter() time.Time {
+	return d.Deleted.Add(DeletionGracePeriod)
+}
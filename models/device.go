@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Device statuses, as determined by how long it has been since a device was
+// last seen relative to its expected reporting interval.
+const (
+	DeviceOnline  = "online"
+	DeviceStale   = "stale"
+	DeviceOffline = "offline"
+)
+
+const (
+	// DefaultReportingInterval is how often devices are expected to post
+	// readings unless configured otherwise.
+	DefaultReportingInterval = time.Minute * 15
+	// staleIntervals and offlineIntervals are how many reporting intervals
+	// may pass without a reading before a device is stale or offline.
+	staleIntervals   = 2
+	offlineIntervals = 6
+)
+
+var (
+	// ErrorDeviceDoesntExist is returned when a device is requested that
+	// has never posted a reading.
+	ErrorDeviceDoesntExist = errors.New("Device does not exist")
+	// ErrorInvalidReportingInterval is returned when a device's expected
+	// reporting interval is not positive.
+	ErrorInvalidReportingInterval = errors.New("Reporting interval must be positive")
+)
+
+// DeviceStore is an interface for any type that can track when a user's
+// devices were last seen and the status last determined for them.
+// SeeDevice should never move a device's last seen time backwards.
+type DeviceStore interface {
+	SeeDevice(userEmail, core string, seen time.Time) error
+	GetDevices(userEmail string) ([]Device, error)
+	GetAllDevices() ([]Device, error)
+	SetReportingInterval(userEmail, core string, interval time.Duration) error
+	SetDeviceStatus(userEmail, core, status string, changed time.Time) error
+}
+
+// Device describes one of a user's cores: when it was last seen, how often
+// it is expected to report, and the status last determined for it.  In JSON
+// the reporting interval is a duration string such as "15m0s".
+type Device struct {
+	UserEmail         string        `json:"user"`
+	CoreID            string        `json:"coreid"`
+	LastSeen          time.Time     `json:"last_seen"`
+	ReportingInterval time.Duration `json:"reporting_interval"`
+	Status            string        `json:"status"`
+	StatusChanged     time.Time     `json:"status_changed"`
+}
+
+// StatusAt returns the device's status as of now.
+func (d Device) StatusAt(now time.Time) string {
+	interval := d.ReportingInterval
+	if interval <= 0 {
+		interval = DefaultReportingInterval
+	}
+
+	switch elapsed := now.Sub(d.LastSeen); {
+	case elapsed > interval*offlineIntervals:
+		return DeviceOffline
+	case elapsed > interval*staleIntervals:
+		return DeviceStale
+	default:
+		return DeviceOnline
+	}
+}
+
+// deviceJSON is a Device as represented in JSON.
+type deviceJSON struct {
+	device
+	ReportingInterval string `json:"reporting_interval"`
+}
+
+type device Device
+
+// MarshalJSON encodes the device with its reporting interval as a duration
+// string.
+func (d Device) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deviceJSON{device: device(d), ReportingInterval: d.ReportingInterval.String()})
+}
+
+// UnmarshalJSON decodes a device encoded by MarshalJSON.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	var dj deviceJSON
+	if err := json.Unmarshal(data, &dj); err != nil {
+		return err
+	}
+
+	*d = Device(dj.device)
+	if dj.ReportingInterval == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(dj.ReportingInterval)
+	if err != nil {
+		return err
+	}
+
+	d.ReportingInterval = interval
+	return nil
+}
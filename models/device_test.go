@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDeviceStatusAt(t *testing.T) {
+	seen := time.Date(2016, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		interval time.Duration
+		elapsed  time.Duration
+		status   string
+	}{
+		{elapsed: time.Minute * 30, status: DeviceOnline},
+		{elapsed: time.Minute * 31, status: DeviceStale},
+		{elapsed: time.Minute * 91, status: DeviceOffline},
+		{interval: time.Hour, elapsed: time.Minute * 91, status: DeviceOnline},
+		{interval: time.Hour, elapsed: time.Hour * 3, status: DeviceStale},
+		{interval: time.Hour, elapsed: time.Hour * 7, status: DeviceOffline},
+	} {
+		device := Device{LastSeen: seen, ReportingInterval: tc.interval}
+		if status := device.StatusAt(seen.Add(tc.elapsed)); status != tc.status {
+			t.Errorf("interval %s, elapsed %s: expected %s, got %s", tc.interval, tc.elapsed, tc.status, status)
+		}
+	}
+}
+
+func TestDeviceJSON(t *testing.T) {
+	device := Device{
+		UserEmail:         "odin@asgard.unv",
+		CoreID:            "53ff6f0650723",
+		LastSeen:          time.Date(2016, 5, 10, 12, 0, 0, 0, time.UTC),
+		ReportingInterval: time.Minute * 10,
+		Status:            DeviceStale,
+		StatusChanged:     time.Date(2016, 5, 10, 12, 30, 0, 0, time.UTC),
+	}
+
+	deviceJSON, err := json.Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(deviceJSON, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["reporting_interval"] != "10m0s" {
+		t.Fatalf("Expected reporting interval as duration string, got %v", fields["reporting_interval"])
+	}
+
+	var decoded Device
+	if err := json.Unmarshal(deviceJSON, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != device {
+		t.Fatalf("Decoded device %v doesn't match %v", decoded, device)
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Kinds of care events.
+const (
+	EventWatering    = "watering"
+	EventFertilizing = "fertilizing"
+)
+
+// Sources of care events.
+const (
+	EventManual    = "manual"
+	EventAutomated = "automated"
+)
+
+var (
+	// ErrorEventDoesntExist is returned when an event is requested that
+	// doesn't exist for the user.
+	ErrorEventDoesntExist = errors.New("Event does not exist")
+	// ErrorInvalidEvent is returned when an event has an unknown kind or
+	// source, no time, or neither a plant nor a core.
+	ErrorInvalidEvent = errors.New("Event must have a known kind and source, a time, and a plant or core")
+)
+
+// EventStore is an interface for any type that can store and retrieve care
+// events such as waterings.
+type EventStore interface {
+	GetEvents(userEmail string, start, end time.Time) ([]Event, error)
+	StoreEvent(event Event) (int64, error)
+	DeleteEvent(userEmail string, id int64) error
+}
+
+// Event records care given to a plant, or to whatever plant a core is in
+// when PlantID is zero, at the time posted.  Amount is in whatever unit the
+// user prefers, such as millilitres of water.
+type Event struct {
+	ID        int64     `json:"id"`
+	UserEmail string    `json:"user"`
+	Kind      string    `json:"kind"`
+	Source    string    `json:"source"`
+	PlantID   int64     `json:"plant_id,omitempty"`
+	CoreID    string    `json:"coreid,omitempty"`
+	Posted    time.Time `json:"posted"`
+	Amount    float64   `json:"amount,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// Validate checks the event is complete, defaulting its source to manual.
+func (e *Event) Validate() error {
+	if e.Source == "" {
+		e.Source = EventManual
+	}
+
+	if (e.Kind != EventWatering && e.Kind != EventFertilizing) ||
+		(e.Source != EventManual && e.Source != EventAutomated) ||
+		e.Posted.IsZero() || (e.PlantID == 0 && e.CoreID == "") {
+		return ErrorInvalidEvent
+	}
+
+	return nil
+}
+
+// Cores returns the cores monitoring the event's plant at the time of the
+// event, given the plant's assignments, or the event's core.
+func (e Event) Cores(assignments []Assignment) []string {
+	if e.CoreID != "" {
+		return []string{e.CoreID}
+	}
+
+	var cores []string
+	for _, a := range assignments {
+		if a.PlantID == e.PlantID && a.Covers(e.Posted) {
+			cores = append(cores, a.CoreID)
+		}
+	}
+
+	return cores
+}
+
+// SortEvents sorts events by the time they were posted.
+func SortEvents(events []Event) {
+	sort.Stable(byEventPosted(events))
+}
+
+type byEventPosted []Event
+
+func (a byEventPosted) Len() int           { return len(a) }
+func (a byEventPosted) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byEventPosted) Less(i, j int) bool { return a[i].Posted.Before(a[j].Posted) }
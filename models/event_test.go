@@ -0,0 +1,58 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventValidate(t *testing.T) {
+	posted := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		event Event
+		err   error
+	}{
+		{Event{Kind: EventWatering, PlantID: 1, Posted: posted}, nil},
+		{Event{Kind: EventFertilizing, Source: EventAutomated, CoreID: "core", Posted: posted}, nil},
+		{Event{Kind: "pruning", PlantID: 1, Posted: posted}, ErrorInvalidEvent},
+		{Event{Kind: EventWatering, Source: "robot", PlantID: 1, Posted: posted}, ErrorInvalidEvent},
+		{Event{Kind: EventWatering, PlantID: 1}, ErrorInvalidEvent},
+		{Event{Kind: EventWatering, Posted: posted}, ErrorInvalidEvent},
+	} {
+		if err := tc.event.Validate(); err != tc.err {
+			t.Errorf("Validating %v: expected %v, got %v", tc.event, tc.err, err)
+		}
+	}
+
+	e := Event{Kind: EventWatering, PlantID: 1, Posted: posted}
+	e.Validate()
+	if e.Source != EventManual {
+		t.Errorf("Expected source to default to %s, got %q", EventManual, e.Source)
+	}
+}
+
+func TestEventCores(t *testing.T) {
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	moved := start.AddDate(0, 0, 2)
+
+	assignments := []Assignment{
+		{PlantID: 1, CoreID: "one", Start: start, End: &moved},
+		{PlantID: 1, CoreID: "two", Start: moved},
+		{PlantID: 2, CoreID: "three", Start: start},
+	}
+
+	for _, tc := range []struct {
+		event Event
+		cores []string
+	}{
+		{Event{PlantID: 1, Posted: start.AddDate(0, 0, 1)}, []string{"one"}},
+		{Event{PlantID: 1, Posted: moved}, []string{"two"}},
+		{Event{PlantID: 1, Posted: start.AddDate(0, 0, -1)}, nil},
+		{Event{PlantID: 1, CoreID: "four", Posted: moved}, []string{"four"}},
+	} {
+		if cores := tc.event.Cores(assignments); !reflect.DeepEqual(cores, tc.cores) {
+			t.Errorf("Expected cores %v for event at %s, got %v", tc.cores, tc.event.Posted, cores)
+		}
+	}
+}
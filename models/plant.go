@@ -0,0 +1,100 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrorZoneDoesntExist is returned when a zone is requested or
+	// referenced that doesn't exist for the user.
+	ErrorZoneDoesntExist = errors.New("Zone does not exist")
+	// ErrorPlantDoesntExist is returned when a plant is requested or
+	// referenced that doesn't exist for the user.
+	ErrorPlantDoesntExist = errors.New("Plant does not exist")
+	// ErrorAssignmentDoesntExist is returned when an assignment is requested
+	// that doesn't exist for the user.
+	ErrorAssignmentDoesntExist = errors.New("Assignment does not exist")
+	// ErrorInvalidPlant is returned when a zone or plant is stored without a
+	// name.
+	ErrorInvalidPlant = errors.New("Zones and plants must have a name")
+	// ErrorInvalidAssignment is returned when an assignment has no core or
+	// ends before it starts.
+	ErrorInvalidAssignment = errors.New("Assignment must have a core and end after it starts")
+	// ErrorAssignmentOverlaps is returned when a core is assigned to a
+	// plant while it is assigned to another plant.
+	ErrorAssignmentOverlaps = errors.New("Core is already assigned during that time")
+)
+
+// PlantStore is an interface for any type that can store a user's zones,
+// plants and the assignments of cores to plants.  Storing a zone or plant
+// with an ID updates it.  Storing an open-ended assignment ends any open
+// assignment of the same core that started earlier, so moving a core only
+// requires assigning it to its new plant; an assignment with an end must not
+// overlap any other.
+type PlantStore interface {
+	GetZones(userEmail string) ([]Zone, error)
+	StoreZone(zone Zone) (int64, error)
+	DeleteZone(userEmail string, id int64) error
+	GetPlants(userEmail string) ([]Plant, error)
+	StorePlant(plant Plant) (int64, error)
+	DeletePlant(userEmail string, id int64) error
+	GetAssignments(userEmail string, plantID int64) ([]Assignment, error)
+	StoreAssignment(assignment Assignment) (int64, error)
+	DeleteAssignment(userEmail string, id int64) error
+}
+
+// Zone is an area, such as a garden bed or window sill, grouping a user's
+// plants.
+type Zone struct {
+	ID          int64  `json:"id"`
+	UserEmail   string `json:"user"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Plant is something a user grows and monitors with their cores.  ZoneID is
+// zero for plants not in a zone.
+type Plant struct {
+	ID        int64  `json:"id"`
+	UserEmail string `json:"user"`
+	ZoneID    int64  `json:"zone_id,omitempty"`
+	Name      string `json:"name"`
+	Species   string `json:"species"`
+	Notes     string `json:"notes"`
+}
+
+// Assignment records that a core monitored a plant from Start until End, or
+// until now if End is nil.
+type Assignment struct {
+	ID        int64      `json:"id"`
+	UserEmail string     `json:"user"`
+	PlantID   int64      `json:"plant_id"`
+	CoreID    string     `json:"coreid"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+}
+
+// Validate checks the assignment has a core and ends after it starts.
+func (a Assignment) Validate() error {
+	if a.CoreID == "" || a.Start.IsZero() || (a.End != nil && !a.End.After(a.Start)) {
+		return ErrorInvalidAssignment
+	}
+
+	return nil
+}
+
+// Covers returns true if the core was assigned at time t.
+func (a Assignment) Covers(t time.Time) bool {
+	return !t.Before(a.Start) && (a.End == nil || t.Before(*a.End))
+}
+
+// Overlaps returns true if both assignments are of the same core for some
+// period of time.
+func (a Assignment) Overlaps(b Assignment) bool {
+	if a.CoreID != b.CoreID {
+		return false
+	}
+
+	return (a.End == nil || b.Start.Before(*a.End)) && (b.End == nil || a.Start.Before(*b.End))
+}
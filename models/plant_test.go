@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssignment(t *testing.T) {
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+
+	closed := Assignment{CoreID: "core", Start: start, End: &end}
+	open := Assignment{CoreID: "core", Start: start}
+
+	if err := closed.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	before := start.Add(-time.Hour)
+	for _, invalid := range []Assignment{
+		{Start: start},
+		{CoreID: "core"},
+		{CoreID: "core", Start: start, End: &before},
+		{CoreID: "core", Start: start, End: &start},
+	} {
+		if err := invalid.Validate(); err != ErrorInvalidAssignment {
+			t.Errorf("%v: expected ErrorInvalidAssignment, got %v", invalid, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		t      time.Time
+		closed bool
+		open   bool
+	}{
+		{t: before, closed: false, open: false},
+		{t: start, closed: true, open: true},
+		{t: end.Add(-time.Second), closed: true, open: true},
+		{t: end, closed: false, open: true},
+	} {
+		if closed.Covers(tc.t) != tc.closed || open.Covers(tc.t) != tc.open {
+			t.Errorf("%s: expected covered %t and %t", tc.t, tc.closed, tc.open)
+		}
+	}
+
+	later := Assignment{CoreID: "core", Start: end}
+	if closed.Overlaps(later) || later.Overlaps(closed) {
+		t.Error("Consecutive assignments shouldn't overlap")
+	}
+
+	if !open.Overlaps(later) || !later.Overlaps(open) {
+		t.Error("Open assignment should overlap later assignment")
+	}
+
+	other := Assignment{CoreID: "other", Start: start}
+	if open.Overlaps(other) {
+		t.Error("Assignments of different cores shouldn't overlap")
+	}
+}
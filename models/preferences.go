@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// PreferenceStore is an interface for any type that can store and retrieve
+// a user's display preferences.
+type PreferenceStore interface {
+	GetPreferences(userEmail string) (Preferences, error)
+	StorePreferences(userEmail string, preferences Preferences) error
+}
+
+// Preferences describe how a user would like their readings presented.
+// Locale is the user's locale and is only informational; it is used to pick
+// defaults for preferences the user hasn't set.  TimeZone is the IANA time
+// zone calendar days are counted in, which CoreTimeZones may override for
+// individual cores.
+type Preferences struct {
+	Locale        string            `json:"locale,omitempty"`
+	Units         Units             `json:"units"`
+	TimeZone      string            `json:"time_zone,omitempty"`
+	CoreTimeZones map[string]string `json:"core_time_zones,omitempty"`
+}
+
+// EffectiveUnits returns the user's preferred units, falling back to the
+// defaults for their locale.
+func (p Preferences) EffectiveUnits() Units {
+	return DefaultUnits(p.Locale).Merge(p.Units)
+}
+
+// Location returns the time zone for the given core, falling back to the
+// user's time zone and then UTC.
+func (p Preferences) Location(core string) (*time.Location, error) {
+	name, ok := p.CoreTimeZones[core]
+	if !ok {
+		name = p.TimeZone
+	}
+
+	return time.LoadLocation(name)
+}
+
+// Validate checks the preferred units and time zones are supported.
+func (p Preferences) Validate() error {
+	if err := p.Units.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone %q", p.TimeZone)
+	}
+
+	for core, name := range p.CoreTimeZones {
+		if _, err := time.LoadLocation(name); err != nil {
+			return fmt.Errorf("unknown time zone %q for core %s", name, core)
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"math"
+	"sort"
 	"time"
 )
 
@@ -12,15 +15,118 @@ const (
 	JSONTime = "2006-01-02T15:04:05.000Z"
 )
 
+// Headers of requests for readings.  Clients mark retries of the same
+// request with the idempotency key.  Pages of readings give the cursor of the
+// next page, if there is one, in the next cursor header; the Link header
+// gives its URL.
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	NextCursorHeader     = "X-Next-Cursor"
+)
+
+var (
+	// ErrorReadingExists is returned from a ReadingStore when a reading is
+	// stored that is identical to one already in the store.
+	ErrorReadingExists = errors.New("Identical reading already exists")
+	// ErrorInvalidCursor is returned when a cursor can't be decoded.
+	ErrorInvalidCursor = errors.New("Invalid cursor")
+)
+
+// ReadingConflictError is returned from a ReadingStore when a reading is
+// stored for the same user, core and time as an existing reading but with
+// differing values.  Stored holds the reading already in the store.
+type ReadingConflictError struct {
+	Stored Reading
+}
+
+func (e ReadingConflictError) Error() string {
+	return "Conflicting reading already exists for core " + e.Stored.CoreID + " at " + e.Stored.Posted.Format(time.RFC3339)
+}
+
 // ReadingStore is an interface for any type that defines methods for storing
-// and accessing readings.
+// and accessing readings.  StoreReading should return ErrorReadingExists or a
+// ReadingConflictError when a reading already exists for the same user, core
+// and time.  Readings are only read, counted or deleted for the given user,
+// never another user's readings of the same core.  HasReadings reports
+// whether the user has any readings of the core.  GetReadings,
+// CountReadings and DeleteReadings span from start to end inclusive, and
+// GetReadings returns readings in time order.  GetReadingsPage returns at
+// most limit of the readings of any of the cores GetReadings would that
+// follow the cursor, in cursor order.  DeleteReadings keeps the readings it
+// deletes until PurgeDeletions purges the deletion; within
+// DeletionGracePeriod of the deletion UndoDeletion restores those not stored
+// again since, returning the number restored, or ErrorDeletionDoesntExist.
+// PurgeDeletions returns the number of deletions made before the given time
+// it purged.  The storetest package verifies implementations conform.
 type ReadingStore interface {
 	StoreReading(reading Reading) error
 	GetLatestReadings(userEmail string) ([]Reading, error)
-	GetReadings(core string, start, end time.Time) ([]Reading, error)
-	DeleteReadings(core string, start, end time.Time) error
+	HasReadings(userEmail, core string) (bool, error)
+	GetReadings(userEmail, core string, start, end time.Time) ([]Reading, error)
+	GetReadingsPage(userEmail string, cores []string, start, end time.Time, after Cursor, limit int) ([]Reading, error)
+	CountReadings(userEmail, core string, start, end time.Time) (int, error)
+	DeleteReadings(userEmail, core string, start, end time.Time) (ReadingDeletion, error)
+	UndoDeletion(userEmail string, id int64) (int, error)
+	PurgeDeletions(before time.Time) (int, error)
+}
+
+// Cursor is a position in a user's readings ordered by the time they were
+// posted and then by core, as a user's readings are unique by core and time.
+// The zero Cursor precedes all readings.
+type Cursor struct {
+	Posted time.Time `json:"posted"`
+	CoreID string    `json:"core"`
+}
+
+// CursorAt returns the cursor positioned at the reading.
+func CursorAt(r Reading) Cursor {
+	return Cursor{Posted: r.Posted, CoreID: r.CoreID}
 }
 
+// Precedes returns true if the reading follows the cursor.
+func (c Cursor) Precedes(r Reading) bool {
+	if !r.Posted.Equal(c.Posted) {
+		return r.Posted.After(c.Posted)
+	}
+
+	return r.CoreID > c.CoreID
+}
+
+// Encode returns the cursor as an opaque string safe for use in URLs.
+func (c Cursor) Encode() string {
+	c.Posted = c.Posted.UTC()
+	bytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// CursorFromString decodes a cursor encoded by Encode.
+func CursorFromString(s string) (Cursor, error) {
+	var c Cursor
+
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrorInvalidCursor
+	}
+
+	if err := json.Unmarshal(bytes, &c); err != nil {
+		return c, ErrorInvalidCursor
+	}
+
+	return c, nil
+}
+
+// SortReadingsByCursor sorts readings in cursor order: by the time they were
+// posted and then by core.
+func SortReadingsByCursor(readings []Reading) {
+	sort.Stable(byCursor(readings))
+}
+
+type byCursor []Reading
+
+func (a byCursor) Len() int           { return len(a) }
+func (a byCursor) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCursor) Less(i, j int) bool { return CursorAt(a[i]).Precedes(a[j]) }
+
 // Reading represents a distinct reading of environment attributes sent by a
 // user's Spark 'Core' or other device at specific point in time.
 type Reading struct {
@@ -34,6 +140,50 @@ type Reading struct {
 	Battery     float64   `json:"battery"`
 }
 
+// Metrics lists the names of the environmental attributes recorded in a
+// Reading, as they appear in JSON.
+var Metrics = []string{"temperature", "humidity", "moisture", "light", "battery"}
+
+// Value returns the value of the named metric; ok is false if metric isn't
+// one of Metrics.
+func (r Reading) Value(metric string) (value float64, ok bool) {
+	field := r.metricField(metric)
+	if field == nil {
+		return 0, false
+	}
+
+	return *field, true
+}
+
+// SetValue sets the value of the named metric; it returns false if metric
+// isn't one of Metrics.
+func (r *Reading) SetValue(metric string, value float64) bool {
+	field := r.metricField(metric)
+	if field == nil {
+		return false
+	}
+
+	*field = value
+	return true
+}
+
+func (r *Reading) metricField(metric string) *float64 {
+	switch metric {
+	case "temperature":
+		return &r.Temperature
+	case "humidity":
+		return &r.Humidity
+	case "moisture":
+		return &r.Moisture
+	case "light":
+		return &r.Light
+	case "battery":
+		return &r.Battery
+	}
+
+	return nil
+}
+
 // ReadingFromJSON is a convenience method for building a Reading from a
 // request sent by a Particle webhook.  Potentially deprecated.
 func ReadingFromJSON(userEmail, coreID string, posted time.Time, JSONStr string) (Reading, error) {
@@ -117,3 +267,14 @@ func FilterReadings(input []Reading, filter func(Reading) bool) (output []Readin
 
 	return
 }
+
+// SortReadings sorts readings by the time they were posted.
+func SortReadings(readings []Reading) {
+	sort.Stable(byPosted(readings))
+}
+
+type byPosted []Reading
+
+func (a byPosted) Len() int           { return len(a) }
+func (a byPosted) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byPosted) Less(i, j int) bool { return a[i].Posted.Before(a[j].Posted) }
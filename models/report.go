@@ -0,0 +1,313 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// Kinds of report findings.
+const (
+	// FindingGap is a span of time in which readings were expected but
+	// none were posted.
+	FindingGap = "gap"
+	// FindingSpike is a reading whose value for a metric is far from its
+	// neighbors' by robust z-score.
+	FindingSpike = "spike"
+	// FindingFlatline is a span of readings reporting exactly the same
+	// value for a metric, suggesting a stuck or disconnected sensor.
+	FindingFlatline = "flatline"
+)
+
+// SensorMetrics lists the metrics checked for spikes and flatlines.  Battery
+// level is excluded as it changes in steps when charged and sits at full
+// while powered.
+var SensorMetrics = []string{"temperature", "humidity", "moisture", "light"}
+
+// ReportOptions tune the analysis of a core's readings.  Zero values are
+// replaced by defaults; a zero Cadence is estimated from the readings.
+type ReportOptions struct {
+	// Cadence is how often readings are expected.  A gap is reported where
+	// more than two cadences pass without a reading.
+	Cadence time.Duration
+	// SpikeThreshold is the modified z-score, relative to the median
+	// absolute deviation of neighboring readings, above which a value is a
+	// spike.
+	SpikeThreshold float64
+	// SpikeWindow is the number of readings either side of a reading it is
+	// compared to.
+	SpikeWindow int
+	// FlatlineDuration is how long a metric must report the same value to
+	// be flatlined.
+	FlatlineDuration time.Duration
+}
+
+// DefaultReportOptions are used for options left zero.
+var DefaultReportOptions = ReportOptions{
+	SpikeThreshold:   3.5,
+	SpikeWindow:      12,
+	FlatlineDuration: time.Hour * 6,
+}
+
+// Finding is an irregularity found in a core's readings between Start and
+// End.  Value and Score are the value and modified z-score of spikes or the
+// flatlined value; Missing is the number of readings expected in a gap.
+type Finding struct {
+	Kind    string    `json:"kind"`
+	Metric  string    `json:"metric,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Value   float64   `json:"value,omitempty"`
+	Score   float64   `json:"score,omitempty"`
+	Missing int       `json:"missing,omitempty"`
+}
+
+// Report lists the findings of analyzing a core's readings between Start
+// and End, ordered by start time.
+type Report struct {
+	CoreID   string        `json:"coreid"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Cadence  time.Duration `json:"cadence"`
+	Readings int           `json:"readings"`
+	Findings []Finding     `json:"findings"`
+}
+
+type report Report
+
+// MarshalJSON encodes the report with its cadence as a duration string.
+func (r Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		report
+		Cadence string `json:"cadence"`
+	}{report: report(r), Cadence: r.Cadence.String()})
+}
+
+// UnmarshalJSON decodes a report encoded by MarshalJSON.
+func (r *Report) UnmarshalJSON(data []byte) error {
+	var rj struct {
+		report
+		Cadence string `json:"cadence"`
+	}
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+
+	*r = Report(rj.report)
+	if rj.Cadence == "" {
+		return nil
+	}
+
+	cadence, err := time.ParseDuration(rj.Cadence)
+	if err != nil {
+		return err
+	}
+
+	r.Cadence = cadence
+	return nil
+}
+
+// AnalyzeReadings reports gaps, spikes and flatlines in the core's readings
+// posted between start and end.  Readings may be in any order.
+func AnalyzeReadings(core string, start, end time.Time, readings []Reading, opts ReportOptions) Report {
+	if opts.SpikeThreshold <= 0 {
+		opts.SpikeThreshold = DefaultReportOptions.SpikeThreshold
+	}
+	if opts.SpikeWindow <= 0 {
+		opts.SpikeWindow = DefaultReportOptions.SpikeWindow
+	}
+	if opts.FlatlineDuration <= 0 {
+		opts.FlatlineDuration = DefaultReportOptions.FlatlineDuration
+	}
+
+	sorted := append([]Reading(nil), readings...)
+	SortReadings(sorted)
+
+	if opts.Cadence <= 0 {
+		opts.Cadence = estimateCadence(sorted)
+	}
+
+	report := Report{
+		CoreID:   core,
+		Start:    start,
+		End:      end,
+		Cadence:  opts.Cadence,
+		Readings: len(sorted),
+		Findings: []Finding{},
+	}
+
+	report.Findings = append(report.Findings, findGaps(sorted, start, end, opts.Cadence)...)
+	for _, metric := range SensorMetrics {
+		values := make([]float64, len(sorted))
+		for i, r := range sorted {
+			values[i], _ = r.Value(metric)
+		}
+
+		report.Findings = append(report.Findings, findSpikes(sorted, metric, values, opts)...)
+		report.Findings = append(report.Findings, findFlatlines(sorted, metric, values, opts)...)
+	}
+
+	sort.Stable(byFindingStart(report.Findings))
+	return report
+}
+
+// estimateCadence returns the median time between readings, or
+// DefaultReportingInterval if there are too few readings to tell.
+func estimateCadence(sorted []Reading) time.Duration {
+	if len(sorted) < 3 {
+		return DefaultReportingInterval
+	}
+
+	intervals := make([]float64, 0, len(sorted)-1)
+	for i := 1; i < len(sorted); i++ {
+		intervals = append(intervals, float64(sorted[i].Posted.Sub(sorted[i-1].Posted)))
+	}
+
+	cadence := time.Duration(median(intervals))
+	if cadence <= 0 {
+		return DefaultReportingInterval
+	}
+
+	return cadence
+}
+
+// findGaps reports spans of more than staleIntervals cadences without a
+// reading, including before the first and after the last reading.
+func findGaps(sorted []Reading, start, end time.Time, cadence time.Duration) []Finding {
+	var findings []Finding
+
+	previous := start
+	check := func(next time.Time) {
+		if elapsed := next.Sub(previous); elapsed > cadence*staleIntervals {
+			findings = append(findings, Finding{
+				Kind:    FindingGap,
+				Start:   previous,
+				End:     next,
+				Missing: int(elapsed/cadence) - 1,
+			})
+		}
+		previous = next
+	}
+
+	for _, r := range sorted {
+		check(r.Posted)
+	}
+	check(end)
+
+	return findings
+}
+
+// findSpikes reports readings whose modified z-score against the median and
+// median absolute deviation of the surrounding window exceeds the
+// threshold.  Where most of the window is the same value, so the median
+// absolute deviation is zero, the mean absolute deviation of the window and
+// the reading is used instead, so a lone outlier in flat data is still
+// reported.
+func findSpikes(sorted []Reading, metric string, values []float64, opts ReportOptions) []Finding {
+	var findings []Finding
+
+	for i, value := range values {
+		lo, hi := i-opts.SpikeWindow, i+opts.SpikeWindow+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(values) {
+			hi = len(values)
+		}
+
+		var neighbors []float64
+		neighbors = append(neighbors, values[lo:i]...)
+		neighbors = append(neighbors, values[i+1:hi]...)
+		if len(neighbors) < 4 {
+			continue
+		}
+
+		m := median(neighbors)
+		deviations := make([]float64, len(neighbors))
+		for j, n := range neighbors {
+			deviations[j] = math.Abs(n - m)
+		}
+
+		var score float64
+		if mad := median(deviations); mad != 0 {
+			score = 0.6745 * (value - m) / mad
+		} else {
+			meanAD := math.Abs(value - m)
+			for _, d := range deviations {
+				meanAD += d
+			}
+			meanAD /= float64(len(deviations) + 1)
+
+			if meanAD == 0 {
+				continue
+			}
+			score = (value - m) / (1.253314 * meanAD)
+		}
+
+		if math.Abs(score) > opts.SpikeThreshold {
+			findings = append(findings, Finding{
+				Kind:   FindingSpike,
+				Metric: metric,
+				Start:  sorted[i].Posted,
+				End:    sorted[i].Posted,
+				Value:  value,
+				Score:  score,
+			})
+		}
+	}
+
+	return findings
+}
+
+// findFlatlines reports runs of at least three readings with exactly the
+// same value lasting at least the flatline duration.  Zero light is
+// expected at night so isn't reported.
+func findFlatlines(sorted []Reading, metric string, values []float64, opts ReportOptions) []Finding {
+	var findings []Finding
+
+	runStart := 0
+	for i := 1; i <= len(values); i++ {
+		if i < len(values) && values[i] == values[runStart] {
+			continue
+		}
+
+		last := i - 1
+		duration := sorted[last].Posted.Sub(sorted[runStart].Posted)
+		dark := metric == "light" && values[runStart] == 0
+		if last-runStart >= 2 && duration >= opts.FlatlineDuration && !dark {
+			findings = append(findings, Finding{
+				Kind:   FindingFlatline,
+				Metric: metric,
+				Start:  sorted[runStart].Posted,
+				End:    sorted[last].Posted,
+				Value:  values[runStart],
+			})
+		}
+
+		runStart = i
+	}
+
+	return findings
+}
+
+// median returns the median of values, which it sorts.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[mid]
+	}
+
+	return (values[mid-1] + values[mid]) / 2
+}
+
+type byFindingStart []Finding
+
+func (a byFindingStart) Len() int           { return len(a) }
+func (a byFindingStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFindingStart) Less(i, j int) bool { return a[i].Start.Before(a[j].Start) }
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeReadings(t *testing.T) {
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour * 48)
+	step := time.Minute * 15
+
+	var readings []Reading
+	for i := 0; i < 48*4; i++ {
+		posted := start.Add(step * time.Duration(i))
+		// nothing posted from 06:00 to 09:00 on the first day
+		if posted.After(start.Add(time.Hour*6)) && posted.Before(start.Add(time.Hour*9)) {
+			continue
+		}
+
+		phase := 2 * math.Pi * float64(i) / (24 * 4)
+		r := Reading{
+			CoreID:      "core",
+			Posted:      posted,
+			Temperature: 20 + 5*math.Sin(phase) + 0.1*math.Sin(float64(i)*7),
+			Humidity:    50 + 10*math.Cos(phase) + 0.2*math.Cos(float64(i)*3),
+			Moisture:    60 - float64(i)*0.05,
+			Light:       math.Max(0, 100*math.Sin(phase)),
+			Battery:     80,
+		}
+
+		// moisture sensor stuck for the last eight hours
+		if posted.After(end.Add(-time.Hour * 8)) {
+			r.Moisture = 42
+		}
+
+		readings = append(readings, r)
+	}
+
+	// temperature spike at 12:00 on the first day
+	spikeAt := start.Add(time.Hour * 12)
+	for i := range readings {
+		if readings[i].Posted.Equal(spikeAt) {
+			readings[i].Temperature = 60
+		}
+	}
+
+	report := AnalyzeReadings("core", start, end, readings, ReportOptions{})
+
+	if report.Cadence != step {
+		t.Errorf("Expected estimated cadence of %s, got %s", step, report.Cadence)
+	}
+
+	counts := make(map[string]int)
+	for _, f := range report.Findings {
+		counts[f.Kind+f.Metric]++
+
+		switch {
+		case f.Kind == FindingGap:
+			if !f.Start.Equal(start.Add(time.Hour*6)) || !f.End.Equal(start.Add(time.Hour*9)) || f.Missing != 11 {
+				t.Errorf("Unexpected gap %v", f)
+			}
+		case f.Kind == FindingSpike && f.Metric == "temperature":
+			if !f.Start.Equal(spikeAt) || f.Value != 60 {
+				t.Errorf("Unexpected spike %v", f)
+			}
+		case f.Kind == FindingFlatline:
+			if f.Metric != "moisture" || f.Value != 42 {
+				t.Errorf("Unexpected flatline %v", f)
+			}
+		}
+	}
+
+	for kind, expected := range map[string]int{
+		FindingGap:                   1,
+		FindingSpike + "temperature": 1,
+		FindingFlatline + "moisture": 1,
+		FindingFlatline + "light":    0,
+		FindingFlatline + "battery":  0,
+		FindingSpike + "humidity":    0,
+	} {
+		if counts[kind] != expected {
+			t.Errorf("Expected %d %s findings, got %d", expected, kind, counts[kind])
+		}
+	}
+
+	for i := 1; i < len(report.Findings); i++ {
+		if report.Findings[i].Start.Before(report.Findings[i-1].Start) {
+			t.Fatal("Findings not ordered by start")
+		}
+	}
+}
+
+func TestAnalyzeReadingsFlatSpike(t *testing.T) {
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	step := time.Minute * 15
+
+	// flat temperature but for a single outlier
+	var readings []Reading
+	for i := 0; i < 24; i++ {
+		readings = append(readings, Reading{CoreID: "core", Posted: start.Add(step * time.Duration(i)), Temperature: 20, Light: 10})
+	}
+	readings[12].Temperature = 35
+
+	report := AnalyzeReadings("core", start, start.Add(step*24), readings, ReportOptions{Cadence: step})
+
+	var spikes []Finding
+	for _, f := range report.Findings {
+		if f.Kind == FindingSpike {
+			spikes = append(spikes, f)
+		}
+	}
+
+	if len(spikes) != 1 || spikes[0].Metric != "temperature" || !spikes[0].Start.Equal(readings[12].Posted) || spikes[0].Value != 35 {
+		t.Fatalf("Expected the outlier reported as a spike, got %v", spikes)
+	}
+}
+
+func TestAnalyzeReadingsTrailingGap(t *testing.T) {
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readings := []Reading{{Posted: start}, {Posted: start.Add(time.Hour)}}
+
+	report := AnalyzeReadings("core", start, start.Add(time.Hour*5), readings, ReportOptions{Cadence: time.Hour})
+	if len(report.Findings) != 1 || report.Findings[0].Kind != FindingGap || report.Findings[0].Missing != 3 {
+		t.Fatalf("Expected a trailing gap of 3 readings, got %v", report.Findings)
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(reportJSON, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Cadence != time.Hour || len(decoded.Findings) != 1 {
+		t.Fatalf("Decoded report %v doesn't match %v", decoded, report)
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorInvalidRetentionPolicy is returned when a retention policy would
+// delete data before it can be rolled up.
+var ErrorInvalidRetentionPolicy = errors.New("Retention policy is invalid")
+
+// RetentionStore is an interface for any type that can store users'
+// retention policies and maintain hourly and daily rollups of their
+// readings.  RollupReadings stores the hourly and daily rollups of the
+// user's readings, combining them with any rollups of the same core and
+// bucket, e.g. from readings posted late, then deletes the readings rolled
+// up, given by core and posted time, all at once.  Readings stored since
+// they were read aren't deleted, so are rolled up by a later run.
+type RetentionStore interface {
+	GetRetentionPolicy(userEmail string) (RetentionPolicy, error)
+	StoreRetentionPolicy(userEmail string, policy RetentionPolicy) error
+	GetRetentionPolicies() (map[string]RetentionPolicy, error)
+	RollupReadings(userEmail string, rolledUp map[string][]time.Time, hourly, daily []Aggregate) error
+	DeleteRollups(userEmail, interval string, before time.Time) error
+	GetRollups(userEmail, core string, start, end time.Time) ([]Aggregate, error)
+}
+
+// RetentionPolicy describes how many days of a user's raw readings, hourly
+// rollups and daily rollups are kept.  Zero means forever.  Raw readings are
+// calibrated and rolled up into hourly and daily rollups, by the hour and day
+// in the user's time zone for their core, before being deleted.
+type RetentionPolicy struct {
+	RawDays    int `json:"raw_days"`
+	HourlyDays int `json:"hourly_days"`
+	DailyDays  int `json:"daily_days"`
+}
+
+// Validate checks the policy keeps each rollup at least as long as the data
+// it is computed from.
+func (p RetentionPolicy) Validate() error {
+	if p.RawDays < 0 || p.HourlyDays < 0 || p.DailyDays < 0 {
+		return ErrorInvalidRetentionPolicy
+	}
+
+	if !keepsLonger(p.HourlyDays, p.RawDays) || !keepsLonger(p.DailyDays, p.HourlyDays) {
+		return ErrorInvalidRetentionPolicy
+	}
+
+	return nil
+}
+
+// Cutoffs returns the times before which raw readings, hourly rollups and
+// daily rollups expire, truncated to the UTC day.  A zero time means data
+// never expires.
+func (p RetentionPolicy) Cutoffs(now time.Time) (raw, hourly, daily time.Time) {
+	cutoff := func(days int) time.Time {
+		if days == 0 {
+			return time.Time{}
+		}
+		return now.UTC().Truncate(time.Hour*24).AddDate(0, 0, -days)
+	}
+
+	return cutoff(p.RawDays), cutoff(p.HourlyDays), cutoff(p.DailyDays)
+}
+
+// keepsLonger returns true if retaining data for a days keeps it at least
+// as long as retaining for b days.
+func keepsLonger(a, b int) bool {
+	if a == 0 {
+		return true
+	}
+
+	return b != 0 && a >= b
+}
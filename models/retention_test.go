@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		policy RetentionPolicy
+		valid  bool
+	}{
+		{policy: RetentionPolicy{}, valid: true},
+		{policy: RetentionPolicy{RawDays: 30}, valid: true},
+		{policy: RetentionPolicy{RawDays: 30, HourlyDays: 90, DailyDays: 365}, valid: true},
+		{policy: RetentionPolicy{RawDays: 30, HourlyDays: 30, DailyDays: 30}, valid: true},
+		{policy: RetentionPolicy{RawDays: 30, HourlyDays: 7}, valid: false},
+		{policy: RetentionPolicy{HourlyDays: 90}, valid: false},
+		{policy: RetentionPolicy{RawDays: 30, HourlyDays: 90, DailyDays: 60}, valid: false},
+		{policy: RetentionPolicy{RawDays: -1}, valid: false},
+	} {
+		err := tc.policy.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("%v: unexpected error %s", tc.policy, err)
+		} else if !tc.valid && err != ErrorInvalidRetentionPolicy {
+			t.Errorf("%v: expected ErrorInvalidRetentionPolicy, got %v", tc.policy, err)
+		}
+	}
+}
+
+func TestRetentionPolicyCutoffs(t *testing.T) {
+	now := time.Date(2016, 5, 10, 15, 30, 0, 0, time.UTC)
+	policy := RetentionPolicy{RawDays: 7, HourlyDays: 30}
+
+	raw, hourly, daily := policy.Cutoffs(now)
+	if !raw.Equal(time.Date(2016, 5, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected raw cutoff %s", raw)
+	}
+
+	if !hourly.Equal(time.Date(2016, 4, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected hourly cutoff %s", hourly)
+	}
+
+	if !daily.IsZero() {
+		t.Errorf("Expected daily rollups to never expire, got cutoff %s", daily)
+	}
+}
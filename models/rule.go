@@ -0,0 +1,377 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Comparisons rule conditions may make between a reading's value and the
+// condition's threshold.
+const (
+	Below   = "<"
+	AtMost  = "<="
+	Above   = ">"
+	AtLeast = ">="
+)
+
+// ruleTimeForm is the layout of the times of day in rule schedules.
+const ruleTimeForm = "15:04"
+
+// Kinds of actions rules may take when triggered.
+const (
+	ActionCommand = "command"
+	ActionWebhook = "webhook"
+)
+
+// Results of rule executions.  Dry run rules record what they would have
+// done without doing it.
+const (
+	ExecutionFired  = "fired"
+	ExecutionDryRun = "dry_run"
+	ExecutionFailed = "failed"
+)
+
+var (
+	// ErrorRuleDoesntExist is returned when a rule is requested that
+	// doesn't exist for the user.
+	ErrorRuleDoesntExist = errors.New("Rule does not exist")
+	// ErrorInvalidRule is returned when a rule has no name, core or
+	// conditions, an unknown metric or comparison, an invalid schedule or
+	// quiet period, a negative cooldown, or an incomplete action.
+	ErrorInvalidRule = errors.New("Rule must have a name, core, valid conditions and a complete action")
+)
+
+// RuleStore is an interface for any type that can store users' automation
+// rules and the history of their executions.  StoreRule inserts rules
+// without an ID and updates those with one.  ClaimFiring atomically records
+// now as the rule's last firing, from which cooldowns count, returning false
+// if the rule is cooling down or doesn't exist, so concurrent readings fire
+// a rule once.  StoreExecution records an execution of a claimed firing;
+// failed executions release the claim, restoring the rule's last firing to
+// its last execution that didn't fail.
+type RuleStore interface {
+	GetRules(userEmail string) ([]Rule, error)
+	GetCoreRules(userEmail, core string) ([]Rule, error)
+	StoreRule(rule Rule) (int64, error)
+	DeleteRule(userEmail string, id int64) error
+	GetExecutions(userEmail string, ruleID int64) ([]Execution, error)
+	ClaimFiring(userEmail string, id int64, now time.Time) (bool, error)
+	StoreExecution(execution Execution) error
+}
+
+// Rule triggers an action when a reading from its core meets all of its
+// conditions, during its schedule, if none of the events in its quiet
+// periods have happened recently and it hasn't fired within its cooldown.
+// Conditions compare calibrated values in the units readings are stored in.
+// In JSON durations are duration strings such as "6h0m0s".
+type Rule struct {
+	ID         int64         `json:"id"`
+	UserEmail  string        `json:"user"`
+	Name       string        `json:"name"`
+	CoreID     string        `json:"coreid"`
+	Conditions []Condition   `json:"conditions"`
+	Quiet      []QuietPeriod `json:"quiet,omitempty"`
+	Schedule   *RuleSchedule `json:"schedule,omitempty"`
+	Action     RuleAction    `json:"action"`
+	Cooldown   time.Duration `json:"cooldown"`
+	Enabled    bool          `json:"enabled"`
+	DryRun     bool          `json:"dry_run"`
+	LastFired  *time.Time    `json:"last_fired,omitempty"`
+}
+
+// Condition compares a metric of a reading to a threshold, e.g. moisture
+// below 30.
+type Condition struct {
+	Metric  string  `json:"metric"`
+	Compare string  `json:"compare"`
+	Value   float64 `json:"value"`
+}
+
+// QuietPeriod holds a rule off while an event of the given kind, such as a
+// watering, has been logged for the rule's core within the period.
+type QuietPeriod struct {
+	Kind   string        `json:"kind"`
+	Period time.Duration `json:"period"`
+}
+
+// RuleSchedule limits a rule to the hours between From and Until, as
+// "15:04" local to TimeZone, on the given days of the week, or every day if
+// none are given.  Until may be before From for schedules spanning midnight.
+type RuleSchedule struct {
+	Days     []time.Weekday `json:"days,omitempty"`
+	From     string         `json:"from"`
+	Until    string         `json:"until"`
+	TimeZone string         `json:"time_zone,omitempty"`
+}
+
+// RuleAction is what a rule does when triggered: queue the named command
+// for its core, or post to the webhook URL.  Commands that water or
+// fertilize may log an event of that kind, so quiet periods account for
+// them.
+type RuleAction struct {
+	Kind     string        `json:"kind"`
+	Command  string        `json:"command,omitempty"`
+	Argument string        `json:"argument,omitempty"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	LogEvent string        `json:"log_event,omitempty"`
+	URL      string        `json:"url,omitempty"`
+}
+
+// Execution records a rule being triggered by a reading, and what came of
+// it.  CommandID is the command queued, if any; Detail describes a failure,
+// or the webhook delivery queued.
+type Execution struct {
+	ID        int64     `json:"id"`
+	RuleID    int64     `json:"rule_id"`
+	UserEmail string    `json:"user"`
+	CoreID    string    `json:"coreid"`
+	Triggered time.Time `json:"triggered"`
+	Reading   time.Time `json:"reading"`
+	Result    string    `json:"result"`
+	Detail    string    `json:"detail,omitempty"`
+	CommandID int64     `json:"command_id,omitempty"`
+}
+
+// Validate checks the rule is complete and its schedule and action are
+// well formed.
+func (r Rule) Validate() error {
+	if r.Name == "" || r.CoreID == "" || len(r.Conditions) == 0 || r.Cooldown < 0 {
+		return ErrorInvalidRule
+	}
+
+	for _, c := range r.Conditions {
+		if _, ok := (Reading{}).Value(c.Metric); !ok {
+			return ErrorInvalidRule
+		}
+
+		switch c.Compare {
+		case Below, AtMost, Above, AtLeast:
+		default:
+			return ErrorInvalidRule
+		}
+	}
+
+	for _, q := range r.Quiet {
+		if (q.Kind != EventWatering && q.Kind != EventFertilizing) || q.Period <= 0 {
+			return ErrorInvalidRule
+		}
+	}
+
+	if r.Schedule != nil {
+		if err := r.Schedule.validate(); err != nil {
+			return err
+		}
+	}
+
+	return r.Action.validate()
+}
+
+func (s RuleSchedule) validate() error {
+	if _, err := time.Parse(ruleTimeForm, s.From); err != nil {
+		return ErrorInvalidRule
+	}
+
+	if _, err := time.Parse(ruleTimeForm, s.Until); err != nil {
+		return ErrorInvalidRule
+	}
+
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return ErrorInvalidRule
+	}
+
+	for _, d := range s.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return ErrorInvalidRule
+		}
+	}
+
+	return nil
+}
+
+func (a RuleAction) validate() error {
+	switch a.Kind {
+	case ActionCommand:
+		command := NewCommand("", "core", a.Command, a.Argument, a.TTL, time.Time{})
+		if a.TTL < 0 || command.Validate() != nil {
+			return ErrorInvalidRule
+		}
+
+		if a.LogEvent != "" && a.LogEvent != EventWatering && a.LogEvent != EventFertilizing {
+			return ErrorInvalidRule
+		}
+	case ActionWebhook:
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrorInvalidRule
+		}
+	default:
+		return ErrorInvalidRule
+	}
+
+	return nil
+}
+
+// Matches returns true if the reading is from the rule's core and meets all
+// of the rule's conditions.
+func (r Rule) Matches(reading Reading) bool {
+	if reading.CoreID != r.CoreID || reading.UserEmail != r.UserEmail {
+		return false
+	}
+
+	for _, c := range r.Conditions {
+		value, ok := reading.Value(c.Metric)
+		if !ok {
+			return false
+		}
+
+		switch {
+		case c.Compare == Below && value < c.Value:
+		case c.Compare == AtMost && value <= c.Value:
+		case c.Compare == Above && value > c.Value:
+		case c.Compare == AtLeast && value >= c.Value:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ScheduledAt returns true if the rule's schedule, if any, permits it to
+// fire at the given time.
+func (r Rule) ScheduledAt(t time.Time) bool {
+	if r.Schedule == nil {
+		return true
+	}
+
+	loc, err := time.LoadLocation(r.Schedule.TimeZone)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+
+	if len(r.Schedule.Days) > 0 {
+		scheduled := false
+		for _, d := range r.Schedule.Days {
+			scheduled = scheduled || d == t.Weekday()
+		}
+
+		if !scheduled {
+			return false
+		}
+	}
+
+	from, _ := time.Parse(ruleTimeForm, r.Schedule.From)
+	until, _ := time.Parse(ruleTimeForm, r.Schedule.Until)
+	minute := func(t time.Time) int { return t.Hour()*60 + t.Minute() }
+
+	now, start, end := minute(t), minute(from), minute(until)
+	if start <= end {
+		return now >= start && now < end
+	}
+
+	return now >= start || now < end
+}
+
+// CoolingDownAt returns true if the rule last fired within its cooldown of
+// the given time.
+func (r Rule) CoolingDownAt(t time.Time) bool {
+	return r.LastFired != nil && t.Sub(*r.LastFired) < r.Cooldown
+}
+
+type rule Rule
+
+// MarshalJSON encodes the rule with its cooldown as a duration string.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		rule
+		Cooldown string `json:"cooldown"`
+	}{rule: rule(r), Cooldown: r.Cooldown.String()})
+}
+
+// UnmarshalJSON decodes a rule encoded by MarshalJSON.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var rj struct {
+		rule
+		Cooldown string `json:"cooldown"`
+	}
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+
+	*r = Rule(rj.rule)
+	return parseDurationField(rj.Cooldown, &r.Cooldown)
+}
+
+type quietPeriod QuietPeriod
+
+// MarshalJSON encodes the quiet period with its period as a duration
+// string.
+func (q QuietPeriod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		quietPeriod
+		Period string `json:"period"`
+	}{quietPeriod: quietPeriod(q), Period: q.Period.String()})
+}
+
+// UnmarshalJSON decodes a quiet period encoded by MarshalJSON.
+func (q *QuietPeriod) UnmarshalJSON(data []byte) error {
+	var qj struct {
+		quietPeriod
+		Period string `json:"period"`
+	}
+	if err := json.Unmarshal(data, &qj); err != nil {
+		return err
+	}
+
+	*q = QuietPeriod(qj.quietPeriod)
+	return parseDurationField(qj.Period, &q.Period)
+}
+
+type ruleAction RuleAction
+
+// MarshalJSON encodes the action with its command TTL, if any, as a
+// duration string.
+func (a RuleAction) MarshalJSON() ([]byte, error) {
+	var ttl string
+	if a.TTL != 0 {
+		ttl = a.TTL.String()
+	}
+
+	return json.Marshal(struct {
+		ruleAction
+		TTL string `json:"ttl,omitempty"`
+	}{ruleAction: ruleAction(a), TTL: ttl})
+}
+
+// UnmarshalJSON decodes an action encoded by MarshalJSON.
+func (a *RuleAction) UnmarshalJSON(data []byte) error {
+	var aj struct {
+		ruleAction
+		TTL string `json:"ttl,omitempty"`
+	}
+	if err := json.Unmarshal(data, &aj); err != nil {
+		return err
+	}
+
+	*a = RuleAction(aj.ruleAction)
+	return parseDurationField(aj.TTL, &a.TTL)
+}
+
+// parseDurationField parses a duration string from JSON into d, leaving it
+// zero if the string is empty.
+func parseDurationField(s string, d *time.Duration) error {
+	if s == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func waterRule() Rule {
+	return Rule{
+		UserEmail:  "user",
+		Name:       "water when dry",
+		CoreID:     "core",
+		Conditions: []Condition{{Metric: "moisture", Compare: Below, Value: 30}},
+		Quiet:      []QuietPeriod{{Kind: EventWatering, Period: time.Hour * 6}},
+		Action:     RuleAction{Kind: ActionCommand, Command: "water", Argument: "20s", LogEvent: EventWatering},
+		Cooldown:   time.Hour,
+		Enabled:    true,
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	for _, tc := range []struct {
+		modify func(*Rule)
+		err    error
+	}{
+		{func(r *Rule) {}, nil},
+		{func(r *Rule) { r.Action = RuleAction{Kind: ActionWebhook, URL: "https://example.com/hook"} }, nil},
+		{func(r *Rule) { r.Schedule = &RuleSchedule{From: "22:00", Until: "06:00", TimeZone: "America/Chicago"} }, nil},
+		{func(r *Rule) { r.Name = "" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Conditions = nil }, ErrorInvalidRule},
+		{func(r *Rule) { r.Conditions[0].Metric = "pressure" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Conditions[0].Compare = "==" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Quiet[0].Kind = "pruning" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Cooldown = -time.Hour }, ErrorInvalidRule},
+		{func(r *Rule) { r.Schedule = &RuleSchedule{From: "8am", Until: "20:00"} }, ErrorInvalidRule},
+		{func(r *Rule) { r.Schedule = &RuleSchedule{From: "08:00", Until: "20:00", TimeZone: "Mars/Olympus"} }, ErrorInvalidRule},
+		{func(r *Rule) { r.Action.Command = "" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Action.LogEvent = "pruning" }, ErrorInvalidRule},
+		{func(r *Rule) { r.Action = RuleAction{Kind: ActionWebhook, URL: "ftp://example.com"} }, ErrorInvalidRule},
+		{func(r *Rule) { r.Action.Kind = "email" }, ErrorInvalidRule},
+	} {
+		rule := waterRule()
+		tc.modify(&rule)
+		if err := rule.Validate(); err != tc.err {
+			t.Errorf("Validating %v: expected %v, got %v", rule, tc.err, err)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule := waterRule()
+	rule.Conditions = append(rule.Conditions, Condition{Metric: "light", Compare: AtLeast, Value: 10})
+
+	for _, tc := range []struct {
+		reading Reading
+		matches bool
+	}{
+		{Reading{UserEmail: "user", CoreID: "core", Moisture: 20, Light: 10}, true},
+		{Reading{UserEmail: "user", CoreID: "core", Moisture: 30, Light: 10}, false},
+		{Reading{UserEmail: "user", CoreID: "core", Moisture: 20, Light: 5}, false},
+		{Reading{UserEmail: "user", CoreID: "other", Moisture: 20, Light: 10}, false},
+		{Reading{UserEmail: "other", CoreID: "core", Moisture: 20, Light: 10}, false},
+	} {
+		if matches := rule.Matches(tc.reading); matches != tc.matches {
+			t.Errorf("Expected match %t for %v, got %t", tc.matches, tc.reading, matches)
+		}
+	}
+}
+
+func TestRuleScheduledAt(t *testing.T) {
+	rule := waterRule()
+	rule.Schedule = &RuleSchedule{Days: []time.Weekday{time.Tuesday}, From: "22:00", Until: "06:00", TimeZone: "America/Chicago"}
+
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2016-05-10 was a Tuesday
+	for _, tc := range []struct {
+		at        time.Time
+		scheduled bool
+	}{
+		{time.Date(2016, 5, 10, 23, 0, 0, 0, chicago), true},
+		{time.Date(2016, 5, 10, 5, 59, 0, 0, chicago), true},
+		{time.Date(2016, 5, 10, 6, 0, 0, 0, chicago), false},
+		{time.Date(2016, 5, 10, 12, 0, 0, 0, chicago), false},
+		{time.Date(2016, 5, 11, 23, 0, 0, 0, chicago), false},
+		// 23:00 Tuesday in Chicago is Wednesday in UTC
+		{time.Date(2016, 5, 11, 4, 0, 0, 0, time.UTC), true},
+	} {
+		if scheduled := rule.ScheduledAt(tc.at); scheduled != tc.scheduled {
+			t.Errorf("Expected scheduled %t at %s, got %t", tc.scheduled, tc.at, scheduled)
+		}
+	}
+
+	rule.Schedule = nil
+	if !rule.ScheduledAt(time.Now()) {
+		t.Error("Expected rule without a schedule to always be scheduled")
+	}
+}
+
+func TestRuleCoolingDownAt(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	rule := waterRule()
+
+	if rule.CoolingDownAt(now) {
+		t.Error("Expected rule that never fired not to be cooling down")
+	}
+
+	fired := now.Add(-time.Minute * 30)
+	rule.LastFired = &fired
+	if !rule.CoolingDownAt(now) {
+		t.Error("Expected rule fired 30m ago to be cooling down")
+	}
+
+	if rule.CoolingDownAt(now.Add(time.Minute * 30)) {
+		t.Error("Expected rule fired an hour ago not to be cooling down")
+	}
+}
+
+func TestRuleJSON(t *testing.T) {
+	rule := waterRule()
+	rule.Action.TTL = time.Minute * 5
+
+	encoded, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["cooldown"] != "1h0m0s" {
+		t.Errorf("Expected cooldown encoded as a duration string, got %v", fields["cooldown"])
+	}
+
+	var decoded Rule
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, rule) {
+		t.Fatalf("Expected %v decoded, got %v", rule, decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"cooldown": "soon"}`), &decoded); err == nil {
+		t.Error("Expected invalid cooldown to fail decoding")
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrorTaskDoesntExist is returned when a scheduled task is requested
+	// that hasn't been registered.
+	ErrorTaskDoesntExist = errors.New("Scheduled task does not exist")
+	// ErrorTaskRunning is returned when a scheduled task is triggered while
+	// another run, possibly on another instance, holds its lock.
+	ErrorTaskRunning = errors.New("Scheduled task is already running")
+)
+
+// TaskStore is an interface for any type that can persist the run state of
+// scheduled tasks and lock them so only one instance runs a task at a time.
+type TaskStore interface {
+	GetTaskStates() ([]TaskState, error)
+	ScheduleTask(name string, next time.Time) error
+	ClaimTask(name, owner string, now time.Time, lease time.Duration, force bool) (bool, error)
+	CompleteTask(name, owner string, ran time.Time, runErr error, next time.Time) error
+}
+
+// TaskState describes the last and next runs of a scheduled task.  While a
+// task is running it is locked by the instance running it until it
+// completes or the lock expires at LockedUntil.
+type TaskState struct {
+	Name        string    `json:"name"`
+	LastRun     time.Time `json:"last_run"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextRun     time.Time `json:"next_run"`
+	LockedBy    string    `json:"locked_by,omitempty"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Locked returns true if the task is locked as of now.
+func (s TaskState) Locked(now time.Time) bool {
+	return s.LockedBy != "" && now.Before(s.LockedUntil)
+}
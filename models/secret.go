@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 )
 
@@ -42,6 +43,13 @@ func (s Secret) Encode() string {
 	return base64.URLEncoding.EncodeToString([]byte(s))
 }
 
+// Fingerprint returns a short hex digest identifying the secret without
+// revealing it.
+func (s Secret) Fingerprint() string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
 // Sign returns a base64 encoded signature of the input string using the
 // secret and HMAC 256 scheme.
 func (s Secret) Sign(input string) string {
@@ -105,3 +105,20 @@ func BenchmarkSecret(b *testing.B) {
 		NewSecret()
 	}
 }
+
+func TestSecretFingerprint(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("Error creating Secret %s", err.Error())
+	}
+
+	fingerprint := secret.Fingerprint()
+	if len(fingerprint) != 16 || fingerprint != secret.Fingerprint() {
+		t.Fatalf("Expected a stable 16 character fingerprint, got %s", fingerprint)
+	}
+
+	other, _ := NewSecret()
+	if other.Fingerprint() == fingerprint {
+		t.Fatal("Different secrets have the same fingerprint")
+	}
+}
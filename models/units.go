@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Units readings can be converted to.
+const (
+	Celsius    = "C"
+	Fahrenheit = "F"
+	Percent    = "percent"
+	Lux        = "lux"
+	// LightFullScale is the illuminance, in lux, of full daylight; it is
+	// used as 100 percent when converting light to Percent.
+	LightFullScale = 100000.0
+)
+
+// CanonicalUnits are the units each metric is stored in.  Readings posted
+// in other units must declare them to be converted on ingest.
+var CanonicalUnits = Units{
+	"temperature": Celsius,
+	"humidity":    Percent,
+	"moisture":    Percent,
+	"light":       Lux,
+	"battery":     Percent,
+}
+
+// unitConversions holds, per metric, functions converting a value in the
+// metric's canonical unit to each supported unit.
+var unitConversions = map[string]map[string]func(float64) float64{
+	"temperature": {
+		Celsius:    func(c float64) float64 { return c },
+		Fahrenheit: func(c float64) float64 { return c*9/5 + 32 },
+	},
+	"humidity": {
+		Percent: func(p float64) float64 { return p },
+	},
+	"moisture": {
+		Percent: func(p float64) float64 { return p },
+	},
+	"light": {
+		Lux:     func(l float64) float64 { return l },
+		Percent: func(l float64) float64 { return l / LightFullScale * 100 },
+	},
+	"battery": {
+		Percent: func(p float64) float64 { return p },
+	},
+}
+
+// canonicalConversions holds, per metric, functions converting a value in
+// each supported unit back to the metric's canonical unit.
+var canonicalConversions = map[string]map[string]func(float64) float64{
+	"temperature": {
+		Celsius:    func(c float64) float64 { return c },
+		Fahrenheit: func(f float64) float64 { return (f - 32) * 5 / 9 },
+	},
+	"humidity": {
+		Percent: func(p float64) float64 { return p },
+	},
+	"moisture": {
+		Percent: func(p float64) float64 { return p },
+	},
+	"light": {
+		Lux:     func(l float64) float64 { return l },
+		Percent: func(p float64) float64 { return p / 100 * LightFullScale },
+	},
+	"battery": {
+		Percent: func(p float64) float64 { return p },
+	},
+}
+
+// Units maps metric names to the unit their values are expressed in.
+type Units map[string]string
+
+// DefaultUnits returns the units used for a user with the given locale when
+// they haven't set a preference; Fahrenheit for the US, canonical units
+// otherwise.
+func DefaultUnits(locale string) Units {
+	units := CanonicalUnits.Merge(nil)
+
+	locale = strings.ToLower(locale)
+	if locale == "us" || strings.HasSuffix(locale, "-us") || strings.HasSuffix(locale, "_us") {
+		units["temperature"] = Fahrenheit
+	}
+
+	return units
+}
+
+// ParseUnits parses units from a comma separated list of metric:unit pairs,
+// e.g. "temperature:F,light:percent".
+func ParseUnits(s string) (Units, error) {
+	units := make(Units)
+	if s == "" {
+		return units, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid unit %q, expected metric:unit", pair)
+		}
+		units[parts[0]] = parts[1]
+	}
+
+	return units, units.Validate()
+}
+
+// String formats the units as a sorted, comma separated list of metric:unit
+// pairs, the inverse of ParseUnits.
+func (u Units) String() string {
+	pairs := make([]string, 0, len(u))
+	for metric, unit := range u {
+		pairs = append(pairs, metric+":"+unit)
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Validate checks each metric supports the unit it's mapped to.
+func (u Units) Validate() error {
+	for metric, unit := range u {
+		conversions, ok := unitConversions[metric]
+		if !ok {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+
+		if _, ok := conversions[unit]; !ok {
+			return fmt.Errorf("unsupported unit %q for %s", unit, metric)
+		}
+	}
+
+	return nil
+}
+
+// Merge returns a copy of the units with entries in overrides replacing
+// those for the same metric.
+func (u Units) Merge(overrides Units) Units {
+	merged := make(Units, len(u))
+	for metric, unit := range u {
+		merged[metric] = unit
+	}
+
+	for metric, unit := range overrides {
+		merged[metric] = unit
+	}
+
+	return merged
+}
+
+// Convert returns the reading, assumed to be in canonical units, with each
+// metric converted to its unit.  Metrics without a supported unit are left
+// unconverted.
+func (u Units) Convert(reading Reading) Reading {
+	for metric, unit := range u {
+		convert, ok := unitConversions[metric][unit]
+		if !ok {
+			continue
+		}
+
+		value, _ := reading.Value(metric)
+		reading.SetValue(metric, convert(value))
+	}
+
+	return reading
+}
+
+// Canonical returns the reading, assumed to be in the units, with each
+// metric converted to its canonical unit; the inverse of Convert.
+func (u Units) Canonical(reading Reading) Reading {
+	for metric, unit := range u {
+		convert, ok := canonicalConversions[metric][unit]
+		if !ok {
+			continue
+		}
+
+		value, _ := reading.Value(metric)
+		reading.SetValue(metric, convert(value))
+	}
+
+	return reading
+}
+
+// ConvertAll converts each of the readings in place.
+func (u Units) ConvertAll(readings []Reading) {
+	for i, reading := range readings {
+		readings[i] = u.Convert(reading)
+	}
+}
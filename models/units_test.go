@@ -0,0 +1,69 @@
+package models
+
+import "testing"
+
+func TestParseUnits(t *testing.T) {
+	units, err := ParseUnits("temperature:F,light:percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if units["temperature"] != Fahrenheit || units["light"] != Percent {
+		t.Fatalf("Incorrect units parsed: %v", units)
+	}
+
+	if units.String() != "light:percent,temperature:F" {
+		t.Fatalf("Units formatted incorrectly: %s", units.String())
+	}
+
+	for _, invalid := range []string{"temperature", "temperature:K", "wind:knots"} {
+		if _, err := ParseUnits(invalid); err == nil {
+			t.Errorf("Units should be invalid: %s", invalid)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	reading := Reading{Temperature: 100, Light: 50000, Humidity: 40}
+	converted := Units{"temperature": Fahrenheit, "light": Percent}.Convert(reading)
+
+	if !floatCompare(converted.Temperature, 212) {
+		t.Errorf("Incorrect temperature conversion; expected 212, got %g", converted.Temperature)
+	}
+
+	if !floatCompare(converted.Light, 50) {
+		t.Errorf("Incorrect light conversion; expected 50, got %g", converted.Light)
+	}
+
+	if !floatCompare(converted.Humidity, 40) {
+		t.Errorf("Unconverted metric changed; expected 40, got %g", converted.Humidity)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	units := Units{"temperature": Fahrenheit, "light": Percent}
+	reading := units.Canonical(Reading{Temperature: 212, Light: 50, Humidity: 40})
+
+	if !floatCompare(reading.Temperature, 100) || !floatCompare(reading.Light, 50000) || !floatCompare(reading.Humidity, 40) {
+		t.Fatalf("Incorrect conversion to canonical units: %v", reading)
+	}
+
+	if converted := units.Convert(reading); !floatCompare(converted.Temperature, 212) || !floatCompare(converted.Light, 50) {
+		t.Fatalf("Canonical should be the inverse of Convert, got %v", converted)
+	}
+}
+
+func TestEffectiveUnits(t *testing.T) {
+	if units := (Preferences{Locale: "en-US"}).EffectiveUnits(); units["temperature"] != Fahrenheit {
+		t.Errorf("US locale should default to Fahrenheit, got %v", units)
+	}
+
+	if units := (Preferences{Locale: "en"}).EffectiveUnits(); units["temperature"] != Celsius {
+		t.Errorf("Non US locale should default to Celsius, got %v", units)
+	}
+
+	preferences := Preferences{Locale: "us", Units: Units{"temperature": Celsius}}
+	if units := preferences.EffectiveUnits(); units["temperature"] != Celsius {
+		t.Errorf("Preference should override locale default, got %v", units)
+	}
+}
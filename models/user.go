@@ -8,9 +8,14 @@ var (
 	// ErrorUserAlreadyExists is returned from a UserStore when a user is
 	// attempted to be stored but already exists in the store.
 	ErrorUserAlreadyExists = errors.New("Entry already exists for user")
+	// ErrorUserDoesntExist is returned from a UserStore when a user is
+	// requested that isn't in the store.
+	ErrorUserDoesntExist = errors.New("No entry exists for user")
 )
 
-// UserStore is an interface represeting types that can store and retrieve user descriptions
+// UserStore is an interface represeting types that can store and retrieve user descriptions.
+// GetUser should return ErrorUserDoesntExist for unknown users, and StoreUser
+// ErrorUserAlreadyExists for users already stored.
 type UserStore interface {
 	GetUser(email string) (User, error)
 	StoreUser(User) error
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// ErrorReadingQuarantined is returned when a reading fails validation
+	// and is placed in quarantine instead of being stored.
+	ErrorReadingQuarantined = errors.New("Reading failed validation and was quarantined")
+	// ErrorQuarantinedDoesntExist is returned from a QuarantineStore when a
+	// requested quarantined reading doesn't exist.
+	ErrorQuarantinedDoesntExist = errors.New("No quarantined reading exists for given criterion")
+)
+
+// DefaultValidationLimits are the limits readings are validated against when
+// a user hasn't configured limits for a core.  Readings are validated as
+// posted, before calibration, so moisture, whose raw range depends on the
+// probe, has no default limit.
+var DefaultValidationLimits = ValidationLimits{
+	"temperature": {Min: -40, Max: 85, MaxRate: 20},
+	"humidity":    {Min: 0, Max: 100, MaxRate: 60},
+	"light":       {Min: 0, Max: 200000},
+	"battery":     {Min: 0, Max: 100},
+}
+
+// QuarantineStore is an interface for any type that can hold readings that
+// failed validation, and the limits readings are validated against.
+type QuarantineStore interface {
+	QuarantineReading(reading Reading, reasons []string) error
+	GetQuarantined(userEmail string) ([]QuarantinedReading, error)
+	ReleaseQuarantined(userEmail string, id int64) (Reading, error)
+	DeleteQuarantined(userEmail string, id int64) error
+	GetValidationLimits(userEmail, core string) (ValidationLimits, error)
+	StoreValidationLimits(userEmail, core string, limits ValidationLimits) error
+}
+
+// QuarantinedReading is a reading held back from a user's readings because it
+// failed validation, along with the reasons it failed.
+type QuarantinedReading struct {
+	ID          int64     `json:"id"`
+	Reading     Reading   `json:"reading"`
+	Reasons     []string  `json:"reasons"`
+	Quarantined time.Time `json:"quarantined"`
+}
+
+// MetricLimit describes the acceptable values of a metric.  MaxRate, if not
+// zero, is the largest change per hour accepted between a core's consecutive
+// readings; readings less than an hour apart may change by up to MaxRate.
+type MetricLimit struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	MaxRate float64 `json:"max_rate"`
+}
+
+// ValidationLimits maps metric names to their limits.  Metrics without an
+// entry aren't validated.
+type ValidationLimits map[string]MetricLimit
+
+// Merge returns a copy of the limits with entries in overrides replacing
+// those for the same metric.
+func (l ValidationLimits) Merge(overrides ValidationLimits) ValidationLimits {
+	merged := make(ValidationLimits, len(l))
+	for metric, limit := range l {
+		merged[metric] = limit
+	}
+
+	for metric, limit := range overrides {
+		merged[metric] = limit
+	}
+
+	return merged
+}
+
+// Validate checks the reading against the limits, returning the reasons it
+// is implausible, if any.  previous, if not nil, is the core's reading prior
+// to this one and is used to check rate of change.
+func (l ValidationLimits) Validate(reading Reading, previous *Reading) (reasons []string) {
+	for _, metric := range Metrics {
+		limit, ok := l[metric]
+		if !ok {
+			continue
+		}
+
+		value, _ := reading.Value(metric)
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < limit.Min || value > limit.Max {
+			reasons = append(reasons, fmt.Sprintf("%s %g outside range [%g, %g]", metric, value, limit.Min, limit.Max))
+			continue
+		}
+
+		if previous == nil || limit.MaxRate == 0 {
+			continue
+		}
+
+		hours := reading.Posted.Sub(previous.Posted).Hours()
+		if hours <= 0 {
+			continue
+		}
+
+		if hours < 1 {
+			hours = 1
+		}
+
+		prevValue, _ := previous.Value(metric)
+		rate := math.Abs(value-prevValue) / hours
+		if rate > limit.MaxRate {
+			reasons = append(reasons, fmt.Sprintf("%s changed %g/h, more than %g/h", metric, rate, limit.MaxRate))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	posted := time.Unix(1461300000, 0)
+	previous := Reading{Posted: posted, Temperature: 20, Humidity: 50, Moisture: 40, Light: 80, Battery: 90}
+
+	for _, tc := range []struct {
+		name     string
+		modify   func(*Reading)
+		previous *Reading
+		reasons  int
+	}{
+		{name: "plausible", modify: func(r *Reading) {}, previous: &previous, reasons: 0},
+		{name: "disconnected probe", modify: func(r *Reading) { r.Temperature = 6553.5 }, reasons: 1},
+		{name: "negative humidity", modify: func(r *Reading) { r.Humidity = -3 }, reasons: 1},
+		{name: "raw moisture", modify: func(r *Reading) { r.Moisture = 3000 }, reasons: 0},
+		{name: "spike", modify: func(r *Reading) { r.Temperature = 60 }, previous: &previous, reasons: 1},
+		{name: "spike without previous", modify: func(r *Reading) { r.Temperature = 60 }, reasons: 0},
+	} {
+		reading := previous
+		reading.Posted = posted.Add(time.Minute * 15)
+		tc.modify(&reading)
+
+		reasons := DefaultValidationLimits.Validate(reading, tc.previous)
+		if len(reasons) != tc.reasons {
+			t.Errorf("%s: expected %d reasons, got %v", tc.name, tc.reasons, reasons)
+		}
+	}
+}
+
+func TestValidationLimitsMerge(t *testing.T) {
+	merged := DefaultValidationLimits.Merge(ValidationLimits{"moisture": {Min: 10, Max: 900}})
+
+	if merged["moisture"].Max != 900 {
+		t.Fatalf("Override not applied; got %v", merged["moisture"])
+	}
+
+	if merged["temperature"] != DefaultValidationLimits["temperature"] {
+		t.Fatalf("Default limit lost in merge; got %v", merged["temperature"])
+	}
+
+	if DefaultValidationLimits["moisture"].Max == 900 {
+		t.Fatal("Merge modified the receiver")
+	}
+}
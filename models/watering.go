@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+const (
+	// WateringBaselineWindow is how long before a watering the last
+	// reading may be to serve as the moisture baseline.
+	WateringBaselineWindow = time.Hour * 6
+	// WateringPeakWindow is how long after a watering moisture may keep
+	// rising to its peak.
+	WateringPeakWindow = time.Hour * 6
+	// WateringDecayWindow is how long after the peak moisture decay is
+	// measured, unless the plant is watered again sooner.
+	WateringDecayWindow = time.Hour * 24 * 7
+)
+
+// WateringResponse describes how a core's soil moisture responded to a
+// watering: how far and how fast it rose from the baseline before watering,
+// how fast it decayed afterwards in percent per day, and how long it took to
+// return to the baseline.  LastedEstimated is true if moisture hadn't yet
+// returned to the baseline and Lasted is extrapolated from the decay rate;
+// Lasted is nil if moisture wasn't decaying.  In JSON durations are duration
+// strings such as "2h30m0s".
+type WateringResponse struct {
+	Event           Event          `json:"event"`
+	CoreID          string         `json:"coreid"`
+	Baseline        float64        `json:"baseline"`
+	Peak            float64        `json:"peak"`
+	PeakAt          time.Time      `json:"peak_at"`
+	Rise            float64        `json:"rise"`
+	RiseTime        time.Duration  `json:"rise_time"`
+	DecayRate       float64        `json:"decay_rate"`
+	Lasted          *time.Duration `json:"lasted"`
+	LastedEstimated bool           `json:"lasted_estimated,omitempty"`
+}
+
+type wateringResponse WateringResponse
+
+// MarshalJSON encodes the response with its durations as duration strings.
+func (w WateringResponse) MarshalJSON() ([]byte, error) {
+	var lasted *string
+	if w.Lasted != nil {
+		l := w.Lasted.String()
+		lasted = &l
+	}
+
+	return json.Marshal(struct {
+		wateringResponse
+		RiseTime string  `json:"rise_time"`
+		Lasted   *string `json:"lasted"`
+	}{wateringResponse: wateringResponse(w), RiseTime: w.RiseTime.String(), Lasted: lasted})
+}
+
+// AnalyzeWatering measures a core's moisture response to a watering event
+// from its readings around the event, stopping at next (the next watering)
+// if not zero.  It isn't ok if there are no readings shortly before and
+// after the event.
+func AnalyzeWatering(event Event, core string, readings []Reading, next time.Time) (WateringResponse, bool) {
+	response := WateringResponse{Event: event, CoreID: core}
+
+	sorted := append([]Reading(nil), readings...)
+	SortReadings(sorted)
+
+	end := event.Posted.Add(WateringPeakWindow + WateringDecayWindow)
+	if !next.IsZero() && next.Before(end) {
+		end = next
+	}
+
+	var baseline *Reading
+	var after []Reading
+	for i, r := range sorted {
+		switch {
+		case !r.Posted.After(event.Posted):
+			if event.Posted.Sub(r.Posted) <= WateringBaselineWindow {
+				baseline = &sorted[i]
+			}
+		case r.Posted.Before(end):
+			after = append(after, r)
+		}
+	}
+
+	if baseline == nil || len(after) == 0 {
+		return response, false
+	}
+	response.Baseline = baseline.Moisture
+
+	peak := -1
+	for i, r := range after {
+		if r.Posted.Sub(event.Posted) > WateringPeakWindow {
+			break
+		}
+		if peak < 0 || r.Moisture > after[peak].Moisture {
+			peak = i
+		}
+	}
+
+	if peak < 0 {
+		return response, false
+	}
+
+	response.Peak, response.PeakAt = after[peak].Moisture, after[peak].Posted
+	response.Rise = response.Peak - response.Baseline
+	response.RiseTime = response.PeakAt.Sub(event.Posted)
+
+	decay := after[peak:]
+	if slope, ok := slopePerDay(decay, "moisture"); ok {
+		response.DecayRate = -slope
+	}
+
+	for _, r := range decay {
+		if r.Moisture <= response.Baseline {
+			lasted := r.Posted.Sub(event.Posted)
+			response.Lasted = &lasted
+			return response, true
+		}
+	}
+
+	if response.DecayRate > 0 {
+		days := math.Max(response.Rise, 0) / response.DecayRate
+		lasted := response.RiseTime + time.Duration(days*day)
+		response.Lasted, response.LastedEstimated = &lasted, true
+	}
+
+	return response, true
+}
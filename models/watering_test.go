@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// wateringReadings generates hourly readings around a watering at the given
+// time: moisture holds at 30% beforehand, peaks at 60% two hours after, then
+// decays by rate percent per day.
+func wateringReadings(watered time.Time, rate float64, days int) []Reading {
+	var readings []Reading
+	for hour := -12; hour < 24*days; hour++ {
+		posted := watered.Add(time.Hour * time.Duration(hour))
+
+		moisture := 30.0
+		switch {
+		case hour == 1:
+			moisture = 50
+		case hour >= 2:
+			moisture = 60 - rate*float64(hour-2)/24
+		}
+
+		readings = append(readings, Reading{CoreID: "core", Posted: posted, Moisture: moisture})
+	}
+
+	return readings
+}
+
+func TestAnalyzeWatering(t *testing.T) {
+	watered := time.Date(2016, 5, 10, 8, 30, 0, 0, time.UTC)
+	event := Event{Kind: EventWatering, PlantID: 1, Posted: watered}
+
+	response, ok := AnalyzeWatering(event, "core", wateringReadings(watered, 10, 7), time.Time{})
+	if !ok {
+		t.Fatal("Expected response to be analyzed")
+	}
+
+	if response.Baseline != 30 || response.Peak != 60 || response.Rise != 30 {
+		t.Errorf("Expected rise from 30 to 60, got %f to %f (%f)", response.Baseline, response.Peak, response.Rise)
+	}
+
+	if response.RiseTime != time.Hour*2 || !response.PeakAt.Equal(watered.Add(time.Hour*2)) {
+		t.Errorf("Expected peak two hours after watering, got %s", response.RiseTime)
+	}
+
+	if math.Abs(response.DecayRate-10) > epsilon {
+		t.Errorf("Expected decay of 10%%/day, got %f", response.DecayRate)
+	}
+
+	// back to 30% three days after the peak
+	if expected := time.Hour * (2 + 72); response.Lasted == nil || *response.Lasted != expected || response.LastedEstimated {
+		t.Errorf("Expected watering to last %s, got %v", expected, response.Lasted)
+	}
+
+	// decaying slower than the window, the duration is extrapolated
+	response, _ = AnalyzeWatering(event, "core", wateringReadings(watered, 2, 10), time.Time{})
+	if expected := time.Hour * (2 + 24*15); response.Lasted == nil || !response.LastedEstimated ||
+		math.Abs(response.Lasted.Hours()-expected.Hours()) > 0.01 {
+		t.Errorf("Expected watering estimated to last %s, got %v", expected, response.Lasted)
+	}
+
+	// watered again the next day, decay is measured until then
+	response, _ = AnalyzeWatering(event, "core", wateringReadings(watered, 10, 7), watered.AddDate(0, 0, 1))
+	if response.Lasted == nil || !response.LastedEstimated {
+		t.Errorf("Expected watering estimated to last, got %v", response.Lasted)
+	}
+
+	// no readings before the watering
+	if _, ok := AnalyzeWatering(event, "core", wateringReadings(watered, 10, 7)[13:], time.Time{}); ok {
+		t.Error("Expected no response without a baseline")
+	}
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded["rise_time"] != "2h0m0s" {
+		t.Errorf("Expected rise time encoded as a duration string, got %v", decoded["rise_time"])
+	}
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Events webhook subscriptions may be notified of: a reading stored, a
+// rule firing, or a device going offline.
+const (
+	WebhookReading       = "reading"
+	WebhookAlert         = "alert"
+	WebhookDeviceOffline = "device_offline"
+)
+
+// WebhookEvents lists the events webhook subscriptions may filter on.
+var WebhookEvents = []string{WebhookReading, WebhookAlert, WebhookDeviceOffline}
+
+// Headers sent with webhook deliveries.  The signature is the user's secret
+// signing the request body, as by Secret.Sign.
+const (
+	WebhookEventHeader     = "X-FREYR-EVENT"
+	WebhookDeliveryHeader  = "X-FREYR-DELIVERY"
+	WebhookSignatureHeader = "X-FREYR-SIGNATURE"
+)
+
+// States of webhook deliveries.  Pending deliveries are retried with
+// increasing backoff until they succeed or run out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// MaxDeliveryAttempts is how many times a webhook delivery is
+	// attempted before it is given up as failed.
+	MaxDeliveryAttempts = 6
+	// deliveryBackoff is how long after its first failed attempt a delivery
+	// is retried, doubling with each subsequent attempt.
+	deliveryBackoff = time.Second * 30
+)
+
+var (
+	// ErrorSubscriptionDoesntExist is returned when a webhook subscription
+	// is requested that doesn't exist for the user.
+	ErrorSubscriptionDoesntExist = errors.New("Webhook subscription does not exist")
+	// ErrorInvalidSubscription is returned when a webhook subscription has
+	// no http(s) URL, no events, or an unknown event.
+	ErrorInvalidSubscription = errors.New("Webhook subscription must have an http(s) URL and known events")
+	// ErrorDeliveryDoesntExist is returned when a webhook delivery is
+	// requested that doesn't exist.
+	ErrorDeliveryDoesntExist = errors.New("Webhook delivery does not exist")
+)
+
+// WebhookStore is an interface for any type that can store users' webhook
+// subscriptions and a log of deliveries to them.  GetSubscriptions includes
+// each subscription's most recent delivery attempt.  ClaimDelivery pushes a
+// due delivery's next attempt back to until, returning false if it wasn't
+// due, so only one worker attempts it at a time.
+type WebhookStore interface {
+	GetSubscriptions(userEmail string) ([]Subscription, error)
+	GetEventSubscriptions(userEmail, event string) ([]Subscription, error)
+	StoreSubscription(subscription Subscription) (int64, error)
+	DeleteSubscription(userEmail string, id int64) error
+	GetDeliveries(userEmail string, subscriptionID int64) ([]Delivery, error)
+	GetDelivery(id int64) (Delivery, error)
+	GetDueDeliveries(now time.Time) ([]Delivery, error)
+	StoreDelivery(delivery Delivery) (int64, error)
+	ClaimDelivery(id int64, now, until time.Time) (bool, error)
+	UpdateDelivery(delivery Delivery) error
+}
+
+// Subscription registers a URL to be posted events of the given kinds,
+// optionally only those concerning one core.
+type Subscription struct {
+	ID             int64      `json:"id"`
+	UserEmail      string     `json:"user"`
+	URL            string     `json:"url"`
+	Events         []string   `json:"events"`
+	CoreID         string     `json:"coreid,omitempty"`
+	Created        time.Time  `json:"created"`
+	LastAttempt    *time.Time `json:"last_attempt,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+}
+
+// Delivery is an event posted, or to be posted, to a subscription's URL,
+// or, without a subscription, to URL, as for rules' webhook actions.
+// Payload is the exact body posted on every attempt.  StatusCode is the
+// response to the last attempt, or zero if no response was received; Error
+// describes why an attempt failed.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	URL            string          `json:"url,omitempty"`
+	UserEmail      string          `json:"user"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	State          string          `json:"state"`
+	Attempts       int             `json:"attempts"`
+	StatusCode     int             `json:"status_code,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Created        time.Time       `json:"created"`
+	LastAttempt    *time.Time      `json:"last_attempt,omitempty"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+}
+
+// WebhookPayload is the body of a webhook delivery; Data depends on the
+// event: a Reading, an Execution or a Device.
+type WebhookPayload struct {
+	Event   string      `json:"event"`
+	User    string      `json:"user"`
+	CoreID  string      `json:"coreid,omitempty"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// Validate checks the subscription has an http(s) URL and only known
+// events.
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(s.Events) == 0 {
+		return ErrorInvalidSubscription
+	}
+
+	for _, event := range s.Events {
+		known := false
+		for _, e := range WebhookEvents {
+			known = known || e == event
+		}
+
+		if !known {
+			return ErrorInvalidSubscription
+		}
+	}
+
+	return nil
+}
+
+// Wants returns true if the subscription is for the event, concerning the
+// given core.
+func (s Subscription) Wants(event, core string) bool {
+	if s.CoreID != "" && s.CoreID != core {
+		return false
+	}
+
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Attempted records the outcome of a delivery attempt at the given time:
+// delivered for a 2xx status code, otherwise scheduled for a retry with
+// exponential backoff, or failed once out of attempts.
+func (d *Delivery) Attempted(now time.Time, statusCode int, err error) {
+	d.Attempts++
+	d.LastAttempt = &now
+	d.StatusCode = statusCode
+	d.Error = ""
+	success := err == nil && statusCode >= 200 && statusCode <= 299
+	switch {
+	case err != nil:
+		d.Error = err.Error()
+	case !success:
+		d.Error = "responded with status " + strconv.Itoa(statusCode)
+	}
+
+	switch {
+	case success:
+		d.State = DeliveryDelivered
+	case d.Attempts >= MaxDeliveryAttempts:
+		d.State = DeliveryFailed
+	default:
+		d.State = DeliveryPending
+		d.NextAttempt = now.Add(deliveryBackoff << uint(d.Attempts-1))
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionValidate(t *testing.T) {
+	for _, tc := range []struct {
+		subscription Subscription
+		err          error
+	}{
+		{Subscription{URL: "https://example.com/hook", Events: []string{WebhookReading}}, nil},
+		{Subscription{URL: "http://example.com", Events: WebhookEvents, CoreID: "core"}, nil},
+		{Subscription{URL: "https://example.com/hook"}, ErrorInvalidSubscription},
+		{Subscription{URL: "ftp://example.com/hook", Events: []string{WebhookAlert}}, ErrorInvalidSubscription},
+		{Subscription{URL: "/hook", Events: []string{WebhookAlert}}, ErrorInvalidSubscription},
+		{Subscription{URL: "https://example.com/hook", Events: []string{"watering"}}, ErrorInvalidSubscription},
+	} {
+		if err := tc.subscription.Validate(); err != tc.err {
+			t.Errorf("Validating %v: expected %v, got %v", tc.subscription, tc.err, err)
+		}
+	}
+}
+
+func TestSubscriptionWants(t *testing.T) {
+	all := Subscription{Events: []string{WebhookReading, WebhookAlert}}
+	one := Subscription{Events: []string{WebhookDeviceOffline}, CoreID: "core"}
+
+	for _, tc := range []struct {
+		subscription Subscription
+		event, core  string
+		expected     bool
+	}{
+		{all, WebhookReading, "core", true},
+		{all, WebhookAlert, "other", true},
+		{all, WebhookDeviceOffline, "core", false},
+		{one, WebhookDeviceOffline, "core", true},
+		{one, WebhookDeviceOffline, "other", false},
+		{one, WebhookReading, "core", false},
+	} {
+		if wants := tc.subscription.Wants(tc.event, tc.core); wants != tc.expected {
+			t.Errorf("%v wants %s from %s: expected %t, got %t", tc.subscription, tc.event, tc.core, tc.expected, wants)
+		}
+	}
+}
+
+func TestDeliveryAttempted(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	d := Delivery{State: DeliveryPending, NextAttempt: now}
+
+	d.Attempted(now, 500, nil)
+	if d.State != DeliveryPending || d.Attempts != 1 || d.StatusCode != 500 || d.Error != "responded with status 500" ||
+		!d.NextAttempt.Equal(now.Add(deliveryBackoff)) {
+		t.Fatalf("Expected retry after %s, got %v", deliveryBackoff, d)
+	}
+
+	d.Attempted(now, 0, errors.New("connection refused"))
+	if d.State != DeliveryPending || d.Error != "connection refused" || !d.NextAttempt.Equal(now.Add(deliveryBackoff*2)) {
+		t.Fatalf("Expected retry after %s, got %v", deliveryBackoff*2, d)
+	}
+
+	d.Attempted(now, 204, nil)
+	if d.State != DeliveryDelivered || d.Error != "" || d.StatusCode != 204 || d.Attempts != 3 {
+		t.Fatalf("Expected delivered, got %v", d)
+	}
+
+	d = Delivery{State: DeliveryPending}
+	for i := 0; i < MaxDeliveryAttempts; i++ {
+		d.Attempted(now, 404, nil)
+	}
+
+	if d.State != DeliveryFailed || d.Attempts != MaxDeliveryAttempts {
+		t.Fatalf("Expected failed after %d attempts, got %v", MaxDeliveryAttempts, d)
+	}
+}
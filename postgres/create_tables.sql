@@ -12,7 +12,7 @@ create table if not exists users (
 
 create table if not exists readings (
     useremail text references users(email),
-    posted timestamp,
+    posted timestamptz,
     coreid text,
     temperature real,
     humidity real,
@@ -22,5 +22,270 @@ create table if not exists readings (
     primary key (useremail, coreid, posted)
 );
 
+create table if not exists reading_deletions (
+    id serial primary key,
+    useremail text references users(email),
+    coreid text not null,
+    start_time timestamptz not null,
+    end_time timestamptz not null,
+    count integer not null,
+    deleted timestamptz not null
+);
+
+-- deleted readings are kept until their deletion is undone or purged
+create table if not exists deleted_readings (
+    deletion_id integer references reading_deletions(id) on delete cascade,
+    useremail text,
+    posted timestamptz,
+    coreid text,
+    temperature real,
+    humidity real,
+    moisture real,
+    light real,
+    battery real
+);
+
+create index if not exists deleted_readings_deletion on deleted_readings (deletion_id);
+
+create table if not exists quarantine (
+    id serial primary key,
+    useremail text references users(email),
+    posted timestamptz,
+    coreid text,
+    temperature real,
+    humidity real,
+    moisture real,
+    light real,
+    battery real,
+    reasons text,
+    quarantined timestamptz,
+    unique (useremail, coreid, posted)
+);
+
+create table if not exists validation_limits (
+    useremail text references users(email),
+    coreid text,
+    metric text,
+    min real,
+    max real,
+    max_rate real,
+    primary key (useremail, coreid, metric)
+);
+
+create table if not exists calibrations (
+    id serial primary key,
+    useremail text references users(email),
+    coreid text,
+    metric text,
+    kind text,
+    params text,
+    effective_from timestamptz
+);
+
+create table if not exists preferences (
+    useremail text primary key references users(email),
+    units text,
+    time_zone text,
+    core_time_zones text
+);
+
+create table if not exists retention_policies (
+    useremail text primary key references users(email),
+    raw_days integer,
+    hourly_days integer,
+    daily_days integer
+);
+
+create table if not exists readings_hourly (
+    useremail text references users(email),
+    coreid text,
+    bucket timestamptz,
+    count integer,
+    temperature_min real,
+    temperature_max real,
+    temperature_mean real,
+    humidity_min real,
+    humidity_max real,
+    humidity_mean real,
+    moisture_min real,
+    moisture_max real,
+    moisture_mean real,
+    light_min real,
+    light_max real,
+    light_mean real,
+    battery_min real,
+    battery_max real,
+    battery_mean real,
+    primary key (useremail, coreid, bucket)
+);
+
+create table if not exists readings_daily (
+    useremail text references users(email),
+    coreid text,
+    bucket timestamptz,
+    count integer,
+    temperature_min real,
+    temperature_max real,
+    temperature_mean real,
+    humidity_min real,
+    humidity_max real,
+    humidity_mean real,
+    moisture_min real,
+    moisture_max real,
+    moisture_mean real,
+    light_min real,
+    light_max real,
+    light_mean real,
+    battery_min real,
+    battery_max real,
+    battery_mean real,
+    primary key (useremail, coreid, bucket)
+);
+
+create table if not exists devices (
+    useremail text references users(email),
+    coreid text,
+    last_seen timestamptz not null,
+    reporting_interval integer not null default 0,
+    status text not null,
+    status_changed timestamptz not null,
+    primary key (useremail, coreid)
+);
+
+create table if not exists zones (
+    id serial primary key,
+    useremail text references users(email),
+    name text not null,
+    description text not null default ''
+);
+
+create table if not exists plants (
+    id serial primary key,
+    useremail text references users(email),
+    zone_id integer references zones(id) on delete set null,
+    name text not null,
+    species text not null default '',
+    notes text not null default ''
+);
+
+create table if not exists plant_assignments (
+    id serial primary key,
+    useremail text references users(email),
+    plant_id integer references plants(id) on delete cascade,
+    coreid text not null,
+    start_time timestamptz not null,
+    end_time timestamptz
+);
+
+create table if not exists events (
+    id serial primary key,
+    useremail text references users(email),
+    kind text not null,
+    source text not null,
+    plant_id integer references plants(id) on delete cascade,
+    coreid text not null default '',
+    posted timestamptz not null,
+    amount real not null default 0,
+    notes text not null default ''
+);
+
+create table if not exists commands (
+    id serial primary key,
+    useremail text references users(email),
+    coreid text not null,
+    name text not null,
+    argument text not null default '',
+    state text not null,
+    created timestamptz not null,
+    expires timestamptz not null,
+    delivered timestamptz,
+    acked timestamptz,
+    result text not null default ''
+);
+
+create index if not exists commands_pending on commands (useremail, coreid) where state = 'pending';
+
+create table if not exists rules (
+    id serial primary key,
+    useremail text references users(email),
+    name text not null,
+    coreid text not null,
+    conditions jsonb not null,
+    quiet jsonb not null default '[]',
+    schedule jsonb,
+    action jsonb not null,
+    cooldown integer not null default 0,
+    enabled boolean not null default true,
+    dry_run boolean not null default false,
+    last_fired timestamptz
+);
+
+create table if not exists rule_executions (
+    id serial primary key,
+    rule_id integer references rules(id) on delete cascade,
+    useremail text references users(email),
+    coreid text not null,
+    triggered timestamptz not null,
+    reading timestamptz not null,
+    result text not null,
+    detail text not null default '',
+    command_id integer references commands(id) on delete set null
+);
+
+create table if not exists webhook_subscriptions (
+    id serial primary key,
+    useremail text references users(email),
+    url text not null,
+    events jsonb not null,
+    coreid text not null default '',
+    created timestamptz not null
+);
+
+-- payloads are text so every attempt posts, and signs, the same bytes
+create table if not exists webhook_deliveries (
+    id serial primary key,
+    subscription_id integer references webhook_subscriptions(id) on delete cascade,
+    url text not null default '',
+    useremail text references users(email),
+    event text not null,
+    payload text not null,
+    state text not null,
+    attempts integer not null default 0,
+    status_code integer not null default 0,
+    error text not null default '',
+    created timestamptz not null,
+    last_attempt timestamptz,
+    next_attempt timestamptz not null
+);
+
+create index if not exists webhook_deliveries_due on webhook_deliveries (next_attempt) where state = 'pending';
+
+create table if not exists scheduled_tasks (
+    name text primary key,
+    last_run timestamptz,
+    last_error text not null default '',
+    next_run timestamptz not null,
+    locked_by text not null default '',
+    locked_until timestamptz
+);
+
+-- readings were originally stored as timestamp without time zone, in UTC
+do $$
+begin
+    if exists (select 1 from information_schema.columns where table_name = 'readings'
+        and column_name = 'posted' and data_type = 'timestamp without time zone') then
+        alter table readings alter column posted type timestamptz using posted at time zone 'UTC';
+    end if;
+end $$;
+
+-- rules' webhook actions are delivered to a URL rather than a subscription
+alter table webhook_deliveries add column if not exists url text not null default '';
+
+-- track devices that posted readings before devices were tracked
+insert into devices (useremail, coreid, last_seen, status, status_changed)
+    select useremail, coreid, max(posted), 'online', max(posted) from readings
+    group by useremail, coreid
+on conflict do nothing;
+
 insert into users (email, full_name, family_name, given_name, gender, locale, secret) values
 ('noone@nothing.com', 'demo user', 'user', 'demo', 'androgenous', 'en', '');
@@ -0,0 +1,83 @@
+// Package prometheus exposes readings to Prometheus: as gauges of the
+// latest value of each metric per core, in its text exposition format, and
+// as history through its remote read protocol.
+package prometheus
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels of Freyr's series: the metric name and the core read from.
+const (
+	NameLabel = "__name__"
+	CoreLabel = "coreid"
+)
+
+// ExpositionContentType is the content type of the text exposition format.
+const ExpositionContentType = "text/plain; version=0.0.4"
+
+// TimestampMetric is the name of the gauge of when each core's latest
+// reading was posted, in seconds since the epoch.
+const TimestampMetric = "freyr_reading_timestamp_seconds"
+
+// MetricNames maps each of models.Metrics to the name of its series, which
+// includes the canonical unit it is stored in.
+var MetricNames = map[string]string{
+	"temperature": "freyr_temperature_celsius",
+	"humidity":    "freyr_humidity_percent",
+	"moisture":    "freyr_moisture_percent",
+	"light":       "freyr_light_lux",
+	"battery":     "freyr_battery_percent",
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteGauges writes gauges of each metric of the latest readings, labelled
+// by core, in the text exposition format.
+func WriteGauges(w io.Writer, latest []models.Reading) error {
+	readings := make([]models.Reading, len(latest))
+	copy(readings, latest)
+	sort.Sort(byCore(readings))
+
+	gauge := func(name, help string, value func(models.Reading) float64) error {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name); err != nil {
+			return err
+		}
+
+		for _, r := range readings {
+			v := strconv.FormatFloat(value(r), 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", name, CoreLabel, labelEscaper.Replace(r.CoreID), v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, metric := range models.Metrics {
+		metric := metric
+		help := fmt.Sprintf("Latest %s reading, calibrated, in %s.", metric, models.CanonicalUnits[metric])
+		err := gauge(MetricNames[metric], help, func(r models.Reading) float64 {
+			value, _ := r.Value(metric)
+			return value
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return gauge(TimestampMetric, "When the latest reading was posted.", func(r models.Reading) float64 {
+		return float64(r.Posted.UnixNano()) / 1e9
+	})
+}
+
+type byCore []models.Reading
+
+func (a byCore) Len() int           { return len(a) }
+func (a byCore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCore) Less(i, j int) bool { return a[i].CoreID < a[j].CoreID }
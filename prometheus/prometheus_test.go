@@ -0,0 +1,174 @@
+package prometheus
+
+import (
+	"bytes"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	src := bytes.Repeat([]byte("freyr"), 1000)
+	decoded, err := decode(snappy.Encode(nil, src))
+	if err != nil || !bytes.Equal(decoded, src) {
+		t.Fatalf("Round trip failed (%v)", err)
+	}
+
+	for _, corrupt := range [][]byte{
+		{},
+		{0x03, 0x08, 'a'},
+		// declares a decoded length of 1GB
+		{0x80, 0x80, 0x80, 0x80, 0x04, 0x00},
+	} {
+		if _, err := decode(corrupt); err == nil {
+			t.Errorf("Decoding %v should fail", corrupt)
+		}
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	req := &ReadRequest{Queries: []*Query{{
+		StartTimestampMs: 1462867200000,
+		EndTimestampMs:   1462870800000,
+		Matchers: []*LabelMatcher{
+			{Type: MatchEqual, Name: NameLabel, Value: "freyr_moisture_percent"},
+			{Type: MatchRegexp, Name: CoreLabel, Value: "core.*"},
+		},
+	}}}
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := ReadRequestFrom(bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, req) {
+		t.Fatalf("Expected %v, got %v", req, decoded)
+	}
+
+	start, end := decoded.Queries[0].Span()
+	if !start.Equal(time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)) || end.Sub(start) != time.Hour {
+		t.Fatalf("Unexpected span %s to %s", start, end)
+	}
+
+	if _, err := ReadRequestFrom(bytes.NewReader(data)); err == nil {
+		t.Fatal("Expected error reading uncompressed request")
+	}
+}
+
+func TestQuerySelects(t *testing.T) {
+	query := &Query{Matchers: []*LabelMatcher{
+		{Type: MatchRegexp, Name: NameLabel, Value: "freyr_(moisture|humidity)_percent"},
+		{Type: MatchNotEqual, Name: CoreLabel, Value: "greenhouse"},
+		{Type: MatchNotRegexp, Name: "job", Value: ".+"},
+	}}
+
+	for _, tc := range []struct {
+		metric, core string
+		expected     bool
+	}{
+		{"moisture", "garden", true},
+		{"humidity", "garden", true},
+		{"temperature", "garden", false},
+		{"moisture", "greenhouse", false},
+	} {
+		selects, err := query.Selects(tc.metric, tc.core)
+		if err != nil || selects != tc.expected {
+			t.Errorf("Selecting %s from %s: expected %t, got %t (%v)", tc.metric, tc.core, tc.expected, selects, err)
+		}
+	}
+
+	bad := &Query{Matchers: []*LabelMatcher{{Type: MatchRegexp, Name: NameLabel, Value: "("}}}
+	if _, err := bad.Selects("moisture", "garden"); err == nil {
+		t.Fatal("Expected error for invalid regexp")
+	}
+
+	unknown := &Query{Matchers: []*LabelMatcher{{Type: 7, Name: NameLabel}}}
+	if _, err := unknown.Selects("moisture", "garden"); err != ErrorUnknownMatchType {
+		t.Fatalf("Expected ErrorUnknownMatchType, got %v", err)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	readings := []models.Reading{
+		{CoreID: "garden", Posted: now.Add(time.Minute), Moisture: 40},
+		{CoreID: "greenhouse", Posted: now, Moisture: 70},
+		{CoreID: "garden", Posted: now, Moisture: 41},
+	}
+
+	series := Series("moisture", "garden", readings)
+	expected := &TimeSeries{
+		Labels:  []*Label{{Name: NameLabel, Value: "freyr_moisture_percent"}, {Name: CoreLabel, Value: "garden"}},
+		Samples: []*Sample{{Value: 41, Timestamp: 1462867200000}, {Value: 40, Timestamp: 1462867260000}},
+	}
+
+	if !reflect.DeepEqual(series, expected) {
+		t.Fatalf("Expected %v, got %v", expected, series)
+	}
+
+	resp := httptest.NewRecorder()
+	if err := WriteReadResponse(resp, &ReadResponse{Results: []*QueryResult{{Timeseries: []*TimeSeries{series}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Header().Get("Content-Encoding") != SnappyEncoding || resp.Header().Get("Content-Type") != ProtobufContentType {
+		t.Fatalf("Unexpected headers %v", resp.Header())
+	}
+
+	data, err := snappy.Decode(nil, resp.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ReadResponse
+	if err := proto.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded.Results[0].Timeseries[0], expected) {
+		t.Fatalf("Expected %v, got %v", expected, decoded.Results[0].Timeseries[0])
+	}
+}
+
+func TestWriteGauges(t *testing.T) {
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	latest := []models.Reading{
+		{CoreID: `green"house`, Posted: now, Temperature: 21.5, Moisture: 70},
+		{CoreID: "garden", Posted: now.Add(time.Second), Temperature: 18, Moisture: 41.25},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGauges(&buf, latest); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"# TYPE freyr_temperature_celsius gauge",
+		`freyr_temperature_celsius{coreid="garden"} 18`,
+		`freyr_temperature_celsius{coreid="green\"house"} 21.5`,
+		`freyr_moisture_percent{coreid="garden"} 41.25`,
+		`freyr_reading_timestamp_seconds{coreid="garden"} 1.462867201e+09`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, buf.String())
+		}
+	}
+
+	if strings.Index(buf.String(), `{coreid="garden"}`) > strings.Index(buf.String(), `{coreid="green\"house"}`) {
+		t.Error("Expected gauges ordered by core")
+	}
+
+	if latest[0].CoreID != `green"house` {
+		t.Error("Expected latest readings left unsorted")
+	}
+}
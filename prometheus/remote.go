@@ -0,0 +1,280 @@
+package prometheus
+
+import (
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/serdmanczyk/freyr/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// The messages of Prometheus' remote read protocol used here, as defined in
+// its prompb package.  Fields Freyr doesn't use, such as query hints, are
+// skipped when decoding.
+
+// ReadRequest is a remote read request of one or more queries.
+type ReadRequest struct {
+	Queries []*Query `protobuf:"bytes,1,rep,name=queries" json:"queries,omitempty"`
+}
+
+// Query selects the series matching all of its matchers, between the start
+// and end timestamps in milliseconds.
+type Query struct {
+	StartTimestampMs int64           `protobuf:"varint,1,opt,name=start_timestamp_ms,proto3" json:"start_timestamp_ms,omitempty"`
+	EndTimestampMs   int64           `protobuf:"varint,2,opt,name=end_timestamp_ms,proto3" json:"end_timestamp_ms,omitempty"`
+	Matchers         []*LabelMatcher `protobuf:"bytes,3,rep,name=matchers" json:"matchers,omitempty"`
+}
+
+// MatchType is how a LabelMatcher compares a label's value.
+type MatchType int32
+
+// Types of label matchers: equal, not equal, regexp match and regexp not
+// match.
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+// LabelMatcher matches series by the value of one of their labels.
+type LabelMatcher struct {
+	Type  MatchType `protobuf:"varint,1,opt,name=type,proto3" json:"type,omitempty"`
+	Name  string    `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Value string    `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// ReadResponse holds the results of each of a ReadRequest's queries, in
+// order.
+type ReadResponse struct {
+	Results []*QueryResult `protobuf:"bytes,1,rep,name=results" json:"results,omitempty"`
+}
+
+// QueryResult holds the series a query selected.
+type QueryResult struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+}
+
+// TimeSeries is a labelled series of samples, in time order.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+// Label is a name and value identifying a series.
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// Sample is a value at a timestamp in milliseconds.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *ReadRequest) Reset()         { *m = ReadRequest{} }
+func (m *ReadRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadRequest) ProtoMessage()    {}
+
+func (m *Query) Reset()         { *m = Query{} }
+func (m *Query) String() string { return proto.CompactTextString(m) }
+func (*Query) ProtoMessage()    {}
+
+func (m *LabelMatcher) Reset()         { *m = LabelMatcher{} }
+func (m *LabelMatcher) String() string { return proto.CompactTextString(m) }
+func (*LabelMatcher) ProtoMessage()    {}
+
+func (m *ReadResponse) Reset()         { *m = ReadResponse{} }
+func (m *ReadResponse) String() string { return proto.CompactTextString(m) }
+func (*ReadResponse) ProtoMessage()    {}
+
+func (m *QueryResult) Reset()         { *m = QueryResult{} }
+func (m *QueryResult) String() string { return proto.CompactTextString(m) }
+func (*QueryResult) ProtoMessage()    {}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+// Content types of remote read requests and responses.
+const (
+	ProtobufContentType = "application/x-protobuf"
+	SnappyEncoding      = "snappy"
+)
+
+// maxReadRequest is the largest remote read request body accepted.
+const maxReadRequest = 1 << 20
+
+// maxDecoded is the largest message decoded, so small bodies can't claim
+// huge decoded lengths.
+const maxDecoded = 1 << 28
+
+// ErrorUnknownMatchType is returned when a query has a matcher of unknown
+// type.
+var ErrorUnknownMatchType = errors.New("Unknown label matcher type")
+
+// ReadRequestFrom decodes a snappy compressed ReadRequest.
+func ReadRequestFrom(r io.Reader) (*ReadRequest, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(r, maxReadRequest))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decode(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var req ReadRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// EncodeReadRequest encodes the request as a snappy compressed protobuf, as
+// Prometheus sends it.
+func EncodeReadRequest(req *ReadRequest) ([]byte, error) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return snappy.Encode(nil, data), nil
+}
+
+// ReadResponseFrom decodes a snappy compressed ReadResponse.
+func ReadResponseFrom(r io.Reader) (*ReadResponse, error) {
+	compressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decode(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ReadResponse
+	if err := proto.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// WriteReadResponse encodes the response as a snappy compressed protobuf.
+func WriteReadResponse(w http.ResponseWriter, resp *ReadResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ProtobufContentType)
+	w.Header().Set("Content-Encoding", SnappyEncoding)
+	_, err = w.Write(snappy.Encode(nil, data))
+	return err
+}
+
+// decode decodes a message compressed with the snappy block format, as
+// Prometheus compresses remote read messages.
+func decode(compressed []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > maxDecoded {
+		return nil, snappy.ErrTooLarge
+	}
+
+	return snappy.Decode(nil, compressed)
+}
+
+// Span returns the times between which the query selects samples.
+func (m *Query) Span() (start, end time.Time) {
+	return fromMillis(m.StartTimestampMs), fromMillis(m.EndTimestampMs)
+}
+
+// Selects returns true if the query's matchers all match the labels of the
+// given metric's series for the core.
+func (m *Query) Selects(metric, core string) (bool, error) {
+	labels := map[string]string{
+		NameLabel: MetricNames[metric],
+		CoreLabel: core,
+	}
+
+	for _, matcher := range m.Matchers {
+		matches, err := matcher.Matches(labels[matcher.Name])
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Matches returns true if the matcher matches a label's value; missing
+// labels have an empty value.  Regular expressions are anchored, as in
+// Prometheus.
+func (m *LabelMatcher) Matches(value string) (bool, error) {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value, nil
+	case MatchNotEqual:
+		return value != m.Value, nil
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(value) == (m.Type == MatchRegexp), nil
+	}
+
+	return false, ErrorUnknownMatchType
+}
+
+// Series returns the series of the metric in the core's readings, in time
+// order.
+func Series(metric, core string, readings []models.Reading) *TimeSeries {
+	readings = models.FilterReadings(readings, func(r models.Reading) bool { return r.CoreID == core })
+	models.SortReadings(readings)
+
+	series := &TimeSeries{
+		Labels: []*Label{
+			{Name: NameLabel, Value: MetricNames[metric]},
+			{Name: CoreLabel, Value: core},
+		},
+		Samples: make([]*Sample, 0, len(readings)),
+	}
+
+	for _, r := range readings {
+		value, _ := r.Value(metric)
+		series.Samples = append(series.Samples, &Sample{Value: value, Timestamp: toMillis(r.Posted)})
+	}
+
+	return series
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC()
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
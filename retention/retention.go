@@ -0,0 +1,131 @@
+// Package retention enforces users' retention policies, rolling raw readings
+// up into hourly and daily summaries before deleting them.
+package retention
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"log"
+	"time"
+)
+
+// pageSize is how many readings are summarized at a time.
+const pageSize = 1000
+
+// Enforce applies each user's retention policy as of now: raw readings past
+// their retention are rolled up, as by Rollup, then deleted, and expired
+// rollups deleted.  Failures for one user don't prevent enforcing the
+// others' policies.
+func Enforce(s models.RetentionStore, rs models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore,
+	now time.Time) error {
+	policies, err := s.GetRetentionPolicies()
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for userEmail, policy := range policies {
+		if err := enforcePolicy(s, rs, c, p, userEmail, policy, now); err != nil {
+			log.Printf("Error enforcing retention policy for %s: %s", userEmail, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed enforcing %d of %d retention policies", failed, len(policies))
+	}
+
+	return nil
+}
+
+func enforcePolicy(s models.RetentionStore, rs models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore,
+	userEmail string, policy models.RetentionPolicy, now time.Time) error {
+	raw, hourly, daily := policy.Cutoffs(now)
+
+	if !raw.IsZero() {
+		if err := Rollup(s, rs, c, p, userEmail, raw); err != nil {
+			return err
+		}
+	}
+
+	for interval, cutoff := range map[string]time.Time{
+		models.IntervalHour: hourly,
+		models.IntervalDay:  daily,
+	} {
+		if cutoff.IsZero() {
+			continue
+		}
+
+		if err := s.DeleteRollups(userEmail, interval, cutoff); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollup summarizes the user's readings posted before the given time into
+// hourly and daily rollups, then stores them, deleting the readings.
+// Readings are calibrated before they're summarized, as minimums, maximums
+// and means can't be calibrated afterwards.  Buckets are aligned to the
+// user's preferred time zone for each core, so days summarized match those
+// readings would be aggregated into.
+func Rollup(s models.RetentionStore, rs models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore,
+	userEmail string, before time.Time) error {
+	calibrations, err := c.GetCalibrations(userEmail)
+	if err != nil {
+		return err
+	}
+
+	preferences, err := p.GetPreferences(userEmail)
+	if err != nil {
+		return err
+	}
+
+	latest, err := rs.GetLatestReadings(userEmail)
+	if err != nil {
+		return err
+	}
+
+	var hourly, daily []models.Aggregate
+	rolledUp := make(map[string][]time.Time, len(latest))
+	for _, reading := range latest {
+		loc, err := preferences.Location(reading.CoreID)
+		if err != nil {
+			return err
+		}
+
+		hour, _ := models.NewBucketer(models.IntervalHour, loc)
+		day, _ := models.NewBucketer(models.IntervalDay, loc)
+
+		var coreHourly, coreDaily []models.Aggregate
+		var after models.Cursor
+		for {
+			readings, err := rs.GetReadingsPage(userEmail, []string{reading.CoreID}, time.Time{}, before, after, pageSize)
+			if err != nil {
+				return err
+			}
+
+			var expired []models.Reading
+			for _, r := range readings {
+				if r.Posted.Before(before) {
+					expired = append(expired, calibrations.Apply(r))
+					rolledUp[r.CoreID] = append(rolledUp[r.CoreID], r.Posted)
+				}
+			}
+
+			coreHourly = models.MergeAggregates(append(coreHourly, models.AggregateReadings(expired, hour)...), hour)
+			coreDaily = models.MergeAggregates(append(coreDaily, models.AggregateReadings(expired, day)...), day)
+
+			if len(readings) < pageSize {
+				break
+			}
+
+			after = models.CursorAt(readings[len(readings)-1])
+		}
+
+		hourly, daily = append(hourly, coreHourly...), append(daily, coreDaily...)
+	}
+
+	return s.RollupReadings(userEmail, rolledUp, hourly, daily)
+}
@@ -0,0 +1,175 @@
+package retention
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestEnforce(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	rs := &fake.RetentionStore{Readings: fS}
+
+	// readings every 30 minutes for ten UTC days
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Minute*30)
+	for i := 0; i < 48*10; i++ {
+		if err := fS.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := rs.StoreRetentionPolicy(userEmail, models.RetentionPolicy{RawDays: 5, HourlyDays: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := start.AddDate(0, 0, 10).Add(time.Hour * 3)
+	if err := Enforce(rs, fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	rawCutoff := start.AddDate(0, 0, 5)
+	readings, err := fS.GetReadings(userEmail, coreid, start.Add(-time.Second), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 48*5 {
+		t.Fatalf("Expected %d raw readings kept, got %d", 48*5, len(readings))
+	}
+
+	for _, r := range readings {
+		if r.Posted.Before(rawCutoff) {
+			t.Fatalf("Reading posted %s should have been rolled up", r.Posted)
+		}
+	}
+
+	rollups, err := rs.GetRollups(userEmail, coreid, start, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// days 0 and 1 only daily, days 2-4 hourly
+	if expected := 2 + 24*3; len(rollups) != expected {
+		t.Fatalf("Expected %d rollups, got %d", expected, len(rollups))
+	}
+
+	var count int
+	for _, a := range rollups {
+		count += a.Metrics["temperature"].Count
+	}
+
+	if count != 48*5 {
+		t.Fatalf("Expected rollups to summarize %d readings, got %d", 48*5, count)
+	}
+}
+
+func TestRollupCalibratedLocalDays(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	rs := &fake.RetentionStore{Readings: fS}
+
+	// readings of 1 and 3 every 12 hours from local midnight in New York
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, loc)
+	for i, moisture := range []float64{1, 3, 1, 3} {
+		reading := models.Reading{UserEmail: userEmail, CoreID: coreid, Posted: start.Add(time.Hour * 12 * time.Duration(i)), Moisture: moisture}
+		if err := fS.StoreReading(reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a non-linear calibration, squaring moisture
+	cs := &fake.CalibrationStore{}
+	_, err = cs.StoreCalibration(models.Calibration{UserEmail: userEmail, CoreID: coreid, Metric: "moisture",
+		Kind: models.CalibrationPolynomial, Coefficients: []float64{0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps := fake.PreferenceStore{}
+	if err := ps.StorePreferences(userEmail, models.Preferences{TimeZone: "America/New_York"}); err != nil {
+		t.Fatal(err)
+	}
+
+	end := start.AddDate(0, 0, 2)
+	if err := Rollup(rs, fS, cs, ps, userEmail, end); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rs.DeleteRollups(userEmail, models.IntervalHour, end); err != nil {
+		t.Fatal(err)
+	}
+
+	rollups, err := rs.GetRollups(userEmail, coreid, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rollups) != 2 {
+		t.Fatalf("Expected 2 daily rollups, got %v", rollups)
+	}
+
+	for i, a := range rollups {
+		if !a.Start.Equal(start.AddDate(0, 0, i)) {
+			t.Errorf("Expected rollup %d to start at local midnight %s, got %s", i, start.AddDate(0, 0, i), a.Start)
+		}
+
+		if summary := a.Metrics["moisture"]; summary.Mean != 5 || summary.Min != 1 || summary.Max != 9 || summary.Count != 2 {
+			t.Errorf("Expected calibrated moisture mean 5 of 1 and 9, got %v", summary)
+		}
+	}
+}
+
+// backfillingStore stores a reading, as if backfilled by another request,
+// between the rollup reading and storing its rollups.
+type backfillingStore struct {
+	*fake.RetentionStore
+	backfilled models.Reading
+}
+
+func (s backfillingStore) RollupReadings(userEmail string, rolledUp map[string][]time.Time, hourly, daily []models.Aggregate) error {
+	if err := s.Readings.StoreReading(s.backfilled); err != nil {
+		return err
+	}
+
+	return s.RetentionStore.RollupReadings(userEmail, rolledUp, hourly, daily)
+}
+
+func TestRollupKeepsReadingsStoredSince(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	start := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+	if err := fS.StoreReading(fake.RandReading(userEmail, coreid, start.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	backfilled := fake.RandReading(userEmail, coreid, start)
+	rs := backfillingStore{RetentionStore: &fake.RetentionStore{Readings: fS}, backfilled: backfilled}
+
+	end := start.AddDate(0, 0, 1)
+	if err := Rollup(rs, fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, userEmail, end); err != nil {
+		t.Fatal(err)
+	}
+
+	readings, err := fS.GetReadings(userEmail, coreid, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 1 || !readings[0].Compare(backfilled) {
+		t.Fatalf("Expected only the backfilled reading kept, got %v", readings)
+	}
+}
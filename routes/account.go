@@ -0,0 +1,572 @@
+package routes
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/token"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrorUnconfirmed is returned when an account is deleted without a
+	// valid confirmation token.
+	ErrorUnconfirmed = errors.New("confirm must be a deletion token issued for the account within 10 minutes")
+	// ErrorDemoAccount is returned when the demo user's account is deleted.
+	ErrorDemoAccount = errors.New("The demo account can't be deleted")
+	// ErrorExportDownloaded is returned when an export's archive is
+	// downloaded again, as it is deleted once downloaded.
+	ErrorExportDownloaded = errors.New("export was already downloaded")
+	// ErrorUnknownExportFormat is returned when readings are exported in a
+	// format other than csv or json.
+	ErrorUnknownExportFormat = errors.New("format must be csv or json")
+)
+
+// deletionConfirmWindow is how long a token confirming an account's deletion
+// is valid for.
+const deletionConfirmWindow = time.Minute * 10
+
+// deletionClaim is the claim of a deletion token naming the account it
+// confirms deleting; it isn't "email", so the token can't be used to log
+// in.
+const deletionClaim = "delete_account"
+
+// exportEnd is later than any reading an export includes.
+var exportEnd = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// AccountExport is the result reported by a job exporting a user's account;
+// once complete its archive is downloaded, once, from the same route.  The
+// archive is spooled to a temporary file, removed when downloaded or when
+// the job expires from the JobLedger.  Readings and rollups are exported
+// in Units.
+type AccountExport struct {
+	Readings int    `json:"readings"`
+	Rollups  int    `json:"rollups"`
+	Units    string `json:"units"`
+	Download string `json:"download"`
+	mu       sync.Mutex
+	archive  string
+}
+
+// Close removes the export's archive, if not already removed.
+func (e *AccountExport) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.archive == "" {
+		return nil
+	}
+
+	err := os.Remove(e.archive)
+	e.archive = ""
+	return err
+}
+
+// secretMetadata describes a user's secret without revealing it.
+type secretMetadata struct {
+	Present     bool   `json:"present"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// ExportAccount handles HTTP requests to export all of a user's data.  A
+// POST queues a job building a zip archive of the user's profile, devices,
+// metadata of their secret, and all their readings and hourly or daily
+// rollups of older readings, as CSV or, with the "format=json" option, JSON;
+// the job's ID is returned.  Readings are calibrated, unless the "raw=true"
+// option is given, and converted to the units of the "units" option or the
+// user's preferences, as by GetReadings.  A GET with the "jobID" option
+// downloads the archive once the job completes.
+func ExportAccount(l *JobLedger, s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, rs models.RetentionStore,
+	u models.UserStore, ss models.SecretStore, d models.DeviceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		if r.Method == "GET" {
+			downloadExport(l, email, w, r)
+			return
+		}
+
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		format := r.FormValue("format")
+		switch format {
+		case "":
+			format = "csv"
+		case "csv", "json":
+		default:
+			http.Error(w, ErrorUnknownExportFormat.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requested, err := models.ParseUnits(r.FormValue("units"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		raw := r.FormValue("raw") == "true"
+
+		// downloaded from the path requested, before any prefix was stripped
+		download, err := url.ParseRequestURI(r.RequestURI)
+		if err != nil {
+			download = &url.URL{Path: r.URL.Path}
+		}
+
+		result := &AccountExport{}
+		jobIDs := make(chan uint, 1)
+		exportFunc := func() error {
+			jobID := <-jobIDs
+			download.RawQuery = url.Values{"jobID": {strconv.FormatUint(uint64(jobID), 10)}}.Encode()
+			result.Download = download.String()
+
+			err := exportAccount(result, s, c, p, rs, u, ss, d, email, format, requested, raw)
+			if err != nil {
+				log.Printf("Failed Job %d exporting account: %s\n", jobID, err)
+				return err
+			}
+
+			log.Printf("Completed Job %d\n", jobID)
+			return nil
+		}
+
+		job, _ := l.Queue(email, "", result, exportFunc)
+		jobID := job.ID()
+		jobIDs <- jobID
+		log.Printf("Queued Job %d\n", jobID)
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(strconv.FormatUint(uint64(jobID), 10)))
+	})
+}
+
+// downloadExport writes the archive of the user's export job given by the
+// "jobID" option.  Other users' exports aren't found.
+func downloadExport(l *JobLedger, userEmail string, w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.ParseUint(r.FormValue("jobID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid or missing jobID", http.StatusBadRequest)
+		return
+	}
+
+	job, result, err := l.JobStatus(userEmail, uint(jobID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	status := job.Status()
+	if !status.Complete {
+		http.Error(w, models.ErrorExportNotReady.Error(), http.StatusAccepted)
+		return
+	}
+
+	export, ok := result.(*AccountExport)
+	if !ok {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	if !status.Success {
+		http.Error(w, status.Error, http.StatusInternalServerError)
+		return
+	}
+
+	export.mu.Lock()
+	defer export.mu.Unlock()
+
+	if export.archive == "" {
+		http.Error(w, ErrorExportDownloaded.Error(), http.StatusGone)
+		return
+	}
+
+	archive, err := os.Open(export.archive)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set(UnitsHeader, export.Units)
+	w.Header().Add("Content-Type", "application/zip")
+	w.Header().Add("Content-Disposition", `attachment; filename="freyr-export.zip"`)
+	if _, err := io.Copy(w, archive); err != nil {
+		// downloads cut short may be retried until the job expires
+		log.Printf("Error downloading export: %s", err)
+		return
+	}
+
+	if err := os.Remove(export.archive); err != nil {
+		log.Printf("Error removing downloaded export: %s", err)
+	}
+	export.archive = ""
+}
+
+// exportAccount builds the user's archive in a temporary file, recorded by
+// the export once complete.  Readings are converted to the requested units,
+// merged with the user's preferences, and calibrated unless raw.
+func exportAccount(export *AccountExport, s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, rs models.RetentionStore,
+	u models.UserStore, ss models.SecretStore, d models.DeviceStore, userEmail, format string, requested models.Units, raw bool) error {
+	user, err := u.GetUser(userEmail)
+	if err != nil {
+		return err
+	}
+
+	devices, err := d.GetDevices(userEmail)
+	if err != nil {
+		return err
+	}
+
+	var metadata secretMetadata
+	secret, err := ss.GetSecret(userEmail)
+	switch err {
+	case nil:
+		metadata = secretMetadata{Present: true, Fingerprint: secret.Fingerprint()}
+	case models.ErrorSecretDoesntExist:
+	default:
+		return err
+	}
+
+	var calibrations models.Calibrations
+	if !raw {
+		calibrations, err = c.GetCalibrations(userEmail)
+		if err != nil {
+			return err
+		}
+	}
+
+	preferences, err := p.GetPreferences(userEmail)
+	if err != nil {
+		return err
+	}
+
+	units := preferences.EffectiveUnits().Merge(requested)
+	export.Units = units.String()
+
+	spool, err := ioutil.TempFile("", "freyr-export-")
+	if err != nil {
+		return err
+	}
+
+	err = writeArchive(spool, s, rs, user, devices, metadata, calibrations, units, export, userEmail, format)
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(spool.Name())
+		return err
+	}
+
+	export.mu.Lock()
+	export.archive = spool.Name()
+	export.mu.Unlock()
+	return nil
+}
+
+// writeArchive writes the zip archive of the user's data to w, counting
+// the readings and rollups written in the export.  Readings are calibrated
+// then converted; rollups, calibrated when rolled up, are only converted.
+func writeArchive(w io.Writer, s models.ReadingStore, rs models.RetentionStore, user models.User, devices []models.Device, metadata secretMetadata,
+	calibrations models.Calibrations, units models.Units, export *AccountExport, userEmail, format string) error {
+	archive := zip.NewWriter(w)
+
+	for name, v := range map[string]interface{}{
+		"profile.json": user,
+		"devices.json": devices,
+		"secret.json":  metadata,
+	} {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+
+		if err := json.NewEncoder(f).Encode(v); err != nil {
+			return err
+		}
+	}
+
+	f, err := archive.Create("readings." + format)
+	if err != nil {
+		return err
+	}
+
+	writeReadings, writeRollups := writeReadingsCSV, writeRollupsCSV
+	if format == "json" {
+		writeReadings, writeRollups = writeReadingsJSON, writeRollupsJSON
+	}
+
+	convert := func(reading models.Reading) models.Reading {
+		return units.Convert(calibrations.Apply(reading))
+	}
+
+	export.Readings, err = writeReadings(f, s, convert, userEmail)
+	if err != nil {
+		return err
+	}
+
+	cores, err := exportCores(s, devices, userEmail)
+	if err != nil {
+		return err
+	}
+
+	f, err = archive.Create("rollups." + format)
+	if err != nil {
+		return err
+	}
+
+	export.Rollups, err = writeRollups(f, rs, units, userEmail, cores)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// exportCores returns the user's cores with readings or seen as devices,
+// whose readings may all have been rolled up, in order.
+func exportCores(s models.ReadingStore, devices []models.Device, userEmail string) ([]string, error) {
+	cores, err := userCores(s, userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(cores))
+	for _, core := range cores {
+		seen[core] = true
+	}
+
+	for _, device := range devices {
+		if !seen[device.CoreID] {
+			seen[device.CoreID] = true
+			cores = append(cores, device.CoreID)
+		}
+	}
+	sort.Strings(cores)
+
+	return cores, nil
+}
+
+// eachReading calls f with each of the user's readings, of all their cores,
+// in cursor order, mapped by convert, returning the number of readings.
+func eachReading(s models.ReadingStore, convert func(models.Reading) models.Reading, userEmail string, f func(models.Reading) error) (int, error) {
+	cores, err := userCores(s, userEmail)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	var after models.Cursor
+	for {
+		readings, err := s.GetReadingsPage(userEmail, cores, time.Time{}, exportEnd, after, maxReadingsLimit)
+		if err != nil {
+			return count, err
+		}
+
+		for _, reading := range readings {
+			if err := f(convert(reading)); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(readings) < maxReadingsLimit {
+			return count, nil
+		}
+
+		after = models.CursorAt(readings[len(readings)-1])
+	}
+}
+
+// eachRollup calls f with each rollup of the given cores, by core then
+// bucket, converted to units, returning the number of rollups.
+func eachRollup(rs models.RetentionStore, units models.Units, userEmail string, cores []string, f func(models.Aggregate) error) (int, error) {
+	var count int
+	for _, core := range cores {
+		rollups, err := rs.GetRollups(userEmail, core, time.Time{}, exportEnd)
+		if err != nil {
+			return count, err
+		}
+
+		for _, rollup := range rollups {
+			if err := f(rollup.Map(units.Convert)); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// writeReadingsCSV writes the user's readings as CSV with a header row.
+func writeReadingsCSV(w io.Writer, s models.ReadingStore, convert func(models.Reading) models.Reading, userEmail string) (int, error) {
+	c := csv.NewWriter(w)
+	if err := c.Write(append([]string{"coreid", "posted"}, models.Metrics...)); err != nil {
+		return 0, err
+	}
+
+	count, err := eachReading(s, convert, userEmail, func(reading models.Reading) error {
+		record := []string{reading.CoreID, reading.Posted.UTC().Format(time.RFC3339Nano)}
+		for _, metric := range models.Metrics {
+			value, _ := reading.Value(metric)
+			record = append(record, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+
+		return c.Write(record)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	c.Flush()
+	return count, c.Error()
+}
+
+// writeReadingsJSON writes the user's readings as a JSON array.
+func writeReadingsJSON(w io.Writer, s models.ReadingStore, convert func(models.Reading) models.Reading, userEmail string) (int, error) {
+	return writeJSONArray(w, func(f func(interface{}) error) (int, error) {
+		return eachReading(s, convert, userEmail, func(reading models.Reading) error {
+			return f(reading)
+		})
+	})
+}
+
+// writeRollupsCSV writes the rollups of the user's cores as CSV with a
+// header row, each metric's summary in its own columns.
+func writeRollupsCSV(w io.Writer, rs models.RetentionStore, units models.Units, userEmail string, cores []string) (int, error) {
+	c := csv.NewWriter(w)
+	header := []string{"coreid", "start"}
+	for _, metric := range models.Metrics {
+		header = append(header, metric+"_min", metric+"_max", metric+"_mean", metric+"_count")
+	}
+	if err := c.Write(header); err != nil {
+		return 0, err
+	}
+
+	count, err := eachRollup(rs, units, userEmail, cores, func(rollup models.Aggregate) error {
+		record := []string{rollup.CoreID, rollup.Start.UTC().Format(time.RFC3339)}
+		for _, metric := range models.Metrics {
+			summary := rollup.Metrics[metric]
+			record = append(record,
+				strconv.FormatFloat(summary.Min, 'g', -1, 64),
+				strconv.FormatFloat(summary.Max, 'g', -1, 64),
+				strconv.FormatFloat(summary.Mean, 'g', -1, 64),
+				strconv.Itoa(summary.Count))
+		}
+
+		return c.Write(record)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	c.Flush()
+	return count, c.Error()
+}
+
+// writeRollupsJSON writes the rollups of the user's cores as a JSON array.
+func writeRollupsJSON(w io.Writer, rs models.RetentionStore, units models.Units, userEmail string, cores []string) (int, error) {
+	return writeJSONArray(w, func(f func(interface{}) error) (int, error) {
+		return eachRollup(rs, units, userEmail, cores, func(rollup models.Aggregate) error {
+			return f(rollup)
+		})
+	})
+}
+
+// writeJSONArray writes each value given by each as elements of a JSON
+// array, returning the number of values.
+func writeJSONArray(w io.Writer, each func(f func(interface{}) error) (int, error)) (int, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+
+	separator := ""
+	count, err := each(func(v interface{}) error {
+		valueJSON, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ","
+
+		_, err = w.Write(valueJSON)
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+
+	_, err = io.WriteString(w, "]")
+	return count, err
+}
+
+// Account handles HTTP requests to delete a user's account: their readings,
+// secret and everything else stored for them.  Deleting takes two requests:
+// one without the "confirm" option is answered with a token, valid for 10
+// minutes, which a second request gives as its "confirm" option.  The demo
+// user's account can't be deleted.
+func Account(a models.AccountStore, t token.Source, demoUser string) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		if email == demoUser {
+			http.Error(w, ErrorDemoAccount.Error(), http.StatusForbidden)
+			return
+		}
+
+		confirm := r.FormValue("confirm")
+		if confirm == "" {
+			confirmation, err := t.GenerateToken(time.Now().Add(deletionConfirmWindow), token.Claims{deletionClaim: email})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(confirmation))
+			return
+		}
+
+		claims, err := t.ValidateToken(confirm)
+		if err != nil || claims[deletionClaim] != email {
+			http.Error(w, ErrorUnconfirmed.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = a.DeleteAccount(email)
+		if err == models.ErrorUserDoesntExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Deleted account %s\n", email)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/bifrost"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/retention"
+	"github.com/serdmanczyk/freyr/token"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportAccount(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	fS := &fake.ReadingStore{}
+	for _, core := range []string{"one", "two"} {
+		for i := 0; i < 3; i++ {
+			reading := fake.RandReading(userEmail, core, start.Add(time.Duration(i)*time.Minute))
+			reading.Temperature, reading.Moisture = 10, 2000
+			if err := fS.StoreReading(reading); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fS.StoreReading(fake.RandReading("janedoe@stupidname.com", "one", start))
+
+	// core three's only reading has been rolled up
+	rolledUp := fake.RandReading(userEmail, "three", start.AddDate(0, 0, -2))
+	rolledUp.Temperature = 10
+	fS.StoreReading(rolledUp)
+
+	rs := &fake.RetentionStore{Readings: fS}
+	if err := retention.Rollup(rs, fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, userEmail, start.AddDate(0, 0, -1)); err != nil {
+		t.Fatal(err)
+	}
+
+	fC := &fake.CalibrationStore{}
+	_, err := fC.StoreCalibration(models.Calibration{UserEmail: userEmail, CoreID: "one", Metric: "moisture", Kind: models.CalibrationLinear, Scale: 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fP := fake.PreferenceStore{}
+	if err := fP.StorePreferences(userEmail, models.Preferences{Units: models.Units{"temperature": models.Fahrenheit}}); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, _ := models.NewSecret()
+	users := fake.UserStore{userEmail: {Email: userEmail, Name: "John Doe"}}
+	secrets := fake.SecretStore{userEmail: secret}
+	devices := &fake.DeviceStore{}
+	devices.SeeDevice(userEmail, "one", start)
+	devices.SeeDevice(userEmail, "three", rolledUp.Posted)
+
+	ledger := NewJobLedger(bifrost.NewWorkerDispatcher(bifrost.Workers(1)))
+	export := ExportAccount(ledger, fS, fC, fP, rs, users, secrets, devices)
+
+	request := func(email, method, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		apollo.New(withEmail(email)).Then(export).ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := request(userEmail, "POST", "/account/export?format=xml"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("Unknown format; expected %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	resp := request(userEmail, "POST", "/account/export")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusAccepted, resp.Code)
+	}
+
+	jobID, err := strconv.ParseUint(resp.Body.String(), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _, err := ledger.JobStatus(userEmail, uint(jobID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.Done()
+
+	_, result, _ := ledger.JobStatus(userEmail, uint(jobID))
+	exported, ok := result.(*AccountExport)
+	if !ok || exported.Readings != 6 || exported.Rollups != 1 {
+		t.Fatalf("Expected 6 readings and 1 rollup exported, got %v", result)
+	}
+	spooled := exported.archive
+
+	download := "/account/export?jobID=" + resp.Body.String()
+	if resp := request("janedoe@stupidname.com", "GET", download); resp.Code != http.StatusNotFound {
+		t.Fatalf("Another user's export; expected %d, got %d", http.StatusNotFound, resp.Code)
+	}
+
+	resp = request(userEmail, "GET", download)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	if units := resp.Header().Get(UnitsHeader); !strings.Contains(units, "temperature:F") {
+		t.Fatalf("Expected readings exported in Fahrenheit, got %s", units)
+	}
+
+	if _, err := os.Stat(spooled); !os.IsNotExist(err) {
+		t.Fatalf("Expected downloaded archive %s to be removed, got %v", spooled, err)
+	}
+
+	if resp := request(userEmail, "GET", download); resp.Code != http.StatusGone {
+		t.Fatalf("Downloading again; expected %d, got %d", http.StatusGone, resp.Code)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[f.Name], _ = ioutil.ReadAll(r)
+		r.Close()
+	}
+
+	var profile models.User
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Name != "John Doe" {
+		t.Fatalf("Expected user's profile, got %s", files["profile.json"])
+	}
+
+	var exportedDevices []models.Device
+	if err := json.Unmarshal(files["devices.json"], &exportedDevices); err != nil || len(exportedDevices) != 2 {
+		t.Fatalf("Expected user's devices, got %s", files["devices.json"])
+	}
+
+	var metadata secretMetadata
+	if err := json.Unmarshal(files["secret.json"], &metadata); err != nil || metadata.Fingerprint != secret.Fingerprint() {
+		t.Fatalf("Expected secret's fingerprint, got %s", files["secret.json"])
+	}
+
+	if bytes.Contains(files["secret.json"], []byte(secret.Encode())) {
+		t.Fatal("Export revealed the user's secret")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(files["readings.csv"])).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 7 || records[0][0] != "coreid" || records[1][0] != "one" || records[2][0] != "two" {
+		t.Fatalf("Expected header and user's 6 readings in order, got %v", records)
+	}
+
+	// calibrated moisture of core one, and each core's temperature in F
+	for _, record := range records[1:] {
+		moisture := "2000"
+		if record[0] == "one" {
+			moisture = "20"
+		}
+
+		if record[2] != "50" || record[4] != moisture {
+			t.Fatalf("Expected temperature 50 and moisture %s, got %v", moisture, record)
+		}
+	}
+
+	rollups, err := csv.NewReader(bytes.NewReader(files["rollups.csv"])).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rollups) != 2 || rollups[0][4] != "temperature_mean" || rollups[1][0] != "three" || rollups[1][4] != "50" {
+		t.Fatalf("Expected header and core three's rollup in Fahrenheit, got %v", rollups)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	demoEmail := "noone@nothing.com"
+
+	fS := &fake.ReadingStore{}
+	fS.StoreReading(fake.RandReading(userEmail, "one", time.Now()))
+
+	users := fake.UserStore{userEmail: {Email: userEmail}, demoEmail: {Email: demoEmail}}
+	secrets := fake.SecretStore{userEmail: models.Secret("shh")}
+	tokens := token.JWTTokenGen("secret")
+	account := Account(fake.AccountStore{Users: users, Secrets: secrets, Readings: fS}, tokens, demoEmail)
+
+	remove := func(email, confirm string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("DELETE", "/account?confirm="+url.QueryEscape(confirm), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		apollo.New(withEmail(email)).Then(account).ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := remove(demoEmail, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("Deleting the demo account; expected %d, got %d", http.StatusForbidden, resp.Code)
+	}
+
+	resp := remove(userEmail, "")
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("Requesting confirmation; expected %d, got %d", http.StatusAccepted, resp.Code)
+	}
+	confirmation := resp.Body.String()
+
+	othersConfirmation := remove("janedoe@stupidname.com", "").Body.String()
+	expired, _ := tokens.GenerateToken(time.Now().Add(-time.Minute), token.Claims{deletionClaim: userEmail})
+	session, _ := token.GenerateWebToken(tokens, time.Now().Add(time.Hour), userEmail)
+
+	for _, confirm := range []string{userEmail, othersConfirmation, expired, session} {
+		if code := remove(userEmail, confirm).Code; code != http.StatusBadRequest {
+			t.Fatalf("Deleting account confirmed with %q; expected %d, got %d", confirm, http.StatusBadRequest, code)
+		}
+	}
+
+	if len(users) != 2 {
+		t.Fatal("Account deleted without confirmation")
+	}
+
+	if code := remove(userEmail, confirmation).Code; code != http.StatusNoContent {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusNoContent, code)
+	}
+
+	latest, _ := fS.GetLatestReadings(userEmail)
+	if len(users) != 1 || len(secrets) != 0 || len(latest) != 0 {
+		t.Fatalf("Account not deleted; users %v, secrets %v, readings %v", users, secrets, latest)
+	}
+
+	if code := remove(userEmail, confirmation).Code; code != http.StatusNotFound {
+		t.Fatalf("Deleting account twice; expected %d, got %d", http.StatusNotFound, code)
+	}
+}
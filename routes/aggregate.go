@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"time"
+)
+
+// Aggregate handles HTTP requests for summaries of a core's readings between
+// a start and end date, bucketed by the "interval" query option ("day",
+// "hour" or a duration such as "15m").  Buckets are aligned to the local time
+// of the "tz" query option, or the user's preferred time zone for the core.
+// Rollups of readings deleted under the user's retention policy are included.
+func Aggregate(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, rs models.RetentionStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		start, end, core, err := getReadingsParams(ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := models.ParseUnits(r.FormValue("units")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		loc, err := requestLocation(preferences, r, core)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		interval := r.FormValue("interval")
+		if interval == "" {
+			interval = models.IntervalDay
+		}
+
+		bucket, err := models.NewBucketer(interval, loc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		readings, err := s.GetReadings(email, core, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rollups, err := rs.GetRollups(email, core, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		aggregates, err := aggregateReadings(c, preferences, w, r, email, readings, rollups, bucket)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(aggregates)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// Today handles HTTP requests for a summary of each of the user's cores'
+// readings since the start of the current calendar day, local to the "tz"
+// query option or the user's preferred time zone for each core.
+func Today(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		if _, err := models.ParseUnits(r.FormValue("units")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		latest, err := s.GetLatestReadings(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		aggregates := make([]models.Aggregate, 0, len(latest))
+		for _, reading := range latest {
+			loc, err := requestLocation(preferences, r, reading.CoreID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			bucket, _ := models.NewBucketer(models.IntervalDay, loc)
+			now := time.Now()
+
+			readings, err := s.GetReadings(email, reading.CoreID, bucket(now), now)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			coreAggregates, err := aggregateReadings(c, preferences, w, r, email, readings, nil, bucket)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			aggregates = append(aggregates, coreAggregates...)
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(aggregates)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// aggregateReadings calibrates and converts the user's readings as they
+// would be returned by GetReadings and aggregates them, along with any
+// rollups, into buckets.  Rollups are calibrated when they're rolled up, so
+// are only converted, by their minimum, maximum and mean, and are
+// calibrated even if raw readings are requested.  The request's units
+// should already have been validated.
+func aggregateReadings(c models.CalibrationStore, preferences models.Preferences, w http.ResponseWriter, r *http.Request,
+	userEmail string, readings []models.Reading, rollups []models.Aggregate, bucket models.Bucketer) ([]models.Aggregate, error) {
+	if err := calibrate(c, r, userEmail, readings); err != nil {
+		return nil, err
+	}
+
+	if err := convertUnits(preferences, w, r, readings); err != nil {
+		return nil, err
+	}
+
+	aggregates := models.AggregateReadings(readings, bucket)
+	if len(rollups) == 0 {
+		return aggregates, nil
+	}
+
+	requested, _ := models.ParseUnits(r.FormValue("units"))
+	units := preferences.EffectiveUnits().Merge(requested)
+	for _, rollup := range rollups {
+		aggregates = append(aggregates, rollup.Map(units.Convert))
+	}
+
+	return models.MergeAggregates(aggregates, bucket), nil
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/retention"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAggregateTimeZone(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	fP := fake.PreferenceStore{}
+
+	// readings every hour for two UTC days
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Hour)
+	for i := 0; i < 48; i++ {
+		if err := fS.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := Aggregate(fS, &fake.CalibrationStore{}, fP, &fake.RetentionStore{Readings: fS})
+
+	for _, tc := range []struct {
+		tz      string
+		buckets int
+	}{
+		{tz: "UTC", buckets: 2},
+		{tz: "America/New_York", buckets: 3},
+	} {
+		query := url.Values{}
+		query.Add("start", start.Add(-time.Second).Format(time.RFC3339))
+		query.Add("end", start.Add(time.Hour*48).Format(time.RFC3339))
+		query.Add("core", coreid)
+		query.Add("interval", models.IntervalDay)
+		query.Add("tz", tc.tz)
+
+		req, err := http.NewRequest("GET", "/aggregate?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		var aggregates []models.Aggregate
+		if err := json.NewDecoder(resp.Body).Decode(&aggregates); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(aggregates) != tc.buckets {
+			t.Fatalf("tz=%s: expected %d daily buckets, got %d", tc.tz, tc.buckets, len(aggregates))
+		}
+	}
+}
+
+func TestAggregateRollups(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	rs := &fake.RetentionStore{Readings: fS}
+
+	// readings every hour for four UTC days, the first two rolled up
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Hour)
+	for i := 0; i < 96; i++ {
+		if err := fS.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := retention.Rollup(rs, fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, userEmail, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := Aggregate(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, rs)
+
+	query := url.Values{}
+	query.Add("start", start.Add(-time.Second).Format(time.RFC3339))
+	query.Add("end", start.Add(time.Hour*96).Format(time.RFC3339))
+	query.Add("core", coreid)
+	query.Add("interval", models.IntervalDay)
+	query.Add("tz", "UTC")
+
+	req, err := http.NewRequest("GET", "/aggregate?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(emailCtx, resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var aggregates []models.Aggregate
+	if err := json.NewDecoder(resp.Body).Decode(&aggregates); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(aggregates) != 4 {
+		t.Fatalf("Expected 4 daily buckets, got %d", len(aggregates))
+	}
+
+	for _, a := range aggregates {
+		if count := a.Metrics["temperature"].Count; count != 24 {
+			t.Errorf("Expected bucket %s to summarize 24 readings, got %d", a.Start, count)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+// calibrate applies the user's calibrations to the readings in place, unless
+// the request asks for raw values with the "raw=true" query option.
+func calibrate(c models.CalibrationStore, r *http.Request, userEmail string, readings []models.Reading) error {
+	if r.FormValue("raw") == "true" || len(readings) == 0 {
+		return nil
+	}
+
+	calibrations, err := c.GetCalibrations(userEmail)
+	if err != nil {
+		return err
+	}
+
+	calibrations.ApplyAll(readings)
+	return nil
+}
+
+// Calibrations handles HTTP requests to list a user's calibrations (GET),
+// optionally filtered by core, add a calibration (POST) or delete one
+// (DELETE).
+func Calibrations(c models.CalibrationStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			calibrations, err := c.GetCalibrations(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if core := r.FormValue("core"); core != "" {
+				var filtered models.Calibrations
+				for _, calibration := range calibrations {
+					if calibration.CoreID == core {
+						filtered = append(filtered, calibration)
+					}
+				}
+				calibrations = filtered
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(calibrations)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var calibration models.Calibration
+			if err := json.NewDecoder(r.Body).Decode(&calibration); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			calibration.UserEmail = email
+			if err := calibration.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			id, err := c.StoreCalibration(calibration)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			calibration.ID = id
+
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(calibration)
+		case "DELETE":
+			id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid or missing calibration id", http.StatusBadRequest)
+				return
+			}
+
+			err = c.DeleteCalibration(email, id)
+			if err == models.ErrorCalibrationDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
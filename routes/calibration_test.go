@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCalibrations(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	fC := &fake.CalibrationStore{}
+
+	posted := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	reading := fake.RandReading(userEmail, coreid, posted)
+	reading.Moisture = 2000
+	if err := fS.StoreReading(reading); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(handler apollo.Handler, email, method, path string, body []byte) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		apollo.New(withEmail(email)).Then(handler).ServeHTTP(resp, req)
+		return resp
+	}
+
+	calibrations := Calibrations(fC)
+	readings := GetReadings(fS, fC, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{})
+
+	moisture := func(raw string) float64 {
+		query := url.Values{}
+		query.Add("start", posted.Add(-time.Second).Format(time.RFC3339))
+		query.Add("end", posted.Add(time.Second).Format(time.RFC3339))
+		query.Add("core", coreid)
+		query.Add("raw", raw)
+
+		resp := request(readings, userEmail, "GET", "/readings?"+query.Encode(), nil)
+		var got []models.Reading
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || len(got) != 1 {
+			t.Fatalf("Expected one reading, got %s (%v)", resp.Body.String(), err)
+		}
+
+		return got[0].Moisture
+	}
+
+	for _, tc := range []struct {
+		calibration models.Calibration
+		code        int
+	}{
+		{models.Calibration{CoreID: coreid, Metric: "moisture", Kind: models.CalibrationLinear}, http.StatusBadRequest},
+		{models.Calibration{CoreID: coreid, Metric: "soil", Kind: models.CalibrationLinear, Scale: 0.01}, http.StatusBadRequest},
+		{models.Calibration{CoreID: coreid, Metric: "moisture", Kind: models.CalibrationLinear, Scale: 0.01}, http.StatusCreated},
+		{models.Calibration{CoreID: "other", Metric: "light", Kind: models.CalibrationLinear, Scale: 2}, http.StatusCreated},
+	} {
+		body, err := json.Marshal(tc.calibration)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp := request(calibrations, userEmail, "POST", "/calibrations", body); resp.Code != tc.code {
+			t.Fatalf("Storing %v: expected %d, got %d", tc.calibration, tc.code, resp.Code)
+		}
+	}
+
+	resp := request(calibrations, userEmail, "GET", "/calibrations?core="+coreid, nil)
+	var listed models.Calibrations
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 1 || listed[0].CoreID != coreid || listed[0].UserEmail != userEmail || listed[0].Scale != 0.01 {
+		t.Fatalf("Expected the core's calibration listed, got %v", listed)
+	}
+
+	if resp := request(calibrations, "janedoe@stupidname.com", "GET", "/calibrations", nil); resp.Body.String() != "null\n" {
+		t.Fatalf("Expected no calibrations for another user, got %s", resp.Body.String())
+	}
+
+	if calibrated, raw := moisture(""), moisture("true"); calibrated != 20 || raw != 2000 {
+		t.Fatalf("Expected moisture calibrated to 20 and raw 2000, got %g and %g", calibrated, raw)
+	}
+
+	id := strconv.FormatInt(listed[0].ID, 10)
+	for _, tc := range []struct {
+		email string
+		path  string
+		code  int
+	}{
+		{userEmail, "/calibrations?id=x", http.StatusBadRequest},
+		{"janedoe@stupidname.com", "/calibrations?id=" + id, http.StatusNotFound},
+		{userEmail, "/calibrations?id=" + id, http.StatusNoContent},
+		{userEmail, "/calibrations?id=" + id, http.StatusNotFound},
+	} {
+		if resp := request(calibrations, tc.email, "DELETE", tc.path, nil); resp.Code != tc.code {
+			t.Fatalf("Deleting %s as %s: expected %d, got %d", tc.path, tc.email, tc.code, resp.Code)
+		}
+	}
+
+	if m := moisture(""); m != 2000 {
+		t.Fatalf("Expected moisture uncalibrated once its calibration is deleted, got %g", m)
+	}
+}
@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Commands handles HTTP requests, at /devices/{core}/commands, to list the
+// commands queued for a core with their current state (GET) or to queue a
+// command given by the "name" and "argument" query options (POST), such as
+// "water" and "30s".  The "ttl" query option, a duration such as "5m", sets
+// how long the command waits to be delivered and acked.
+func Commands(cs models.CommandStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+		core := resourceID(r)
+		now := time.Now()
+
+		switch r.Method {
+		case "GET":
+			commands, err := cs.GetCommands(email, core)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if commands == nil {
+				commands = []models.Command{}
+			}
+
+			for i := range commands {
+				commands[i].State = commands[i].StateAt(now)
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(commands)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var ttl time.Duration
+			if ttlStr := r.FormValue("ttl"); ttlStr != "" {
+				var err error
+				if ttl, err = time.ParseDuration(ttlStr); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			command := models.NewCommand(email, core, r.FormValue("name"), r.FormValue("argument"), ttl, now)
+			if err := command.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			id, err := cs.StoreCommand(command)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			command.ID = id
+
+			writeStored(w, true, command)
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// PollCommands handles HTTP requests from devices for the commands queued
+// for them, given by the "coreid" form value.  Pending commands are returned
+// once, then considered delivered; polling also counts as the device being
+// seen.
+func PollCommands(cs models.CommandStore, d models.DeviceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		core := r.PostFormValue("coreid")
+		if core == "" {
+			http.Error(w, "coreid required", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		if err := d.SeeDevice(email, core, now); err != nil {
+			log.Printf("Error recording core %s as seen: %s", core, err)
+		}
+
+		commands, err := cs.DeliverCommands(email, core, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if commands == nil {
+			commands = []models.Command{}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(commands)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// AckCommand handles HTTP requests from devices acknowledging they carried
+// out the delivered command given by the "id" form value, along with the
+// "result" form value describing the outcome.
+func AckCommand(cs models.CommandStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		core := r.PostFormValue("coreid")
+
+		id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+		if err != nil || core == "" {
+			http.Error(w, "coreid and command id required", http.StatusBadRequest)
+			return
+		}
+
+		err = cs.AckCommand(email, core, id, r.PostFormValue("result"), time.Now())
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case models.ErrorCommandDoesntExist:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrorCommandNotDelivered:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	core := "123123123123"
+
+	cs := &fake.CommandStore{}
+	ds := &fake.DeviceStore{}
+
+	commands := Subresources("devices", map[string]http.Handler{
+		"commands": apollo.New(withEmail(userEmail)).Then(Commands(cs)),
+	})
+	poll := apollo.New(withEmail(userEmail)).Then(PollCommands(cs, ds))
+	ack := apollo.New(withEmail(userEmail)).Then(AckCommand(cs))
+
+	do := func(handler http.Handler, method, path string, form url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	path := "/devices/" + core + "/commands"
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"?name=water&argument=30s", http.StatusCreated},
+		{"?name=fan&argument=on&ttl=1h", http.StatusCreated},
+		{"?name=water&ttl=48h", http.StatusBadRequest},
+		{"?name=water&ttl=soon", http.StatusBadRequest},
+		{"?argument=30s", http.StatusBadRequest},
+	} {
+		if resp := do(commands, "POST", path+tc.query, nil); resp.Code != tc.code {
+			t.Fatalf("Queuing %s: expected %d, got %d", tc.query, tc.code, resp.Code)
+		}
+	}
+
+	// acking before delivery conflicts
+	if resp := do(ack, "POST", "/commands/ack", url.Values{"coreid": {core}, "id": {"1"}}); resp.Code != http.StatusConflict {
+		t.Fatalf("Expected %d acking undelivered command, got %d", http.StatusConflict, resp.Code)
+	}
+
+	resp := do(poll, "POST", "/commands", url.Values{"coreid": {core}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var delivered []models.Command
+	if err := json.NewDecoder(resp.Body).Decode(&delivered); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 2 || delivered[0].Name != "water" || delivered[0].Argument != "30s" || delivered[0].State != models.CommandDelivered {
+		t.Fatalf("Expected water and fan commands delivered, got %v", delivered)
+	}
+
+	if devices, _ := ds.GetDevices(userEmail); len(devices) != 1 || devices[0].CoreID != core {
+		t.Fatalf("Expected polling core to be seen, got %v", devices)
+	}
+
+	// commands are only delivered once
+	resp = do(poll, "POST", "/commands", url.Values{"coreid": {core}})
+	if resp.Body.String() != "[]\n" {
+		t.Fatalf("Expected no commands on second poll, got %s", resp.Body.String())
+	}
+
+	id := strconv.FormatInt(delivered[0].ID, 10)
+	for _, tc := range []struct {
+		form url.Values
+		code int
+	}{
+		{url.Values{"coreid": {core}, "id": {id}, "result": {"watered"}}, http.StatusNoContent},
+		{url.Values{"coreid": {core}, "id": {id}}, http.StatusConflict},
+		{url.Values{"coreid": {"456456456456"}, "id": {id}}, http.StatusNotFound},
+		{url.Values{"coreid": {core}, "id": {"many"}}, http.StatusBadRequest},
+	} {
+		if resp := do(ack, "POST", "/commands/ack", tc.form); resp.Code != tc.code {
+			t.Fatalf("Acking %v: expected %d, got %d", tc.form, tc.code, resp.Code)
+		}
+	}
+
+	resp = do(commands, "GET", path, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var listed []models.Command
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 2 || listed[0].State != models.CommandAcked || listed[0].Result != "watered" || listed[1].State != models.CommandDelivered {
+		t.Fatalf("Unexpected commands %v", listed)
+	}
+}
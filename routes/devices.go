@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultBatteryWindow is how far back battery forecasts look for readings
+// unless the "days" query option is given.
+const DefaultBatteryWindow = 14
+
+// Devices handles HTTP requests to list a user's devices with their current
+// status (GET) or to set how often the core given by the "core" query option
+// is expected to report, given by the "interval" query option as a duration
+// such as "10m" (POST).
+func Devices(d models.DeviceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		if r.Method == "POST" {
+			core := r.FormValue("core")
+			if core == "" {
+				http.Error(w, "core required", http.StatusBadRequest)
+				return
+			}
+
+			interval, err := time.ParseDuration(r.FormValue("interval"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if interval <= 0 {
+				http.Error(w, models.ErrorInvalidReportingInterval.Error(), http.StatusBadRequest)
+				return
+			}
+
+			err = d.SetReportingInterval(email, core, interval)
+			if err == models.ErrorDeviceDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		devices, err := d.GetDevices(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		for i := range devices {
+			devices[i].Status = devices[i].StatusAt(now)
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(devices)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// Battery handles HTTP requests for a forecast of when the core's battery
+// will be empty, based on its readings over the number of days given by the
+// "days" query option.
+func Battery(s models.ReadingStore, c models.CalibrationStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		core := resourceID(r)
+
+		days := DefaultBatteryWindow
+		if daysStr := r.FormValue("days"); daysStr != "" {
+			var err error
+			days, err = strconv.Atoi(daysStr)
+			if err != nil || days <= 0 {
+				http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		end := time.Now()
+		readings, err := s.GetReadings(email, core, end.AddDate(0, 0, -days), end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(readings) == 0 {
+			http.Error(w, "no readings for core", http.StatusNotFound)
+			return
+		}
+
+		if err := calibrate(c, r, email, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(models.ForecastBattery(core, readings))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDevices(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fD := &fake.DeviceStore{}
+	if err := fD.SeeDevice(userEmail, coreid, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := Devices(fD)
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+
+	for _, tc := range []struct {
+		query  string
+		code   int
+		status string
+	}{
+		{query: "", code: http.StatusNotFound},
+		{query: "?core=" + coreid + "&interval=-5m", code: http.StatusBadRequest},
+		{query: "?core=nope&interval=5m", code: http.StatusNotFound},
+		{query: "?core=" + coreid + "&interval=30m", code: http.StatusOK, status: models.DeviceStale},
+		{query: "?core=" + coreid + "&interval=2h", code: http.StatusOK, status: models.DeviceOnline},
+	} {
+		method := "POST"
+		if tc.query == "" {
+			method = "PUT"
+		}
+
+		req, err := http.NewRequest(method, "/devices"+tc.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("%s %s: expected %d, got %d", method, tc.query, tc.code, resp.Code)
+		}
+
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var devices []models.Device
+		if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(devices) != 1 || devices[0].Status != tc.status {
+			t.Fatalf("%s: expected core %s, got %v", tc.query, tc.status, devices)
+		}
+	}
+}
+
+func TestBattery(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	start := time.Now().Add(-time.Hour * 48)
+	for hour := 0; hour < 48; hour++ {
+		err := fS.StoreReading(models.Reading{
+			UserEmail: userEmail,
+			CoreID:    coreid,
+			Posted:    start.Add(time.Hour * time.Duration(hour)),
+			Battery:   90 - float64(hour)/4,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := Subresources("devices", map[string]http.Handler{
+		"battery": apollo.New(withEmail(userEmail)).Then(Battery(fS, &fake.CalibrationStore{})),
+	})
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{path: "/devices/" + coreid + "/battery", code: http.StatusOK},
+		{path: "/devices/" + coreid + "/battery?days=0", code: http.StatusBadRequest},
+		{path: "/devices/" + coreid + "/voltage", code: http.StatusNotFound},
+		{path: "/devices/nope/battery", code: http.StatusNotFound},
+	} {
+		req, err := http.NewRequest("GET", tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.path, tc.code, resp.Code)
+		}
+
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var forecast models.BatteryForecast
+		if err := json.NewDecoder(resp.Body).Decode(&forecast); err != nil {
+			t.Fatal(err)
+		}
+
+		if forecast.CoreID != coreid || forecast.DaysUntilEmpty == nil || forecast.Readings != 48 {
+			t.Fatalf("Unexpected forecast %v", forecast)
+		}
+	}
+}
+
+// withEmail returns middleware authorizing requests as the given user.
+func withEmail(email string) apollo.Constructor {
+	return apollo.Constructor(func(next apollo.Handler) apollo.Handler {
+		return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(context.WithValue(ctx, "email", email), w, r)
+		})
+	})
+}
@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// readingsWithEvents is the response to reading queries asking for care
+// events to be overlaid with the "events=true" query option.
+type readingsWithEvents struct {
+	Readings interface{}    `json:"readings"`
+	Events   []models.Event `json:"events"`
+}
+
+// readingColumns is the response to reading queries asking for the
+// "columnar" format.
+type readingColumns struct {
+	Cores  []models.ReadingColumns `json:"cores"`
+	Events []models.Event          `json:"events,omitempty"`
+}
+
+// writeReadings writes the readings as JSON, in the shape asked for by the
+// request's "fields" and "format" query options, along with the events
+// returned by events if the request has the "events=true" query option.
+func writeReadings(w http.ResponseWriter, r *http.Request, readings []models.Reading, events func() ([]models.Event, error)) {
+	metrics, columnar, err := getShapeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var overlay []models.Event
+	if r.FormValue("events") == "true" {
+		overlay, err = events()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if overlay == nil {
+			overlay = []models.Event{}
+		}
+	}
+
+	var rows interface{} = readings
+	if r.FormValue("fields") != "" {
+		projected := make([]map[string]interface{}, len(readings))
+		for i, reading := range readings {
+			projected[i] = reading.Project(metrics)
+		}
+		rows = projected
+	}
+
+	var body interface{} = rows
+	switch {
+	case columnar:
+		columns := models.Columns(readings, metrics)
+		if columns == nil {
+			columns = []models.ReadingColumns{}
+		}
+		body = readingColumns{Cores: columns, Events: overlay}
+	case overlay != nil:
+		body = readingsWithEvents{Readings: rows, Events: overlay}
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// coreEvents returns the user's events posted within the time span that
+// concern the core: those logged against it, and those logged against a
+// plant it was assigned to at the time.
+func coreEvents(es models.EventStore, ps models.PlantStore, userEmail, core string, start, end time.Time) ([]models.Event, error) {
+	events, err := es.GetEvents(userEmail, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	plantAssignments := make(map[int64][]models.Assignment)
+	var filtered []models.Event
+	for _, e := range events {
+		if e.CoreID == "" {
+			if _, ok := plantAssignments[e.PlantID]; !ok {
+				if plantAssignments[e.PlantID], err = ps.GetAssignments(userEmail, e.PlantID); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, c := range e.Cores(plantAssignments[e.PlantID]) {
+			if c == core {
+				filtered = append(filtered, e)
+				break
+			}
+		}
+	}
+
+	return filtered, nil
+}
+
+// coresEvents returns the user's events posted within the time span that
+// concern any of the cores, in order, each only once.
+func coresEvents(es models.EventStore, ps models.PlantStore, userEmail string, cores []string, start, end time.Time) ([]models.Event, error) {
+	var events []models.Event
+	seen := make(map[int64]bool)
+	for _, core := range cores {
+		concerning, err := coreEvents(es, ps, userEmail, core, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range concerning {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				events = append(events, e)
+			}
+		}
+	}
+
+	models.SortEvents(events)
+	return events, nil
+}
+
+// plantEvents returns the user's events posted within the time span that
+// concern the plant: those logged against it, and those logged against a
+// core assigned to it at the time.
+func plantEvents(es models.EventStore, userEmail string, plantID int64, assignments []models.Assignment, start, end time.Time) ([]models.Event, error) {
+	events, err := es.GetEvents(userEmail, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []models.Event
+	for _, e := range events {
+		if e.PlantID == plantID {
+			filtered = append(filtered, e)
+			continue
+		}
+
+		for _, a := range assignments {
+			if e.CoreID != "" && a.CoreID == e.CoreID && a.Covers(e.Posted) {
+				filtered = append(filtered, e)
+				break
+			}
+		}
+	}
+
+	return filtered, nil
+}
+
+// Events handles HTTP requests to list a user's care events between a start
+// and end date, optionally only those concerning the "plant" or "core" query
+// option (GET), log an event (POST) or delete the event given by the "id"
+// query option (DELETE).
+func Events(es models.EventStore, ps models.PlantStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			start, end, err := getTimeSpanParams(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			events, status, err := selectedEvents(es, ps, r, email, start, end)
+			if err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(events)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var event models.Event
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			event.UserEmail = email
+			if err := event.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			id, err := es.StoreEvent(event)
+			if err == models.ErrorPlantDoesntExist {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			event.ID = id
+
+			writeStored(w, true, event)
+		case "DELETE":
+			deleteByID(w, r, "event", models.ErrorEventDoesntExist, func(id int64) error {
+				return es.DeleteEvent(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// selectedEvents returns the events within the time span concerning the
+// plant or core given by the "plant" or "core" query options, or all the
+// user's events if neither is given, along with an HTTP status for errors.
+func selectedEvents(es models.EventStore, ps models.PlantStore, r *http.Request, userEmail string, start, end time.Time) ([]models.Event, int, error) {
+	if core := r.FormValue("core"); core != "" {
+		events, err := coreEvents(es, ps, userEmail, core, start, end)
+		return events, http.StatusInternalServerError, err
+	}
+
+	if plant := r.FormValue("plant"); plant != "" {
+		plantID, err := strconv.ParseInt(plant, 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		assignments, err := ps.GetAssignments(userEmail, plantID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		events, err := plantEvents(es, userEmail, plantID, assignments, start, end)
+		return events, http.StatusInternalServerError, err
+	}
+
+	events, err := es.GetEvents(userEmail, start, end)
+	return events, http.StatusInternalServerError, err
+}
+
+// WateringResponses handles HTTP requests for the soil moisture response of
+// each watering, between a start and end date, concerning the plant or core
+// given by the "plant" or "core" query option.  Moisture is calibrated unless
+// raw values are requested.
+func WateringResponses(es models.EventStore, ps models.PlantStore, s models.ReadingStore, c models.CalibrationStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		start, end, err := getTimeSpanParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.FormValue("core") == "" && r.FormValue("plant") == "" {
+			http.Error(w, "plant or core required", http.StatusBadRequest)
+			return
+		}
+
+		// look past the end for the next watering of the last ones
+		events, status, err := selectedEvents(es, ps, r, email, start, end.Add(models.WateringPeakWindow+models.WateringDecayWindow))
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		plantAssignments := make(map[int64][]models.Assignment)
+		waterings := make(map[string][]models.Event)
+		for _, e := range events {
+			if e.Kind != models.EventWatering {
+				continue
+			}
+
+			if _, ok := plantAssignments[e.PlantID]; !ok && e.CoreID == "" {
+				if plantAssignments[e.PlantID], err = ps.GetAssignments(email, e.PlantID); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			for _, core := range e.Cores(plantAssignments[e.PlantID]) {
+				if selected := r.FormValue("core"); selected == "" || selected == core {
+					waterings[core] = append(waterings[core], e)
+				}
+			}
+		}
+
+		cores := make([]string, 0, len(waterings))
+		for core := range waterings {
+			cores = append(cores, core)
+		}
+		sort.Strings(cores)
+
+		responses := []models.WateringResponse{}
+		for _, core := range cores {
+			coreWaterings := waterings[core]
+			for i, e := range coreWaterings {
+				if e.Posted.After(end) {
+					break
+				}
+
+				var next time.Time
+				if i+1 < len(coreWaterings) {
+					next = coreWaterings[i+1].Posted
+				}
+
+				readings, err := s.GetReadings(email, core, e.Posted.Add(-models.WateringBaselineWindow),
+					e.Posted.Add(models.WateringPeakWindow+models.WateringDecayWindow))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				if err := calibrate(c, r, email, readings); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				if response, ok := models.AnalyzeWatering(e, core, readings, next); ok {
+					responses = append(responses, response)
+				}
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(responses)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
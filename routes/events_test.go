@@ -0,0 +1,242 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	es := &fake.EventStore{}
+	ps := &fake.PlantStore{}
+	fS := &fake.ReadingStore{}
+
+	basil, err := ps.StorePlant(models.Plant{UserEmail: userEmail, Name: "basil bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := ps.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: basil, CoreID: "one", Start: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	readingGen := fake.ReadingGen(userEmail, "one", start, time.Hour)
+	for i := 0; i < 48; i++ {
+		if err := fS.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := apollo.New(withEmail(userEmail)).Then(Events(es, ps))
+
+	for _, tc := range []struct {
+		event models.Event
+		code  int
+	}{
+		{models.Event{Kind: models.EventWatering, PlantID: basil, Posted: start.Add(time.Hour * 8)}, http.StatusCreated},
+		{models.Event{Kind: models.EventFertilizing, CoreID: "one", Posted: start.Add(time.Hour * 20)}, http.StatusCreated},
+		{models.Event{Kind: models.EventWatering, CoreID: "two", Posted: start.Add(time.Hour * 30)}, http.StatusCreated},
+		{models.Event{Kind: "pruning", PlantID: basil, Posted: start}, http.StatusBadRequest},
+	} {
+		body, err := json.Marshal(tc.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/events", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("Logging %s event: expected %d, got %d", tc.event.Kind, tc.code, resp.Code)
+		}
+	}
+
+	query := url.Values{}
+	query.Add("start", start.Format(time.RFC3339))
+	query.Add("end", start.AddDate(0, 0, 2).Format(time.RFC3339))
+
+	getEvents := func(filter, value string) []models.Event {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if filter != "" {
+			q.Add(filter, value)
+		}
+
+		req, err := http.NewRequest("GET", "/events?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		var events []models.Event
+		if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+			t.Fatal(err)
+		}
+
+		return events
+	}
+
+	if events := getEvents("", ""); len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	// the plant's watering and the core's fertilizing concern both
+	for _, filter := range [][2]string{{"core", "one"}, {"plant", strconv.FormatInt(basil, 10)}} {
+		events := getEvents(filter[0], filter[1])
+		if len(events) != 2 || events[0].Kind != models.EventWatering || events[1].Kind != models.EventFertilizing {
+			t.Fatalf("Expected watering and fertilizing events for %s %s, got %v", filter[0], filter[1], events)
+		}
+	}
+
+	// overlaid on the core's readings
+	overlay := url.Values{}
+	for k, v := range query {
+		overlay[k] = v
+	}
+	overlay.Add("core", "one")
+	overlay.Add("events", "true")
+
+	req, err := http.NewRequest("GET", "/readings?"+overlay.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	apollo.New(withEmail(userEmail)).Then(GetReadings(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, es, ps)).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var overlaid struct {
+		Readings []models.Reading `json:"readings"`
+		Events   []models.Event   `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&overlaid); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(overlaid.Readings) != 48 || len(overlaid.Events) != 2 {
+		t.Fatalf("Expected 48 readings and 2 events, got %d and %d", len(overlaid.Readings), len(overlaid.Events))
+	}
+
+	// deleted
+	req, err = http.NewRequest("DELETE", "/events?id=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	if events := getEvents("", ""); len(events) != 2 {
+		t.Fatalf("Expected 2 events after delete, got %d", len(events))
+	}
+}
+
+func TestWateringResponses(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	es := &fake.EventStore{}
+	ps := &fake.PlantStore{}
+	fS := &fake.ReadingStore{}
+
+	basil, err := ps.StorePlant(models.Plant{UserEmail: userEmail, Name: "basil bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := ps.StoreAssignment(models.Assignment{UserEmail: userEmail, PlantID: basil, CoreID: "one", Start: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	// watered on the morning of day one and day four; moisture jumps from
+	// 30% to 60% then decays by 10% a day
+	waterings := []time.Time{start.Add(time.Hour * 8), start.AddDate(0, 0, 3).Add(time.Hour * 8)}
+	for hour := 0; hour < 24*7; hour++ {
+		posted := start.Add(time.Hour * time.Duration(hour))
+
+		moisture := 30.0
+		for _, watered := range waterings {
+			if since := posted.Sub(watered); since > 0 {
+				moisture = 60 - 10*since.Hours()/24
+			}
+		}
+
+		if err := fS.StoreReading(models.Reading{UserEmail: userEmail, CoreID: "one", Posted: posted, Moisture: moisture}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, watered := range waterings {
+		if _, err := es.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventWatering, Source: models.EventManual, PlantID: basil, Posted: watered}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := url.Values{}
+	query.Add("start", start.Format(time.RFC3339))
+	query.Add("end", start.AddDate(0, 0, 7).Format(time.RFC3339))
+	query.Add("plant", strconv.FormatInt(basil, 10))
+
+	req, err := http.NewRequest("GET", "/events/response?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	apollo.New(withEmail(userEmail)).Then(WateringResponses(es, ps, fS, &fake.CalibrationStore{})).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var responses []struct {
+		CoreID   string  `json:"coreid"`
+		Rise     float64 `json:"rise"`
+		RiseTime string  `json:"rise_time"`
+		Lasted   *string `json:"lasted"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 watering responses, got %d", len(responses))
+	}
+
+	for _, response := range responses {
+		if response.CoreID != "one" || response.RiseTime != "1h0m0s" || response.Lasted == nil {
+			t.Errorf("Unexpected watering response %v", response)
+		}
+	}
+}
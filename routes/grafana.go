@@ -0,0 +1,355 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The Grafana SimpleJSON datasource protocol names series by targets of the
+// form "core.metric"; a target's data may choose the summary of each bucket
+// plotted: its "mean" (the default), "min" or "max".
+
+// ErrorInvalidTarget is returned when a Grafana target doesn't name one of
+// the user's cores and a metric, or asks for an unknown summary.
+var ErrorInvalidTarget = errors.New("Target must be of the form core.metric")
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Data   struct {
+		Summary string `json:"summary"`
+	} `json:"data"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int64           `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange    `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	Title      string          `json:"title"`
+	Tags       []string        `json:"tags"`
+	Text       string          `json:"text"`
+}
+
+// GrafanaTest handles the request Grafana makes to the datasource's root to
+// test the connection, answering that the user is authorized.
+func GrafanaTest() apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/") {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// GrafanaSearch handles Grafana's requests for the targets a user may plot:
+// each metric of each of their cores, filtered by the target searched for.
+func GrafanaSearch(s models.ReadingStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		var search struct {
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cores, err := userCores(s, getEmail(ctx))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		targets := []string{}
+		for _, core := range cores {
+			for _, metric := range models.Metrics {
+				target := core + "." + metric
+				if strings.Contains(target, search.Target) {
+					targets = append(targets, target)
+				}
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(targets)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// GrafanaQuery handles Grafana's requests for the series of targets over a
+// range.  Readings, and rollups of older readings, are summarized in buckets
+// of Grafana's interval, widened so no more than its maximum data points
+// are returned, aligned to the core's preferred time zone.  Values are
+// calibrated and converted to the user's preferred units.
+func GrafanaQuery(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, rs models.RetentionStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		var query grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start, end := query.Range.From, query.Range.To
+		if !end.After(start) {
+			http.Error(w, "range must end after it starts", http.StatusBadRequest)
+			return
+		}
+
+		interval := time.Duration(query.IntervalMs) * time.Millisecond
+		if query.MaxDataPoints > 0 {
+			if least := end.Sub(start) / time.Duration(query.MaxDataPoints); interval < least {
+				interval = least
+			}
+		}
+
+		if interval < time.Second {
+			interval = time.Second
+		}
+
+		cores, err := userCores(s, email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// targets of the same core share its aggregates
+		aggregates := make(map[string][]models.Aggregate)
+		series := make([]grafanaSeries, 0, len(query.Targets))
+
+		for _, target := range query.Targets {
+			core, metric, err := parseGrafanaTarget(target, cores)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if _, ok := aggregates[core]; !ok {
+				loc, err := requestLocation(preferences, r, core)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				bucket, err := models.NewBucketer(interval.String(), loc)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				readings, err := s.GetReadings(email, core, start, end)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				rollups, err := rs.GetRollups(email, core, start, end)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				aggregates[core], err = aggregateReadings(c, preferences, w, r, email, readings, rollups, bucket)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			datapoints := make([][2]float64, 0, len(aggregates[core]))
+			for _, a := range aggregates[core] {
+				summary, ok := a.Metrics[metric]
+				if !ok || summary.Count == 0 {
+					continue
+				}
+
+				value := summary.Mean
+				switch target.Data.Summary {
+				case "min":
+					value = summary.Min
+				case "max":
+					value = summary.Max
+				}
+
+				datapoints = append(datapoints, [2]float64{value, float64(a.Start.UnixNano() / int64(time.Millisecond))})
+			}
+
+			series = append(series, grafanaSeries{Target: target.Target, Datapoints: datapoints})
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(series)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// GrafanaAnnotations handles Grafana's requests for annotations over a
+// range: the user's care events, only those concerning the core given as
+// the annotation's query, if any.
+func GrafanaAnnotations(es models.EventStore, ps models.PlantStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		var query grafanaAnnotationQuery
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var annotation struct {
+			Query string `json:"query"`
+		}
+		if len(query.Annotation) > 0 {
+			if err := json.Unmarshal(query.Annotation, &annotation); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		start, end := query.Range.From, query.Range.To
+
+		var events []models.Event
+		var err error
+		if core := strings.TrimSpace(annotation.Query); core != "" {
+			events, err = coreEvents(es, ps, email, core, start, end)
+		} else {
+			events, err = es.GetEvents(email, start, end)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		models.SortEvents(events)
+
+		annotations := make([]grafanaAnnotation, 0, len(events))
+		for _, e := range events {
+			tags := []string{e.Kind, e.Source}
+			if e.CoreID != "" {
+				tags = append(tags, e.CoreID)
+			}
+
+			text := e.Notes
+			if e.Amount != 0 {
+				text = strings.TrimSpace(fmt.Sprintf("%g %s", e.Amount, e.Notes))
+			}
+
+			annotations = append(annotations, grafanaAnnotation{
+				Annotation: query.Annotation,
+				Time:       e.Posted.UnixNano() / int64(time.Millisecond),
+				Title:      e.Kind,
+				Tags:       tags,
+				Text:       text,
+			})
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(annotations)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// userCores returns the cores the user has readings from, in order.
+func userCores(s models.ReadingStore, userEmail string) ([]string, error) {
+	latest, err := s.GetLatestReadings(userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	cores := make([]string, 0, len(latest))
+	for _, reading := range latest {
+		cores = append(cores, reading.CoreID)
+	}
+	sort.Strings(cores)
+
+	return cores, nil
+}
+
+// parseGrafanaTarget splits a target into one of the given cores and a
+// metric.
+func parseGrafanaTarget(target grafanaTarget, cores []string) (core, metric string, err error) {
+	i := strings.LastIndex(target.Target, ".")
+	if i < 0 {
+		return "", "", ErrorInvalidTarget
+	}
+
+	core, metric = target.Target[:i], target.Target[i+1:]
+	if _, ok := (models.Reading{}).Value(metric); !ok {
+		return "", "", ErrorInvalidTarget
+	}
+
+	switch target.Data.Summary {
+	case "", "mean", "min", "max":
+	default:
+		return "", "", ErrorInvalidTarget
+	}
+
+	for _, c := range cores {
+		if c == core {
+			return core, metric, nil
+		}
+	}
+
+	return "", "", ErrorInvalidTarget
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGrafana(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	start := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+
+	s := &fake.ReadingStore{}
+	for i := 0; i < 12; i++ {
+		posted := start.Add(time.Duration(i) * time.Minute * 5)
+		s.StoreReading(models.Reading{UserEmail: userEmail, CoreID: "garden", Posted: posted, Moisture: float64(40 + i), Temperature: 20})
+	}
+	s.StoreReading(models.Reading{UserEmail: userEmail, CoreID: "greenhouse", Posted: start, Moisture: 70})
+	s.StoreReading(models.Reading{UserEmail: "other@stupidname.com", CoreID: "neighbour", Posted: start, Moisture: 10})
+
+	es := &fake.EventStore{}
+	es.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventWatering, Source: models.EventManual, CoreID: "garden", Posted: start.Add(time.Minute * 20), Amount: 500, Notes: "ml"})
+	es.StoreEvent(models.Event{UserEmail: userEmail, Kind: models.EventFertilizing, Source: models.EventManual, CoreID: "greenhouse", Posted: start.Add(time.Minute * 10)})
+
+	withUser := apollo.New(withEmail(userEmail))
+	search := withUser.Then(GrafanaSearch(s))
+	query := withUser.Then(GrafanaQuery(s, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.RetentionStore{Readings: s}))
+	annotations := withUser.Then(GrafanaAnnotations(es, &fake.PlantStore{}))
+
+	post := func(handler http.Handler, path, body string, v interface{}) int {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code == http.StatusOK && v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return resp.Code
+	}
+
+	var targets []string
+	if code := post(search, "/grafana/search", `{"target": "moist"}`, &targets); code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, code)
+	}
+
+	if len(targets) != 2 || targets[0] != "garden.moisture" || targets[1] != "greenhouse.moisture" {
+		t.Fatalf("Expected moisture targets of the user's cores, got %v", targets)
+	}
+
+	post(search, "/grafana/search", `{"target": ""}`, &targets)
+	if len(targets) != 2*len(models.Metrics) {
+		t.Fatalf("Expected every metric of every core, got %v", targets)
+	}
+
+	var series []grafanaSeries
+	code := post(query, "/grafana/query", `{
+		"range": {"from": "2016-05-10T08:00:00.000Z", "to": "2016-05-10T09:00:00.000Z"},
+		"intervalMs": 60000, "maxDataPoints": 4,
+		"targets": [{"target": "garden.moisture", "refId": "A"}, {"target": "garden.moisture", "refId": "B", "data": {"summary": "max"}}]}`, &series)
+	if code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, code)
+	}
+
+	if len(series) != 2 || len(series[0].Datapoints) != 4 {
+		t.Fatalf("Expected readings bucketed into 15 minute intervals, got %v", series)
+	}
+
+	ms := float64(start.UnixNano() / int64(time.Millisecond))
+	if series[0].Datapoints[0] != [2]float64{41, ms} || series[1].Datapoints[0] != [2]float64{42, ms} {
+		t.Fatalf("Expected mean and max of first bucket, got %v and %v", series[0].Datapoints[0], series[1].Datapoints[0])
+	}
+
+	for _, body := range []string{
+		`{"range": {"from": "2016-05-10T08:00:00Z", "to": "2016-05-10T09:00:00Z"}, "targets": [{"target": "neighbour.moisture"}]}`,
+		`{"range": {"from": "2016-05-10T08:00:00Z", "to": "2016-05-10T09:00:00Z"}, "targets": [{"target": "garden.wetness"}]}`,
+		`{"range": {"from": "2016-05-10T08:00:00Z", "to": "2016-05-10T09:00:00Z"}, "targets": [{"target": "garden.moisture", "data": {"summary": "median"}}]}`,
+		`{"range": {"from": "2016-05-10T09:00:00Z", "to": "2016-05-10T08:00:00Z"}, "targets": []}`,
+		`{"range": {"from": "yesterday"}}`,
+	} {
+		if code := post(query, "/grafana/query", body, nil); code != http.StatusBadRequest {
+			t.Errorf("Querying %s: expected %d, got %d", body, http.StatusBadRequest, code)
+		}
+	}
+
+	var annotated []grafanaAnnotation
+	code = post(annotations, "/grafana/annotations", `{
+		"range": {"from": "2016-05-10T08:00:00.000Z", "to": "2016-05-10T09:00:00.000Z"},
+		"annotation": {"name": "care", "enable": true, "query": ""}}`, &annotated)
+	if code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, code)
+	}
+
+	if len(annotated) != 2 || annotated[0].Title != models.EventFertilizing || annotated[1].Text != "500 ml" {
+		t.Fatalf("Expected events in order, got %v", annotated)
+	}
+
+	if string(annotated[0].Annotation) != `{"name":"care","enable":true,"query":""}` {
+		t.Fatalf("Expected annotation echoed, got %s", annotated[0].Annotation)
+	}
+
+	post(annotations, "/grafana/annotations", `{
+		"range": {"from": "2016-05-10T08:00:00.000Z", "to": "2016-05-10T09:00:00.000Z"},
+		"annotation": {"name": "garden", "query": "garden"}}`, &annotated)
+	if len(annotated) != 1 || annotated[0].Title != models.EventWatering || annotated[0].Tags[2] != "garden" {
+		t.Fatalf("Expected only the garden's events, got %v", annotated)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/grafana/", http.StatusOK},
+		{"POST", "/grafana/", http.StatusNotFound},
+		{"GET", "/grafana/unknown", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(tc.method, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		withUser.Then(GrafanaTest()).ServeHTTP(resp, req)
+		if resp.Code != tc.code {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.code, resp.Code)
+		}
+	}
+}
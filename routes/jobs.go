@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/bifrost"
+	"golang.org/x/net/context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ErrorJobDoesntExist is returned when the status of a job is requested that
+// the dispatcher doesn't know of or that was queued by another user.
+var ErrorJobDoesntExist = errors.New("job does not exist")
+
+// JobLedger queues jobs on a bifrost.JobDispatcher while keeping track of
+// the users who queued them, the results jobs report and the idempotency
+// keys they were queued under.  Entries are forgotten once the dispatcher no
+// longer knows of their job, closing results that are io.Closers, such as
+// exports spooled to files.
+type JobLedger struct {
+	dispatcher bifrost.JobDispatcher
+	lock       sync.Mutex
+	owners     map[uint]string
+	results    map[uint]interface{}
+	keys       map[string]uint
+}
+
+// NewJobLedger returns a new *JobLedger queuing jobs on the given dispatcher.
+func NewJobLedger(j bifrost.JobDispatcher) *JobLedger {
+	return &JobLedger{
+		dispatcher: j,
+		owners:     make(map[uint]string),
+		results:    make(map[uint]interface{}),
+		keys:       make(map[string]uint),
+	}
+}
+
+// Queue queues f to be run by the dispatcher on behalf of owner, the email
+// of the user queuing it.  result, if not nil, should be written to by f and
+// is reported with the job's status once complete.  If key is not empty and
+// a job the owner already queued under the same key is still known to the
+// dispatcher, that job is returned instead and queued is false.
+func (l *JobLedger) Queue(owner, key string, result interface{}, f bifrost.JobRunnerFunc) (job bifrost.JobTracker, queued bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune()
+
+	if key != "" {
+		key = owner + "\x00" + key
+		if jobID, ok := l.keys[key]; ok {
+			if job, err := l.dispatcher.JobStatus(jobID); err == nil {
+				return job, false
+			}
+		}
+	}
+
+	job = l.dispatcher.QueueFunc(f)
+	l.owners[job.ID()] = owner
+	if key != "" {
+		l.keys[key] = job.ID()
+	}
+	if result != nil {
+		l.results[job.ID()] = result
+	}
+
+	return job, true
+}
+
+// JobStatus returns the JobTracker for the owner's job with the given jobID
+// and, if the job has completed, the result it reported.  Other users' jobs
+// don't exist.
+func (l *JobLedger) JobStatus(owner string, jobID uint) (bifrost.JobTracker, interface{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if queuedBy, ok := l.owners[jobID]; !ok || queuedBy != owner {
+		return nil, nil, ErrorJobDoesntExist
+	}
+
+	job, err := l.dispatcher.JobStatus(jobID)
+	if err != nil {
+		return nil, nil, ErrorJobDoesntExist
+	}
+
+	if !job.Status().Complete {
+		return job, nil, nil
+	}
+
+	return job, l.results[jobID], nil
+}
+
+// Prune forgets jobs the dispatcher has expired.  Jobs are pruned whenever
+// one is queued; Prune should also be run periodically so results are
+// closed promptly.
+func (l *JobLedger) Prune() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune()
+}
+
+// prune removes entries for jobs the dispatcher has expired.  Must be called
+// with the lock held.
+func (l *JobLedger) prune() {
+	for jobID := range l.owners {
+		if _, err := l.dispatcher.JobStatus(jobID); err != nil {
+			if closer, ok := l.results[jobID].(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					log.Printf("Error closing result of expired Job %d: %s", jobID, err)
+				}
+			}
+
+			delete(l.owners, jobID)
+			delete(l.results, jobID)
+		}
+	}
+
+	for key, jobID := range l.keys {
+		if _, err := l.dispatcher.JobStatus(jobID); err != nil {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// jobStatus is the response to a job status request; the job's result, when
+// present, is added to the fields of the bifrost.JobStatus.
+type jobStatus struct {
+	Status bifrost.JobStatus
+	Result interface{}
+}
+
+func (s jobStatus) MarshalJSON() ([]byte, error) {
+	statusJSON, err := json.Marshal(s.Status)
+	if err != nil || s.Result == nil {
+		return statusJSON, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(statusJSON, &fields); err != nil {
+		return nil, err
+	}
+
+	resultJSON, err := json.Marshal(s.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	fields["Result"] = resultJSON
+	return json.Marshal(fields)
+}
+
+// Jobs handles HTTP requests for the status of a job the user queued.
+func Jobs(l *JobLedger) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		strJobID := r.FormValue("jobID")
+		if strJobID == "" {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+
+		jobID, err := strconv.ParseUint(strJobID, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tracker, result, err := l.JobStatus(getEmail(ctx), uint(jobID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(jobStatus{Status: tracker.Status(), Result: result})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
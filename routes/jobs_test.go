@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/bifrost"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJobsOwner(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	ledger := NewJobLedger(bifrost.NewWorkerDispatcher(bifrost.Workers(1)))
+	job, _ := ledger.Queue(userEmail, "batch", "done", func() error { return nil })
+	<-job.Done()
+
+	if other, queued := ledger.Queue("janedoe@stupidname.com", "batch", nil, func() error { return nil }); !queued || other.ID() == job.ID() {
+		t.Fatal("Another user's job with the same idempotency key should be queued")
+	}
+
+	status := func(email string) int {
+		req, err := http.NewRequest("GET", "/job?jobID="+strconv.FormatUint(uint64(job.ID()), 10), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		apollo.New(withEmail(email)).Then(Jobs(ledger)).ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := status(userEmail); code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, code)
+	}
+
+	if code := status("janedoe@stupidname.com"); code != http.StatusNotFound {
+		t.Fatalf("Another user's job; expected %d, got %d", http.StatusNotFound, code)
+	}
+
+	if _, _, err := ledger.JobStatus("janedoe@stupidname.com", job.ID()); err != ErrorJobDoesntExist {
+		t.Fatalf("Expected ErrorJobDoesntExist, got %v", err)
+	}
+}
+
+type closer bool
+
+func (c *closer) Close() error {
+	*c = true
+	return nil
+}
+
+func TestJobsPruneClosesResults(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	ledger := NewJobLedger(bifrost.NewWorkerDispatcher(bifrost.Workers(1), bifrost.JobExpiry(time.Millisecond*10)))
+	result := new(closer)
+	job, _ := ledger.Queue(userEmail, "", result, func() error { return nil })
+	<-job.Done()
+
+	for deadline := time.Now().Add(time.Second); !bool(*result); time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected expired job's result to be closed")
+		}
+		ledger.Prune()
+	}
+
+	if _, _, err := ledger.JobStatus(userEmail, job.ID()); err != ErrorJobDoesntExist {
+		t.Fatalf("Expected ErrorJobDoesntExist, got %v", err)
+	}
+}
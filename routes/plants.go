@@ -0,0 +1,344 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Zones handles HTTP requests to list a user's zones (GET), add or update a
+// zone (POST) or delete the zone given by the "id" query option (DELETE).
+func Zones(ps models.PlantStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			zones, err := ps.GetZones(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(zones)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var zone models.Zone
+			if err := json.NewDecoder(r.Body).Decode(&zone); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			zone.UserEmail = email
+			if zone.Name == "" {
+				http.Error(w, models.ErrorInvalidPlant.Error(), http.StatusBadRequest)
+				return
+			}
+
+			created := zone.ID == 0
+			id, err := ps.StoreZone(zone)
+			if err == models.ErrorZoneDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			zone.ID = id
+
+			writeStored(w, created, zone)
+		case "DELETE":
+			deleteByID(w, r, "zone", models.ErrorZoneDoesntExist, func(id int64) error {
+				return ps.DeleteZone(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// Plants handles HTTP requests to list a user's plants (GET), add or update
+// a plant (POST) or delete the plant given by the "id" query option
+// (DELETE).
+func Plants(ps models.PlantStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			plants, err := ps.GetPlants(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(plants)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var plant models.Plant
+			if err := json.NewDecoder(r.Body).Decode(&plant); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			plant.UserEmail = email
+			if plant.Name == "" {
+				http.Error(w, models.ErrorInvalidPlant.Error(), http.StatusBadRequest)
+				return
+			}
+
+			created := plant.ID == 0
+			id, err := ps.StorePlant(plant)
+			switch err {
+			case nil:
+			case models.ErrorZoneDoesntExist:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case models.ErrorPlantDoesntExist:
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			plant.ID = id
+
+			writeStored(w, created, plant)
+		case "DELETE":
+			deleteByID(w, r, "plant", models.ErrorPlantDoesntExist, func(id int64) error {
+				return ps.DeletePlant(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// PlantAssignments handles HTTP requests, at /plants/{id}/assignments, to
+// list the cores assigned to a plant over time (GET), assign a core to the
+// plant (POST) or delete the assignment given by the "id" query option
+// (DELETE).
+func PlantAssignments(ps models.PlantStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		plant, err := pathPlant(ps, r, email)
+		if err == models.ErrorPlantDoesntExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			assignments, err := ps.GetAssignments(email, plant.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(assignments)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var assignment models.Assignment
+			if err := json.NewDecoder(r.Body).Decode(&assignment); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			assignment.UserEmail, assignment.PlantID = email, plant.ID
+			if err := assignment.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			id, err := ps.StoreAssignment(assignment)
+			if err == models.ErrorAssignmentOverlaps {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			assignment.ID = id
+
+			writeStored(w, true, assignment)
+		case "DELETE":
+			deleteByID(w, r, "assignment", models.ErrorAssignmentDoesntExist, func(id int64) error {
+				return ps.DeleteAssignment(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// PlantReadings handles HTTP requests, at /plants/{id}/readings, for the
+// readings of whichever cores were assigned to a plant between a start and
+// end date.  Readings are ordered by time posted and are calibrated and
+// converted as they would be by GetReadings, which the plant's care events
+// may likewise be overlaid on.
+func PlantReadings(ps models.PlantStore, s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, es models.EventStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		start, end, err := getTimeSpanParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		plant, err := pathPlant(ps, r, email)
+		if err == models.ErrorPlantDoesntExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		readings, err := plantReadings(ps, s, email, plant.ID, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := calibrate(c, r, email, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := convertUnits(preferences, w, r, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeReadings(w, r, readings, func() ([]models.Event, error) {
+			assignments, err := ps.GetAssignments(email, plant.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			return plantEvents(es, email, plant.ID, assignments, start, end)
+		})
+	})
+}
+
+// plantReadings collects the user's readings, posted between start and end,
+// from each core while it was assigned to the plant.
+func plantReadings(ps models.PlantStore, s models.ReadingStore, userEmail string, plantID int64, start, end time.Time) ([]models.Reading, error) {
+	assignments, err := ps.GetAssignments(userEmail, plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := []models.Reading{}
+	for _, a := range assignments {
+		from, to := start, end
+		if a.Start.After(from) {
+			from = a.Start
+		}
+		if a.End != nil && a.End.Before(to) {
+			to = *a.End
+		}
+		if from.After(to) {
+			continue
+		}
+
+		coreReadings, err := s.GetReadings(userEmail, a.CoreID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		readings = append(readings, models.FilterReadings(coreReadings, func(reading models.Reading) bool {
+			return a.Covers(reading.Posted)
+		})...)
+	}
+
+	models.SortReadings(readings)
+	return readings, nil
+}
+
+// pathPlant returns the user's plant identified by a /plants/{id}/...
+// path.
+func pathPlant(ps models.PlantStore, r *http.Request, userEmail string) (models.Plant, error) {
+	id, err := strconv.ParseInt(resourceID(r), 10, 64)
+	if err != nil {
+		return models.Plant{}, models.ErrorPlantDoesntExist
+	}
+
+	plants, err := ps.GetPlants(userEmail)
+	if err != nil {
+		return models.Plant{}, err
+	}
+
+	for _, plant := range plants {
+		if plant.ID == id {
+			return plant, nil
+		}
+	}
+
+	return models.Plant{}, models.ErrorPlantDoesntExist
+}
+
+// writeStored writes an entity stored by a POST request, with status 201
+// if it was created.
+func writeStored(w http.ResponseWriter, created bool, v interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// deleteByID handles a DELETE request for the entity given by the "id" query
+// option, responding 404 if del returns notFound.
+func deleteByID(w http.ResponseWriter, r *http.Request, entity string, notFound error, del func(id int64) error) {
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid or missing "+entity+" id", http.StatusBadRequest)
+		return
+	}
+
+	err = del(id)
+	if err == notFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
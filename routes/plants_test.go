@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPlantReadings(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	fS := &fake.ReadingStore{}
+	ps := &fake.PlantStore{}
+
+	basil, err := ps.StorePlant(models.Plant{UserEmail: userEmail, Name: "basil bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tomato, err := ps.StorePlant(models.Plant{UserEmail: userEmail, Name: "tomato pot 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hourly readings, on the half hour, from two cores for four days
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	for _, core := range []string{"one", "two"} {
+		readingGen := fake.ReadingGen(userEmail, core, start.Add(time.Minute*30), time.Hour)
+		for i := 0; i < 96; i++ {
+			if err := fS.StoreReading(readingGen()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	handler := Subresources("plants", map[string]http.Handler{
+		"assignments": apollo.New(withEmail(userEmail)).Then(PlantAssignments(ps)),
+		"readings":    apollo.New(withEmail(userEmail)).Then(PlantReadings(ps, fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{})),
+	})
+
+	// core one monitors the basil for a day then moves to the tomato, core
+	// two takes over the basil on day three; a bounded assignment doesn't
+	// end the open one it overlaps
+	for _, tc := range []struct {
+		plant int64
+		core  string
+		day   int
+		days  int
+		code  int
+	}{
+		{plant: basil, core: "one", day: 0, code: http.StatusCreated},
+		{plant: tomato, core: "one", day: 1, code: http.StatusCreated},
+		{plant: basil, core: "two", day: 2, code: http.StatusCreated},
+		{plant: basil, core: "one", day: 0, code: http.StatusConflict},
+		{plant: tomato, core: "two", day: 3, days: 1, code: http.StatusConflict},
+		{plant: basil + tomato, core: "two", day: 3, code: http.StatusNotFound},
+	} {
+		assignment := models.Assignment{CoreID: tc.core, Start: start.AddDate(0, 0, tc.day)}
+		if tc.days != 0 {
+			end := assignment.Start.AddDate(0, 0, tc.days)
+			assignment.End = &end
+		}
+
+		body, err := json.Marshal(assignment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := "/plants/" + strconv.FormatInt(tc.plant, 10) + "/assignments"
+		req, err := http.NewRequest("POST", path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("assigning %s to %d: expected %d, got %d", tc.core, tc.plant, tc.code, resp.Code)
+		}
+	}
+
+	query := url.Values{}
+	query.Add("start", start.Format(time.RFC3339))
+	query.Add("end", start.AddDate(0, 0, 4).Format(time.RFC3339))
+
+	req, err := http.NewRequest("GET", "/plants/"+strconv.FormatInt(basil, 10)+"/readings?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var readings []models.Reading
+	if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 72 {
+		t.Fatalf("Expected 72 readings, got %d", len(readings))
+	}
+
+	for i, r := range readings {
+		expected := "one"
+		if r.Posted.After(start.AddDate(0, 0, 2).Add(-time.Second)) {
+			expected = "two"
+		}
+
+		if r.CoreID != expected {
+			t.Fatalf("Reading posted %s from core %s, expected %s", r.Posted, r.CoreID, expected)
+		}
+
+		if i > 0 && r.Posted.Before(readings[i-1].Posted) {
+			t.Fatal("Readings not ordered by time posted")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"time"
+)
+
+// UnitsHeader is the response header listing the units readings are
+// expressed in.
+const UnitsHeader = "X-FREYR-UNITS"
+
+// convertUnits converts readings, in place, to the units given in the
+// request's "units" query option, falling back to the user's preferences,
+// and adds the applied units to the response headers.
+func convertUnits(preferences models.Preferences, w http.ResponseWriter, r *http.Request, readings []models.Reading) error {
+	requested, err := models.ParseUnits(r.FormValue("units"))
+	if err != nil {
+		return err
+	}
+
+	units := preferences.EffectiveUnits().Merge(requested)
+	units.ConvertAll(readings)
+	w.Header().Set(UnitsHeader, units.String())
+	return nil
+}
+
+// declaredUnits returns the units readings posted in the request are in,
+// as declared by its "units" option.  Metrics not declared are assumed to be
+// in canonical units already.
+func declaredUnits(r *http.Request) (models.Units, error) {
+	return models.ParseUnits(r.FormValue("units"))
+}
+
+// requestLocation returns the time zone given in the request's "tz" query
+// option, falling back to the user's preference for the core.
+func requestLocation(preferences models.Preferences, r *http.Request, core string) (*time.Location, error) {
+	if tz := r.FormValue("tz"); tz != "" {
+		return time.LoadLocation(tz)
+	}
+
+	return preferences.Location(core)
+}
+
+// Preferences handles HTTP requests to get (GET) or update (POST) a user's
+// preferences.
+func Preferences(p models.PreferenceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		if r.Method == "POST" {
+			var preferences models.Preferences
+			if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := preferences.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := p.StorePreferences(email, preferences); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences.Units = preferences.EffectiveUnits()
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(preferences)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/prometheus"
+	"golang.org/x/net/context"
+	"net/http"
+)
+
+// Metrics handles HTTP requests from Prometheus scraping gauges of the
+// latest calibrated value of each metric from each of a user's cores.
+func Metrics(s models.ReadingStore, c models.CalibrationStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		readings, err := s.GetLatestReadings(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := calibrate(c, r, email, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", prometheus.ExpositionContentType)
+		if err := prometheus.WriteGauges(w, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// RemoteRead handles Prometheus remote read requests for the calibrated
+// history of a user's cores.  Each query selects series by metric name and
+// core, and is answered from the readings between its start and end.
+func RemoteRead(s models.ReadingStore, c models.CalibrationStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+		req, err := prometheus.ReadRequestFrom(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cores, err := userCores(s, email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := &prometheus.ReadResponse{Results: make([]*prometheus.QueryResult, 0, len(req.Queries))}
+		for _, query := range req.Queries {
+			result := &prometheus.QueryResult{Timeseries: []*prometheus.TimeSeries{}}
+
+			for _, core := range cores {
+				var metrics []string
+				for _, metric := range models.Metrics {
+					selected, err := query.Selects(metric, core)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					if selected {
+						metrics = append(metrics, metric)
+					}
+				}
+
+				if len(metrics) == 0 {
+					continue
+				}
+
+				start, end := query.Span()
+				readings, err := s.GetReadings(email, core, start, end)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				if len(readings) == 0 {
+					continue
+				}
+
+				if err := calibrate(c, r, email, readings); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				for _, metric := range metrics {
+					result.Timeseries = append(result.Timeseries, prometheus.Series(metric, core, readings))
+				}
+			}
+
+			resp.Results = append(resp.Results, result)
+		}
+
+		if err := prometheus.WriteReadResponse(w, resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"bytes"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func prometheusStores(t *testing.T, userEmail string, now time.Time) (*fake.ReadingStore, *fake.CalibrationStore) {
+	s := &fake.ReadingStore{}
+	for _, r := range []models.Reading{
+		{UserEmail: userEmail, CoreID: "garden", Posted: now, Moisture: 40, Temperature: 20},
+		{UserEmail: userEmail, CoreID: "garden", Posted: now.Add(time.Minute), Moisture: 38, Temperature: 21},
+		{UserEmail: userEmail, CoreID: "greenhouse", Posted: now, Moisture: 70, Temperature: 25},
+		{UserEmail: "other@stupidname.com", CoreID: "neighbour", Posted: now, Moisture: 10},
+	} {
+		if err := s.StoreReading(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &fake.CalibrationStore{}
+	_, err := c.StoreCalibration(models.Calibration{UserEmail: userEmail, CoreID: "garden", Metric: "moisture",
+		Kind: models.CalibrationLinear, Offset: 5, Scale: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, c
+}
+
+func TestMetrics(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	s, c := prometheusStores(t, userEmail, now)
+
+	handler := apollo.New(withEmail(userEmail)).Then(Metrics(s, c))
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != prometheus.ExpositionContentType {
+		t.Fatalf("Unexpected response %d (%s)", resp.Code, resp.Header().Get("Content-Type"))
+	}
+
+	body := resp.Body.String()
+	for _, line := range []string{
+		`freyr_moisture_percent{coreid="garden"} 43`,
+		`freyr_moisture_percent{coreid="greenhouse"} 70`,
+		`freyr_temperature_celsius{coreid="garden"} 21`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, body)
+		}
+	}
+
+	if strings.Contains(body, "neighbour") {
+		t.Errorf("Expected only the user's cores, got:\n%s", body)
+	}
+}
+
+func TestRemoteRead(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	s, c := prometheusStores(t, userEmail, now)
+
+	handler := apollo.New(withEmail(userEmail)).Then(RemoteRead(s, c))
+
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+	read := func(queries ...*prometheus.Query) *httptest.ResponseRecorder {
+		body, err := prometheus.EncodeReadRequest(&prometheus.ReadRequest{Queries: queries})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/read", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", prometheus.ProtobufContentType)
+		req.Header.Set("Content-Encoding", prometheus.SnappyEncoding)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := read(
+		&prometheus.Query{StartTimestampMs: ms(now), EndTimestampMs: ms(now.Add(time.Hour)), Matchers: []*prometheus.LabelMatcher{
+			{Type: prometheus.MatchEqual, Name: prometheus.NameLabel, Value: "freyr_moisture_percent"},
+		}},
+		&prometheus.Query{StartTimestampMs: ms(now.Add(time.Second)), EndTimestampMs: ms(now.Add(time.Hour)), Matchers: []*prometheus.LabelMatcher{
+			{Type: prometheus.MatchRegexp, Name: prometheus.NameLabel, Value: "freyr_.*"},
+			{Type: prometheus.MatchEqual, Name: prometheus.CoreLabel, Value: "garden"},
+		}},
+		&prometheus.Query{StartTimestampMs: ms(now), EndTimestampMs: ms(now.Add(time.Hour)), Matchers: []*prometheus.LabelMatcher{
+			{Type: prometheus.MatchEqual, Name: prometheus.CoreLabel, Value: "neighbour"},
+		}},
+	)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	result, err := prometheus.ReadResponseFrom(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Results) != 3 {
+		t.Fatalf("Expected a result per query, got %v", result)
+	}
+
+	moisture := result.Results[0].Timeseries
+	if len(moisture) != 2 || moisture[0].Labels[1].Value != "garden" || moisture[1].Labels[1].Value != "greenhouse" {
+		t.Fatalf("Expected moisture of both cores, got %v", moisture)
+	}
+
+	if len(moisture[0].Samples) != 2 || moisture[0].Samples[0].Value != 45 || moisture[0].Samples[1].Timestamp != ms(now.Add(time.Minute)) {
+		t.Fatalf("Expected calibrated garden moisture, got %v", moisture[0].Samples)
+	}
+
+	garden := result.Results[1].Timeseries
+	if len(garden) != len(models.Metrics) || len(garden[0].Samples) != 1 {
+		t.Fatalf("Expected every metric of the garden's last reading, got %v", garden)
+	}
+
+	if len(result.Results[2].Timeseries) != 0 {
+		t.Fatalf("Expected no series of other users' cores, got %v", result.Results[2])
+	}
+
+	req, err := http.NewRequest("POST", "/read", strings.NewReader("not snappy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	resp = read(&prometheus.Query{Matchers: []*prometheus.LabelMatcher{{Type: prometheus.MatchRegexp, Name: prometheus.NameLabel, Value: "("}}})
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Incorrect response code for bad regexp; expected %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+// Quarantine handles HTTP requests to list a user's quarantined readings
+// (GET), release one into their readings (POST) or discard one (DELETE).
+// Released readings are stored in s without being validated again.
+func Quarantine(q models.QuarantineStore, s models.ReadingStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		if r.Method == "GET" {
+			quarantined, err := q.GetQuarantined(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(quarantined)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		if r.Method != "POST" && r.Method != "DELETE" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid or missing quarantined reading id", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == "DELETE" {
+			err := q.DeleteQuarantined(email, id)
+			if err == models.ErrorQuarantinedDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		reading, err := q.ReleaseQuarantined(email, id)
+		if err == models.ErrorQuarantinedDoesntExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.StoreReading(reading)
+		if err != nil && err != models.ErrorReadingExists {
+			// put it back so the release can be retried
+			q.QuarantineReading(reading, []string{"release failed: " + err.Error()})
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(reading)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// ValidationLimits handles HTTP requests to get (GET) or update (POST) the
+// limits a core's readings are validated against.
+func ValidationLimits(q models.QuarantineStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		core := r.FormValue("core")
+		if core == "" {
+			http.Error(w, "core id missing from query", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == "POST" {
+			var limits models.ValidationLimits
+			if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := checkLimits(limits); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := q.StoreValidationLimits(email, core, limits); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		limits, err := q.GetValidationLimits(email, core)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(models.DefaultValidationLimits.Merge(limits))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+func checkLimits(limits models.ValidationLimits) error {
+	for metric, limit := range limits {
+		if _, ok := (models.Reading{}).Value(metric); !ok {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+
+		if limit.Min > limit.Max || limit.MaxRate < 0 {
+			return fmt.Errorf("invalid limits for %s", metric)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fQ := &fake.QuarantineStore{}
+	fS := &fake.ReadingStore{}
+
+	posted := time.Unix(5, 0).In(time.UTC)
+	reading := fake.RandReading(userEmail, coreid, posted)
+	if err := fQ.QuarantineReading(reading, []string{"too hot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	otherCtx := context.WithValue(context.Background(), "email", "someoneelse@stupidname.com")
+	handler := Quarantine(fQ, fS)
+
+	listReq, err := http.NewRequest("GET", "/quarantine", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listResp := httptest.NewRecorder()
+	handler.ServeHTTP(emailCtx, listResp, listReq)
+
+	if listResp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, listResp.Code)
+	}
+
+	var quarantined []models.QuarantinedReading
+	if err := json.NewDecoder(listResp.Body).Decode(&quarantined); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quarantined) != 1 {
+		t.Fatalf("Expected 1 quarantined reading, got %d", len(quarantined))
+	}
+
+	releaseReq, err := http.NewRequest("POST", "/quarantine?id="+strconv.FormatInt(quarantined[0].ID, 10), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherResp := httptest.NewRecorder()
+	handler.ServeHTTP(otherCtx, otherResp, releaseReq)
+
+	if otherResp.Code != http.StatusNotFound {
+		t.Fatalf("Other users shouldn't release readings; expected %d, got %d", http.StatusNotFound, otherResp.Code)
+	}
+
+	releaseResp := httptest.NewRecorder()
+	handler.ServeHTTP(emailCtx, releaseResp, releaseReq)
+
+	if releaseResp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, releaseResp.Code)
+	}
+
+	stored, err := fS.GetReadings(userEmail, coreid, posted.Add(-time.Second), posted.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 1 || !stored[0].Compare(reading) {
+		t.Fatalf("Released reading should be stored, got %v", stored)
+	}
+
+	remaining, _ := fQ.GetQuarantined(userEmail)
+	if len(remaining) != 0 {
+		t.Fatalf("Released reading should leave quarantine, got %v", remaining)
+	}
+}
@@ -4,19 +4,33 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/cyclopsci/apollo"
-	"github.com/serdmanczyk/bifrost"
 	"github.com/serdmanczyk/freyr/models"
 	"golang.org/x/net/context"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// maxReadingsLimit is the most readings returned in a page, and the number
+// returned when no limit is given.
+const maxReadingsLimit = 10000
+
 var (
 	// ErrorNoReading is used when a reading is not present in a
 	// Post request.
 	ErrorNoReading = errors.New("reading not present in request")
+	// ErrorInvalidLimit is returned when a page's limit isn't a positive
+	// number no more than maxReadingsLimit.
+	ErrorInvalidLimit = errors.New("limit must be between 1 and 10000")
+	// ErrorUnknownFormat is returned when readings are requested in a
+	// format other than rows or columnar.
+	ErrorUnknownFormat = errors.New("format must be rows or columnar")
+	// ErrorCoreForbidden is returned when readings are requested or
+	// deleted for a core the user has posted no readings of.
+	ErrorCoreForbidden = errors.New("core does not belong to user")
 )
 
 // StringsEmpty returns true if any passed string arguments are zero valued
@@ -66,7 +80,8 @@ func loadCoreReading(ctx context.Context, r *http.Request) (models.Reading, erro
 }
 
 // PostReading returns a handler that accepts HTTP requests to store new
-// readings.
+// readings.  Values are stored in canonical units, converted from any
+// declared by the "units" option, e.g. "temperature:F".
 func PostReading(s models.ReadingStore) apollo.Handler {
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -80,7 +95,32 @@ func PostReading(s models.ReadingStore) apollo.Handler {
 			return
 		}
 
-		if err := s.StoreReading(reading); err != nil {
+		units, err := declaredUnits(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reading = units.Canonical(reading)
+
+		err = s.StoreReading(reading)
+		if err == models.ErrorReadingExists {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if err == models.ErrorReadingQuarantined {
+			http.Error(w, err.Error(), http.StatusAccepted)
+			return
+		}
+
+		if conflict, ok := err.(models.ReadingConflictError); ok {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(conflict.Stored)
+			return
+		}
+
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -89,9 +129,21 @@ func PostReading(s models.ReadingStore) apollo.Handler {
 	})
 }
 
+// PostReadingsResult is the result reported by a job storing multiple
+// readings.
+type PostReadingsResult struct {
+	Stored      int `json:"stored"`
+	Duplicates  int `json:"duplicates"`
+	Conflicts   int `json:"conflicts"`
+	Quarantined int `json:"quarantined"`
+	Failed      int `json:"failed"`
+}
+
 // PostReadings returns a handler that accepts HTTP requests to store multiple
-// readings
-func PostReadings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler {
+// readings.  Requests carrying an Idempotency-Key header that matches a
+// previous request by the same user are answered with the original job.
+// Values are converted to canonical units as in PostReading.
+func PostReadings(l *JobLedger, s models.ReadingStore) apollo.Handler {
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "", http.StatusNotFound)
@@ -104,10 +156,39 @@ func PostReadings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler
 			return
 		}
 
-		var jobID uint
+		units, err := declaredUnits(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for i, reading := range readings {
+			readings[i] = units.Canonical(reading)
+		}
+
+		email := getEmail(ctx)
+		key := r.Header.Get(models.IdempotencyKeyHeader)
+
+		result := &PostReadingsResult{}
+		jobIDs := make(chan uint, 1)
 		postReadingsFunc := func() (e error) {
+			jobID := <-jobIDs
 			for _, reading := range readings {
-				if err := s.StoreReading(reading); err != nil {
+				err := s.StoreReading(reading)
+				if _, ok := err.(models.ReadingConflictError); ok {
+					result.Conflicts++
+					continue
+				}
+
+				switch err {
+				case nil:
+					result.Stored++
+				case models.ErrorReadingExists:
+					result.Duplicates++
+				case models.ErrorReadingQuarantined:
+					result.Quarantined++
+				default:
+					result.Failed++
 					// TODO: return aggregate error instead of most recent
 					e = err
 				}
@@ -116,9 +197,12 @@ func PostReadings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler
 			return
 		}
 
-		job := j.QueueFunc(postReadingsFunc)
-		jobID = job.ID()
-		log.Printf("Queued Job %d\n", jobID)
+		job, queued := l.Queue(email, key, result, postReadingsFunc)
+		jobID := job.ID()
+		if queued {
+			jobIDs <- jobID
+			log.Printf("Queued Job %d\n", jobID)
+		}
 		jobIdStr := strconv.FormatUint(uint64(jobID), 10)
 		w.WriteHeader(http.StatusAccepted)
 		w.Write([]byte(jobIdStr))
@@ -126,8 +210,11 @@ func PostReadings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler
 }
 
 // GetLatestReadings handles HTTP requests for the latest reading per core
-// owned by a particular user.
-func GetLatestReadings(s models.ReadingStore) apollo.Handler {
+// owned by a particular user.  The user's calibrations are applied unless
+// raw values are requested, and values are converted to the requested or
+// preferred units.  Each reading includes its core's status and when the
+// core was last seen.
+func GetLatestReadings(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, d models.DeviceStore) apollo.Handler {
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			http.Error(w, "", http.StatusNotFound)
@@ -141,8 +228,43 @@ func GetLatestReadings(s models.ReadingStore) apollo.Handler {
 			return
 		}
 
+		if err := calibrate(c, r, userEmail, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences, err := p.GetPreferences(userEmail)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := convertUnits(preferences, w, r, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		devices, err := d.GetDevices(userEmail)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		latest := make([]latestReading, 0, len(readings))
+		for _, reading := range readings {
+			l := latestReading{Reading: reading}
+			for _, device := range devices {
+				if device.CoreID == reading.CoreID {
+					lastSeen := device.LastSeen
+					l.Status, l.LastSeen = device.StatusAt(now), &lastSeen
+				}
+			}
+			latest = append(latest, l)
+		}
+
 		w.Header().Add("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(readings)
+		err = json.NewEncoder(w).Encode(latest)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -150,10 +272,18 @@ func GetLatestReadings(s models.ReadingStore) apollo.Handler {
 	})
 }
 
+// latestReading is a core's latest reading along with the core's status, if
+// the core has been seen since devices were tracked.
+type latestReading struct {
+	models.Reading
+	Status   string     `json:"status,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
 // Readings is the generalized route for the /readings path
-func Readings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler {
-	getHandler := GetReadings(s)
-	postHandler := PostReadings(j, s)
+func Readings(l *JobLedger, s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, es models.EventStore, ps models.PlantStore) apollo.Handler {
+	getHandler := GetReadings(s, c, p, es, ps)
+	postHandler := PostReadings(l, s)
 
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
@@ -170,8 +300,12 @@ func Readings(j bifrost.JobDispatcher, s models.ReadingStore) apollo.Handler {
 	})
 }
 
-// DeleteReadings handles HTTP requests to delete readings for a user between
-// the specified dates.
+// DeleteReadings handles HTTP requests to delete a user's readings of a core
+// between the specified dates.  Deleting readings of a core the user has
+// posted no readings of is forbidden.  The deletion is returned, with when
+// its readings are purged; until then UndoDeleteReadings restores them.
+// With the "dry_run=true" query option nothing is deleted, and the count of
+// readings that would be is returned.
 func DeleteReadings(s models.ReadingStore) apollo.Handler {
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method != "DELETE" {
@@ -185,32 +319,153 @@ func DeleteReadings(s models.ReadingStore) apollo.Handler {
 			return
 		}
 
-		err = s.DeleteReadings(core, start, end)
+		email := getEmail(ctx)
+		err = ownCores(s, email, []string{core})
+		if err == ErrorCoreForbidden {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusNoContent)
+		var response interface{}
+		if r.FormValue("dry_run") == "true" {
+			count, err := s.CountReadings(email, core, start, end)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			response = deletionCount{Count: count}
+		} else {
+			deletion, err := s.DeleteReadings(email, core, start, end)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			response = readingDeletion{deletion, deletion.PurgeAfter()}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	})
 }
 
-// GetReadings handles HTTP requests for readings made by a particular core
-// between a start and end date.
-func GetReadings(s models.ReadingStore) apollo.Handler {
+// readingDeletion is a deletion along with when its readings are purged.
+type readingDeletion struct {
+	models.ReadingDeletion
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+// deletionCount is the count of readings a dry run would delete, or an undo
+// restored.
+type deletionCount struct {
+	Count int `json:"count"`
+}
+
+// UndoDeleteReadings handles HTTP requests to restore the readings of the
+// user's deletion given by the "id" form value, returning the count of
+// readings restored.  Readings stored again since they were deleted aren't
+// replaced.  Deletions already undone or purged aren't found.
+func UndoDeleteReadings(s models.ReadingStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid or missing deletion id", http.StatusBadRequest)
+			return
+		}
+
+		restored, err := s.UndoDeletion(getEmail(ctx), id)
+		if err == models.ErrorDeletionDoesntExist {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(deletionCount{Count: restored})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// GetReadings handles HTTP requests for readings made by the cores given by
+// the "core" query option, repeated or comma separated, or by all the
+// user's cores with "all_cores=true", between a start and end date.  The
+// user's calibrations are applied unless raw values are requested, and
+// values are converted to the requested or preferred units.  With the
+// "events=true" query option, care events concerning the cores are returned
+// alongside the readings.  Readings are paged, in order of the time they
+// were posted: the "limit" query option gives the most returned, and the
+// "cursor" option the cursor returned by the previous page.  When there are
+// more readings the next page's cursor is returned in the NextCursorHeader
+// and its URL in the Link header.  The "fields" option limits the metrics
+// returned, and "format=columnar" returns each core's readings as columns.
+// Requesting a core the user has posted no readings of is forbidden, while
+// none of the user's readings in the span is not found.
+func GetReadings(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, es models.EventStore, ps models.PlantStore) apollo.Handler {
 	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			http.Error(w, "", http.StatusNotFound)
 			return
 		}
 
-		start, end, core, err := getReadingsParams(ctx, r)
+		email := getEmail(ctx)
+
+		start, end, err := getTimeSpanParams(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		readings, err := s.GetReadings(core, start, end)
+		after, limit, err := getPageParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, _, err := getShapeParams(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cores, err := getCoresParam(s, email, r)
+		if err == errNoCores {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			err = ownCores(s, email, cores)
+		}
+		if err == ErrorCoreForbidden {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// one more than the limit tells whether there's another page
+		readings, err := s.GetReadingsPage(email, cores, start, end, after, limit+1)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -221,16 +476,161 @@ func GetReadings(s models.ReadingStore) apollo.Handler {
 			return
 		}
 
-		w.Header().Add("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(readings)
+		// events are of the span of the page
+		eventsStart, eventsEnd := start, end
+		if !after.Posted.IsZero() {
+			eventsStart = after.Posted
+		}
+
+		if len(readings) > limit {
+			readings = readings[:limit]
+			eventsEnd = readings[limit-1].Posted
+			setNextPage(w, r, models.CursorAt(readings[limit-1]))
+		}
+
+		if err := calibrate(c, r, email, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+
+		if err := convertUnits(preferences, w, r, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeReadings(w, r, readings, func() ([]models.Event, error) {
+			return coresEvents(es, ps, email, cores, eventsStart, eventsEnd)
+		})
 	})
 }
 
+var errNoCores = errors.New("core id missing from query")
+
+// getCoresParam returns the cores given by the "core" query option, repeated
+// or comma separated, or all the user's cores if the "all_cores" option is
+// true.
+func getCoresParam(s models.ReadingStore, userEmail string, r *http.Request) ([]string, error) {
+	if r.FormValue("all_cores") == "true" {
+		return userCores(s, userEmail)
+	}
+
+	r.ParseForm()
+
+	var cores []string
+	seen := make(map[string]bool)
+	for _, value := range r.Form["core"] {
+		for _, core := range strings.Split(value, ",") {
+			if core = strings.TrimSpace(core); core != "" && !seen[core] {
+				seen[core] = true
+				cores = append(cores, core)
+			}
+		}
+	}
+
+	if len(cores) == 0 {
+		return nil, errNoCores
+	}
+
+	return cores, nil
+}
+
+// ownCores returns ErrorCoreForbidden unless the user has posted readings
+// of each of the cores.
+func ownCores(s models.ReadingStore, userEmail string, cores []string) error {
+	for _, core := range cores {
+		owned, err := s.HasReadings(userEmail, core)
+		if err != nil {
+			return err
+		}
+
+		if !owned {
+			return ErrorCoreForbidden
+		}
+	}
+
+	return nil
+}
+
+// getShapeParams parses the optional "fields" and "format" query options,
+// the metrics readings are returned with and whether they're returned as
+// columns.
+func getShapeParams(r *http.Request) (metrics []string, columnar bool, err error) {
+	metrics, err = models.ParseMetrics(r.FormValue("fields"))
+	if err != nil {
+		return
+	}
+
+	switch r.FormValue("format") {
+	case "", "rows":
+	case "columnar":
+		columnar = true
+	default:
+		err = ErrorUnknownFormat
+	}
+
+	return
+}
+
+// getPageParams parses the optional "cursor" and "limit" query options.
+func getPageParams(r *http.Request) (after models.Cursor, limit int, err error) {
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		after, err = models.CursorFromString(cursor)
+		if err != nil {
+			return
+		}
+	}
+
+	limit = maxReadingsLimit
+	if l := r.FormValue("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxReadingsLimit {
+			err = ErrorInvalidLimit
+		}
+	}
+
+	return
+}
+
+// setNextPage sets the headers giving the cursor and URL of the page
+// following the cursor: the request's URL with the cursor replaced.
+func setNextPage(w http.ResponseWriter, r *http.Request, next models.Cursor) {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		u = &url.URL{Path: r.URL.Path}
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", next.Encode())
+	u.RawQuery = query.Encode()
+
+	w.Header().Set(models.NextCursorHeader, next.Encode())
+	w.Header().Set("Link", "<"+u.String()+">; rel=\"next\"")
+}
+
 func getReadingsParams(ctx context.Context, r *http.Request) (start, end time.Time, core string, err error) {
+	start, end, err = getTimeSpanParams(r)
+	if err != nil {
+		return
+	}
+
+	core = r.FormValue("core")
+	if core == "" {
+		err = errors.New("core id missing from query")
+		return
+	}
+
+	return
+}
+
+// getTimeSpanParams parses the required "start" and "end" RFC3339 query
+// options.
+func getTimeSpanParams(r *http.Request) (start, end time.Time, err error) {
 	startDate := r.FormValue("start")
 	if startDate == "" {
 		err = errors.New("start date missing from query")
@@ -249,15 +649,5 @@ func getReadingsParams(ctx context.Context, r *http.Request) (start, end time.Ti
 	}
 
 	end, err = time.Parse(time.RFC3339, endDate)
-	if err != nil {
-		return
-	}
-
-	core = r.FormValue("core")
-	if core == "" {
-		err = errors.New("core id missing from query")
-		return
-	}
-
 	return
 }
@@ -1,13 +1,17 @@
 package routes
 
 import (
+	"bytes"
 	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/bifrost"
 	"github.com/serdmanczyk/freyr/fake"
 	"github.com/serdmanczyk/freyr/models"
 	"golang.org/x/net/context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -53,7 +57,7 @@ func TestPostReading(t *testing.T) {
 		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusCreated, postReadingResp.Code)
 	}
 
-	storedReadings, err := fS.GetReadings(coreid, postTime.Add(time.Second*-1), postTime.Add(time.Second*1))
+	storedReadings, err := fS.GetReadings(userEmail, coreid, postTime.Add(time.Second*-1), postTime.Add(time.Second*1))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -67,6 +71,42 @@ func TestPostReading(t *testing.T) {
 	}
 }
 
+func TestPostReadingUnits(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+	postTime := time.Unix(5, 0).In(time.UTC)
+
+	fS := &fake.ReadingStore{}
+	handler := PostReading(fS)
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+
+	post := func(units string, reading models.Reading) int {
+		req, err := http.NewRequest("POST", "/post_reading?units="+units, strings.NewReader(formData(reading)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+		return resp.Code
+	}
+
+	reading := models.Reading{UserEmail: userEmail, CoreID: coreid, Posted: postTime, Temperature: 212, Humidity: 40}
+	if code := post("temperature:K", reading); code != http.StatusBadRequest {
+		t.Fatalf("Unsupported unit; expected %d, got %d", http.StatusBadRequest, code)
+	}
+
+	if code := post("temperature:F", reading); code != http.StatusCreated {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusCreated, code)
+	}
+
+	stored, _ := fS.GetReadings(userEmail, coreid, postTime, postTime)
+	if len(stored) != 1 || stored[0].Temperature != 100 || stored[0].Humidity != 40 {
+		t.Fatalf("Expected reading stored in canonical units, got %v", stored)
+	}
+}
+
 func TestGetReadings(t *testing.T) {
 	userEmail := "johndoe@stupidname.com"
 	coreid := "78348972452498"
@@ -97,7 +137,7 @@ func TestGetReadings(t *testing.T) {
 	getReadingsResp := httptest.NewRecorder()
 
 	emailCtx := context.WithValue(context.Background(), "email", userEmail)
-	handler := GetReadings(fS)
+	handler := GetReadings(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{})
 	handler.ServeHTTP(emailCtx, getReadingsResp, getReadingsReq)
 
 	var retReadings []models.Reading
@@ -115,3 +155,623 @@ func TestGetReadings(t *testing.T) {
 		t.Fatalf("Unexpected number of readings returned; expected 100 got %d", len(retReadings))
 	}
 }
+
+func TestGetReadingsPages(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	fS := &fake.ReadingStore{}
+	for i := 0; i < 25; i++ {
+		if err := fS.StoreReading(fake.RandReading(userEmail, coreid, start.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := GetReadings(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{})
+
+	query := url.Values{}
+	query.Add("start", start.Format(time.RFC3339))
+	query.Add("end", start.Add(time.Hour).Format(time.RFC3339))
+	query.Add("core", coreid)
+	query.Add("limit", "10")
+	next := "/readings?" + query.Encode()
+
+	var walked []models.Reading
+	for pages := 0; next != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("Expected 3 pages, still paging at %s", next)
+		}
+
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		var readings []models.Reading
+		if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+			t.Fatal(err)
+		}
+		walked = append(walked, readings...)
+
+		next = ""
+		if link := resp.Header().Get("Link"); link != "" {
+			if !strings.HasSuffix(link, `>; rel="next"`) {
+				t.Fatalf("Malformed Link header: %s", link)
+			}
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+
+			if cursor := resp.Header().Get(models.NextCursorHeader); !strings.Contains(next, "cursor="+cursor) {
+				t.Fatalf("Link %s doesn't give next cursor %s", next, cursor)
+			}
+		}
+	}
+
+	if len(walked) != 25 {
+		t.Fatalf("Expected 25 readings over all pages, got %d", len(walked))
+	}
+
+	for i, r := range walked {
+		if expected := start.Add(time.Duration(i) * time.Minute); !r.Posted.Equal(expected) {
+			t.Fatalf("Reading %d out of order; posted %s expected %s", i, r.Posted, expected)
+		}
+	}
+
+	for _, bad := range []url.Values{{"limit": {"0"}}, {"limit": {"10001"}}, {"cursor": {"notacursor"}}} {
+		badQuery := url.Values{}
+		for k, v := range query {
+			badQuery[k] = v
+		}
+		for k, v := range bad {
+			badQuery[k] = v
+		}
+
+		req, err := http.NewRequest("GET", "/readings?"+badQuery.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%v: incorrect response code; expected %d, got %d", bad, http.StatusBadRequest, resp.Code)
+		}
+	}
+}
+
+func TestGetReadingsCores(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	fS := &fake.ReadingStore{}
+	for _, core := range []string{"one", "two", "three"} {
+		for i := 0; i < 3; i++ {
+			if err := fS.StoreReading(fake.RandReading(userEmail, core, start.Add(time.Duration(i)*time.Minute))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	handler := apollo.New(withEmail(userEmail)).Then(
+		GetReadings(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{}))
+
+	get := func(options url.Values) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Add("start", start.Format(time.RFC3339))
+		query.Add("end", start.Add(time.Hour).Format(time.RFC3339))
+		for k, v := range options {
+			query[k] = v
+		}
+
+		req, err := http.NewRequest("GET", "/readings?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// cores repeated or comma separated, in time then core order
+	resp := get(url.Values{"core": {"two,one"}})
+	var readings []models.Reading
+	if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readings) != 6 || readings[0].CoreID != "one" || readings[1].CoreID != "two" {
+		t.Fatalf("Expected readings of cores one and two in order, got %v", readings)
+	}
+
+	// projected
+	resp = get(url.Values{"core": {"one", "three"}, "fields": {"light,temperature"}})
+	var projected []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&projected); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(projected) != 6 {
+		t.Fatalf("Expected 6 readings, got %d", len(projected))
+	}
+
+	for _, p := range projected {
+		if _, ok := p["humidity"]; ok || p["light"] == nil || p["temperature"] == nil {
+			t.Fatalf("Reading not projected to light and temperature: %v", p)
+		}
+	}
+
+	// all cores as columns
+	resp = get(url.Values{"all_cores": {"true"}, "format": {"columnar"}, "fields": {"moisture"}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var columns readingColumns
+	if err := json.NewDecoder(resp.Body).Decode(&columns); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(columns.Cores) != 3 {
+		t.Fatalf("Expected columns of 3 cores, got %v", columns.Cores)
+	}
+
+	for _, c := range columns.Cores {
+		if len(c.Timestamps) != 3 || len(c.Values) != 1 || len(c.Values["moisture"]) != 3 {
+			t.Fatalf("Expected 3 timestamps and moisture values for core %s, got %v", c.CoreID, c)
+		}
+
+		if c.Timestamps[1]-c.Timestamps[0] != int64(time.Minute/time.Millisecond) {
+			t.Fatalf("Timestamps not in milliseconds: %v", c.Timestamps)
+		}
+	}
+
+	for _, bad := range []url.Values{
+		{},
+		{"core": {"one"}, "fields": {"wind"}},
+		{"core": {"one"}, "format": {"xml"}},
+	} {
+		if resp := get(bad); resp.Code != http.StatusBadRequest {
+			t.Fatalf("%v: incorrect response code; expected %d, got %d", bad, http.StatusBadRequest, resp.Code)
+		}
+	}
+}
+
+func TestReadingsOwnership(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	otherEmail := "janedoe@stupidname.com"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	fS := &fake.ReadingStore{}
+	for _, reading := range []models.Reading{
+		fake.RandReading(userEmail, "mine", start),
+		fake.RandReading(otherEmail, "mine", start.Add(time.Minute)),
+		fake.RandReading(otherEmail, "theirs", start),
+	} {
+		if err := fS.StoreReading(reading); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getHandler := apollo.New(withEmail(userEmail)).Then(
+		GetReadings(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{}))
+	deleteHandler := apollo.New(withEmail(userEmail)).Then(DeleteReadings(fS))
+
+	request := func(handler http.Handler, method, core string, end time.Time) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Add("core", core)
+		query.Add("start", start.Format(time.RFC3339))
+		query.Add("end", end.Format(time.RFC3339))
+
+		req, err := http.NewRequest(method, "/readings?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for _, tc := range []struct {
+		handler http.Handler
+		method  string
+		core    string
+		end     time.Time
+		code    int
+	}{
+		// only the user's own readings of a core are returned
+		{getHandler, "GET", "mine", start.Add(time.Hour), http.StatusOK},
+		// cores the user has no readings of are forbidden
+		{getHandler, "GET", "theirs", start.Add(time.Hour), http.StatusForbidden},
+		{getHandler, "GET", "unknown", start.Add(time.Hour), http.StatusForbidden},
+		// the user's core without readings in the span is not found
+		{getHandler, "GET", "mine", start.Add(-time.Second), http.StatusNotFound},
+		{deleteHandler, "DELETE", "theirs", start.Add(time.Hour), http.StatusForbidden},
+		{deleteHandler, "DELETE", "mine", start.Add(time.Hour), http.StatusOK},
+	} {
+		resp := request(tc.handler, tc.method, tc.core, tc.end)
+		if resp.Code != tc.code {
+			t.Fatalf("%s of core %s to %s; expected %d, got %d", tc.method, tc.core, tc.end, tc.code, resp.Code)
+		}
+
+		if tc.method == "GET" && tc.code == http.StatusOK {
+			var readings []models.Reading
+			if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(readings) != 1 || readings[0].UserEmail != userEmail {
+				t.Fatalf("Expected only the user's reading, got %v", readings)
+			}
+		}
+	}
+
+	// deletes leave other users' readings of the same core
+	for _, email := range []string{otherEmail, userEmail} {
+		readings, err := fS.GetReadings(email, "mine", start, start.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := map[string]int{otherEmail: 1, userEmail: 0}[email]; len(readings) != expected {
+			t.Fatalf("Expected %d readings of %s, got %v", expected, email, readings)
+		}
+	}
+
+	readings, _ := fS.GetReadings(otherEmail, "theirs", start, start.Add(time.Hour))
+	if len(readings) != 1 {
+		t.Fatalf("Another user's core was deleted: %v", readings)
+	}
+}
+
+func TestDeleteReadingsUndo(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+	start := time.Date(2016, time.May, 12, 0, 0, 0, 0, time.UTC)
+
+	fS := &fake.ReadingStore{}
+	for i := 0; i < 4; i++ {
+		if err := fS.StoreReading(fake.RandReading(userEmail, coreid, start.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleteHandler := apollo.New(withEmail(userEmail)).Then(DeleteReadings(fS))
+	undoHandler := apollo.New(withEmail(userEmail)).Then(UndoDeleteReadings(fS))
+
+	deleteReadings := func(dryRun bool, response interface{}) {
+		query := url.Values{}
+		query.Add("core", coreid)
+		query.Add("start", start.Format(time.RFC3339))
+		query.Add("end", start.Add(time.Minute*2).Format(time.RFC3339))
+		if dryRun {
+			query.Add("dry_run", "true")
+		}
+
+		req, err := http.NewRequest("DELETE", "/delete_readings?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		deleteHandler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	undo := func(id string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/undo_delete_readings?id="+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		undoHandler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	remaining := func() int {
+		count, _ := fS.CountReadings(userEmail, coreid, start, start.Add(time.Hour))
+		return count
+	}
+
+	var count deletionCount
+	deleteReadings(true, &count)
+	if count.Count != 3 || remaining() != 4 {
+		t.Fatalf("Dry run should count 3 readings and delete none; counted %d, %d remain", count.Count, remaining())
+	}
+
+	var deletion readingDeletion
+	deleteReadings(false, &deletion)
+	if deletion.Count != 3 || remaining() != 1 {
+		t.Fatalf("Expected 3 readings deleted; deleted %d, %d remain", deletion.Count, remaining())
+	}
+
+	if !deletion.PurgeAfter.Equal(deletion.Deleted.Add(models.DeletionGracePeriod)) {
+		t.Fatalf("Expected purge %s after deletion at %s, got %s", models.DeletionGracePeriod, deletion.Deleted, deletion.PurgeAfter)
+	}
+
+	id := strconv.FormatInt(deletion.ID, 10)
+	resp := undo(id)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count.Count != 3 || remaining() != 4 {
+		t.Fatalf("Expected 3 readings restored; restored %d, %d remain", count.Count, remaining())
+	}
+
+	if resp := undo(id); resp.Code != http.StatusNotFound {
+		t.Fatalf("Undoing twice; expected %d, got %d", http.StatusNotFound, resp.Code)
+	}
+
+	if resp := undo("bogus"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("Undoing invalid id; expected %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+}
+
+func TestPostReadingDuplicate(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+
+	postTime := time.Unix(5, 0).In(time.UTC)
+	reading := fake.RandReading(userEmail, coreid, postTime)
+	conflicting := reading
+	conflicting.Temperature += 5
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := PostReading(fS)
+
+	for _, tc := range []struct {
+		reading models.Reading
+		code    int
+	}{
+		{reading: reading, code: http.StatusCreated},
+		{reading: reading, code: http.StatusOK},
+		{reading: conflicting, code: http.StatusConflict},
+	} {
+		req, err := http.NewRequest("POST", "/post_reading", strings.NewReader(formData(tc.reading)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.ParseForm()
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("Incorrect response code; expected %d, got %d", tc.code, resp.Code)
+		}
+
+		if tc.code != http.StatusConflict {
+			continue
+		}
+
+		var stored models.Reading
+		if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+			t.Fatal(err)
+		}
+
+		if !stored.Compare(reading) {
+			t.Fatalf("Conflict should return stored reading; expected %v, got %v", reading, stored)
+		}
+	}
+}
+
+func TestPostReadingsIdempotent(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	ledger := NewJobLedger(bifrost.NewWorkerDispatcher(bifrost.Workers(1)))
+	handler := PostReadings(ledger, fS)
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+
+	start := time.Unix(5, 0).In(time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Minute)
+	var readings []models.Reading
+	for i := 0; i < 10; i++ {
+		readings = append(readings, readingGen())
+	}
+
+	post := func(key string, readings []models.Reading) uint {
+		body, err := json.Marshal(readings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/readings", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusAccepted, resp.Code)
+		}
+
+		jobID, err := strconv.ParseUint(resp.Body.String(), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job, _, err := ledger.JobStatus(userEmail, uint(jobID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-job.Done()
+
+		return uint(jobID)
+	}
+
+	first := post("batch-one", readings)
+	if replayed := post("batch-one", readings); replayed != first {
+		t.Fatalf("Retried request should return original job %d, got %d", first, replayed)
+	}
+
+	second := post("batch-two", readings[:5])
+	if second == first {
+		t.Fatal("Request with new idempotency key should queue a new job")
+	}
+
+	for jobID, expected := range map[uint]PostReadingsResult{
+		first:  {Stored: 10},
+		second: {Duplicates: 5},
+	} {
+		_, result, err := ledger.JobStatus(userEmail, jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := result.(*PostReadingsResult)
+		if !ok {
+			t.Fatalf("Unexpected result for job %d: %v", jobID, result)
+		}
+
+		if *got != expected {
+			t.Fatalf("Incorrect result for job %d; expected %v, got %v", jobID, expected, *got)
+		}
+	}
+}
+
+func TestGetReadingsCalibrated(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	fC := &fake.CalibrationStore{}
+
+	posted := time.Unix(50, 0).In(time.UTC)
+	reading := fake.RandReading(userEmail, coreid, posted)
+	reading.Moisture = 2000
+	if err := fS.StoreReading(reading); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := fC.StoreCalibration(models.Calibration{
+		UserEmail: userEmail,
+		CoreID:    coreid,
+		Metric:    "moisture",
+		Kind:      models.CalibrationLinear,
+		Scale:     0.01,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := GetReadings(fS, fC, fake.PreferenceStore{}, &fake.EventStore{}, &fake.PlantStore{})
+
+	for _, tc := range []struct {
+		raw      string
+		moisture float64
+	}{
+		{raw: "", moisture: 20},
+		{raw: "true", moisture: 2000},
+	} {
+		query := url.Values{}
+		query.Add("start", posted.Add(-time.Second).Format(time.RFC3339))
+		query.Add("end", posted.Add(time.Second).Format(time.RFC3339))
+		query.Add("core", coreid)
+		query.Add("raw", tc.raw)
+
+		req, err := http.NewRequest("GET", "/readings?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		var readings []models.Reading
+		if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(readings) != 1 || readings[0].Moisture != tc.moisture {
+			t.Fatalf("raw=%q: expected moisture %g, got %v", tc.raw, tc.moisture, readings)
+		}
+	}
+}
+
+func TestGetLatestReadingsUnits(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	fP := fake.PreferenceStore{}
+
+	reading := fake.RandReading(userEmail, coreid, time.Unix(50, 0).In(time.UTC))
+	reading.Temperature = 20
+	reading.Light = 25000
+	if err := fS.StoreReading(reading); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fP.StorePreferences(userEmail, models.Preferences{Units: models.Units{"temperature": models.Fahrenheit}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+	handler := GetLatestReadings(fS, &fake.CalibrationStore{}, fP, &fake.DeviceStore{})
+
+	for _, tc := range []struct {
+		units              string
+		temperature, light float64
+	}{
+		{units: "", temperature: 68, light: 25000},
+		{units: "temperature:C,light:percent", temperature: 20, light: 25},
+	} {
+		req, err := http.NewRequest("GET", "/latest?units="+url.QueryEscape(tc.units), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+		}
+
+		var readings []models.Reading
+		if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(readings) != 1 || readings[0].Temperature != tc.temperature || readings[0].Light != tc.light {
+			t.Fatalf("units=%q: expected temperature %g and light %g, got %v", tc.units, tc.temperature, tc.light, readings)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"time"
+)
+
+// Report handles HTTP requests for a report of gaps, spikes and flatlines in
+// a core's readings between a start and end date.  Gaps are measured against
+// the "cadence" query option, a duration such as "10m", falling back to the
+// core's reporting interval and then the typical time between its readings.
+// Values are calibrated and converted as they would be by GetReadings.
+func Report(s models.ReadingStore, c models.CalibrationStore, p models.PreferenceStore, d models.DeviceStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		start, end, core, err := getReadingsParams(ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var opts models.ReportOptions
+		if cadence := r.FormValue("cadence"); cadence != "" {
+			opts.Cadence, err = time.ParseDuration(cadence)
+			if err != nil || opts.Cadence <= 0 {
+				http.Error(w, "cadence must be a positive duration", http.StatusBadRequest)
+				return
+			}
+		} else {
+			devices, err := d.GetDevices(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			for _, device := range devices {
+				if device.CoreID == core {
+					opts.Cadence = device.ReportingInterval
+				}
+			}
+		}
+
+		readings, err := s.GetReadings(email, core, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := calibrate(c, r, email, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		preferences, err := p.GetPreferences(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := convertUnits(preferences, w, r, readings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(models.AnalyzeReadings(core, start, end, readings, opts))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+	coreid := "78348972452498"
+
+	fS := &fake.ReadingStore{}
+	fD := &fake.DeviceStore{}
+
+	// hourly readings for a day, then nothing for the last six hours
+	start := time.Date(2016, 5, 10, 0, 0, 0, 0, time.UTC)
+	readingGen := fake.ReadingGen(userEmail, coreid, start, time.Hour)
+	for i := 0; i < 18; i++ {
+		if err := fS.StoreReading(readingGen()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fD.SeeDevice(userEmail, coreid, start); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fD.SetReportingInterval(userEmail, coreid, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := Report(fS, &fake.CalibrationStore{}, fake.PreferenceStore{}, fD)
+	emailCtx := context.WithValue(context.Background(), "email", userEmail)
+
+	for _, tc := range []struct {
+		cadence string
+		code    int
+		gaps    int
+	}{
+		{cadence: "", code: http.StatusOK, gaps: 1},
+		{cadence: "4h", code: http.StatusOK, gaps: 0},
+		{cadence: "-1h", code: http.StatusBadRequest},
+	} {
+		query := url.Values{}
+		query.Add("start", start.Add(-time.Second).Format(time.RFC3339))
+		query.Add("end", start.Add(time.Hour*24).Format(time.RFC3339))
+		query.Add("core", coreid)
+		query.Add("cadence", tc.cadence)
+
+		req, err := http.NewRequest("GET", "/report?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(emailCtx, resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("cadence %q: expected %d, got %d", tc.cadence, tc.code, resp.Code)
+		}
+
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var report models.Report
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+
+		var gaps int
+		for _, f := range report.Findings {
+			if f.Kind == models.FindingGap {
+				gaps++
+			}
+		}
+
+		if report.Readings != 18 || gaps != tc.gaps {
+			t.Fatalf("cadence %q: expected 18 readings and %d gaps, got %d and %d", tc.cadence, tc.gaps, report.Readings, gaps)
+		}
+	}
+}
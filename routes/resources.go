@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Subresources routes requests for /{collection}/{id}/{resource}, such as
+// /devices/{core}/battery, to the handler for the resource.  Handlers get
+// the ID from the path with resourceID.
+func Subresources(collection string, resources map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != collection || parts[1] == "" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		handler, ok := resources[parts[2]]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// resourceID returns the ID from a /{collection}/{id}/{resource} path.
+func resourceID(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[1]
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+// Rules handles HTTP requests to list a user's automation rules (GET), add
+// or update a rule (POST) or delete the rule given by the "id" query option
+// (DELETE).
+func Rules(rs models.RuleStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			rules, err := rs.GetRules(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if rules == nil {
+				rules = []models.Rule{}
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(rules)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var rule models.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			rule.UserEmail = email
+			rule.LastFired = nil
+			if err := rule.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			created := rule.ID == 0
+			id, err := rs.StoreRule(rule)
+			if err == models.ErrorRuleDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rule.ID = id
+
+			writeStored(w, created, rule)
+		case "DELETE":
+			deleteByID(w, r, "rule", models.ErrorRuleDoesntExist, func(id int64) error {
+				return rs.DeleteRule(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// RuleExecutions handles HTTP requests, at /rules/{id}/executions, for the
+// history of a rule's executions, most recent first.
+func RuleExecutions(rs models.RuleStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		id, err := strconv.ParseInt(resourceID(r), 10, 64)
+		if err != nil {
+			http.Error(w, models.ErrorRuleDoesntExist.Error(), http.StatusNotFound)
+			return
+		}
+
+		rules, err := rs.GetRules(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		exists := false
+		for _, rule := range rules {
+			exists = exists || rule.ID == id
+		}
+
+		if !exists {
+			http.Error(w, models.ErrorRuleDoesntExist.Error(), http.StatusNotFound)
+			return
+		}
+
+		executions, err := rs.GetExecutions(email, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if executions == nil {
+			executions = []models.Execution{}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(executions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRules(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	rs := &fake.RuleStore{}
+	handler := apollo.New(withEmail(userEmail)).Then(Rules(rs))
+	executions := Subresources("rules", map[string]http.Handler{
+		"executions": apollo.New(withEmail(userEmail)).Then(RuleExecutions(rs)),
+	})
+
+	do := func(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	rule := `{"name": "water when dry", "coreid": "core", "enabled": true, "cooldown": "30m",
+		"conditions": [{"metric": "moisture", "compare": "<", "value": 30}],
+		"quiet": [{"kind": "watering", "period": "6h"}],
+		"action": {"kind": "command", "command": "water", "argument": "20s"}}`
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{rule, http.StatusCreated},
+		{`{"name": "no conditions", "coreid": "core", "action": {"kind": "webhook", "url": "https://example.com"}}`, http.StatusBadRequest},
+		{`{"name": "bad cooldown", "cooldown": "soon"}`, http.StatusBadRequest},
+		{`{"id": 42, "name": "missing", "coreid": "core", "conditions": [{"metric": "moisture", "compare": "<", "value": 30}],
+			"action": {"kind": "webhook", "url": "https://example.com"}}`, http.StatusNotFound},
+	} {
+		if resp := do(handler, "POST", "/rules", tc.body); resp.Code != tc.code {
+			t.Fatalf("Storing %s: expected %d, got %d", tc.body, tc.code, resp.Code)
+		}
+	}
+
+	resp := do(handler, "GET", "/rules", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var rules []models.Rule
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 1 || rules[0].Cooldown != time.Minute*30 || rules[0].UserEmail != userEmail {
+		t.Fatalf("Unexpected rules %v", rules)
+	}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	if err := rs.StoreExecution(models.Execution{RuleID: rules[0].ID, UserEmail: userEmail, CoreID: "core", Triggered: now, Reading: now, Result: models.ExecutionFired}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/rules/1/executions", http.StatusOK},
+		{"/rules/2/executions", http.StatusNotFound},
+		{"/rules/one/executions", http.StatusNotFound},
+	} {
+		if resp := do(executions, "GET", tc.path, ""); resp.Code != tc.code {
+			t.Fatalf("Getting %s: expected %d, got %d", tc.path, tc.code, resp.Code)
+		}
+	}
+
+	resp = do(executions, "GET", "/rules/1/executions", "")
+	var history []models.Execution
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 1 || history[0].Result != models.ExecutionFired {
+		t.Fatalf("Unexpected executions %v", history)
+	}
+
+	if resp := do(handler, "DELETE", "/rules?id=1", ""); resp.Code != http.StatusNoContent {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	if resp := do(handler, "GET", "/rules", ""); resp.Body.String() != "[]\n" {
+		t.Fatalf("Expected no rules after delete, got %s", resp.Body.String())
+	}
+}
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/scheduler"
+	"golang.org/x/net/context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Tasks handles HTTP requests to list the scheduler's tasks and their run
+// state (GET) or to run the task named by the "name" query option now
+// (POST).  Triggered runs are queued as jobs and the job ID returned.
+func Tasks(sch *scheduler.Scheduler, l *JobLedger) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		states, err := sch.Tasks(time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(states)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			name := r.FormValue("name")
+
+			var registered bool
+			for _, state := range states {
+				registered = registered || state.Name == name
+			}
+
+			if !registered {
+				http.Error(w, models.ErrorTaskDoesntExist.Error(), http.StatusNotFound)
+				return
+			}
+
+			job, _ := l.Queue(getEmail(ctx), "", nil, func() error {
+				return sch.Trigger(name, time.Now())
+			})
+			log.Printf("Queued Job %d to run task %s\n", job.ID(), name)
+
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(strconv.FormatUint(uint64(job.ID()), 10)))
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
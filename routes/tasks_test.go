@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/bifrost"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"github.com/serdmanczyk/freyr/scheduler"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTasks(t *testing.T) {
+	dispatcher := bifrost.NewWorkerDispatcher(bifrost.Workers(1))
+	defer dispatcher.Stop()
+
+	ran := make(chan struct{}, 1)
+	sch := scheduler.New(&fake.TaskStore{})
+	sch.Register("retention", scheduler.Every(time.Hour), func(now time.Time) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	handler := Tasks(sch, NewJobLedger(dispatcher))
+	ctx := context.WithValue(context.Background(), "email", "odin@asgard.unv")
+
+	req, err := http.NewRequest("GET", "/tasks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(ctx, resp, req)
+
+	var states []models.TaskState
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 || states[0].Name != "retention" {
+		t.Fatalf("Unexpected tasks %v", states)
+	}
+
+	for _, tc := range []struct {
+		name string
+		code int
+	}{
+		{name: "retention", code: http.StatusAccepted},
+		{name: "weekly", code: http.StatusNotFound},
+	} {
+		req, err := http.NewRequest("POST", "/tasks?name="+tc.name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(ctx, resp, req)
+
+		if resp.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.code, resp.Code)
+		}
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Triggered task didn't run")
+	}
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhooks handles HTTP requests to list a user's webhook subscriptions
+// with their last delivery attempt (GET), add or update a subscription
+// (POST) or delete the subscription given by the "id" query option
+// (DELETE).
+func Webhooks(ws models.WebhookStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		email := getEmail(ctx)
+
+		switch r.Method {
+		case "GET":
+			subscriptions, err := ws.GetSubscriptions(email)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if subscriptions == nil {
+				subscriptions = []models.Subscription{}
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(subscriptions)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case "POST":
+			var subscription models.Subscription
+			if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			subscription.UserEmail = email
+			subscription.LastAttempt, subscription.LastStatusCode = nil, 0
+			if err := subscription.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			created := subscription.ID == 0
+			if created {
+				subscription.Created = time.Now()
+			}
+
+			id, err := ws.StoreSubscription(subscription)
+			if err == models.ErrorSubscriptionDoesntExist {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			subscription.ID = id
+
+			writeStored(w, created, subscription)
+		case "DELETE":
+			deleteByID(w, r, "webhook", models.ErrorSubscriptionDoesntExist, func(id int64) error {
+				return ws.DeleteSubscription(email, id)
+			})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+}
+
+// WebhookDeliveries handles HTTP requests, at /webhooks/{id}/deliveries,
+// for the log of deliveries to a subscription, most recent first.
+func WebhookDeliveries(ws models.WebhookStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		email := getEmail(ctx)
+
+		id, err := strconv.ParseInt(resourceID(r), 10, 64)
+		if err != nil {
+			http.Error(w, models.ErrorSubscriptionDoesntExist.Error(), http.StatusNotFound)
+			return
+		}
+
+		subscriptions, err := ws.GetSubscriptions(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		exists := false
+		for _, s := range subscriptions {
+			exists = exists || s.ID == id
+		}
+
+		if !exists {
+			http.Error(w, models.ErrorSubscriptionDoesntExist.Error(), http.StatusNotFound)
+			return
+		}
+
+		deliveries, err := ws.GetDeliveries(email, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []models.Delivery{}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(deliveries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	ws := &fake.WebhookStore{}
+	handler := apollo.New(withEmail(userEmail)).Then(Webhooks(ws))
+	deliveries := Subresources("webhooks", map[string]http.Handler{
+		"deliveries": apollo.New(withEmail(userEmail)).Then(WebhookDeliveries(ws)),
+	})
+
+	do := func(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"url": "https://example.com/hook", "events": ["reading", "alert"], "coreid": "core"}`, http.StatusCreated},
+		{`{"url": "https://example.com/hook", "events": ["watering"]}`, http.StatusBadRequest},
+		{`{"url": "mailto:john@example.com", "events": ["alert"]}`, http.StatusBadRequest},
+		{`{"url": "https://example.com/hook"`, http.StatusBadRequest},
+		{`{"id": 42, "url": "https://example.com/hook", "events": ["alert"]}`, http.StatusNotFound},
+	} {
+		if resp := do(handler, "POST", "/webhooks", tc.body); resp.Code != tc.code {
+			t.Fatalf("Storing %s: expected %d, got %d", tc.body, tc.code, resp.Code)
+		}
+	}
+
+	resp := do(handler, "GET", "/webhooks", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var subscriptions []models.Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&subscriptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subscriptions) != 1 || subscriptions[0].UserEmail != userEmail || subscriptions[0].Created.IsZero() {
+		t.Fatalf("Unexpected subscriptions %v", subscriptions)
+	}
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	d := models.Delivery{SubscriptionID: subscriptions[0].ID, UserEmail: userEmail, Event: models.WebhookAlert,
+		Payload: json.RawMessage(`{}`), State: models.DeliveryPending, Created: now, NextAttempt: now}
+	d.Attempted(now, http.StatusInternalServerError, nil)
+	if _, err := ws.StoreDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/webhooks/1/deliveries", http.StatusOK},
+		{"/webhooks/2/deliveries", http.StatusNotFound},
+		{"/webhooks/one/deliveries", http.StatusNotFound},
+	} {
+		if resp := do(deliveries, "GET", tc.path, ""); resp.Code != tc.code {
+			t.Fatalf("Getting %s: expected %d, got %d", tc.path, tc.code, resp.Code)
+		}
+	}
+
+	resp = do(deliveries, "GET", "/webhooks/1/deliveries", "")
+	var log []models.Delivery
+	if err := json.NewDecoder(resp.Body).Decode(&log); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log) != 1 || log[0].StatusCode != http.StatusInternalServerError || log[0].State != models.DeliveryPending {
+		t.Fatalf("Unexpected deliveries %v", log)
+	}
+
+	resp = do(handler, "GET", "/webhooks", "")
+	if err := json.NewDecoder(resp.Body).Decode(&subscriptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if subscriptions[0].LastStatusCode != http.StatusInternalServerError || subscriptions[0].LastAttempt == nil {
+		t.Fatalf("Expected last attempt on subscription, got %v", subscriptions[0])
+	}
+
+	if resp := do(handler, "DELETE", "/webhooks?id=1", ""); resp.Code != http.StatusNoContent {
+		t.Fatalf("Incorrect response code; expected %d, got %d", http.StatusNoContent, resp.Code)
+	}
+
+	if resp := do(handler, "GET", "/webhooks", ""); resp.Body.String() != "[]\n" {
+		t.Fatalf("Expected no webhooks after delete, got %s", resp.Body.String())
+	}
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/lineprotocol"
+	"github.com/serdmanczyk/freyr/models"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxWriteBatch is the largest line protocol batch accepted, uncompressed.
+const maxWriteBatch = 5 << 20
+
+// Write handles HTTP requests writing a batch of points in InfluxDB line
+// protocol, as InfluxDB's /write endpoint does, storing them as readings.
+// Points are attributed to the core given by the "coreid" query option, or
+// else by the tags named by the comma separated "core_tag" option, or else
+// by one of lineprotocol.DefaultCoreTags.  Points of the same core and time
+// are merged into one reading, as are points within the "window" option,
+// e.g. "window=10s", of a reading's first point.  Readings must give every
+// metric; those a device doesn't measure, e.g. moisture, light and battery
+// of a Tasmota or ESPHome temperature and humidity sensor, are given by the
+// "fill" option, e.g. "fill=moisture:0,light:0,battery:100".  Batches with
+// incomplete readings are rejected.  The "precision" option gives the
+// precision of timestamps, and the "units" option any non-canonical units
+// values, including those filled, are in, as in PostReading.  Errors are
+// reported as InfluxDB does, as JSON objects with an "error" message.
+func Write(s models.ReadingStore) apollo.Handler {
+	return apollo.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeLineProtocolError(w, http.StatusBadRequest, err)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+
+		batch, err := ioutil.ReadAll(io.LimitReader(body, maxWriteBatch+1))
+		if err != nil {
+			writeLineProtocolError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if len(batch) > maxWriteBatch {
+			writeLineProtocolError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("batch exceeds %d bytes", maxWriteBatch))
+			return
+		}
+
+		query := r.URL.Query()
+		points, err := lineprotocol.Parse(batch, query.Get("precision"), time.Now())
+		if err != nil {
+			writeLineProtocolError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		mapping := lineprotocol.Mapping{CoreID: r.FormValue("coreid")}
+		if tags := query.Get("core_tag"); tags != "" {
+			mapping.CoreTags = strings.Split(tags, ",")
+		}
+
+		if window := query.Get("window"); window != "" {
+			mapping.Window, err = time.ParseDuration(window)
+			if err != nil || mapping.Window < 0 {
+				writeLineProtocolError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", window))
+				return
+			}
+		}
+
+		mapping.Fill, err = lineprotocol.ParseFill(query.Get("fill"))
+		if err != nil {
+			writeLineProtocolError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		readings, err := mapping.Readings(getEmail(ctx), points)
+		if err != nil {
+			writeLineProtocolError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		units, err := declaredUnits(r)
+		if err != nil {
+			writeLineProtocolError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		for i, reading := range readings {
+			readings[i] = units.Canonical(reading)
+		}
+
+		result := PostReadingsResult{}
+		for _, reading := range readings {
+			err := s.StoreReading(reading)
+			if _, ok := err.(models.ReadingConflictError); ok {
+				result.Conflicts++
+				continue
+			}
+
+			switch err {
+			case nil:
+				result.Stored++
+			case models.ErrorReadingExists:
+				result.Duplicates++
+			case models.ErrorReadingQuarantined:
+				result.Quarantined++
+			default:
+				writeLineProtocolError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		if result.Conflicts > 0 {
+			writeLineProtocolError(w, http.StatusBadRequest,
+				fmt.Errorf("partial write: %d readings conflict with those already stored", result.Conflicts))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func writeLineProtocolError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", err.Error())
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
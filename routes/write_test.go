@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/cyclopsci/apollo"
+	"github.com/serdmanczyk/freyr/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	s := &fake.ReadingStore{}
+	handler := apollo.New(withEmail(userEmail)).Then(Write(s))
+
+	write := func(path, batch string, gzipped bool) *httptest.ResponseRecorder {
+		body := bytes.NewBufferString(batch)
+		if gzipped {
+			body = &bytes.Buffer{}
+			gz := gzip.NewWriter(body)
+			gz.Write([]byte(batch))
+			gz.Close()
+		}
+
+		req, err := http.NewRequest("POST", path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// the metrics every reading must give besides its temperature
+	rest := ",humidity=50,moisture=40,light=300,battery=90"
+	batch := "sensors,device=garden temperature=21.5,humidity=60,light=300,battery=90 1462867200\n" +
+		"moisture,device=garden value=41 1462867200\n" +
+		"sensors,device=greenhouse temperature=25" + rest + " 1462867200\n"
+
+	for _, tc := range []struct {
+		path    string
+		batch   string
+		gzipped bool
+		code    int
+	}{
+		{"/write?precision=s", batch, false, http.StatusNoContent},
+		{"/write?precision=s", batch, true, http.StatusNoContent},
+		{"/write?precision=s&coreid=porch", "sensors temperature=3" + rest + " 1462867200", false, http.StatusNoContent},
+		{"/write?precision=s&core_tag=room", "sensors,room=shed temperature=4" + rest + " 1462867200", false, http.StatusNoContent},
+		{"/write?precision=s", "sensors temperature=3" + rest + " 1462867200", false, http.StatusBadRequest},
+		{"/write?precision=s", "sensors,device=garden temperature=30" + rest + " 1462867200", false, http.StatusBadRequest},
+		{"/write?precision=s", "temperature,device=garden value=21 1462867260", false, http.StatusBadRequest},
+		{"/write", "sensors,device=garden temperature=", false, http.StatusBadRequest},
+		{"/write?precision=fortnight", batch, false, http.StatusBadRequest},
+	} {
+		resp := write(tc.path, tc.batch, tc.gzipped)
+		if resp.Code != tc.code {
+			t.Fatalf("Writing %q to %s: expected %d, got %d: %s", tc.batch, tc.path, tc.code, resp.Code, resp.Body.String())
+		}
+
+		if tc.code != http.StatusNoContent && !strings.Contains(resp.Body.String(), `"error"`) {
+			t.Fatalf("Expected InfluxDB style error, got %s", resp.Body.String())
+		}
+	}
+
+	latest, err := s.GetLatestReadings(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cores := make(map[string]float64)
+	for _, r := range latest {
+		cores[r.CoreID] = r.Temperature
+		if !r.Posted.Equal(time.Unix(1462867200, 0)) {
+			t.Errorf("Unexpected time %s for %s", r.Posted, r.CoreID)
+		}
+	}
+
+	if len(latest) != 4 || cores["garden"] != 21.5 || cores["porch"] != 3 || cores["shed"] != 4 {
+		t.Fatalf("Unexpected readings stored %v", latest)
+	}
+
+	garden, _ := s.GetReadings(userEmail, "garden", time.Unix(1462867199, 0), time.Unix(1462867201, 0))
+	if len(garden) != 1 || garden[0].Moisture != 41 || garden[0].Humidity != 60 {
+		t.Fatalf("Expected garden points merged into one reading, got %v", garden)
+	}
+
+	if resp := write("/write", "", false); resp.Code != http.StatusNoContent {
+		t.Fatalf("Expected empty batch accepted, got %d", resp.Code)
+	}
+}
+
+func TestWriteWindowFill(t *testing.T) {
+	userEmail := "johndoe@stupidname.com"
+
+	s := &fake.ReadingStore{}
+	handler := apollo.New(withEmail(userEmail)).Then(Write(s))
+
+	// a Tasmota sensor's temperature and humidity, two seconds apart
+	batch := "temperature,device=porch value=70 1462867200\n" +
+		"humidity,device=porch value=60 1462867202\n"
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"window=10s", http.StatusBadRequest},
+		{"fill=moisture:0,light:0,battery:100", http.StatusBadRequest},
+		{"window=-1s&fill=moisture:0,light:0,battery:100", http.StatusBadRequest},
+		{"window=10s&fill=moisture:zero", http.StatusBadRequest},
+		{"window=10s&fill=soil:0", http.StatusBadRequest},
+		{"window=10s&fill=moisture:0,light:0,battery:100&units=temperature:F", http.StatusNoContent},
+	} {
+		req, err := http.NewRequest("POST", "/write?precision=s&"+tc.query, strings.NewReader(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != tc.code {
+			t.Fatalf("Writing with %s: expected %d, got %d: %s", tc.query, tc.code, resp.Code, resp.Body.String())
+		}
+	}
+
+	porch, _ := s.GetReadings(userEmail, "porch", time.Unix(1462867199, 0), time.Unix(1462867203, 0))
+	if len(porch) != 1 || !porch[0].Posted.Equal(time.Unix(1462867200, 0)) || porch[0].Humidity != 60 ||
+		porch[0].Battery != 100 || porch[0].Temperature < 21.1 || porch[0].Temperature > 21.2 {
+		t.Fatalf("Expected points merged into one filled reading in Celsius, got %v", porch)
+	}
+}
@@ -0,0 +1,239 @@
+// Package scheduler runs registered background tasks periodically, keeping
+// their run state in a models.TaskStore so that, with several instances of
+// the server sharing one store, each run happens on only one of them.
+package scheduler
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/models"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Schedule determines when a task next runs after a given time.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Every is a Schedule running a task at multiples of its duration since the
+// zero time, e.g. on the hour for time.Hour.
+type Every time.Duration
+
+// Next returns the first multiple of the duration after t.
+func (e Every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// TaskFunc performs a task's work as of now.
+type TaskFunc func(now time.Time) error
+
+type task struct {
+	schedule Schedule
+	run      TaskFunc
+}
+
+// Scheduler runs registered tasks when they are due.  Running tasks are
+// locked in the store for at most the lock duration, after which another
+// instance may assume the run failed and run the task again.
+type Scheduler struct {
+	store models.TaskStore
+	owner string
+	lease time.Duration
+	lock  sync.Mutex
+	tasks map[string]task
+}
+
+// Option is a functional option for configuring a Scheduler.
+type Option func(*Scheduler)
+
+// Owner sets the name the scheduler locks tasks under, by default the host
+// name and process ID.
+func Owner(owner string) Option {
+	return func(s *Scheduler) {
+		s.owner = owner
+	}
+}
+
+// Lease sets how long tasks are locked for while running, by default an
+// hour.
+func Lease(lease time.Duration) Option {
+	return func(s *Scheduler) {
+		s.lease = lease
+	}
+}
+
+// New returns a new *Scheduler keeping task state in the given store.
+func New(store models.TaskStore, opts ...Option) *Scheduler {
+	hostname, _ := os.Hostname()
+
+	s := &Scheduler{
+		store: store,
+		owner: fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		lease: time.Hour,
+		tasks: make(map[string]task),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Register adds a task to run on the given schedule.  Registering a task
+// under an existing name replaces it.
+func (s *Scheduler) Register(name string, schedule Schedule, run TaskFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tasks[name] = task{schedule: schedule, run: run}
+}
+
+// Tasks returns the state of every registered task ordered by name.  Tasks
+// that haven't been scheduled in the store yet are reported as next running
+// per their schedule.
+func (s *Scheduler) Tasks(now time.Time) ([]models.TaskState, error) {
+	stored, err := s.store.GetTaskStates()
+	if err != nil {
+		return nil, err
+	}
+
+	persisted := make(map[string]models.TaskState, len(stored))
+	for _, state := range stored {
+		persisted[state.Name] = state
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	states := make([]models.TaskState, 0, len(s.tasks))
+	for name, t := range s.tasks {
+		state, ok := persisted[name]
+		if !ok {
+			state = models.TaskState{Name: name, NextRun: t.schedule.Next(now)}
+		}
+		states = append(states, state)
+	}
+
+	sort.Sort(byName(states))
+	return states, nil
+}
+
+// RunDue claims every registered task due as of now that isn't locked and
+// runs each in its own goroutine, so a slow task doesn't hold up others.
+// The returned channel is closed once the tasks started complete.
+func (s *Scheduler) RunDue(now time.Time) <-chan struct{} {
+	s.lock.Lock()
+	tasks := make(map[string]task, len(s.tasks))
+	for name, t := range s.tasks {
+		tasks[name] = t
+	}
+	s.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for name, t := range tasks {
+		if err := s.store.ScheduleTask(name, t.schedule.Next(now)); err != nil {
+			log.Printf("Error scheduling task %s: %s", name, err)
+			continue
+		}
+
+		claimed, err := s.store.ClaimTask(name, s.owner, now, s.lease, false)
+		if err != nil {
+			log.Printf("Error claiming task %s: %s", name, err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, t task) {
+			defer wg.Done()
+
+			if err := s.execute(name, t, now); err != nil {
+				log.Printf("Error running task %s: %s", name, err)
+			}
+		}(name, t)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// Trigger runs the named task now regardless of its schedule, returning the
+// task's error.  ErrorTaskRunning is returned if the task is locked.
+func (s *Scheduler) Trigger(name string, now time.Time) error {
+	s.lock.Lock()
+	t, ok := s.tasks[name]
+	s.lock.Unlock()
+
+	if !ok {
+		return models.ErrorTaskDoesntExist
+	}
+
+	if err := s.store.ScheduleTask(name, t.schedule.Next(now)); err != nil {
+		return err
+	}
+
+	ran, err := s.run(name, t, now, true)
+	if err == nil && !ran {
+		return models.ErrorTaskRunning
+	}
+
+	return err
+}
+
+// Start runs due tasks every interval until stop is closed.
+func (s *Scheduler) Start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.RunDue(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// run claims and, if claimed, runs the task.  It returns whether the task
+// ran and the task's error.
+func (s *Scheduler) run(name string, t task, now time.Time, force bool) (bool, error) {
+	claimed, err := s.store.ClaimTask(name, s.owner, now, s.lease, force)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	return true, s.execute(name, t, now)
+}
+
+// execute runs a claimed task then records its outcome, returning the
+// task's error.
+func (s *Scheduler) execute(name string, t task, now time.Time) error {
+	log.Printf("Running task %s", name)
+	runErr := t.run(now)
+
+	if err := s.store.CompleteTask(name, s.owner, now, runErr, t.schedule.Next(now)); err != nil {
+		log.Printf("Error recording run of task %s: %s", name, err)
+	}
+
+	return runErr
+}
+
+type byName []models.TaskState
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
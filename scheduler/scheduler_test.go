@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"errors"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunDue(t *testing.T) {
+	store := &fake.TaskStore{}
+	start := time.Date(2016, 5, 10, 0, 30, 0, 0, time.UTC)
+
+	var lock sync.Mutex
+	var runs []time.Time
+	taskErr := errors.New("Oops")
+
+	// two instances sharing a store should run each due task once
+	var schedulers []*Scheduler
+	for _, owner := range []string{"one", "two"} {
+		s := New(store, Owner(owner))
+		s.Register("hourly", Every(time.Hour), func(now time.Time) error {
+			lock.Lock()
+			defer lock.Unlock()
+			runs = append(runs, now)
+			return taskErr
+		})
+		schedulers = append(schedulers, s)
+	}
+
+	for _, now := range []time.Time{
+		start,
+		start.Add(time.Minute * 20),
+		start.Add(time.Minute * 40),
+		start.Add(time.Minute * 50),
+	} {
+		var wg sync.WaitGroup
+		for _, s := range schedulers {
+			wg.Add(1)
+			go func(s *Scheduler) {
+				defer wg.Done()
+				<-s.RunDue(now)
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	if len(runs) != 1 || !runs[0].Equal(start.Add(time.Minute*40)) {
+		t.Fatalf("Expected a single run at 01:10, got %v", runs)
+	}
+
+	states, err := schedulers[0].Tasks(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 {
+		t.Fatalf("Expected 1 task, got %d", len(states))
+	}
+
+	state := states[0]
+	if !state.NextRun.Equal(start.Add(time.Minute*90)) || state.LastError != taskErr.Error() || state.Locked(start) {
+		t.Fatalf("Unexpected task state %v", state)
+	}
+}
+
+func TestRunDueConcurrently(t *testing.T) {
+	s := New(&fake.TaskStore{})
+	start := time.Date(2016, 5, 10, 0, 30, 0, 0, time.UTC)
+
+	release := make(chan struct{})
+	s.Register("slow", Every(time.Minute), func(now time.Time) error {
+		<-release
+		return nil
+	})
+
+	fast := make(chan time.Time, 2)
+	s.Register("fast", Every(time.Minute), func(now time.Time) error {
+		fast <- now
+		return nil
+	})
+
+	// tasks are scheduled on the first tick, and run from the next
+	<-s.RunDue(start)
+
+	var done []<-chan struct{}
+	for i := 1; i <= 2; i++ {
+		now := start.Add(time.Minute * time.Duration(i))
+		done = append(done, s.RunDue(now))
+
+		select {
+		case ran := <-fast:
+			if !ran.Equal(now) {
+				t.Fatalf("Expected fast task run at %s, got %s", now, ran)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Fast task held up by the slow task")
+		}
+	}
+
+	close(release)
+	for _, d := range done {
+		<-d
+	}
+
+	states, err := s.Tasks(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range states {
+		if state.Locked(start) {
+			t.Fatalf("Expected tasks complete, got %v", state)
+		}
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	store := &fake.TaskStore{}
+	now := time.Date(2016, 5, 10, 0, 30, 0, 0, time.UTC)
+
+	s := New(store)
+	ran := make(chan struct{})
+	release := make(chan struct{})
+	s.Register("daily", Every(time.Hour*24), func(now time.Time) error {
+		ran <- struct{}{}
+		<-release
+		return nil
+	})
+
+	if err := s.Trigger("weekly", now); err != models.ErrorTaskDoesntExist {
+		t.Fatalf("Expected ErrorTaskDoesntExist, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- s.Trigger("daily", now)
+	}()
+	<-ran
+
+	if err := s.Trigger("daily", now); err != models.ErrorTaskRunning {
+		t.Fatalf("Expected ErrorTaskRunning, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := s.Tasks(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !states[0].LastRun.Equal(now) {
+		t.Fatalf("Expected last run at %s, got %s", now, states[0].LastRun)
+	}
+}
@@ -0,0 +1,864 @@
+// Package storetest is a conformance suite for implementations of
+// models.ReadingStore, models.UserStore, models.SecretStore and
+// models.AccountStore, verifying
+// they behave alike whatever holds their data: Postgres, SQLite or memory.
+package storetest
+
+import (
+	"fmt"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Stores are the stores under test.  As in the database, a user is stored
+// before their readings and secret.  Accounts deletes from the other stores.
+type Stores struct {
+	Readings models.ReadingStore
+	Users    models.UserStore
+	Secrets  models.SecretStore
+	Accounts models.AccountStore
+}
+
+// Test runs the suite against stores returned by newStores, which is called
+// for each test.  Each test uses users and cores of its own, so stores may be
+// shared between tests, and with data already stored.
+func Test(t *testing.T, newStores func() Stores) {
+	tests := []struct {
+		name string
+		test func(*testing.T, fixture)
+	}{
+		{"StoreUser", testStoreUser},
+		{"StoreUserTwice", testStoreUserTwice},
+		{"GetMissingUser", testGetMissingUser},
+		{"StoreSecret", testStoreSecret},
+		{"ReplaceSecret", testReplaceSecret},
+		{"GetMissingSecret", testGetMissingSecret},
+		{"StoreReading", testStoreReading},
+		{"StoreReadingTwice", testStoreReadingTwice},
+		{"StoreConflictingReading", testStoreConflictingReading},
+		{"StoreReadingOtherUser", testStoreReadingOtherUser},
+		{"GetReadingsInclusive", testGetReadingsInclusive},
+		{"GetReadingsOrdered", testGetReadingsOrdered},
+		{"GetReadingsEmpty", testGetReadingsEmpty},
+		{"GetReadingsOtherUser", testGetReadingsOtherUser},
+		{"GetReadingsPages", testGetReadingsPages},
+		{"GetReadingsPageBounds", testGetReadingsPageBounds},
+		{"GetReadingsPageCores", testGetReadingsPageCores},
+		{"GetLatestReadings", testGetLatestReadings},
+		{"GetLatestReadingsEmpty", testGetLatestReadingsEmpty},
+		{"DeleteReadingsInclusive", testDeleteReadingsInclusive},
+		{"DeleteReadingsOtherUser", testDeleteReadingsOtherUser},
+		{"DeleteReadingsEmpty", testDeleteReadingsEmpty},
+		{"HasReadings", testHasReadings},
+		{"CountReadings", testCountReadings},
+		{"UndoDeletion", testUndoDeletion},
+		{"UndoDeletionOtherUser", testUndoDeletionOtherUser},
+		{"PurgeDeletions", testPurgeDeletions},
+		{"DeleteAccount", testDeleteAccount},
+		{"DeleteMissingAccount", testDeleteMissingAccount},
+	}
+
+	for i, tt := range tests {
+		f := newFixture(newStores(), i)
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, f)
+		})
+	}
+}
+
+// run distinguishes the users and cores of one run of the suite from those
+// of previous runs against the same database.
+var run = time.Now().UnixNano()
+
+// fixture holds the stores under test and the names of the users and cores
+// a test may use.
+type fixture struct {
+	Stores
+	email, otherEmail string
+	core, otherCore   string
+}
+
+func newFixture(s Stores, test int) fixture {
+	return fixture{
+		Stores:     s,
+		email:      fmt.Sprintf("amypond.%d.%d@leadworth.co.uk", run, test),
+		otherEmail: fmt.Sprintf("rorywilliams.%d.%d@leadworth.co.uk", run, test),
+		core:       fmt.Sprintf("pandorica-%d-%d", run, test),
+		otherCore:  fmt.Sprintf("tardis-%d-%d", run, test),
+	}
+}
+
+// epoch is the time readings are posted from, in a zone other than UTC to
+// verify stores compare times rather than their representations.
+var epoch = time.Date(2016, time.May, 12, 6, 30, 15, 0, time.FixedZone("CDT", -5*60*60))
+
+func testUser(email string) models.User {
+	return models.User{
+		Email:      email,
+		Name:       "Amelia Pond",
+		GivenName:  "Amelia",
+		FamilyName: "Pond",
+		Gender:     "female",
+		Locale:     "gb",
+	}
+}
+
+func (f fixture) storeUsers(t *testing.T, emails ...string) {
+	for _, email := range emails {
+		if err := f.Users.StoreUser(testUser(email)); err != nil {
+			t.Fatalf("Failed storing user %s: %s", email, err)
+		}
+	}
+}
+
+func (f fixture) storeReadings(t *testing.T, readings ...models.Reading) {
+	for _, r := range readings {
+		if err := f.Readings.StoreReading(r); err != nil {
+			t.Fatalf("Failed storing reading %v: %s", r, err)
+		}
+	}
+}
+
+func (f fixture) getReadings(t *testing.T, email, core string, start, end time.Time) []models.Reading {
+	readings, err := f.Readings.GetReadings(email, core, start, end)
+	if err != nil {
+		t.Fatalf("Failed getting readings: %s", err)
+	}
+
+	return readings
+}
+
+// sameReadings returns true if both hold the same readings in the same
+// order.
+func sameReadings(a, b []models.Reading) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Compare(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameReadingsUnordered returns true if both hold the same readings, in any
+// order.
+func sameReadingsUnordered(a, b []models.Reading) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	matched := make([]bool, len(b))
+	for _, ra := range a {
+		found := false
+		for j, rb := range b {
+			if !matched[j] && ra.Compare(rb) {
+				matched[j], found = true, true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testStoreUser(t *testing.T, f fixture) {
+	user := testUser(f.email)
+	f.storeUsers(t, f.email)
+
+	stored, err := f.Users.GetUser(f.email)
+	if err != nil {
+		t.Fatalf("Failed getting user: %s", err)
+	}
+
+	if !reflect.DeepEqual(user, stored) {
+		t.Fatalf("User did not match stored; got %v expected %v", stored, user)
+	}
+}
+
+func testStoreUserTwice(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	changed := testUser(f.email)
+	changed.Name = "Amelia Williams"
+	if err := f.Users.StoreUser(changed); err != models.ErrorUserAlreadyExists {
+		t.Fatalf("Incorrect error storing user twice; expected %v got %v", models.ErrorUserAlreadyExists, err)
+	}
+
+	stored, err := f.Users.GetUser(f.email)
+	if err != nil {
+		t.Fatalf("Failed getting user: %s", err)
+	}
+
+	if stored.Name != testUser(f.email).Name {
+		t.Fatalf("User stored twice was changed; got %v", stored)
+	}
+}
+
+func testGetMissingUser(t *testing.T, f fixture) {
+	f.storeUsers(t, f.otherEmail)
+
+	if _, err := f.Users.GetUser(f.email); err != models.ErrorUserDoesntExist {
+		t.Fatalf("Incorrect error getting missing user; expected %v got %v", models.ErrorUserDoesntExist, err)
+	}
+}
+
+func (f fixture) storeSecret(t *testing.T, email string) models.Secret {
+	secret, err := models.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Secrets.StoreSecret(email, secret); err != nil {
+		t.Fatalf("Failed storing secret: %s", err)
+	}
+
+	return secret
+}
+
+func (f fixture) checkSecret(t *testing.T, email string, expected models.Secret) {
+	stored, err := f.Secrets.GetSecret(email)
+	if err != nil {
+		t.Fatalf("Failed getting secret: %s", err)
+	}
+
+	if stored.Encode() != expected.Encode() {
+		t.Fatalf("Secret did not match stored; got %s expected %s", stored.Encode(), expected.Encode())
+	}
+}
+
+func testStoreSecret(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	secret := f.storeSecret(t, f.email)
+	other := f.storeSecret(t, f.otherEmail)
+
+	f.checkSecret(t, f.email, secret)
+	f.checkSecret(t, f.otherEmail, other)
+}
+
+func testReplaceSecret(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	f.storeSecret(t, f.email)
+	replaced := f.storeSecret(t, f.email)
+
+	f.checkSecret(t, f.email, replaced)
+}
+
+func testGetMissingSecret(t *testing.T, f fixture) {
+	if _, err := f.Secrets.GetSecret(f.email); err != models.ErrorSecretDoesntExist {
+		t.Fatalf("Incorrect error getting secret of missing user; expected %v got %v", models.ErrorSecretDoesntExist, err)
+	}
+
+	f.storeUsers(t, f.email)
+
+	if _, err := f.Secrets.GetSecret(f.email); err != models.ErrorSecretDoesntExist {
+		t.Fatalf("Incorrect error getting missing secret; expected %v got %v", models.ErrorSecretDoesntExist, err)
+	}
+}
+
+func testStoreReading(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	reading := fake.RandReading(f.email, f.core, epoch)
+	f.storeReadings(t, reading)
+
+	readings := f.getReadings(t, f.email, f.core, epoch, epoch)
+	if !sameReadings(readings, []models.Reading{reading}) {
+		t.Fatalf("Readings did not match stored; got %v expected %v", readings, reading)
+	}
+}
+
+func testStoreReadingTwice(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	reading := fake.RandReading(f.email, f.core, epoch)
+	f.storeReadings(t, reading)
+
+	// the same time in another zone is the same reading
+	again := reading
+	again.Posted = reading.Posted.UTC()
+	if err := f.Readings.StoreReading(again); err != models.ErrorReadingExists {
+		t.Fatalf("Incorrect error storing reading twice; expected %v got %v", models.ErrorReadingExists, err)
+	}
+
+	if readings := f.getReadings(t, f.email, f.core, epoch, epoch); len(readings) != 1 {
+		t.Fatalf("Reading stored twice; got %v", readings)
+	}
+}
+
+func testStoreConflictingReading(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	reading := fake.RandReading(f.email, f.core, epoch)
+	f.storeReadings(t, reading)
+
+	conflicting := reading
+	conflicting.Temperature++
+
+	err := f.Readings.StoreReading(conflicting)
+	conflict, ok := err.(models.ReadingConflictError)
+	if !ok {
+		t.Fatalf("Incorrect error storing conflicting reading; expected a conflict got %v", err)
+	}
+
+	if !conflict.Stored.Compare(reading) {
+		t.Fatalf("Conflict did not hold stored reading; got %v expected %v", conflict.Stored, reading)
+	}
+
+	readings := f.getReadings(t, f.email, f.core, epoch, epoch)
+	if !sameReadings(readings, []models.Reading{reading}) {
+		t.Fatalf("Conflicting reading replaced stored; got %v expected %v", readings, reading)
+	}
+}
+
+func testStoreReadingOtherUser(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	// readings are unique by user, core and time
+	readings := []models.Reading{
+		fake.RandReading(f.email, f.core, epoch),
+		fake.RandReading(f.otherEmail, f.core, epoch),
+	}
+	f.storeReadings(t, readings...)
+
+	for _, reading := range readings {
+		stored := f.getReadings(t, reading.UserEmail, f.core, epoch, epoch)
+		if !sameReadings(stored, []models.Reading{reading}) {
+			t.Fatalf("Readings did not match stored; got %v expected %v", stored, reading)
+		}
+	}
+}
+
+func testGetReadingsOtherUser(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+	f.storeReadings(t, fake.RandReading(f.otherEmail, f.core, epoch))
+
+	if readings := f.getReadings(t, f.email, f.core, epoch, epoch); len(readings) != 0 {
+		t.Fatalf("Got readings of another user: %v", readings)
+	}
+
+	readings, err := f.Readings.GetReadingsPage(f.email, []string{f.core}, epoch, epoch, models.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Failed getting readings page: %s", err)
+	}
+
+	if len(readings) != 0 {
+		t.Fatalf("Got page of another user's readings: %v", readings)
+	}
+}
+
+func testGetReadingsInclusive(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	start, end := epoch, epoch.Add(time.Hour)
+	within := []models.Reading{
+		fake.RandReading(f.email, f.core, start),
+		fake.RandReading(f.email, f.core, start.Add(time.Minute*30)),
+		fake.RandReading(f.email, f.core, end),
+	}
+	f.storeReadings(t, within...)
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, start.Add(-time.Second)),
+		fake.RandReading(f.email, f.core, end.Add(time.Second)),
+		fake.RandReading(f.email, f.otherCore, start.Add(time.Minute)),
+	)
+
+	readings := f.getReadings(t, f.email, f.core, start.UTC(), end.UTC())
+	if !sameReadings(readings, within) {
+		t.Fatalf("Readings did not match those within span; got %v expected %v", readings, within)
+	}
+}
+
+func testGetReadingsOrdered(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	var readings []models.Reading
+	for _, offset := range []time.Duration{time.Hour * 3, 0, time.Hour * 26, time.Minute, time.Hour} {
+		readings = append(readings, fake.RandReading(f.email, f.core, epoch.Add(offset)))
+	}
+	f.storeReadings(t, readings...)
+
+	models.SortReadings(readings)
+
+	stored := f.getReadings(t, f.email, f.core, epoch, epoch.Add(time.Hour*48))
+	if !sameReadings(stored, readings) {
+		t.Fatalf("Readings not in time order; got %v expected %v", stored, readings)
+	}
+}
+
+func testGetReadingsEmpty(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+	f.storeReadings(t, fake.RandReading(f.email, f.core, epoch))
+
+	if readings := f.getReadings(t, f.email, f.otherCore, epoch, epoch.Add(time.Hour)); len(readings) != 0 {
+		t.Fatalf("Got readings of core without any: %v", readings)
+	}
+
+	if readings := f.getReadings(t, f.email, f.core, epoch.Add(time.Second), epoch.Add(time.Hour)); len(readings) != 0 {
+		t.Fatalf("Got readings outside span: %v", readings)
+	}
+
+	// spans ending before they start are empty
+	if readings := f.getReadings(t, f.email, f.core, epoch.Add(time.Hour), epoch.Add(-time.Hour)); len(readings) != 0 {
+		t.Fatalf("Got readings of reversed span: %v", readings)
+	}
+}
+
+func testGetReadingsPages(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	// readings of another user at the same times aren't paged
+	for _, offset := range []time.Duration{time.Hour, 0, time.Minute * 2, time.Minute, time.Minute * 3} {
+		f.storeReadings(t,
+			fake.RandReading(f.otherEmail, f.core, epoch.Add(offset)),
+			fake.RandReading(f.email, f.core, epoch.Add(offset)),
+		)
+	}
+
+	start, end := epoch, epoch.Add(time.Hour)
+	all := f.getReadings(t, f.email, f.core, start, end)
+	if len(all) != 5 {
+		t.Fatalf("Got %d readings; expected 5", len(all))
+	}
+
+	var walked []models.Reading
+	var cursor models.Cursor
+	for page := 0; ; page++ {
+		readings, err := f.Readings.GetReadingsPage(f.email, []string{f.core}, start, end, cursor, 3)
+		if err != nil {
+			t.Fatalf("Failed getting readings page: %s", err)
+		}
+
+		if len(readings) > 3 {
+			t.Fatalf("Page %d exceeded limit; got %d readings", page, len(readings))
+		}
+
+		if len(readings) == 0 {
+			break
+		}
+
+		walked = append(walked, readings...)
+		cursor = models.CursorAt(readings[len(readings)-1])
+	}
+
+	if !sameReadings(walked, all) {
+		t.Fatalf("Pages did not hold readings in order; got %v expected %v", walked, all)
+	}
+
+	for i := 1; i < len(walked); i++ {
+		if !models.CursorAt(walked[i-1]).Precedes(walked[i]) {
+			t.Fatalf("Readings not in cursor order; %v before %v", walked[i-1], walked[i])
+		}
+	}
+}
+
+func testGetReadingsPageBounds(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	start, end := epoch, epoch.Add(time.Hour)
+	within := []models.Reading{
+		fake.RandReading(f.email, f.core, start),
+		fake.RandReading(f.email, f.core, end),
+	}
+	f.storeReadings(t, within...)
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, start.Add(-time.Second)),
+		fake.RandReading(f.email, f.core, end.Add(time.Second)),
+	)
+
+	readings, err := f.Readings.GetReadingsPage(f.email, []string{f.core}, start.UTC(), end.UTC(), models.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Failed getting readings page: %s", err)
+	}
+
+	if !sameReadings(readings, within) {
+		t.Fatalf("Page did not match readings within span; got %v expected %v", readings, within)
+	}
+
+	// the cursor is exclusive
+	readings, err = f.Readings.GetReadingsPage(f.email, []string{f.core}, start, end, models.CursorAt(within[1]), 10)
+	if err != nil {
+		t.Fatalf("Failed getting readings page: %s", err)
+	}
+
+	if len(readings) != 0 {
+		t.Fatalf("Got readings following last reading: %v", readings)
+	}
+}
+
+func testGetReadingsPageCores(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	// readings of both cores at the same times are ordered by core
+	var expected []models.Reading
+	for _, offset := range []time.Duration{0, time.Minute, time.Hour} {
+		expected = append(expected,
+			fake.RandReading(f.email, f.core, epoch.Add(offset)),
+			fake.RandReading(f.email, f.otherCore, epoch.Add(offset)),
+		)
+	}
+	f.storeReadings(t, expected...)
+	f.storeReadings(t, fake.RandReading(f.email, f.core+"-unasked", epoch))
+
+	if f.otherCore < f.core {
+		for i := 0; i < len(expected); i += 2 {
+			expected[i], expected[i+1] = expected[i+1], expected[i]
+		}
+	}
+
+	cores := []string{f.core, f.otherCore}
+	readings, err := f.Readings.GetReadingsPage(f.email, cores, epoch, epoch.Add(time.Hour), models.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Failed getting readings page: %s", err)
+	}
+
+	if !sameReadings(readings, expected) {
+		t.Fatalf("Page did not hold readings of cores in order; got %v expected %v", readings, expected)
+	}
+
+	// a cursor between the cores' readings at the same time
+	readings, err = f.Readings.GetReadingsPage(f.email, cores, epoch, epoch.Add(time.Hour), models.CursorAt(expected[2]), 2)
+	if err != nil {
+		t.Fatalf("Failed getting readings page: %s", err)
+	}
+
+	if !sameReadings(readings, expected[3:5]) {
+		t.Fatalf("Page did not follow cursor; got %v expected %v", readings, expected[3:5])
+	}
+
+	readings, err = f.Readings.GetReadingsPage(f.email, nil, epoch, epoch.Add(time.Hour), models.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Failed getting readings page of no cores: %s", err)
+	}
+
+	if len(readings) != 0 {
+		t.Fatalf("Got readings of no cores: %v", readings)
+	}
+}
+
+func testGetLatestReadings(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	latest := []models.Reading{
+		fake.RandReading(f.email, f.core, epoch.Add(time.Hour)),
+		fake.RandReading(f.email, f.otherCore, epoch.Add(time.Minute)),
+	}
+	f.storeReadings(t, latest...)
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, epoch),
+		fake.RandReading(f.email, f.otherCore, epoch),
+		fake.RandReading(f.otherEmail, f.otherCore+"-other", epoch.Add(time.Hour*2)),
+	)
+
+	readings, err := f.Readings.GetLatestReadings(f.email)
+	if err != nil {
+		t.Fatalf("Failed getting latest readings: %s", err)
+	}
+
+	if !sameReadingsUnordered(readings, latest) {
+		t.Fatalf("Latest readings did not match; got %v expected %v", readings, latest)
+	}
+}
+
+func testGetLatestReadingsEmpty(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+	f.storeReadings(t, fake.RandReading(f.otherEmail, f.core, epoch))
+
+	readings, err := f.Readings.GetLatestReadings(f.email)
+	if err != nil {
+		t.Fatalf("Failed getting latest readings: %s", err)
+	}
+
+	if len(readings) != 0 {
+		t.Fatalf("Got latest readings of user without any: %v", readings)
+	}
+}
+
+func testDeleteReadingsInclusive(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	start, end := epoch, epoch.Add(time.Hour)
+	kept := []models.Reading{
+		fake.RandReading(f.email, f.core, start.Add(-time.Second)),
+		fake.RandReading(f.email, f.core, end.Add(time.Second)),
+	}
+	f.storeReadings(t, kept...)
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, start),
+		fake.RandReading(f.email, f.core, start.Add(time.Minute*30)),
+		fake.RandReading(f.email, f.core, end),
+	)
+
+	other := fake.RandReading(f.email, f.otherCore, start.Add(time.Minute))
+	f.storeReadings(t, other)
+
+	deletion, err := f.Readings.DeleteReadings(f.email, f.core, start.UTC(), end.UTC())
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	if deletion.Count != 3 {
+		t.Fatalf("Deletion counted %d readings; expected 3", deletion.Count)
+	}
+
+	readings := f.getReadings(t, f.email, f.core, start.Add(-time.Hour), end.Add(time.Hour))
+	if !sameReadings(readings, kept) {
+		t.Fatalf("Readings remaining did not match those outside span; got %v expected %v", readings, kept)
+	}
+
+	readings = f.getReadings(t, f.email, f.otherCore, start, end)
+	if !sameReadings(readings, []models.Reading{other}) {
+		t.Fatalf("Readings of other core were deleted; got %v expected %v", readings, other)
+	}
+
+	// deleted readings may be stored again
+	f.storeReadings(t, fake.RandReading(f.email, f.core, start))
+}
+
+func testDeleteReadingsOtherUser(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	other := fake.RandReading(f.otherEmail, f.core, epoch)
+	f.storeReadings(t, other)
+
+	if _, err := f.Readings.DeleteReadings(f.email, f.core, epoch, epoch); err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	readings := f.getReadings(t, f.otherEmail, f.core, epoch, epoch)
+	if !sameReadings(readings, []models.Reading{other}) {
+		t.Fatalf("Readings of another user were deleted; got %v expected %v", readings, other)
+	}
+}
+
+func testDeleteReadingsEmpty(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	deletion, err := f.Readings.DeleteReadings(f.email, f.core, epoch, epoch.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed deleting readings of core without any: %s", err)
+	}
+
+	if deletion.Count != 0 {
+		t.Fatalf("Deletion counted %d readings of core without any", deletion.Count)
+	}
+}
+
+func testHasReadings(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+	f.storeReadings(t, fake.RandReading(f.otherEmail, f.core, epoch))
+
+	for _, core := range []string{f.core, f.otherCore} {
+		has, err := f.Readings.HasReadings(f.email, core)
+		if err != nil {
+			t.Fatalf("Failed checking readings: %s", err)
+		}
+
+		if has {
+			t.Fatalf("User has no readings of %s; another user's readings counted", core)
+		}
+	}
+
+	f.storeReadings(t, fake.RandReading(f.email, f.core, epoch))
+	if has, err := f.Readings.HasReadings(f.email, f.core); err != nil || !has {
+		t.Fatalf("Expected user to have readings of %s, got %t (%v)", f.core, has, err)
+	}
+}
+
+func testCountReadings(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+
+	start, end := epoch, epoch.Add(time.Hour)
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, start),
+		fake.RandReading(f.email, f.core, end),
+		fake.RandReading(f.email, f.core, end.Add(time.Second)),
+		fake.RandReading(f.email, f.otherCore, start),
+		fake.RandReading(f.otherEmail, f.core, start.Add(time.Minute)),
+	)
+
+	count, err := f.Readings.CountReadings(f.email, f.core, start.UTC(), end.UTC())
+	if err != nil {
+		t.Fatalf("Failed counting readings: %s", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("Counted %d readings; expected 2", count)
+	}
+
+	// counting deletes nothing
+	if readings := f.getReadings(t, f.email, f.core, start, end); len(readings) != 2 {
+		t.Fatalf("Counting changed readings: %v", readings)
+	}
+}
+
+func testUndoDeletion(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	deleted := []models.Reading{
+		fake.RandReading(f.email, f.core, epoch),
+		fake.RandReading(f.email, f.core, epoch.Add(time.Minute)),
+		fake.RandReading(f.email, f.core, epoch.Add(time.Hour)),
+	}
+	f.storeReadings(t, deleted...)
+
+	deletion, err := f.Readings.DeleteReadings(f.email, f.core, epoch, epoch.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	// readings stored again since the deletion are kept over those deleted
+	again := fake.RandReading(f.email, f.core, epoch.Add(time.Minute))
+	f.storeReadings(t, again)
+
+	restored, err := f.Readings.UndoDeletion(f.email, deletion.ID)
+	if err != nil {
+		t.Fatalf("Failed undoing deletion: %s", err)
+	}
+
+	if restored != 2 {
+		t.Fatalf("Restored %d readings; expected 2", restored)
+	}
+
+	expected := []models.Reading{deleted[0], again, deleted[2]}
+	readings := f.getReadings(t, f.email, f.core, epoch, epoch.Add(time.Hour))
+	if !sameReadings(readings, expected) {
+		t.Fatalf("Readings did not match restored; got %v expected %v", readings, expected)
+	}
+
+	if _, err := f.Readings.UndoDeletion(f.email, deletion.ID); err != models.ErrorDeletionDoesntExist {
+		t.Fatalf("Expected error undoing deletion twice, got %v", err)
+	}
+}
+
+func testUndoDeletionOtherUser(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+	f.storeReadings(t, fake.RandReading(f.otherEmail, f.core, epoch))
+
+	deletion, err := f.Readings.DeleteReadings(f.otherEmail, f.core, epoch, epoch)
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	if _, err := f.Readings.UndoDeletion(f.email, deletion.ID); err != models.ErrorDeletionDoesntExist {
+		t.Fatalf("Expected error undoing another user's deletion, got %v", err)
+	}
+
+	if readings := f.getReadings(t, f.otherEmail, f.core, epoch, epoch); len(readings) != 0 {
+		t.Fatalf("Another user's deletion was undone: %v", readings)
+	}
+}
+
+func testPurgeDeletions(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email)
+
+	reading := fake.RandReading(f.email, f.core, epoch)
+	f.storeReadings(t, reading)
+
+	deletion, err := f.Readings.DeleteReadings(f.email, f.core, epoch, epoch)
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	// deletions made since aren't purged
+	if _, err := f.Readings.PurgeDeletions(deletion.Deleted.Add(-time.Second)); err != nil {
+		t.Fatalf("Failed purging deletions: %s", err)
+	}
+
+	if restored, err := f.Readings.UndoDeletion(f.email, deletion.ID); err != nil || restored != 1 {
+		t.Fatalf("Expected deletion before purge to be undone, restored %d: %v", restored, err)
+	}
+
+	deletion, err = f.Readings.DeleteReadings(f.email, f.core, epoch, epoch)
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	purged, err := f.Readings.PurgeDeletions(deletion.Deleted.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Failed purging deletions: %s", err)
+	}
+
+	if purged < 1 {
+		t.Fatalf("Purged %d deletions; expected the deletion purged", purged)
+	}
+
+	if _, err := f.Readings.UndoDeletion(f.email, deletion.ID); err != models.ErrorDeletionDoesntExist {
+		t.Fatalf("Expected error undoing purged deletion, got %v", err)
+	}
+
+	if readings := f.getReadings(t, f.email, f.core, epoch, epoch); len(readings) != 0 {
+		t.Fatalf("Purged readings were restored: %v", readings)
+	}
+}
+
+func testDeleteAccount(t *testing.T, f fixture) {
+	f.storeUsers(t, f.email, f.otherEmail)
+	f.storeSecret(t, f.email)
+	other := f.storeSecret(t, f.otherEmail)
+
+	f.storeReadings(t,
+		fake.RandReading(f.email, f.core, epoch),
+		fake.RandReading(f.email, f.otherCore, epoch),
+		fake.RandReading(f.email, f.core, epoch.Add(time.Minute)),
+	)
+	otherReading := fake.RandReading(f.otherEmail, f.core, epoch)
+	f.storeReadings(t, otherReading)
+
+	deletion, err := f.Readings.DeleteReadings(f.email, f.core, epoch.Add(time.Minute), epoch.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed deleting readings: %s", err)
+	}
+
+	if err := f.Accounts.DeleteAccount(f.email); err != nil {
+		t.Fatalf("Failed deleting account: %s", err)
+	}
+
+	if _, err := f.Users.GetUser(f.email); err != models.ErrorUserDoesntExist {
+		t.Fatalf("Expected deleted account's user not to exist, got %v", err)
+	}
+
+	if _, err := f.Secrets.GetSecret(f.email); err != models.ErrorSecretDoesntExist {
+		t.Fatalf("Expected deleted account's secret not to exist, got %v", err)
+	}
+
+	latest, err := f.Readings.GetLatestReadings(f.email)
+	if err != nil {
+		t.Fatalf("Failed getting latest readings: %s", err)
+	}
+
+	if len(latest) != 0 {
+		t.Fatalf("Got readings of deleted account: %v", latest)
+	}
+
+	if _, err := f.Readings.UndoDeletion(f.email, deletion.ID); err != models.ErrorDeletionDoesntExist {
+		t.Fatalf("Expected deleted account's deletion not to exist, got %v", err)
+	}
+
+	// other accounts are kept
+	f.checkSecret(t, f.otherEmail, other)
+	if readings := f.getReadings(t, f.otherEmail, f.core, epoch, epoch); !sameReadings(readings, []models.Reading{otherReading}) {
+		t.Fatalf("Readings of another account were deleted; got %v expected %v", readings, otherReading)
+	}
+
+	// the user may sign up again
+	f.storeUsers(t, f.email)
+}
+
+func testDeleteMissingAccount(t *testing.T, f fixture) {
+	if err := f.Accounts.DeleteAccount(f.email); err != models.ErrorUserDoesntExist {
+		t.Fatalf("Expected error deleting account of missing user, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package storetest
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"testing"
+)
+
+func TestFakeStores(t *testing.T) {
+	Test(t, func() Stores {
+		readings, users, secrets := &fake.ReadingStore{}, fake.UserStore{}, fake.SecretStore{}
+		return Stores{
+			Readings: readings,
+			Users:    users,
+			Secrets:  secrets,
+			Accounts: fake.AccountStore{Users: users, Secrets: secrets, Readings: readings},
+		}
+	})
+}
@@ -0,0 +1,73 @@
+// Package validation checks incoming readings for implausible values before
+// they are stored, quarantining any that fail.
+package validation
+
+import (
+	"github.com/serdmanczyk/freyr/models"
+	"time"
+)
+
+// rateWindow is how far back to look for a core's previous reading when
+// checking rate of change.
+const rateWindow = time.Hour * 24
+
+// ReadingStore wraps a models.ReadingStore, validating readings against the
+// limits in a models.QuarantineStore before they are stored.  Readings that
+// fail validation are quarantined and models.ErrorReadingQuarantined is
+// returned.
+type ReadingStore struct {
+	models.ReadingStore
+	quarantine models.QuarantineStore
+}
+
+// NewReadingStore returns a new *ReadingStore
+func NewReadingStore(rs models.ReadingStore, qs models.QuarantineStore) *ReadingStore {
+	return &ReadingStore{ReadingStore: rs, quarantine: qs}
+}
+
+// StoreReading validates the reading, storing it if valid and quarantining it
+// otherwise.
+func (s *ReadingStore) StoreReading(reading models.Reading) error {
+	limits, err := s.quarantine.GetValidationLimits(reading.UserEmail, reading.CoreID)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.previousReading(reading)
+	if err != nil {
+		return err
+	}
+
+	reasons := models.DefaultValidationLimits.Merge(limits).Validate(reading, previous)
+	if len(reasons) == 0 {
+		return s.ReadingStore.StoreReading(reading)
+	}
+
+	if err := s.quarantine.QuarantineReading(reading, reasons); err != nil {
+		return err
+	}
+
+	return models.ErrorReadingQuarantined
+}
+
+// previousReading returns the core's most recent reading before the input
+// reading, or nil if there is none within the rate window.
+func (s *ReadingStore) previousReading(reading models.Reading) (*models.Reading, error) {
+	readings, err := s.ReadingStore.GetReadings(reading.UserEmail, reading.CoreID, reading.Posted.Add(-rateWindow), reading.Posted)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *models.Reading
+	for i, r := range readings {
+		if r.UserEmail != reading.UserEmail || !r.Posted.Before(reading.Posted) {
+			continue
+		}
+
+		if previous == nil || r.Posted.After(previous.Posted) {
+			previous = &readings[i]
+		}
+	}
+
+	return previous, nil
+}
@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"testing"
+	"time"
+)
+
+func TestStoreReading(t *testing.T) {
+	userEmail := "idunn@asgard.unv"
+	coreID := "5555555555"
+
+	rs := &fake.ReadingStore{}
+	qs := &fake.QuarantineStore{}
+	vs := NewReadingStore(rs, qs)
+
+	posted := time.Unix(1461300000, 0)
+	good := fake.RandReading(userEmail, coreID, posted)
+	if err := vs.StoreReading(good); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := fake.RandReading(userEmail, coreID, posted.Add(time.Minute))
+	bad.Temperature = 6553.5
+	if err := vs.StoreReading(bad); err != models.ErrorReadingQuarantined {
+		t.Fatalf("Expected reading to be quarantined, got %v", err)
+	}
+
+	stored, err := rs.GetReadings(userEmail, coreID, posted.Add(-time.Second), posted.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 1 || !stored[0].Compare(good) {
+		t.Fatalf("Only valid reading should be stored, got %v", stored)
+	}
+
+	quarantined, err := qs.GetQuarantined(userEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quarantined) != 1 || !quarantined[0].Reading.Compare(bad) {
+		t.Fatalf("Invalid reading should be quarantined, got %v", quarantined)
+	}
+
+	err = qs.StoreValidationLimits(userEmail, coreID, models.ValidationLimits{
+		"temperature": {Min: -40, Max: 10000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad.Posted = bad.Posted.Add(time.Minute)
+	if err := vs.StoreReading(bad); err != nil {
+		t.Fatalf("Reading within configured limits should be stored, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+// Package webhooks delivers events to the URLs users subscribe to them, and
+// to their rules' webhook actions, signing each delivery with the user's
+// secret and retrying failed deliveries with backoff.
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/serdmanczyk/bifrost"
+	"github.com/serdmanczyk/freyr/models"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrorForbiddenDestination is returned when a delivery would connect to a
+// loopback, private, link-local or otherwise non-public address.
+var ErrorForbiddenDestination = errors.New("webhook destination is not a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598, which
+// net.IP doesn't consider private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+const (
+	// attemptTimeout is how long subscribers have to respond to a delivery.
+	attemptTimeout = time.Second * 10
+	// claimLease is how long an attempt may take before the delivery may be
+	// claimed by another attempt.
+	claimLease = time.Minute
+)
+
+// JobQueuer queues functions to be run in the background, such as a
+// bifrost.JobDispatcher.
+type JobQueuer interface {
+	QueueFunc(j bifrost.JobRunnerFunc) bifrost.JobTracker
+}
+
+// Publisher records deliveries of events to users' subscriptions and
+// queues jobs attempting them.
+type Publisher struct {
+	store   models.WebhookStore
+	secrets models.SecretStore
+	jobs    JobQueuer
+	client  *http.Client
+}
+
+// NewPublisher returns a new *Publisher
+func NewPublisher(ws models.WebhookStore, ss models.SecretStore, jobs JobQueuer) *Publisher {
+	return &Publisher{
+		store:   ws,
+		secrets: ss,
+		jobs:    jobs,
+		client:  newClient(publicIP),
+	}
+}
+
+// publicIP returns whether the address is publicly routable, so may be
+// delivered to.
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// newClient returns a client that only connects to addresses allowed,
+// checked as each connection is dialed so names resolving to other
+// addresses are refused too, and that doesn't follow redirects.
+func newClient(allowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: attemptTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return ErrorForbiddenDestination
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout:   attemptTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: attemptTimeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Publish records a delivery of the event, concerning the core, to each of
+// the user's subscriptions wanting it and queues a job attempting each.
+func (p *Publisher) Publish(userEmail, event, core string, data interface{}, now time.Time) error {
+	subscriptions, err := p.store.GetEventSubscriptions(userEmail, event)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, s := range subscriptions {
+		if !s.Wants(event, core) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(models.WebhookPayload{Event: event, User: userEmail, CoreID: core, Created: now, Data: data})
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := p.record(pending(models.Delivery{SubscriptionID: s.ID}, userEmail, event, payload, now)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deliver records a delivery of the event, concerning the core, to the URL
+// rather than a subscription, as for rules' webhook actions, and queues a
+// job attempting it.  Like deliveries to subscriptions it is signed,
+// retried and logged.  The delivery's ID is returned.
+func (p *Publisher) Deliver(userEmail, url, event, core string, data interface{}, now time.Time) (int64, error) {
+	payload, err := json.Marshal(models.WebhookPayload{Event: event, User: userEmail, CoreID: core, Created: now, Data: data})
+	if err != nil {
+		return 0, err
+	}
+
+	return p.record(pending(models.Delivery{URL: url}, userEmail, event, payload, now))
+}
+
+// record stores the delivery and queues a job attempting it.
+func (p *Publisher) record(d models.Delivery) (int64, error) {
+	id, err := p.store.StoreDelivery(d)
+	if err != nil {
+		return 0, err
+	}
+
+	p.queue(id)
+	return id, nil
+}
+
+// pending completes the delivery of the payload, due now.
+func pending(d models.Delivery, userEmail, event string, payload []byte, now time.Time) models.Delivery {
+	d.UserEmail, d.Event, d.Payload = userEmail, event, payload
+	d.State, d.Created, d.NextAttempt = models.DeliveryPending, now, now
+	return d
+}
+
+// RetryDue queues jobs attempting the pending deliveries due a retry.  It
+// should be run periodically.
+func (p *Publisher) RetryDue(now time.Time) error {
+	due, err := p.store.GetDueDeliveries(now)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		p.queue(d.ID)
+	}
+
+	return nil
+}
+
+func (p *Publisher) queue(id int64) {
+	p.jobs.QueueFunc(func() error {
+		return p.Attempt(id, time.Now())
+	})
+}
+
+// Attempt posts the delivery to its subscription's URL, or its own URL if
+// it has no subscription, signed by the user's secret, and records the
+// outcome.  Deliveries that aren't due, or are being attempted elsewhere,
+// are skipped.  An error is returned if the attempt failed.
+func (p *Publisher) Attempt(id int64, now time.Time) error {
+	claimed, err := p.store.ClaimDelivery(id, now, now.Add(claimLease))
+	if err != nil || !claimed {
+		return err
+	}
+
+	d, err := p.store.GetDelivery(id)
+	if err != nil {
+		return err
+	}
+
+	url := d.URL
+	if d.SubscriptionID != 0 {
+		subscriptions, err := p.store.GetSubscriptions(d.UserEmail)
+		if err != nil {
+			return err
+		}
+
+		url = ""
+		for _, s := range subscriptions {
+			if s.ID == d.SubscriptionID {
+				url = s.URL
+			}
+		}
+
+		if url == "" {
+			return models.ErrorSubscriptionDoesntExist
+		}
+	}
+
+	statusCode, err := p.post(url, d)
+	d.Attempted(now, statusCode, err)
+	if err := p.store.UpdateDelivery(d); err != nil {
+		return err
+	}
+
+	if d.State != models.DeliveryDelivered {
+		return fmt.Errorf("delivery %d to %s failed: %s", d.ID, url, d.Error)
+	}
+
+	return nil
+}
+
+// post posts the delivery's payload to the URL, returning the response
+// status code.  Redirects aren't followed, so are reported as failures.
+func (p *Publisher) post(url string, d models.Delivery) (int, error) {
+	secret, err := p.secrets.GetSecret(d.UserEmail)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.WebhookEventHeader, d.Event)
+	req.Header.Set(models.WebhookDeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(models.WebhookSignatureHeader, secret.Sign(string(d.Payload)))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// DeviceStatusChanged publishes devices going offline, implementing the
+// devices.Notifier interface.
+func (p *Publisher) DeviceStatusChanged(device models.Device, previous string) error {
+	if device.Status != models.DeviceOffline {
+		return nil
+	}
+
+	return p.Publish(device.UserEmail, models.WebhookDeviceOffline, device.CoreID, device, device.StatusChanged)
+}
+
+// ReadingStore wraps a models.ReadingStore, publishing each new reading
+// stored.
+type ReadingStore struct {
+	models.ReadingStore
+	publisher *Publisher
+}
+
+// NewReadingStore returns a new *ReadingStore
+func NewReadingStore(rs models.ReadingStore, p *Publisher) *ReadingStore {
+	return &ReadingStore{ReadingStore: rs, publisher: p}
+}
+
+// StoreReading stores the reading then publishes it.  Failing to publish is
+// logged rather than failing to store the reading.
+func (s *ReadingStore) StoreReading(reading models.Reading) error {
+	if err := s.ReadingStore.StoreReading(reading); err != nil {
+		return err
+	}
+
+	err := s.publisher.Publish(reading.UserEmail, models.WebhookReading, reading.CoreID, reading, time.Now())
+	if err != nil {
+		log.Printf("Error publishing reading from core %s: %s", reading.CoreID, err)
+	}
+
+	return nil
+}
+
+// RuleStore wraps a models.RuleStore, publishing an alert whenever a rule
+// fires, or fails trying; dry runs aren't published.
+type RuleStore struct {
+	models.RuleStore
+	publisher *Publisher
+}
+
+// NewRuleStore returns a new *RuleStore
+func NewRuleStore(rs models.RuleStore, p *Publisher) *RuleStore {
+	return &RuleStore{RuleStore: rs, publisher: p}
+}
+
+// StoreExecution stores the execution then publishes it.  Failing to
+// publish is logged rather than failing to store the execution.
+func (s *RuleStore) StoreExecution(e models.Execution) error {
+	if err := s.RuleStore.StoreExecution(e); err != nil {
+		return err
+	}
+
+	if e.Result == models.ExecutionDryRun {
+		return nil
+	}
+
+	if err := s.publisher.Publish(e.UserEmail, models.WebhookAlert, e.CoreID, e, e.Triggered); err != nil {
+		log.Printf("Error publishing execution of rule %d: %s", e.RuleID, err)
+	}
+
+	return nil
+}
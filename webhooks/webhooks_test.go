@@ -0,0 +1,287 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"github.com/serdmanczyk/bifrost"
+	"github.com/serdmanczyk/freyr/fake"
+	"github.com/serdmanczyk/freyr/models"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const userEmail = "johndoe@stupidname.com"
+
+// syncQueuer runs queued jobs immediately, collecting their errors.
+type syncQueuer struct {
+	errs []error
+}
+
+func (q *syncQueuer) QueueFunc(j bifrost.JobRunnerFunc) bifrost.JobTracker {
+	q.errs = append(q.errs, j())
+	return nil
+}
+
+// receiver records the webhook requests posted to it, responding with its
+// status code.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func setup(t *testing.T, status int, events ...string) (*Publisher, *fake.WebhookStore, *syncQueuer, *receiver, models.Secret) {
+	secret, err := models.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := &receiver{status: status}
+	server := httptest.NewServer(rc)
+
+	ws := &fake.WebhookStore{}
+	_, err = ws.StoreSubscription(models.Subscription{UserEmail: userEmail, URL: server.URL, Events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test servers listen on loopback addresses
+	jobs := &syncQueuer{}
+	p := NewPublisher(ws, fake.SecretStore{userEmail: secret}, jobs)
+	p.client = newClient(func(net.IP) bool { return true })
+	return p, ws, jobs, rc, secret
+}
+
+func TestPublishSigned(t *testing.T) {
+	p, ws, jobs, rc, secret := setup(t, http.StatusOK, models.WebhookReading)
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	reading := fake.RandReading(userEmail, "core", now)
+
+	if err := p.Publish(userEmail, models.WebhookReading, "core", reading, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(userEmail, models.WebhookAlert, "core", reading, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.requests) != 1 || jobs.errs[0] != nil {
+		t.Fatalf("Expected one delivery, got %d (%v)", len(rc.requests), jobs.errs)
+	}
+
+	r, body := rc.requests[0], rc.bodies[0]
+	if r.Header.Get(models.WebhookEventHeader) != models.WebhookReading {
+		t.Fatalf("Expected event header %s, got %s", models.WebhookReading, r.Header.Get(models.WebhookEventHeader))
+	}
+
+	if !secret.Verify(string(body), r.Header.Get(models.WebhookSignatureHeader)) {
+		t.Fatal("Expected delivery signed by user's secret")
+	}
+
+	var payload struct {
+		models.WebhookPayload
+		Data models.Reading `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Event != models.WebhookReading || payload.CoreID != "core" || payload.Data.Temperature != reading.Temperature {
+		t.Fatalf("Unexpected payload %s", body)
+	}
+
+	subscriptions, _ := ws.GetSubscriptions(userEmail)
+	deliveries, _ := ws.GetDeliveries(userEmail, subscriptions[0].ID)
+	if len(deliveries) != 1 || deliveries[0].State != models.DeliveryDelivered || deliveries[0].StatusCode != http.StatusOK {
+		t.Fatalf("Expected delivery logged as delivered, got %v", deliveries)
+	}
+
+	if subscriptions[0].LastStatusCode != http.StatusOK {
+		t.Fatalf("Expected last status code %d, got %d", http.StatusOK, subscriptions[0].LastStatusCode)
+	}
+}
+
+func TestRetryDue(t *testing.T) {
+	p, ws, jobs, rc, _ := setup(t, http.StatusServiceUnavailable, models.WebhookAlert)
+
+	now := time.Now()
+	if err := p.Publish(userEmail, models.WebhookAlert, "core", models.Execution{}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs.errs) != 1 || jobs.errs[0] == nil {
+		t.Fatalf("Expected failed attempt, got %v", jobs.errs)
+	}
+
+	subscriptions, _ := ws.GetSubscriptions(userEmail)
+	deliveries, _ := ws.GetDeliveries(userEmail, subscriptions[0].ID)
+	if len(deliveries) != 1 || deliveries[0].State != models.DeliveryPending || deliveries[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected delivery pending a retry, got %v", deliveries)
+	}
+
+	if err := p.RetryDue(time.Now()); err != nil || len(rc.requests) != 1 {
+		t.Fatalf("Expected no retry before backoff, got %d requests (%v)", len(rc.requests), err)
+	}
+
+	rc.status = http.StatusAccepted
+	if err := p.RetryDue(deliveries[0].NextAttempt); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs attempt at the current time, so attempt directly once due.
+	if err := p.Attempt(deliveries[0].ID, deliveries[0].NextAttempt); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery, _ := ws.GetDelivery(deliveries[0].ID)
+	if delivery.State != models.DeliveryDelivered || delivery.Attempts != 2 || delivery.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected delivered on retry, got %v", delivery)
+	}
+
+	if err := p.Attempt(delivery.ID, delivery.NextAttempt.Add(time.Hour)); err != nil || len(rc.requests) != 2 {
+		t.Fatalf("Expected delivered delivery not reattempted, got %d requests (%v)", len(rc.requests), err)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	p, ws, jobs, _, secret := setup(t, http.StatusOK)
+
+	rc := &receiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	id, err := p.Deliver(userEmail, server.URL, models.WebhookAlert, "core", models.Execution{RuleID: 1}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.requests) != 1 || len(jobs.errs) != 1 || jobs.errs[0] == nil {
+		t.Fatalf("Expected one failed attempt, got %d requests (%v)", len(rc.requests), jobs.errs)
+	}
+
+	if !secret.Verify(string(rc.bodies[0]), rc.requests[0].Header.Get(models.WebhookSignatureHeader)) {
+		t.Fatal("Expected delivery signed by user's secret")
+	}
+
+	d, err := ws.GetDelivery(id)
+	if err != nil || d.URL != server.URL || d.State != models.DeliveryPending || d.Error != "responded with status 500" {
+		t.Fatalf("Expected delivery pending a retry, got %v (%v)", d, err)
+	}
+}
+
+func TestForbiddenDestinations(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "::1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "fe80::1", "100.64.0.1", "0.0.0.0"} {
+		if publicIP(net.ParseIP(address)) {
+			t.Errorf("Expected %s forbidden", address)
+		}
+	}
+
+	for _, address := range []string{"8.8.8.8", "2001:4860:4860::8888"} {
+		if !publicIP(net.ParseIP(address)) {
+			t.Errorf("Expected %s allowed", address)
+		}
+	}
+
+	rc := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	p, ws, _, _, _ := setup(t, http.StatusOK)
+	p.client = newClient(publicIP)
+
+	id, err := p.Deliver(userEmail, server.URL, models.WebhookAlert, "core", models.Execution{RuleID: 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := ws.GetDelivery(id)
+	if len(rc.requests) != 0 || d.State == models.DeliveryDelivered || !strings.Contains(d.Error, ErrorForbiddenDestination.Error()) {
+		t.Fatalf("Expected delivery to loopback refused, got %d requests (%v)", len(rc.requests), d)
+	}
+}
+
+func TestRedirectsNotFollowed(t *testing.T) {
+	p, ws, _, rc, _ := setup(t, http.StatusOK)
+
+	target := httptest.NewServer(rc)
+	defer target.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+
+	id, err := p.Deliver(userEmail, redirect.URL, models.WebhookAlert, "core", models.Execution{RuleID: 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := ws.GetDelivery(id)
+	if len(rc.requests) != 0 || d.StatusCode != http.StatusFound || d.State == models.DeliveryDelivered {
+		t.Fatalf("Expected redirect reported as failed, got %d requests (%v)", len(rc.requests), d)
+	}
+}
+
+func TestDeviceStatusChanged(t *testing.T) {
+	p, _, _, rc, _ := setup(t, http.StatusOK, models.WebhookDeviceOffline)
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	device := models.Device{UserEmail: userEmail, CoreID: "core", Status: models.DeviceOnline, StatusChanged: now}
+
+	if err := p.DeviceStatusChanged(device, models.DeviceOffline); err != nil || len(rc.requests) != 0 {
+		t.Fatalf("Expected device coming online not published, got %d requests (%v)", len(rc.requests), err)
+	}
+
+	device.Status = models.DeviceOffline
+	if err := p.DeviceStatusChanged(device, models.DeviceOnline); err != nil || len(rc.requests) != 1 {
+		t.Fatalf("Expected device going offline published, got %d requests (%v)", len(rc.requests), err)
+	}
+}
+
+func TestStoreWrappers(t *testing.T) {
+	p, _, _, rc, _ := setup(t, http.StatusOK, models.WebhookReading, models.WebhookAlert)
+
+	now := time.Date(2016, 5, 10, 8, 0, 0, 0, time.UTC)
+	rs := NewReadingStore(&fake.ReadingStore{}, p)
+	if err := rs.StoreReading(fake.RandReading(userEmail, "core", now)); err != nil {
+		t.Fatal(err)
+	}
+
+	es := NewRuleStore(&fake.RuleStore{}, p)
+	ruleID, err := es.StoreRule(models.Rule{UserEmail: userEmail, Name: "alert", CoreID: "core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range []string{models.ExecutionFired, models.ExecutionDryRun, models.ExecutionFailed} {
+		err := es.StoreExecution(models.Execution{RuleID: ruleID, UserEmail: userEmail, CoreID: "core", Triggered: now, Result: result})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []string
+	for _, r := range rc.requests {
+		events = append(events, r.Header.Get(models.WebhookEventHeader))
+	}
+
+	if len(events) != 3 || events[0] != models.WebhookReading || events[1] != models.WebhookAlert || events[2] != models.WebhookAlert {
+		t.Fatalf("Expected reading and two alerts published, got %v", events)
+	}
+}